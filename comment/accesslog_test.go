@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_service_accessLog(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		level      zapcore.Level
+		handler    http.HandlerFunc
+		wantLogged bool
+		wantStatus int64
+		wantBytes  int64
+	}{
+		{
+			name:  "it logs the status and size of the response",
+			level: zapcore.InfoLevel,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "created")
+			},
+			wantLogged: true,
+			wantStatus: http.StatusCreated,
+			wantBytes:  7,
+		},
+		{
+			name:       "it logs an ok status if the handler does not write one",
+			level:      zapcore.InfoLevel,
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantLogged: true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "it does not log if the level is disabled",
+			level: zapcore.DebugLevel,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "OK")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.InfoLevel)
+			svc := &service{logger: zap.New(core), cfg: config{AccessLogLevel: tt.level}}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/books/1234", nil)
+			w := httptest.NewRecorder()
+			svc.accessLog(tt.handler).ServeHTTP(w, r)
+
+			if !tt.wantLogged {
+				assert.Equal(t, 0, logs.Len())
+				return
+			}
+
+			assert.Equal(t, 1, logs.Len())
+			fields := logs.All()[0].ContextMap()
+			assert.Equal(t, http.MethodPost, fields["method"])
+			assert.Equal(t, "/v1/books/1234", fields["path"])
+			assert.Equal(t, "192.0.2.1", fields["client_ip"])
+			assert.Equal(t, tt.wantStatus, fields["status"])
+			assert.Equal(t, tt.wantBytes, fields["bytes"])
+			assert.Contains(t, fields, "duration")
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// checkAttachments returns the rules the attachments of a comment break: there may be at most
+// MAXATTACHMENTS of them, each an absolute http(s) url on one of the ATTACHMENTHOSTS
+func (svc *service) checkAttachments(attachments []string) validationError {
+	var v validationError
+	if max := svc.config().MaxAttachments; max > 0 && len(attachments) > max {
+		v = append(v, violation("attachments", errCommentAttachmentLimit.withArgs(max)))
+	}
+
+	for i, a := range attachments {
+		field := fmt.Sprintf("attachments.%d", i)
+		u, err := url.Parse(a)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v = append(v, violation(field, errCommentAttachmentInvalid.withArgs(a)))
+			continue
+		}
+
+		if !svc.allowedAttachmentHost(u.Hostname()) {
+			v = append(v, violation(field, errCommentAttachmentHost.withArgs(u.Hostname())))
+		}
+	}
+
+	return v
+}
+
+// allowedAttachmentHost reports whether the host is one of the configured attachment hosts,
+// ignoring case. Every host is allowed if none are configured.
+func (svc *service) allowedAttachmentHost(host string) bool {
+	hosts := svc.config().AttachmentHosts
+	if len(hosts) == 0 {
+		return true
+	}
+
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
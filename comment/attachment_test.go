@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_checkAttachments(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		hosts       []string
+		max         int
+		attachments []string
+		want        validationError
+	}{
+		{
+			name: "it passes a comment without attachments",
+			max:  1,
+		},
+		{
+			name:        "it passes http and https urls on any host if none are configured",
+			attachments: []string{"http://example.com/a.png", "https://cdn.example.org/b.pdf"},
+		},
+		{
+			name:        "it passes urls on the allowed hosts, ignoring case",
+			hosts:       []string{"cdn.example.com"},
+			attachments: []string{"https://CDN.example.com/a.png", "https://cdn.example.com:8443/b.png"},
+		},
+		{
+			name:        "it fails urls on other hosts",
+			hosts:       []string{"cdn.example.com"},
+			attachments: []string{"https://cdn.example.com/a.png", "https://evil.example.com/b.png"},
+			want: validationError{
+				violation("attachments.1", errCommentAttachmentHost.withArgs("evil.example.com")),
+			},
+		},
+		{
+			name:        "it fails urls that are not absolute http or https urls",
+			attachments: []string{"ftp://example.com/a.png", "/a.png", "javascript:alert(1)", "http://%zz"},
+			want: validationError{
+				violation("attachments.0", errCommentAttachmentInvalid.withArgs("ftp://example.com/a.png")),
+				violation("attachments.1", errCommentAttachmentInvalid.withArgs("/a.png")),
+				violation("attachments.2", errCommentAttachmentInvalid.withArgs("javascript:alert(1)")),
+				violation("attachments.3", errCommentAttachmentInvalid.withArgs("http://%zz")),
+			},
+		},
+		{
+			name:        "it fails more attachments than allowed",
+			max:         1,
+			attachments: []string{"https://example.com/a.png", "https://example.com/b.png"},
+			want: validationError{
+				violation("attachments", errCommentAttachmentLimit.withArgs(1)),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{cfg: config{AttachmentHosts: tt.hosts, MaxAttachments: tt.max}}
+			assert.Equal(t, tt.want, svc.checkAttachments(tt.attachments))
+		})
+	}
+}
+
+func Test_service_handleAdd_attachments(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cfg := testConfig()
+	cfg.AttachmentHosts = []string{"cdn.example.com"}
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments",
+		strings.NewReader(`{"value":"hello","attachments":["https://evil.example.com/a.png"]}`))
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, buildValidationResp(violation("attachments.0", errCommentAttachmentHost.withArgs("evil.example.com"))),
+		w.Body.String())
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments",
+		strings.NewReader(`{"value":"hello","attachments":["https://cdn.example.com/a.png"]}`))
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"attachments":["https://cdn.example.com/a.png"]`)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	auditActionDelete  = "delete"
+	auditActionRestore = "restore"
+	auditActionPin     = "pin"
+	auditActionUnpin   = "unpin"
+	auditActionUnhide  = "unhide"
+)
+
+// auditKey is the bucket of the audit trail. Buckets starting with an underscore are reserved
+// for the service and never taken for commentable types.
+var auditKey = []byte("_audit")
+
+// auditEntry records a change made to a comment, e.g. to investigate moderation disputes
+type auditEntry struct {
+	Action  string          `json:"action"`
+	Kind    string          `json:"commentable_type"`
+	Key     string          `json:"commentable_key"`
+	Actor   string          `json:"actor,omitempty"` // empty for anonymous callers
+	Admin   bool            `json:"admin,omitempty"`
+	IP      string          `json:"ip,omitempty"` // of the client the change was made from
+	At      time.Time       `json:"at"`
+	Comment json.RawMessage `json:"comment"` // as it was before the change, null once its author was erased
+}
+
+// audit records the entry in the audit trail. It is meant to be called in the transaction
+// making the change so that the trail can't diverge from the comments.
+func audit(tx *bolt.Tx, e auditEntry) error {
+	b, err := tx.CreateBucketIfNotExists(auditKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// keyed by sequence so that the trail is kept in the order of the changes
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return b.Put(key, data)
+}
+
+// redactAudit clears the author from the audit trail, e.g. when erasing their comments: the actor and ip
+// of the changes they made, and the comment of the changes made to their comments, which holds what they
+// wrote. The entries themselves are kept so that the trail still tells what was changed when.
+// It returns how many entries were redacted.
+func redactAudit(db *bolt.DB, author string) (int, error) {
+	var redacted int
+	err := db.Update(func(tx *bolt.Tx) error {
+		redacted = 0
+
+		b := tx.Bucket(auditKey)
+		if b == nil {
+			return nil
+		}
+
+		// the bucket can't be modified while iterating over it so the changes are collected first
+		updates := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var e auditEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			var c comment
+			if len(e.Comment) > 0 {
+				if err := json.Unmarshal(e.Comment, &c); err != nil {
+					return err
+				}
+			}
+
+			if e.Actor != author && c.Author != author {
+				return nil
+			}
+
+			if e.Actor == author {
+				e.Actor, e.IP = "", ""
+			}
+			if c.Author == author {
+				e.Comment = nil
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			updates[string(k)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for k, data := range updates {
+			if err = b.Put([]byte(k), data); err != nil {
+				return err
+			}
+		}
+
+		redacted = len(updates)
+		return nil
+	})
+
+	return redacted, err
+}
+
+// recentAudit returns up to limit of the most recent audit entries, the most recent first, all of them if limit is 0
+func recentAudit(db *bolt.DB, limit int) ([]auditEntry, error) {
+	entries := []auditEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditKey)
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && (limit == 0 || len(entries) < limit); k, v = c.Prev() {
+			var e auditEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			entries = append(entries, e)
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// handleAudit responds with the most recent entries of the audit trail,
+// as many as the limit query parameter asks for, see pageSize
+func (svc *service) handleAudit(w http.ResponseWriter, r *http.Request) {
+	limit, e := svc.pageSize(r, errAuditLimitInvalid)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	// every db keeps the trail of the types in it
+	entries := []auditEntry{}
+	for _, db := range svc.dbs() {
+		recent, err := recentAudit(db, limit)
+		if err != nil {
+			svc.fail(w, svc.logger, errAuditList, err, zap.Int("limit", limit))
+			return
+		}
+
+		entries = append(entries, recent...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.After(entries[j].At) })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	svc.respondWithList(w, "entries", entries)
+}
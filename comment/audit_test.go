@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_commentable_remove_audit(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+
+	var removed []*comment
+	for _, v := range []string{"first", "second", "third"} {
+		c, err := cm.add(&comment{Value: v})
+		assert.NoError(t, err)
+		assert.NoError(t, cm.remove(c.ID, caller{id: "jane", admin: true, ip: "203.0.113.7"}))
+		removed = append(removed, c)
+	}
+	assert.NoError(t, cm.remove("unknown", caller{id: "jane"}))
+
+	entries, err := recentAudit(db, 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	for i, e := range entries {
+		c := removed[len(removed)-1-i] // the most recent first
+		assert.Equal(t, auditActionDelete, e.Action)
+		assert.Equal(t, "books", e.Kind)
+		assert.Equal(t, "1", e.Key)
+		assert.Equal(t, "jane", e.Actor)
+		assert.True(t, e.Admin)
+		assert.Equal(t, "203.0.113.7", e.IP)
+		assert.False(t, e.At.IsZero())
+
+		var got comment
+		assert.NoError(t, json.Unmarshal(e.Comment, &got))
+		assert.Equal(t, c.ID, got.ID)
+		assert.Equal(t, c.Value, got.Value)
+	}
+
+	entries, err = recentAudit(db, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3, "removing a missing comment should not be audited")
+}
+
+func Test_recentAudit_empty(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	entries, err := recentAudit(db, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []auditEntry{}, entries)
+}
+
+func Test_verify_reserved(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{string(auditKey)}))
+	found, err := verify(db, string(auditKey))
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func Test_service_handleAudit(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+	for i := 0; i < 3; i++ {
+		c, err := cm.add(&comment{Value: "hello"})
+		assert.NoError(t, err)
+		assert.NoError(t, cm.remove(c.ID, caller{id: "jane"}))
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		authHeader  string
+		wantCode    int
+		wantBody    string
+		wantEntries int
+	}{
+		{
+			name:     "it does not respond with the audit trail if the caller is not an admin",
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errForbidden),
+		},
+		{
+			name:       "it responds with error if the limit is invalid",
+			query:      "?limit=none",
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusBadRequest,
+			wantBody:   buildErrResp(errAuditLimitInvalid.withArgs("none")),
+		},
+		{
+			name:        "it responds with the recent entries",
+			authHeader:  "Bearer secret",
+			wantCode:    http.StatusOK,
+			wantEntries: 3,
+		},
+		{
+			name:        "it responds with as many entries as the limit",
+			query:       "?limit=2",
+			authHeader:  "Bearer secret",
+			wantCode:    http.StatusOK,
+			wantEntries: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/admin/audit%s", tt.query), nil)
+			r.Header.Set("Authorization", tt.authHeader)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+				return
+			}
+
+			var data struct {
+				Entries []auditEntry `json:"entries"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+			assert.Len(t, data.Entries, tt.wantEntries)
+		})
+	}
+}
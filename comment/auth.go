@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// caller is the user a request is made on behalf of
+type caller struct {
+	id    string // the user id forwarded by the gateway, empty for anonymous requests
+	admin bool   // whether the request carries the admin token
+	ip    string // of the client, see clientIP
+}
+
+type callerCtxKey struct{}
+
+// auth identifies the caller of the request. The service expects to sit behind a gateway that
+// authenticates users and forwards their id in the X-User-ID header,
+// while admins are identified by the configured admin token sent as a bearer token.
+func (svc *service) auth(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		c := caller{id: r.Header.Get(userIDHeader), ip: clientIP(r, svc.cfg.TrustProxy)}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if svc.cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(svc.cfg.AdminToken)) == 1 {
+			c.admin = true
+		}
+
+		ctx := context.WithValue(r.Context(), callerCtxKey{}, c)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// adminOnly rejects requests that were not made by an admin
+func (svc *service) adminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !callerOf(r).admin {
+			svc.fail(w, svc.logger, errForbidden, nil, zap.String("path", r.URL.Path))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// callerOf returns the caller identified by auth, requests that weren't identified are anonymous
+func callerOf(r *http.Request) caller {
+	c, _ := r.Context().Value(callerCtxKey{}).(caller)
+	return c
+}
+
+// canModify reports whether the caller is allowed to change the comment, which only admins and its author are
+func (c caller) canModify(cmt *comment) bool {
+	return c.admin || (c.id != "" && c.id == cmt.Author)
+}
+
+// canSee reports whether the caller is allowed to see the comment.
+// Private comments are only visible to their author and to admins, hidden ones only to admins.
+func (c caller) canSee(cmt *comment) bool {
+	if c.admin {
+		return true
+	}
+
+	if cmt.Hidden {
+		return false
+	}
+
+	if cmt.Visibility != visibilityPrivate {
+		return true
+	}
+
+	return c.id != "" && c.id == cmt.Author
+}
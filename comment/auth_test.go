@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_auth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		adminToken string
+		userID     string
+		authHeader string
+		want       caller
+	}{
+		{
+			name: "it identifies anonymous requests",
+		},
+		{
+			name:   "it identifies the user from the X-User-ID header",
+			userID: "jane",
+			want:   caller{id: "jane"},
+		},
+		{
+			name:       "it identifies admins from the admin token",
+			adminToken: "secret",
+			authHeader: "Bearer secret",
+			want:       caller{admin: true},
+		},
+		{
+			name:       "it does not identify admins with the wrong token",
+			adminToken: "secret",
+			userID:     "jane",
+			authHeader: "Bearer not-the-secret",
+			want:       caller{id: "jane"},
+		},
+		{
+			name:       "it does not identify admins if no admin token is configured",
+			authHeader: "Bearer ",
+			want:       caller{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{cfg: config{AdminToken: tt.adminToken}}
+
+			var got caller
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				got = callerOf(r)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(userIDHeader, tt.userID)
+			r.Header.Set("Authorization", tt.authHeader)
+			w := httptest.NewRecorder()
+
+			svc.auth(http.HandlerFunc(fn)).ServeHTTP(w, r)
+			tt.want.ip = "192.0.2.1" // the remote address of test requests
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_service_adminOnly(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantBody   string
+		pass       bool
+	}{
+		{
+			name:     "it rejects anonymous requests",
+			wantBody: buildErrResp(errForbidden),
+		},
+		{
+			name:       "it rejects requests with the wrong token",
+			authHeader: "Bearer not-the-secret",
+			wantBody:   buildErrResp(errForbidden),
+		},
+		{
+			name:       "it passes on requests of admins",
+			authHeader: "Bearer secret",
+			pass:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{AdminToken: "secret"}}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			r := httptest.NewRequest(http.MethodDelete, "/", nil)
+			r.Header.Set("Authorization", tt.authHeader)
+			w := httptest.NewRecorder()
+
+			svc.auth(svc.adminOnly(http.HandlerFunc(fn))).ServeHTTP(w, r)
+			assert.Equal(t, tt.pass, passed)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_caller_canSee(t *testing.T) {
+	t.Parallel()
+
+	private := &comment{Author: "jane", Visibility: visibilityPrivate}
+	tests := []struct {
+		name   string
+		caller caller
+		cmt    *comment
+		want   bool
+	}{
+		{
+			name:   "anyone can see public comments",
+			caller: caller{},
+			cmt:    &comment{Author: "jane", Visibility: visibilityPublic},
+			want:   true,
+		},
+		{
+			name:   "anyone can see comments without a visibility",
+			caller: caller{},
+			cmt:    &comment{Author: "jane"},
+			want:   true,
+		},
+		{
+			name:   "the author can see their private comments",
+			caller: caller{id: "jane"},
+			cmt:    private,
+			want:   true,
+		},
+		{
+			name:   "admins can see private comments",
+			caller: caller{admin: true},
+			cmt:    private,
+			want:   true,
+		},
+		{
+			name:   "other users can't see private comments",
+			caller: caller{id: "john"},
+			cmt:    private,
+		},
+		{
+			name:   "anonymous users can't see private comments",
+			caller: caller{},
+			cmt:    private,
+		},
+		{
+			name:   "anonymous users can't see anonymous private comments",
+			caller: caller{},
+			cmt:    &comment{Visibility: visibilityPrivate},
+		},
+		{
+			name:   "the author can't see their hidden comments",
+			caller: caller{id: "jane"},
+			cmt:    &comment{Author: "jane", Hidden: true},
+		},
+		{
+			name:   "anonymous users can't see hidden comments",
+			caller: caller{},
+			cmt:    &comment{Hidden: true},
+		},
+		{
+			name:   "admins can see hidden comments",
+			caller: caller{admin: true},
+			cmt:    &comment{Author: "jane", Visibility: visibilityPrivate, Hidden: true},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.caller.canSee(tt.cmt))
+		})
+	}
+}
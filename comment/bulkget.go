@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// bulkGetPath is the route getting several comments of a resource at once
+const bulkGetPath = "/comments/get"
+
+// isBulkGet reports whether a request of the method to the path gets comments in bulk, which is a read even
+// though it is a POST. The method is passed on its own as it is the requested one for CORS preflights.
+func isBulkGet(method, path string) bool {
+	return method == http.MethodPost && strings.HasSuffix(path, bulkGetPath)
+}
+
+// getMany returns the comments of the given keys in the order of the keys, in a single read.
+// Keys of missing or expired comments are skipped, and so are repeated ones.
+func (cm *commentable) getMany(cKeys []string) ([]*comment, error) {
+	cmts := []*comment{}
+	err := cm.db.View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return nil
+		}
+
+		now := time.Now()
+		seen := make(map[string]bool, len(cKeys))
+		for _, cKey := range cKeys {
+			data := comments.Get([]byte(cKey))
+			if data == nil || seen[cKey] {
+				continue
+			}
+			seen[cKey] = true
+
+			c := &comment{}
+			if err := json.Unmarshal(data, c); err != nil {
+				return err
+			}
+
+			// expired comments are gone even before they are swept
+			if !c.expired(now) {
+				cmts = append(cmts, c)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cmts, nil
+}
+
+// handleBulkGet responds with the comments of the ids in the body, e.g. {"ids":["a","b"]}, in the order
+// of the ids, for clients refreshing several comments at once. Comments that are missing, private
+// to others or hidden are left out rather than failing the request, so that the found ones can still be refreshed.
+func (svc *service) handleBulkGet(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.IDs == nil {
+		svc.fail(w, svc.logger, errCommentBulkInvalid, err)
+		return
+	}
+
+	l := svc.logger.With(zap.String(commentableKeyParam, c.key), zap.String(commentableTypeParam, c.kind))
+	if max := svc.config().MaxBulkGetIDs; max > 0 && len(req.IDs) > max {
+		svc.fail(w, l, errCommentBulkLimit.withArgs(max), nil, zap.Int("ids", len(req.IDs)))
+		return
+	}
+
+	cmts, err := c.getMany(req.IDs)
+	if err != nil {
+		svc.fail(w, l, errCommentList, err)
+		return
+	}
+
+	svc.respondWithList(w, "comments", newCommentResponses(filter(cmts, callerOf(r).canSee), callerOf(r)))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_commentable_getMany(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+
+	_, err := cm.getMany([]string{"a"})
+	assert.NoError(t, err, "a resource without comments should have none of them")
+
+	past := time.Now().Add(-time.Minute)
+	first, err := cm.add(&comment{Value: "first"})
+	assert.NoError(t, err)
+	second, err := cm.add(&comment{Value: "second"})
+	assert.NoError(t, err)
+	expired, err := cm.add(&comment{Value: "gone", ExpiresAt: &past})
+	assert.NoError(t, err)
+
+	got, err := cm.getMany([]string{second.ID, "unknown", first.ID, expired.ID, second.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, second.ID, got[0].ID, "the comments should be in the order of the ids")
+		assert.Equal(t, first.ID, got[1].ID)
+	}
+
+	_, err = (&commentable{db: db, kind: "posts", key: "unknown"}).getMany([]string{first.ID})
+	assert.EqualError(t, err, "posts not found with key unknown")
+}
+
+func Test_service_handleBulkGet(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	public, err := cm.add(&comment{Value: "public"})
+	assert.NoError(t, err)
+	private, err := cm.add(&comment{Value: "private", Author: "jane", Visibility: visibilityPrivate})
+	assert.NoError(t, err)
+	hidden, err := cm.add(&comment{Value: "spam", Author: "jane", Hidden: true})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		payload  string
+		user     string
+		admin    bool
+		readOnly bool
+		wantCode int
+		wantBody string
+		wantIDs  []string
+	}{
+		{
+			name:     "it responds with error if the ids are missing",
+			payload:  `{}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentBulkInvalid),
+		},
+		{
+			name:     "it responds with error if there are too many ids",
+			payload:  `{"ids":["a","b","c"]}`,
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentBulkLimit.withArgs(2)),
+		},
+		{
+			name:     "it leaves out missing comments and those private to others",
+			payload:  `{"ids":["` + private.ID + `","unknown"]}`,
+			wantCode: http.StatusOK,
+			wantIDs:  []string{},
+		},
+		{
+			name:     "it responds with the comments the caller can see",
+			payload:  `{"ids":["` + private.ID + `","` + public.ID + `"]}`,
+			user:     "jane",
+			wantCode: http.StatusOK,
+			wantIDs:  []string{private.ID, public.ID},
+		},
+		{
+			name:     "it leaves out hidden comments, even to their author",
+			payload:  `{"ids":["` + hidden.ID + `","` + public.ID + `"]}`,
+			user:     "jane",
+			wantCode: http.StatusOK,
+			wantIDs:  []string{public.ID},
+		},
+		{
+			name:     "it responds with hidden comments to admins",
+			payload:  `{"ids":["` + hidden.ID + `","` + public.ID + `"]}`,
+			admin:    true,
+			wantCode: http.StatusOK,
+			wantIDs:  []string{hidden.ID, public.ID},
+		},
+		{
+			name:     "it gets comments even if read-only",
+			payload:  `{"ids":["` + public.ID + `"]}`,
+			readOnly: true,
+			wantCode: http.StatusOK,
+			wantIDs:  []string{public.ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MaxBulkGetIDs = 2
+			cfg.ReadOnly = tt.readOnly
+			cfg.AdminToken = "secret"
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments/get", strings.NewReader(tt.payload))
+			r.Header.Set(userIDHeader, tt.user)
+			if tt.admin {
+				r.Header.Set("Authorization", "Bearer secret")
+			}
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+
+			if tt.wantIDs != nil {
+				var resp struct {
+					Comments []comment `json:"comments"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+				ids := []string{}
+				for _, c := range resp.Comments {
+					ids = append(ids, c.ID)
+				}
+				assert.Equal(t, tt.wantIDs, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commentCache is an LRU cache of the comments of commentables, holding both single comments
+// keyed by their id and the lists of all comments of commentables.
+// A nil *commentCache is a disabled cache which never hits.
+type commentCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	recency *list.List // most recently used at the front
+
+	// gen is bumped on every invalidation so that comments read from the db before
+	// a write are not cached after the write invalidated them
+	gen uint64
+
+	hits, misses uint64
+}
+
+type commentCacheEntry struct {
+	key  string
+	cmt  *comment   // set for single comments
+	cmts []*comment // set for lists
+}
+
+// newCommentCache returns a cache holding up to size comments and lists, or nil if size is not positive
+func newCommentCache(size int) *commentCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &commentCache{size: size, entries: map[string]*list.Element{}, recency: list.New()}
+}
+
+// the parts are joined by a control character, which keys and ids can't contain
+func commentListCacheKey(kind, key string) string {
+	return kind + "\x00" + key + "\x00"
+}
+
+func commentCacheKey(kind, key, id string) string {
+	return commentListCacheKey(kind, key) + id
+}
+
+// lookupComment returns a copy of the cached comment. On a miss it returns the generation
+// to store the comment read from the db with.
+func (c *commentCache) lookupComment(kind, key, id string) (*comment, uint64, bool) {
+	e, gen, ok := c.lookup(commentCacheKey(kind, key, id))
+	if !ok {
+		return nil, gen, false
+	}
+
+	return e.cmt.clone(), gen, true
+}
+
+// lookupList returns copies of the cached comments of the commentable, see lookupComment
+func (c *commentCache) lookupList(kind, key string) ([]*comment, uint64, bool) {
+	e, gen, ok := c.lookup(commentListCacheKey(kind, key))
+	if !ok {
+		return nil, gen, false
+	}
+
+	return cloneAll(e.cmts), gen, true
+}
+
+func (c *commentCache) lookup(k string) (commentCacheEntry, uint64, bool) {
+	if c == nil {
+		return commentCacheEntry{}, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[k]
+	if !ok {
+		c.misses++
+		return commentCacheEntry{}, c.gen, false
+	}
+
+	c.hits++
+	c.recency.MoveToFront(el)
+	return *el.Value.(*commentCacheEntry), c.gen, true
+}
+
+// storeComment caches a copy of the comment unless the cache was invalidated since gen
+func (c *commentCache) storeComment(kind, key string, cmt *comment, gen uint64) {
+	c.store(commentCacheEntry{key: commentCacheKey(kind, key, cmt.ID), cmt: cmt.clone()}, gen)
+}
+
+// storeList caches copies of all comments of the commentable unless the cache was invalidated since gen
+func (c *commentCache) storeList(kind, key string, cmts []*comment, gen uint64) {
+	c.store(commentCacheEntry{key: commentListCacheKey(kind, key), cmts: cloneAll(cmts)}, gen)
+}
+
+func (c *commentCache) store(e commentCacheEntry, gen uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	if el, ok := c.entries[e.key]; ok {
+		*el.Value.(*commentCacheEntry) = e
+		c.recency.MoveToFront(el)
+		return
+	}
+
+	c.entries[e.key] = c.recency.PushFront(&e)
+	if c.recency.Len() > c.size {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*commentCacheEntry).key)
+	}
+}
+
+// invalidate drops the cached list of the commentable along with the cached comment with the id,
+// or with all its cached comments if the id is empty. It is to be called whenever they are written.
+func (c *commentCache) invalidate(kind, key, id string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	prefix := commentListCacheKey(kind, key)
+	for k, el := range c.entries {
+		if k == prefix || k == prefix+id || (id == "" && strings.HasPrefix(k, prefix)) {
+			c.recency.Remove(el)
+			delete(c.entries, k)
+		}
+	}
+}
+
+// clear drops all cached comments, to be called when comments are written in bulk
+func (c *commentCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = map[string]*list.Element{}
+	c.recency.Init()
+}
+
+type cacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Size    int    `json:"size"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+func (c *commentCache) stats() cacheStats {
+	if c == nil {
+		return cacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return cacheStats{Enabled: true, Size: c.recency.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// getComment reads the comment of the commentable through the cache
+func (svc *service) getComment(cm *commentable, id string) (*comment, error) {
+	cmt, gen, ok := svc.cache.lookupComment(cm.kind, cm.key, id)
+	if ok {
+		// expired comments are gone even before they are swept
+		if cmt.expired(time.Now()) {
+			return nil, cm.commentNotFound(id)
+		}
+
+		return cmt, nil
+	}
+
+	cmt, err := cm.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.cache.storeComment(cm.kind, cm.key, cmt, gen)
+	return cmt, nil
+}
+
+// listAllComments reads all comments of the commentable through the cache
+func (svc *service) listAllComments(cm *commentable) ([]*comment, error) {
+	cmts, gen, ok := svc.cache.lookupList(cm.kind, cm.key)
+	if ok {
+		now := time.Now()
+		return filter(cmts, func(cmt *comment) bool { return !cmt.expired(now) }), nil
+	}
+
+	cmts, err := cm.list()
+	if err != nil {
+		return nil, err
+	}
+
+	svc.cache.storeList(cm.kind, cm.key, cmts, gen)
+	return cmts, nil
+}
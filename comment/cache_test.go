@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_newCommentCache(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newCommentCache(0))
+	assert.Nil(t, newCommentCache(-1))
+	assert.NotNil(t, newCommentCache(1))
+}
+
+func Test_commentCache(t *testing.T) {
+	t.Parallel()
+
+	c := newCommentCache(2)
+	_, gen, ok := c.lookupComment("posts", "1", "a")
+	assert.False(t, ok)
+
+	c.storeComment("posts", "1", &comment{ID: "a", Value: "first"}, gen)
+	cmt, _, ok := c.lookupComment("posts", "1", "a")
+	assert.True(t, ok)
+	assert.Equal(t, &comment{ID: "a", Value: "first"}, cmt)
+
+	// changing a looked up comment does not change the cached one
+	cmt.Value = "changed"
+	cmt, _, _ = c.lookupComment("posts", "1", "a")
+	assert.Equal(t, "first", cmt.Value)
+
+	// posts/1/a was used last so the list of posts/1 is evicted for posts/2/b
+	_, gen, _ = c.lookupList("posts", "1")
+	c.storeList("posts", "1", []*comment{{ID: "a", Value: "first"}}, gen)
+	c.lookupComment("posts", "1", "a")
+	_, gen, _ = c.lookupComment("posts", "2", "b")
+	c.storeComment("posts", "2", &comment{ID: "b"}, gen)
+
+	_, _, ok = c.lookupList("posts", "1")
+	assert.False(t, ok)
+	_, _, ok = c.lookupComment("posts", "1", "a")
+	assert.True(t, ok)
+
+	c.invalidate("posts", "1", "a")
+	_, _, ok = c.lookupComment("posts", "1", "a")
+	assert.False(t, ok)
+	_, _, ok = c.lookupComment("posts", "2", "b")
+	assert.True(t, ok, "comments of other commentables should stay cached")
+
+	assert.Equal(t, cacheStats{Enabled: true, Size: 1, Hits: 5, Misses: 5}, c.stats())
+}
+
+func Test_commentCache_invalidate(t *testing.T) {
+	t.Parallel()
+
+	c := newCommentCache(10)
+	_, gen, _ := c.lookupList("posts", "1")
+	c.storeList("posts", "1", []*comment{{ID: "a"}, {ID: "b"}}, gen)
+	c.storeComment("posts", "1", &comment{ID: "a"}, gen)
+	c.storeComment("posts", "1", &comment{ID: "b"}, gen)
+	c.storeComment("posts", "10", &comment{ID: "a"}, gen)
+
+	c.invalidate("posts", "1", "a")
+	_, _, ok := c.lookupList("posts", "1")
+	assert.False(t, ok, "the list should be invalidated along with the comment")
+	_, _, ok = c.lookupComment("posts", "1", "b")
+	assert.True(t, ok)
+
+	c.invalidate("posts", "1", "")
+	_, _, ok = c.lookupComment("posts", "1", "b")
+	assert.False(t, ok, "all comments of the commentable should be invalidated")
+	_, _, ok = c.lookupComment("posts", "10", "a")
+	assert.True(t, ok, "comments of commentables sharing the key prefix should stay cached")
+}
+
+func Test_commentCache_staleStore(t *testing.T) {
+	t.Parallel()
+
+	c := newCommentCache(1)
+	_, gen, _ := c.lookupList("posts", "1")
+	c.invalidate("posts", "1", "")
+	c.storeList("posts", "1", []*comment{{ID: "a"}}, gen)
+
+	_, _, ok := c.lookupList("posts", "1")
+	assert.False(t, ok, "comments read before an invalidation should not be cached")
+}
+
+func Test_commentCache_clear(t *testing.T) {
+	t.Parallel()
+
+	c := newCommentCache(2)
+	_, gen, _ := c.lookupComment("posts", "1", "a")
+	c.storeComment("posts", "1", &comment{ID: "a"}, gen)
+	c.storeList("posts", "1", []*comment{{ID: "a"}}, gen)
+
+	_, stale, _ := c.lookupComment("posts", "1", "b")
+	c.clear()
+	c.storeComment("posts", "1", &comment{ID: "b"}, stale)
+
+	for _, id := range []string{"a", "b"} {
+		_, _, ok := c.lookupComment("posts", "1", id)
+		assert.False(t, ok, "posts/1/%s should not be cached after clearing", id)
+	}
+	_, _, ok := c.lookupList("posts", "1")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.stats().Size)
+}
+
+func Test_commentCache_disabled(t *testing.T) {
+	t.Parallel()
+
+	var c *commentCache
+	c.storeComment("posts", "1", &comment{ID: "a"}, 0)
+	c.storeList("posts", "1", []*comment{{ID: "a"}}, 0)
+	c.invalidate("posts", "1", "a")
+	c.clear()
+
+	_, _, ok := c.lookupComment("posts", "1", "a")
+	assert.False(t, ok)
+	_, _, ok = c.lookupList("posts", "1")
+	assert.False(t, ok)
+	assert.Equal(t, cacheStats{}, c.stats())
+}
+
+func Test_service_getComment_expired(t *testing.T) {
+	t.Parallel()
+
+	svc := &service{cache: newCommentCache(10)}
+	cm := &commentable{kind: "posts", key: "1"}
+	past := time.Now().Add(-time.Minute)
+	expired := &comment{ID: "a", ExpiresAt: &past}
+
+	_, gen, _ := svc.cache.lookupComment(cm.kind, cm.key, expired.ID)
+	svc.cache.storeComment(cm.kind, cm.key, expired, gen)
+	svc.cache.storeList(cm.kind, cm.key, []*comment{expired}, gen)
+
+	_, err := svc.getComment(cm, expired.ID)
+	assert.Error(t, err, "a cached comment should expire like a stored one")
+
+	cmts, err := svc.listAllComments(cm)
+	assert.NoError(t, err)
+	assert.Empty(t, cmts)
+}
+
+func Test_service_cached(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	cfg := testConfig()
+	cfg.CacheSize = 10
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	assert.NoError(t, svc.setup([]string{"posts"}))
+	svc.registerRoutes(mux)
+
+	serve := func(method, path, payload string, wantCode int) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(payload)))
+		assert.Equal(t, wantCode, w.Code)
+		return w.Body.String()
+	}
+
+	list := "/v1/posts/my-key/comments"
+	var added comment
+	err := json.Unmarshal([]byte(serve(http.MethodPost, list, `{"value":"first"}`, http.StatusOK)), &added)
+	assert.NoError(t, err)
+	path := fmt.Sprintf("%s/%s", list, added.ID)
+
+	assert.Equal(t, serve(http.MethodGet, list, "", http.StatusOK), serve(http.MethodGet, list, "", http.StatusOK))
+	assert.Equal(t, serve(http.MethodGet, path, "", http.StatusOK), serve(http.MethodGet, path, "", http.StatusOK))
+	assert.Equal(t, cacheStats{Enabled: true, Size: 2, Hits: 2, Misses: 2}, svc.cache.stats())
+
+	// the comments are read from the db again after they changed
+	serve(http.MethodPost, list, `{"value":"second"}`, http.StatusOK)
+	assert.Contains(t, serve(http.MethodGet, list, "", http.StatusOK), "second")
+
+	serve(http.MethodPatch, path, `{"value":"edited","version":1}`, http.StatusOK)
+	assert.Contains(t, serve(http.MethodGet, path, "", http.StatusOK), "edited")
+
+	serve(http.MethodDelete, path, "", http.StatusOK)
+	serve(http.MethodGet, path, "", http.StatusNotFound)
+	assert.NotContains(t, serve(http.MethodGet, list, "", http.StatusOK), "edited")
+}
+
+func Test_service_handleMetrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cacheSize int
+		want      string
+	}{
+		{
+			name: "it reports the cache as disabled",
+			want: `{"cache":{"enabled":false,"size":0,"hits":0,"misses":0}}`,
+		},
+		{
+			name:      "it reports the cache counters",
+			cacheSize: 10,
+			want:      `{"cache":{"enabled":true,"size":0,"hits":0,"misses":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CacheSize = tt.cacheSize
+
+			mux := chi.NewRouter()
+			svc := newService(nil, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_clientIP(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		forwarded  []string // X-Forwarded-For lines, in the order they were sent
+		trustProxy bool
+		want       string
+	}{
+		{
+			name:       "it returns the host of the remote address",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "it returns the remote address as is if it has no port",
+			remoteAddr: "10.0.0.1",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "it ignores the proxy headers unless the proxy is trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "it returns the forwarded ip if the proxy is trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			trustProxy: true,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "it returns the last hop of a chain appended by the proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 198.51.100.2,203.0.113.7"},
+			trustProxy: true,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "it ignores the addresses spoofed by the client before the proxy's",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "127.0.0.1, 203.0.113.7"},
+			trustProxy: true,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "it returns the last hop of the last line if the header was sent more than once",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"127.0.0.1", "198.51.100.1, 203.0.113.7"},
+			trustProxy: true,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "it ignores the lines spoofed by the client before the proxy's",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1, 127.0.0.1", "203.0.113.7"},
+			trustProxy: true,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "it normalizes ipv6 addresses",
+			remoteAddr: "[::1]:1234",
+			headers:    map[string]string{"X-Forwarded-For": "2001:DB8::1"},
+			trustProxy: true,
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "it falls back to X-Real-IP if the last hop is not an ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, unknown", "X-Real-IP": "203.0.113.8"},
+			trustProxy: true,
+			want:       "203.0.113.8",
+		},
+		{
+			name:       "it falls back to the remote address if no header holds an ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "evil", "X-Real-IP": "evil"},
+			trustProxy: true,
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			assert.Equal(t, tt.want, clientIP(r, tt.trustProxy))
+		})
+	}
+}
@@ -1,6 +1,196 @@
 package main
 
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	visibilityPublic  = "public"
+	visibilityPrivate = "private" // only visible to the author and admins
+)
+
 type comment struct {
-	ID    string `json:"id"`
-	Value string `json:"value"`
+	ID          string     `json:"id"`
+	Value       string     `json:"value"`
+	Author      string     `json:"author,omitempty"`
+	Category    string     `json:"category,omitempty"` // e.g. question, review, spoiler
+	Tags        []string   `json:"tags,omitempty"`
+	Mentions    []string   `json:"mentions,omitempty"`
+	Attachments []string   `json:"attachments,omitempty"` // urls
+	Visibility  string     `json:"visibility,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	EditedBy    string     `json:"edited_by,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Pinned      bool       `json:"pinned,omitempty"`
+	PinnedAt    *time.Time `json:"pinned_at,omitempty"`
+	SpamScore   float64    `json:"spam_score,omitempty"`
+	Hidden      bool       `json:"hidden,omitempty"`
+	Version     int        `json:"version"`              // incremented on every save
+	DedupeKey   string     `json:"dedupe_key,omitempty"` // set by the client on add, see addOnce
+}
+
+// commentResponse is a comment as sent in responses, along with counts computed from its value
+// when it is sent rather than stored, so that they follow changes to how they are counted
+type commentResponse struct {
+	*comment
+	Pinned    bool    `json:"pinned"`               // sent even if false, unlike the stored one it shadows
+	SpamScore float64 `json:"spam_score,omitempty"` // only sent to admins, so that spammers can't tune against it
+	Hidden    bool    `json:"hidden,omitempty"`     // only sent to admins, like the score it follows from
+	DedupeKey string  `json:"dedupe_key,omitempty"` // only sent to the author and admins, so others can't replay it
+	Length    int     `json:"length"`               // in characters, i.e. runes rather than bytes
+	Words     int     `json:"words"`
+}
+
+// newCommentResponse returns the comment as sent in responses to the caller
+func newCommentResponse(c *comment, cl caller) commentResponse {
+	resp := commentResponse{
+		comment: c,
+		Pinned:  c.Pinned,
+		Length:  utf8.RuneCountInString(c.Value),
+		Words:   countWords(c.Value),
+	}
+	if cl.admin {
+		resp.SpamScore = c.SpamScore
+		resp.Hidden = c.Hidden
+	}
+	if cl.canModify(c) {
+		resp.DedupeKey = c.DedupeKey
+	}
+
+	return resp
+}
+
+func newCommentResponses(cmts []*comment, cl caller) []commentResponse {
+	responses := make([]commentResponse, len(cmts))
+	for i, c := range cmts {
+		responses[i] = newCommentResponse(c, cl)
+	}
+
+	return responses
+}
+
+// countWords counts the words of the value, which are separated by any unicode whitespace
+func countWords(value string) int {
+	return len(strings.Fields(value))
+}
+
+// expired reports whether the comment has expired by the given time
+func (c *comment) expired(now time.Time) bool {
+	return c.ExpiresAt != nil && !c.ExpiresAt.After(now)
+}
+
+// lastModified returns when the comment was last saved, nil for comments saved before it was recorded
+func (c *comment) lastModified() *time.Time {
+	if c.UpdatedAt != nil {
+		return c.UpdatedAt
+	}
+
+	return c.CreatedAt
+}
+
+// etag returns a strong etag of the comment, derived from its json so that it changes on every save
+func (c *comment) etag() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%x"`, sum[:16]), nil
+}
+
+// clone returns a copy of the comment that can be changed without changing the comment
+func (c *comment) clone() *comment {
+	cc := *c
+	if c.Tags != nil {
+		cc.Tags = append([]string{}, c.Tags...)
+	}
+	if c.Mentions != nil {
+		cc.Mentions = append([]string{}, c.Mentions...)
+	}
+	if c.Attachments != nil {
+		cc.Attachments = append([]string{}, c.Attachments...)
+	}
+
+	return &cc
+}
+
+// cloneAll returns copies of the comments, see clone
+func cloneAll(cmts []*comment) []*comment {
+	clones := make([]*comment, len(cmts))
+	for i, c := range cmts {
+		clones[i] = c.clone()
+	}
+
+	return clones
+}
+
+// filter returns the comments for which keep returns true
+func filter(cmts []*comment, keep func(*comment) bool) []*comment {
+	kept := []*comment{}
+	for _, c := range cmts {
+		if keep(c) {
+			kept = append(kept, c)
+		}
+	}
+
+	return kept
+}
+
+// normalizeTags lowercases the tags and drops empty and duplicate ones
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+
+	return normalized
+}
+
+// mentionPattern matches @username, where usernames are letters, digits and underscores.
+// The @ must not follow a word character so that e.g. email addresses aren't taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// mentions returns the usernames mentioned in the value, each once in the order they are first mentioned
+func mentions(value string) []string {
+	var found []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(value, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			found = append(found, m[1])
+		}
+	}
+
+	return found
+}
+
+// hasTag reports whether the comment is tagged with the given normalized tag
+func (c *comment) hasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_filter(t *testing.T) {
+	t.Parallel()
+
+	one := &comment{ID: "1", Category: "question"}
+	two := &comment{ID: "2", Category: "review"}
+	three := &comment{ID: "3", Category: "question"}
+
+	tests := []struct {
+		name string
+		keep func(*comment) bool
+		want []*comment
+	}{
+		{
+			name: "it returns the comments that are kept in order",
+			keep: func(c *comment) bool { return c.Category == "question" },
+			want: []*comment{one, three},
+		},
+		{
+			name: "it returns empty if no comment is kept",
+			keep: func(c *comment) bool { return false },
+			want: []*comment{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, filter([]*comment{one, two, three}, tt.keep))
+		})
+	}
+}
+
+func Test_normalizeTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{
+			name: "it lowercases the tags",
+			tags: []string{"Go", "BOLT"},
+			want: []string{"go", "bolt"},
+		},
+		{
+			name: "it drops duplicate tags keeping the first",
+			tags: []string{"go", "bolt", "Go", "go"},
+			want: []string{"go", "bolt"},
+		},
+		{
+			name: "it drops empty tags",
+			tags: []string{"", "go", "  "},
+			want: []string{"go"},
+		},
+		{
+			name: "it returns empty if all tags are dropped",
+			tags: []string{"", " "},
+			want: []string{},
+		},
+		{
+			name: "it returns nil if there are no tags",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeTags(tt.tags))
+		})
+	}
+}
+
+func Test_comment_hasTag(t *testing.T) {
+	t.Parallel()
+
+	c := &comment{Tags: []string{"go", "bolt"}}
+	assert.True(t, c.hasTag("go"))
+	assert.True(t, c.hasTag("bolt"))
+	assert.False(t, c.hasTag("chi"))
+	assert.False(t, (&comment{}).hasTag("go"))
+}
+
+func Test_comment_etag(t *testing.T) {
+	t.Parallel()
+
+	c := &comment{ID: "1", Value: "hello", Version: 1}
+	etag, err := c.etag()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	same, err := (&comment{ID: "1", Value: "hello", Version: 1}).etag()
+	assert.NoError(t, err)
+	assert.Equal(t, etag, same, "the etag should only depend on the comment")
+
+	c.Version++
+	saved, err := c.etag()
+	assert.NoError(t, err)
+	assert.NotEqual(t, etag, saved, "the etag should change on every save")
+}
+
+func Test_comment_clone(t *testing.T) {
+	t.Parallel()
+
+	c := &comment{
+		Value:       "hello",
+		Tags:        []string{"go"},
+		Mentions:    []string{"jane"},
+		Attachments: []string{"https://img.example.com/a.png"},
+	}
+	cc := c.clone()
+	assert.Equal(t, c, cc)
+
+	cc.Tags[0] = "bolt"
+	cc.Mentions[0] = "john"
+	cc.Attachments[0] = "https://img.example.com/b.png"
+	assert.Equal(t, []string{"go"}, c.Tags)
+	assert.Equal(t, []string{"jane"}, c.Mentions)
+	assert.Equal(t, []string{"https://img.example.com/a.png"}, c.Attachments, "the clone should not share the attachments")
+}
+
+func Test_mentions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "it finds no mentions in a comment without any",
+			value: "no one to notify",
+		},
+		{
+			name:  "it finds the mentioned usernames in the order they are mentioned",
+			value: "@jane, what do you think? (cc @John_Doe2)",
+			want:  []string{"jane", "John_Doe2"},
+		},
+		{
+			name:  "it finds each username once",
+			value: "@jane @john @jane",
+			want:  []string{"jane", "john"},
+		},
+		{
+			name:  "it ends usernames at the first character that is not a letter, digit or underscore",
+			value: "thanks @jane! and @john-doe.",
+			want:  []string{"jane", "john"},
+		},
+		{
+			name:  "it does not take email addresses or lone @s for mentions",
+			value: "write to jane@example.com @ 5pm or @@john",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mentions(tt.value))
+		})
+	}
+}
+
+func Test_newCommentResponse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		value      string
+		wantLength int
+		wantWords  int
+	}{
+		{
+			name:       "it counts the characters and words of the value",
+			value:      "nice post, thanks",
+			wantLength: 17,
+			wantWords:  3,
+		},
+		{
+			name:       "it counts multibyte characters once",
+			value:      "héllo wörld 👋",
+			wantLength: 13,
+			wantWords:  3,
+		},
+		{
+			name:       "it counts words separated by any whitespace",
+			value:      "  one\ttwo\nthree four  ",
+			wantLength: 22,
+			wantWords:  4,
+		},
+		{
+			name: "it counts nothing in an empty value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newCommentResponse(&comment{Value: tt.value}, caller{})
+			assert.Equal(t, tt.wantLength, got.Length)
+			assert.Equal(t, tt.wantWords, got.Words)
+		})
+	}
+}
+
+func Test_newCommentResponse_spamScore(t *testing.T) {
+	t.Parallel()
+
+	c := &comment{Value: "best casino", SpamScore: 0.5, Hidden: true}
+
+	data, err := json.Marshal(newCommentResponse(c, caller{id: "jane"}))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "spam_score", "only admins should get the spam score")
+	assert.NotContains(t, string(data), "hidden", "only admins should be told the comment is hidden")
+
+	data, err = json.Marshal(newCommentResponse(c, caller{admin: true}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"spam_score":0.5`)
+	assert.Contains(t, string(data), `"hidden":true`)
+}
+
+func Test_newCommentResponse_dedupeKey(t *testing.T) {
+	t.Parallel()
+
+	c := &comment{Value: "hello", Author: "jane", DedupeKey: "abc"}
+
+	for _, cl := range []caller{{}, {id: "john"}} {
+		data, err := json.Marshal(newCommentResponse(c, cl))
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "dedupe_key", "only the author and admins should get the dedupe key")
+	}
+
+	for _, cl := range []caller{{id: "jane"}, {admin: true}} {
+		data, err := json.Marshal(newCommentResponse(c, cl))
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"dedupe_key":"abc"`)
+	}
+}
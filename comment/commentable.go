@@ -1,20 +1,105 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/boltdb/bolt"
-	"github.com/kjk/betterguid"
 )
 
 var (
-	commentableNotFoundFmt     = "%s not found with key %s"
-	commentableTypeNotFoundFmt = "commentable type, %s, not found"
-	commentNotFoundFmt         = "comment with key %s not found for %s with id %s"
-	commentsKey                = []byte("comments")
+	commentableNotFoundFmt      = "%s not found with key %s"
+	commentableKeyInvalidFmt    = "resource key is invalid, %s"
+	commentableTypeNotFoundFmt  = "commentable type, %s, not found"
+	commentNotFoundFmt          = "comment with key %s not found for %s with id %s"
+	commentCategoryInvalidFmt   = "comment category, %s, is not allowed"
+	commentVisibilityInvalidFmt = "comment visibility, %s, should be either public or private"
+	commentsKey                 = []byte("comments")
+	trashKey                    = []byte("_trash") // deleted comments until restored or purged
+
+	errVersionMismatch  = errors.New("comment has been modified since the given version")
+	errTargetNotEmpty   = errors.New("target already has comments")
+	errNotInTrash       = errors.New("comment not found in the trash")
+	errRestoreConflict  = errors.New("a comment with the same key already exists")
+	errRestoreForbidden = errors.New("only admins and the author can restore a comment")
 )
 
+// typeNotFound, notFound and commentNotFound are the errors of the buckets of the commentable
+// missing, built in one place so that every method reports them alike
+func (cm *commentable) typeNotFound() error {
+	return fmt.Errorf(commentableTypeNotFoundFmt, cm.kind)
+}
+
+func (cm *commentable) notFound() error {
+	return fmt.Errorf(commentableNotFoundFmt, cm.kind, cm.key)
+}
+
+func (cm *commentable) commentNotFound(cKey string) error {
+	return fmt.Errorf(commentNotFoundFmt, cKey, cm.kind, cm.key)
+}
+
+// checkKey reports why the resource key can't be used as a bucket name, nil if it can.
+// Keys come straight from the url so they are kept short and printable, and must not match
+// any of the reserved patterns.
+func checkKey(key string, maxLen int, reserved keyPatterns) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+
+	if maxLen > 0 && len(key) > maxLen {
+		return fmt.Errorf("key is longer than %d bytes", maxLen)
+	}
+
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return errors.New("key contains control characters")
+		}
+	}
+
+	if p, ok := reserved.match(key); ok {
+		return fmt.Errorf("key matches the reserved pattern %s", p)
+	}
+
+	return nil
+}
+
+// keyPatterns are glob patterns of keys, see path.Match, e.g. admin or internal-*
+type keyPatterns []string
+
+// Decode implements envconfig.Decoder so that an invalid pattern fails the startup
+func (ps *keyPatterns) Decode(value string) error {
+	*ps = nil
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid key pattern %q, %v", p, err)
+		}
+		*ps = append(*ps, p)
+	}
+
+	return nil
+}
+
+// match returns the first pattern the key matches
+func (ps keyPatterns) match(key string) (string, bool) {
+	for _, p := range ps {
+		if ok, _ := path.Match(p, key); ok {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
 func setup(db *bolt.DB, cmts []string) error {
 	return db.Update(func(tx *bolt.Tx) error {
 		for _, b := range cmts {
@@ -27,8 +112,13 @@ func setup(db *bolt.DB, cmts []string) error {
 	})
 }
 
-func verify(db *bolt.DB, kind string) (found bool) {
-	db.View(func(tx *bolt.Tx) error {
+// verify tells whether the type exists, failing if the db could not be read, e.g. once it is closed
+func verify(db *bolt.DB, kind string) (found bool, err error) {
+	if strings.HasPrefix(kind, "_") { // reserved for the service, e.g. the audit trail
+		return false, nil
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(kind))
 		found = b != nil
 		return nil
@@ -41,6 +131,11 @@ type commentable struct {
 	kind string // author, books
 	key  string // resource id
 	db   *bolt.DB
+	ids  idGenerator // of added comments, betterguid if nil
+	// creates the comments bucket in ensure rather than on the first save
+	eager bool
+	// most comments the commentable may have, only checked when adding them, any number if 0
+	maxComments int
 }
 
 func (cm *commentable) ensure() error {
@@ -50,18 +145,34 @@ func (cm *commentable) ensure() error {
 			return fmt.Errorf("resource '%s' does not exist", cm.kind)
 		}
 
-		_, err := bucket.CreateBucketIfNotExists([]byte(cm.key))
+		rBucket, err := bucket.CreateBucketIfNotExists([]byte(cm.key))
+		if err != nil || !cm.eager {
+			return err
+		}
+
+		_, err = rBucket.CreateBucketIfNotExists(commentsKey)
 		return err
 	})
 }
 
-func (cm *commentable) exists() (found bool) {
-	cm.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(cm.kind))
-		if bucket != nil && bucket.Bucket([]byte(cm.key)) != nil {
-			found = true
-		}
+func (cm *commentable) exists() (bool, error) {
+	e, err := cm.lookup()
+	return e.ResourceExists, err
+}
+
+// existence tells which of the type and the resource exist, e.g. for clients to tell
+// whether to create a resource they were told is not found or to fix its type
+type existence struct {
+	TypeExists     bool `json:"type_exists"`
+	ResourceExists bool `json:"resource_exists"`
+}
 
+// lookup checks whether the type and the resource exist in a single read, failing if the db could not be read
+func (cm *commentable) lookup() (e existence, err error) {
+	err = cm.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(cm.kind))
+		e.TypeExists = bucket != nil
+		e.ResourceExists = bucket != nil && bucket.Bucket([]byte(cm.key)) != nil
 		return nil
 	})
 
@@ -69,15 +180,35 @@ func (cm *commentable) exists() (found bool) {
 }
 
 func (cm *commentable) add(c *comment) (*comment, error) {
+	return cm.addIf(c, nil)
+}
+
+// addIf adds the comment provided check, if not nil, passes on the comments of the resource, see saveIf
+func (cm *commentable) addIf(c *comment, check func(comments *bolt.Bucket) error) (*comment, error) {
 	if c == nil {
 		return nil, fmt.Errorf("comment should not be empty")
 	}
 
-	c.ID = betterguid.New()
-	return cm.save(c)
+	ids := cm.ids
+	if ids == nil {
+		ids = betterguidGenerator{}
+	}
+
+	c.ID = ids.newID()
+	c.Version = 0
+	return cm.saveIf(c, check)
 }
 
+// save stores the comment, provided the stored comment is still at the version of the given one.
+// The version is incremented on every successful save so that concurrent updates can't clobber each other.
+// New comments are rejected with a commentLimitError once the commentable has maxComments.
 func (cm *commentable) save(c *comment) (*comment, error) {
+	return cm.saveIf(c, nil)
+}
+
+// saveIf is save, failing with the error of check, if not nil, which is called with the comments
+// of the resource in the transaction storing the comment so that they can't change in between
+func (cm *commentable) saveIf(c *comment, check func(comments *bolt.Bucket) error) (*comment, error) {
 	if c == nil {
 		return nil, fmt.Errorf("comment should not be empty")
 	}
@@ -85,12 +216,12 @@ func (cm *commentable) save(c *comment) (*comment, error) {
 	err := cm.db.Update(func(tx *bolt.Tx) error {
 		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
 		if cmBucket == nil {
-			return fmt.Errorf(commentableTypeNotFoundFmt, cm.kind)
+			return cm.typeNotFound()
 		}
 
 		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
 		if rBucket == nil {
-			return fmt.Errorf(commentableNotFoundFmt, cm.key, cm.kind)
+			return cm.notFound()
 		}
 
 		comments, err := rBucket.CreateBucketIfNotExists(commentsKey) // prep the comments subbucket
@@ -98,6 +229,26 @@ func (cm *commentable) save(c *comment) (*comment, error) {
 			return fmt.Errorf("error setting up comments for %s with key %s %v", cm.kind, cm.key, err)
 		}
 
+		if check != nil {
+			if err = check(comments); err != nil {
+				return err
+			}
+		}
+
+		if data := comments.Get([]byte(c.ID)); data != nil {
+			var stored comment
+			if err = json.Unmarshal(data, &stored); err != nil {
+				return err
+			}
+
+			if stored.Version != c.Version {
+				return errVersionMismatch
+			}
+		} else if cm.maxComments > 0 && comments.Stats().KeyN >= cm.maxComments {
+			return commentLimitError{cm.kind, cm.key, cm.maxComments}
+		}
+
+		c.Version++
 		data, err := json.Marshal(c)
 		if err != nil {
 			return fmt.Errorf("error preparing comment %v, %v", c, err)
@@ -114,25 +265,47 @@ func (cm *commentable) save(c *comment) (*comment, error) {
 	return c, err
 }
 
+// list returns the comments in the byte order of their ids, which is the order they were added in
+// with a time ordered id scheme, see idGenerator
 func (cm *commentable) list() ([]*comment, error) {
 	var comments []*comment
-	err := cm.db.View(func(tx *bolt.Tx) error {
+	err := cm.each(func(c *comment) error {
+		comments = append(comments, c)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if comments == nil {
+		comments = []*comment{}
+	}
+
+	return comments, nil
+}
+
+// each calls fn with every comment in the order of list, one at a time and within a single read transaction,
+// stopping at the first error fn returns. The transaction keeps bolt from growing the db file for writes
+// while it is open, so callers that take their time, e.g. to stream the comments, use eachBatch instead.
+func (cm *commentable) each(fn func(*comment) error) error {
+	return cm.db.View(func(tx *bolt.Tx) error {
 		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
 		if cmBucket == nil {
-			return fmt.Errorf(commentableTypeNotFoundFmt, cm.kind)
+			return cm.typeNotFound()
 		}
 
 		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
 		if rBucket == nil {
-			return fmt.Errorf(commentableNotFoundFmt, cm.key, cm.kind)
+			return cm.notFound()
 		}
 
-		comments = []*comment{}
 		komments := rBucket.Bucket(commentsKey)
 		if komments == nil {
 			return nil
 		}
 
+		now := time.Now()
 		return komments.ForEach(func(_, data []byte) error {
 			var c comment
 			err := json.Unmarshal(data, &c)
@@ -140,61 +313,409 @@ func (cm *commentable) list() ([]*comment, error) {
 				return err
 			}
 
-			comments = append(comments, &c)
+			// hidden comments, e.g. likely spam, are left out
+			if c.expired(now) || c.Hidden {
+				return nil
+			}
+			return fn(&c)
+		})
+	})
+}
+
+// eachBatch calls fn with the comments in the order of list, up to n at a time, stopping at the first error
+// fn returns. Every batch is read in a read transaction of its own which is closed before fn is called,
+// so that callers taking their time don't hold up writes. The next batch starts after the last id read,
+// so comments added or removed meanwhile may or may not be passed to fn depending on their id.
+func (cm *commentable) eachBatch(n int, fn func([]*comment) error) error {
+	var after []byte
+	for done := false; !done; {
+		var batch []*comment
+		err := cm.db.View(func(tx *bolt.Tx) error {
+			cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+			if cmBucket == nil {
+				return cm.typeNotFound()
+			}
+
+			rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+			if rBucket == nil {
+				return cm.notFound()
+			}
+
+			komments := rBucket.Bucket(commentsKey)
+			if komments == nil {
+				done = true
+				return nil
+			}
+
+			cur := komments.Cursor()
+			k, data := cur.First()
+			if after != nil {
+				k, data = cur.Seek(after)
+				if k != nil && bytes.Equal(k, after) {
+					k, data = cur.Next()
+				}
+			}
+
+			now := time.Now()
+			// n bounds the comments read rather than those kept, so that skipping many stays a short read
+			for read := 0; k != nil && read < n; k, data = cur.Next() {
+				read++
+				after = append(after[:0], k...) // k is only valid within the transaction
+
+				var c comment
+				if err := json.Unmarshal(data, &c); err != nil {
+					return err
+				}
+
+				// hidden comments, e.g. likely spam, are left out
+				if c.expired(now) || c.Hidden {
+					continue
+				}
+				batch = append(batch, &c)
+			}
+
+			done = k == nil
 			return nil
 		})
+		if err != nil {
+			return err
+		}
+
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// latest returns the last comment in the order of list that keep is true for, nil if there is none.
+// It reads the comments backwards from the end of the bucket, so only those after it are read,
+// and with a time ordered id scheme it is the one added most recently.
+func (cm *commentable) latest(keep func(*comment) bool) (latest *comment, err error) {
+	err = cm.db.View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		komments := rBucket.Bucket(commentsKey)
+		if komments == nil {
+			return nil
+		}
+
+		now := time.Now()
+		cur := komments.Cursor()
+		for k, data := cur.Last(); k != nil; k, data = cur.Prev() {
+			var c comment
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+
+			// left out like in each
+			if c.expired(now) || c.Hidden || !keep(&c) {
+				continue
+			}
+
+			latest = &c
+			return nil
+		}
+
+		return nil
 	})
 
-	return comments, err
+	return latest, err
 }
 
 func (cm *commentable) get(cKey string) (c *comment, err error) {
 	err = cm.db.View(func(tx *bolt.Tx) error {
 		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
 		if cmBucket == nil {
-			return fmt.Errorf(commentableTypeNotFoundFmt, cm.kind)
+			return cm.typeNotFound()
 		}
 
 		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
 		if rBucket == nil {
-			return fmt.Errorf(commentableNotFoundFmt, cm.kind, cm.key)
+			return cm.notFound()
 		}
 
 		comments := rBucket.Bucket(commentsKey) // prep the comments subbucket
 		if comments == nil {
-			return fmt.Errorf(commentNotFoundFmt, cKey, cm.kind, cm.key)
+			return cm.commentNotFound(cKey)
 		}
 
 		cmm := comments.Get([]byte(cKey))
 		if cmm == nil {
-			return fmt.Errorf(commentNotFoundFmt, cKey, cm.kind, cm.key)
+			return cm.commentNotFound(cKey)
 		}
 
 		c = &comment{}
-		return json.Unmarshal(cmm, c)
+		if err := json.Unmarshal(cmm, c); err != nil {
+			return err
+		}
+
+		// expired comments are gone even before they are swept
+		if c.expired(time.Now()) {
+			c = nil
+			return cm.commentNotFound(cKey)
+		}
+
+		return nil
 	})
 
 	return c, err
 }
 
-func (cm *commentable) remove(cKey string) error {
+// count returns the number of comments on the commentable, without reading them, so private,
+// hidden and expired ones are counted too
+func (cm *commentable) count() (int, error) {
+	var n int
+	err := cm.db.View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		if comments := rBucket.Bucket(commentsKey); comments != nil {
+			n = comments.Stats().KeyN
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+// move moves all comments on the commentable to the one with the given key, creating it if needed,
+// and returns how many were moved. It fails with errTargetNotEmpty if the target already has
+// comments, unless they are to be merged.
+func (cm *commentable) move(to string, merge bool) (int, error) {
+	var n int
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return nil
+		}
+
+		// the target is created in the same transaction so that a failed move leaves no trace
+		target, err := cmBucket.CreateBucketIfNotExists([]byte(to))
+		if err != nil {
+			return err
+		}
+
+		targetComments, err := target.CreateBucketIfNotExists(commentsKey)
+		if err != nil {
+			return err
+		}
+
+		if !merge && targetComments.Stats().KeyN > 0 {
+			return errTargetNotEmpty
+		}
+
+		err = comments.ForEach(func(id, data []byte) error {
+			n++
+			return targetComments.Put(id, data)
+		})
+		if err != nil {
+			return err
+		}
+
+		return rBucket.DeleteBucket(commentsKey)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// clear removes all comments on the commentable at once and returns how many were removed
+func (cm *commentable) clear() (int, error) {
+	var n int
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return nil
+		}
+
+		n = comments.Stats().KeyN
+		return rBucket.DeleteBucket(commentsKey)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// remove moves the comment into the trash, from which it can be restored until purged,
+// recording it in the audit trail as deleted by the caller
+func (cm *commentable) remove(cKey string, by caller) error {
 	return cm.db.Update(func(tx *bolt.Tx) error {
 		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
 		if cmBucket == nil {
-			return fmt.Errorf(commentableTypeNotFoundFmt, cm.kind)
+			return cm.typeNotFound()
 		}
 
 		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
 		if rBucket == nil {
-			return fmt.Errorf(commentableNotFoundFmt, cm.key, cm.kind)
+			return cm.notFound()
 		}
 
-		comments := rBucket.Bucket(commentsKey) // prep the comments subbucket
+		// a missing comment is removed already, be it that there are no comments at all
+		comments := rBucket.Bucket(commentsKey)
 		if comments == nil {
-			return fmt.Errorf("comment with key %s not found for %s resource with id %s", cKey, cm.kind, cm.key)
+			return nil
+		}
+
+		data := comments.Get([]byte(cKey))
+		if data == nil {
+			return nil
+		}
+
+		err := audit(tx, auditEntry{
+			Action:  auditActionDelete,
+			Kind:    cm.kind,
+			Key:     cm.key,
+			Actor:   by.id,
+			Admin:   by.admin,
+			IP:      by.ip,
+			At:      time.Now().UTC(),
+			Comment: json.RawMessage(data),
+		})
+		if err != nil {
+			return err
+		}
+
+		var c comment
+		if err = json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		c.DeletedAt = &now
+		trashed, err := json.Marshal(&c)
+		if err != nil {
+			return err
+		}
+
+		trash, err := rBucket.CreateBucketIfNotExists(trashKey)
+		if err != nil {
+			return err
+		}
+
+		if err = trash.Put([]byte(cKey), trashed); err != nil {
+			return err
 		}
 
 		return comments.Delete([]byte(cKey))
 	})
+}
+
+// restore moves the comment with the given key back from the trash and returns it
+func (cm *commentable) restore(cKey string, by caller) (*comment, error) {
+	var c comment
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind))
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key))
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		trash := rBucket.Bucket(trashKey)
+		if trash == nil {
+			return errNotInTrash
+		}
+
+		data := trash.Get([]byte(cKey))
+		if data == nil {
+			return errNotInTrash
+		}
+
+		comments, err := rBucket.CreateBucketIfNotExists(commentsKey)
+		if err != nil {
+			return err
+		}
+
+		if comments.Get([]byte(cKey)) != nil {
+			return errRestoreConflict
+		}
+
+		if err = json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		if !by.canModify(&c) {
+			return errRestoreForbidden
+		}
+
+		err = audit(tx, auditEntry{
+			Action:  auditActionRestore,
+			Kind:    cm.kind,
+			Key:     cm.key,
+			Actor:   by.id,
+			Admin:   by.admin,
+			IP:      by.ip,
+			At:      time.Now().UTC(),
+			Comment: json.RawMessage(data),
+		})
+		if err != nil {
+			return err
+		}
+
+		c.DeletedAt = nil
+		restored, err := json.Marshal(&c)
+		if err != nil {
+			return err
+		}
+
+		if err = comments.Put([]byte(cKey), restored); err != nil {
+			return err
+		}
+
+		return trash.Delete([]byte(cKey))
+	})
+	if err != nil {
+		return nil, err
+	}
 
+	return &c, nil
 }
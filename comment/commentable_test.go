@@ -2,10 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/assert"
@@ -43,6 +45,43 @@ func cleanup(db *bolt.DB) {
 	}
 }
 
+func Test_keyPatterns_Decode(t *testing.T) {
+	t.Parallel()
+
+	var ps keyPatterns
+	assert.NoError(t, ps.Decode("admin, internal-*,,"))
+	assert.Equal(t, keyPatterns{"admin", "internal-*"}, ps)
+	assert.EqualError(t, ps.Decode("admin,[a-"), `invalid key pattern "[a-", syntax error in pattern`)
+}
+
+func Test_checkKey_reserved(t *testing.T) {
+	t.Parallel()
+
+	reserved := keyPatterns{"admin", "internal-*", "tmp?"}
+	tests := []struct {
+		key     string
+		wantErr string
+	}{
+		{key: "admin", wantErr: "key matches the reserved pattern admin"},
+		{key: "internal-1234", wantErr: "key matches the reserved pattern internal-*"},
+		{key: "tmp1", wantErr: "key matches the reserved pattern tmp?"},
+		{key: "administrator"},
+		{key: "my-internal-1234"},
+		{key: "tmp12"},
+	}
+
+	for _, tt := range tests {
+		err := checkKey(tt.key, 128, reserved)
+		if tt.wantErr == "" {
+			assert.NoError(t, err, tt.key)
+		} else {
+			assert.EqualError(t, err, tt.wantErr, tt.key)
+		}
+	}
+
+	assert.NoError(t, checkKey("admin", 128, nil), "no key should be reserved by default")
+}
+
 func Test_commentable_ensure(t *testing.T) {
 	t.Parallel()
 
@@ -108,6 +147,26 @@ func Test_commentable_ensure(t *testing.T) {
 	}
 }
 
+func Test_commentable_ensure_eager(t *testing.T) {
+	t.Parallel()
+
+	for _, eager := range []bool{false, true} {
+		db := setupDB()
+		assert.NoError(t, setup(db, []string{"resource"}))
+
+		cc := &commentable{db: db, kind: "resource", key: "resourceID", eager: eager}
+		assert.NoError(t, cc.ensure())
+		assert.NoError(t, cc.ensure(), "ensuring an existing resource should not fail")
+
+		db.View(func(tx *bolt.Tx) error {
+			comments := tx.Bucket([]byte("resource")).Bucket([]byte("resourceID")).Bucket(commentsKey)
+			assert.Equal(t, eager, comments != nil)
+			return nil
+		})
+		cleanup(db)
+	}
+}
+
 func Test_commentable_exists(t *testing.T) {
 	t.Parallel()
 
@@ -162,7 +221,8 @@ func Test_commentable_exists(t *testing.T) {
 			}
 
 			cc := &commentable{db: db, key: key, kind: kind}
-			got := cc.exists()
+			got, err := cc.exists()
+			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -203,7 +263,8 @@ func Test_verify(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			got := verify(db, kind)
+			got, err := verify(db, kind)
+			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -246,7 +307,8 @@ func Test_setup(t *testing.T) {
 			assert.Equal(t, tt.want, got)
 			
 			for i, name := range tt.args {
-				assert.Equal(t, tt.exp[i], verify(db, name))
+				found, _ := verify(db, name)
+				assert.Equal(t, tt.exp[i], found)
 			}
 		})
 	}
@@ -261,6 +323,7 @@ func Test_commentable_save(t *testing.T) {
 		name    string
 		kind    string
 		key     string
+		stored  *comment
 		co      *comment
 		want    *comment
 		wantErr error
@@ -269,14 +332,14 @@ func Test_commentable_save(t *testing.T) {
 			name:    "it returns error if commentable type is not found",
 			kind:    "unknown",
 			co:      &comment{ID: "1234", Value: "something"},
-			wantErr: fmt.Errorf(commentableTypeNotFoundFmt, "unknown"),
+			wantErr: errors.New("commentable type, unknown, not found"),
 		},
 		{
 			name:    "it returns error if commentable is not found",
 			kind:    kind,
 			key:     "unknown",
 			co:      &comment{ID: "1234", Value: "something"},
-			wantErr: fmt.Errorf(commentableNotFoundFmt, "unknown", kind),
+			wantErr: errors.New("commentableType not found with key unknown"),
 		},
 		{
 			name:    "it returns error if comment id is empty",
@@ -296,7 +359,23 @@ func Test_commentable_save(t *testing.T) {
 			kind: kind,
 			key:  key,
 			co:   &comment{ID: "1234", Value: "something"},
-			want: &comment{ID: "1234", Value: "something"},
+			want: &comment{ID: "1234", Value: "something", Version: 1},
+		},
+		{
+			name:    "it returns error if the stored comment is at a different version",
+			kind:    kind,
+			key:     key,
+			stored:  &comment{ID: "1234", Value: "something", Version: 2},
+			co:      &comment{ID: "1234", Value: "something else", Version: 1},
+			wantErr: errVersionMismatch,
+		},
+		{
+			name:   "it saves the comment and increments its version if the stored comment is at the same version",
+			kind:   kind,
+			key:    key,
+			stored: &comment{ID: "1234", Value: "something", Version: 2},
+			co:     &comment{ID: "1234", Value: "something else", Version: 2},
+			want:   &comment{ID: "1234", Value: "something else", Version: 3},
 		},
 	}
 
@@ -311,8 +390,21 @@ func Test_commentable_save(t *testing.T) {
 					return err
 				}
 
-				_, err = b.CreateBucket([]byte(key))
-				return err
+				cb, err := b.CreateBucket([]byte(key))
+				if err != nil || tt.stored == nil {
+					return err
+				}
+
+				ccb, err := cb.CreateBucket(commentsKey)
+				if err != nil {
+					return err
+				}
+
+				data, err := json.Marshal(tt.stored)
+				if err != nil {
+					return err
+				}
+				return ccb.Put([]byte(tt.stored.ID), data)
 			})
 			assert.NoError(t, err)
 
@@ -341,14 +433,14 @@ func Test_commentable_add(t *testing.T) {
 			name:    "it returns error if comemntable type is not found",
 			kind:    "unknown",
 			co:      &comment{Value: "some comment stuff"},
-			wantErr: fmt.Errorf(commentableTypeNotFoundFmt, "unknown"),
+			wantErr: errors.New("commentable type, unknown, not found"),
 		},
 		{
 			name:    "it returns error if commentable is not found",
 			kind:    kind,
 			key:     "unknown",
 			co:      &comment{Value: "some comment stuff"},
-			wantErr: fmt.Errorf(commentableNotFoundFmt, "unknown", kind),
+			wantErr: errors.New("commentable not found with key unknown"),
 		},
 		{
 			name:    "it returns error if the comment is empty",
@@ -412,6 +504,11 @@ func Test_commentable_get(t *testing.T) {
 			return err
 		}
 
+		// a commentable without any comments yet
+		if _, err := b.CreateBucket([]byte("empty")); err != nil {
+			return err
+		}
+
 		ccb, err := cb.CreateBucket([]byte("comments"))
 		if err != nil {
 			return err
@@ -437,21 +534,28 @@ func Test_commentable_get(t *testing.T) {
 			name:    "it returns error if commentable type is not found",
 			kind:    "unknown",
 			cKey:    cmt.ID,
-			wantErr: fmt.Errorf(commentableTypeNotFoundFmt, "unknown"),
+			wantErr: errors.New("commentable type, unknown, not found"),
 		},
 		{
 			name:    "it returns error if commentable is not found",
 			kind:    kind,
 			key:     "unknown",
 			cKey:    cmt.ID,
-			wantErr: fmt.Errorf(commentableNotFoundFmt, kind, "unknown"),
+			wantErr: errors.New("commentable not found with key unknown"),
 		},
 		{
 			name:    "it returns error if comment with the given key is not found",
 			kind:    kind,
 			key:     key,
 			cKey:    "unknown-key",
-			wantErr: fmt.Errorf(commentNotFoundFmt, "unknown-key", kind, key),
+			wantErr: errors.New("comment with key unknown-key not found for commentable with id commentableID"),
+		},
+		{
+			name:    "it returns error if the commentable has no comments yet",
+			kind:    kind,
+			key:     "empty",
+			cKey:    cmt.ID,
+			wantErr: errors.New("comment with key 12345 not found for commentable with id empty"),
 		},
 		{
 			name: "it returns the comment for the given key",
@@ -493,6 +597,11 @@ func Test_commentable_remove(t *testing.T) {
 			return err
 		}
 
+		// a commentable without any comments yet
+		if _, err := b.CreateBucket([]byte("empty")); err != nil {
+			return err
+		}
+
 		ccb, err := cb.CreateBucket([]byte("comments"))
 		if err != nil {
 			return err
@@ -517,14 +626,20 @@ func Test_commentable_remove(t *testing.T) {
 			name:    "it returns error if commentable type is not found",
 			kind:    "unknown",
 			cKey:    cmt.ID,
-			wantErr: fmt.Errorf(commentableTypeNotFoundFmt, "unknown"),
+			wantErr: errors.New("commentable type, unknown, not found"),
 		},
 		{
 			name:    "it returns error if commentable is not found",
 			kind:    kind,
 			key:     "unknown",
 			cKey:    cmt.ID,
-			wantErr: fmt.Errorf(commentableNotFoundFmt, "unknown", kind),
+			wantErr: errors.New("commentable not found with key unknown"),
+		},
+		{
+			name: "it returns no error if the commentable has no comments yet",
+			kind: kind,
+			key:  "empty",
+			cKey: cmt.ID,
 		},
 		{
 			name: "it removes the comment and returns no error",
@@ -537,7 +652,7 @@ func Test_commentable_remove(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cm := &commentable{db: db, kind: tt.kind, key: tt.key}
-			err := cm.remove(tt.cKey)
+			err := cm.remove(tt.cKey, caller{id: "jane"})
 
 			assert.Equal(t, tt.wantErr, err)
 		})
@@ -560,13 +675,13 @@ func Test_commentable_list(t *testing.T) {
 		{
 			name:    "it returns error if commentable type is not found",
 			kind:    "unknown",
-			wantErr: fmt.Errorf(commentableTypeNotFoundFmt, "unknown"),
+			wantErr: errors.New("commentable type, unknown, not found"),
 		},
 		{
 			name:    "it returns error if commentable is not found",
 			kind:    kind,
 			key:     "unknown",
-			wantErr: fmt.Errorf(commentableNotFoundFmt, "unknown", kind),
+			wantErr: errors.New("commentable not found with key unknown"),
 		},
 		{
 			name: "it returns the comments for the given resource",
@@ -618,3 +733,325 @@ func Test_commentable_list(t *testing.T) {
 		})
 	}
 }
+
+func Test_commentable_eachBatch(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		c, err := cm.add(&comment{Value: fmt.Sprintf("comment %d", i), Hidden: i == 1})
+		assert.NoError(t, err)
+		if i != 1 {
+			want = append(want, c.ID)
+		}
+	}
+
+	var got []string
+	var sizes []int
+	err := cm.eachBatch(2, func(cmts []*comment) error {
+		sizes = append(sizes, len(cmts))
+		for _, c := range cmts {
+			got = append(got, c.ID)
+		}
+
+		// no transaction is held while the batch is handled, so the db can be written to meanwhile
+		return db.Update(func(tx *bolt.Tx) error { return nil })
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, want, got, "hidden comments should be left out")
+	assert.Equal(t, []int{1, 2, 1}, sizes, "batches should be of the comments read, kept or not")
+
+	stop := errors.New("stop")
+	calls := 0
+	err = cm.eachBatch(2, func([]*comment) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+
+	err = (&commentable{db: db, kind: "posts", key: "unknown"}).eachBatch(2, func([]*comment) error { return nil })
+	assert.EqualError(t, err, "posts not found with key unknown")
+}
+
+func Test_commentable_count(t *testing.T) {
+	t.Parallel()
+
+	kind := "commentable"
+	key := "commentableID"
+	tests := []struct {
+		name    string
+		kind    string
+		key     string
+		add     int
+		want    int
+		wantErr error
+	}{
+		{
+			name:    "it returns error if commentable type is not found",
+			kind:    "unknown",
+			wantErr: errors.New("commentable type, unknown, not found"),
+		},
+		{
+			name:    "it returns error if commentable is not found",
+			kind:    kind,
+			key:     "unknown",
+			wantErr: errors.New("commentable not found with key unknown"),
+		},
+		{
+			name: "it returns zero if no comment was added",
+			kind: kind,
+			key:  key,
+		},
+		{
+			name: "it returns the number of comments",
+			kind: kind,
+			key:  key,
+			add:  3,
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			cm := &commentable{db: db, kind: kind, key: key}
+			assert.NoError(t, setup(db, []string{kind}))
+			assert.NoError(t, cm.ensure())
+			for i := 0; i < tt.add; i++ {
+				_, err := cm.add(&comment{Value: "hello world"})
+				assert.NoError(t, err)
+			}
+
+			got, err := (&commentable{db: db, kind: tt.kind, key: tt.key}).count()
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_commentable_clear(t *testing.T) {
+	t.Parallel()
+
+	kind := "commentable"
+	key := "commentableID"
+	tests := []struct {
+		name    string
+		kind    string
+		key     string
+		add     int
+		want    int
+		wantErr error
+	}{
+		{
+			name:    "it returns error if commentable type is not found",
+			kind:    "unknown",
+			wantErr: errors.New("commentable type, unknown, not found"),
+		},
+		{
+			name:    "it returns error if commentable is not found",
+			kind:    kind,
+			key:     "unknown",
+			wantErr: errors.New("commentable not found with key unknown"),
+		},
+		{
+			name: "it removes nothing if no comment was added",
+			kind: kind,
+			key:  key,
+		},
+		{
+			name: "it removes all comments",
+			kind: kind,
+			key:  key,
+			add:  3,
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			cm := &commentable{db: db, kind: kind, key: key}
+			assert.NoError(t, setup(db, []string{kind}))
+			assert.NoError(t, cm.ensure())
+			for i := 0; i < tt.add; i++ {
+				_, err := cm.add(&comment{Value: "hello world"})
+				assert.NoError(t, err)
+			}
+
+			got, err := (&commentable{db: db, kind: tt.kind, key: tt.key}).clear()
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+
+			cmts, err := cm.list()
+			assert.NoError(t, err)
+			if tt.wantErr == nil {
+				assert.Empty(t, cmts)
+			} else {
+				assert.Len(t, cmts, tt.add)
+			}
+		})
+	}
+}
+
+func Test_commentable_move(t *testing.T) {
+	t.Parallel()
+
+	kind := "commentable"
+	key := "commentableID"
+	target := "targetID"
+	tests := []struct {
+		name       string
+		targetHas  int
+		merge      bool
+		want       int
+		wantErr    error
+		wantTarget int
+		wantSource int
+	}{
+		{
+			name:       "it moves the comments to a new target",
+			want:       2,
+			wantTarget: 2,
+		},
+		{
+			name:       "it fails if the target already has comments",
+			targetHas:  1,
+			wantErr:    errTargetNotEmpty,
+			wantTarget: 1,
+			wantSource: 2,
+		},
+		{
+			name:       "it merges the comments into the target",
+			targetHas:  1,
+			merge:      true,
+			want:       2,
+			wantTarget: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			assert.NoError(t, setup(db, []string{kind}))
+			source := &commentable{db: db, kind: kind, key: key}
+			assert.NoError(t, source.ensure())
+			for i := 0; i < 2; i++ {
+				_, err := source.add(&comment{Value: "hello world"})
+				assert.NoError(t, err)
+			}
+
+			to := &commentable{db: db, kind: kind, key: target}
+			if tt.targetHas > 0 {
+				assert.NoError(t, to.ensure())
+				for i := 0; i < tt.targetHas; i++ {
+					_, err := to.add(&comment{Value: "hello target"})
+					assert.NoError(t, err)
+				}
+			}
+
+			got, err := source.move(target, tt.merge)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+
+			n, err := to.count()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantTarget, n)
+
+			n, err = source.count()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSource, n)
+		})
+	}
+}
+
+func Test_commentable_expired(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "commentable"
+	assert.NoError(t, setup(db, []string{kind}))
+	cm := &commentable{db: db, kind: kind, key: "commentableID"}
+	assert.NoError(t, cm.ensure())
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	expired, err := cm.add(&comment{Value: "gone", ExpiresAt: &past})
+	assert.NoError(t, err)
+	live, err := cm.add(&comment{Value: "still here", ExpiresAt: &future})
+	assert.NoError(t, err)
+
+	_, err = cm.get(expired.ID)
+	assert.Equal(t, fmt.Errorf(commentNotFoundFmt, expired.ID, cm.kind, cm.key), err)
+
+	got, err := cm.get(live.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, live.ID, got.ID)
+
+	cmts, err := cm.list()
+	assert.NoError(t, err)
+	assert.Len(t, cmts, 1)
+	assert.Equal(t, live.ID, cmts[0].ID)
+}
+
+func Test_commentable_restore(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+
+	c, err := cm.add(&comment{Value: "hello", Author: "john"})
+	assert.NoError(t, err)
+
+	_, err = cm.restore(c.ID, caller{})
+	assert.Equal(t, errNotInTrash, err, "a comment that was not deleted can't be restored")
+
+	assert.NoError(t, cm.remove(c.ID, caller{id: "jane"}))
+	_, err = cm.get(c.ID)
+	assert.Error(t, err, "a deleted comment should not be found")
+
+	_, err = cm.restore(c.ID, caller{id: "jane"})
+	assert.Equal(t, errRestoreForbidden, err, "only admins and the author can restore a comment")
+	_, err = cm.restore(c.ID, caller{})
+	assert.Equal(t, errRestoreForbidden, err)
+
+	got, err := cm.restore(c.ID, caller{id: "john"})
+	assert.NoError(t, err)
+	assert.Equal(t, c.ID, got.ID)
+	assert.Equal(t, c.Value, got.Value)
+	assert.Nil(t, got.DeletedAt)
+
+	got, err = cm.get(c.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, c.Value, got.Value)
+
+	_, err = cm.restore(c.ID, caller{admin: true})
+	assert.Equal(t, errNotInTrash, err, "a comment can only be restored once")
+
+	entries, err := recentAudit(db, 1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, auditActionRestore, entries[0].Action)
+	assert.Equal(t, "john", entries[0].Actor)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// handleCountCommenters responds with how many distinct authors commented on the resource,
+// e.g. to show "commented by 42 people". Only the comments the caller can see are counted.
+func (svc *service) handleCountCommenters(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+
+	cmts, err := svc.listAllComments(c)
+	if err != nil {
+		svc.fail(w, svc.logger, errCommentList, err,
+			zap.String(commentableKeyParam, c.key),
+			zap.String(commentableTypeParam, c.kind),
+		)
+		return
+	}
+
+	svc.respondWithPayload(w, struct {
+		Count int `json:"count"`
+	}{countCommenters(filter(cmts, callerOf(r).canSee), svc.cfg.CountAnonymousCommenters)}, http.StatusOK)
+}
+
+// countCommenters counts the distinct authors of the comments. Anonymous comments are
+// counted as one more commenter if anonymous, and not at all otherwise.
+func countCommenters(cmts []*comment, anonymous bool) int {
+	authors := map[string]bool{}
+	for _, c := range cmts {
+		if c.Author != "" || anonymous {
+			authors[c.Author] = true
+		}
+	}
+
+	return len(authors)
+}
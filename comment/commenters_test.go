@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_countCommenters(t *testing.T) {
+	t.Parallel()
+
+	cmts := []*comment{
+		{Author: "jane"},
+		{Author: "john"},
+		{Author: "jane"},
+		{},
+		{},
+	}
+
+	tests := []struct {
+		name      string
+		cmts      []*comment
+		anonymous bool
+		want      int
+	}{
+		{
+			name: "it counts nothing without comments",
+			cmts: []*comment{},
+		},
+		{
+			name: "it counts each author once and leaves out anonymous comments",
+			cmts: cmts,
+			want: 2,
+		},
+		{
+			name:      "it counts anonymous comments as one commenter if anonymous",
+			cmts:      cmts,
+			anonymous: true,
+			want:      3,
+		},
+		{
+			name:      "it counts only anonymous comments as one commenter",
+			cmts:      []*comment{{}, {}},
+			anonymous: true,
+			want:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, countCommenters(tt.cmts, tt.anonymous))
+		})
+	}
+}
+
+func Test_service_handleCountCommenters(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+	for _, c := range []*comment{
+		{Value: "hello", Author: "jane"},
+		{Value: "hello", Author: "john"},
+		{Value: "hello"},
+		{Value: "hello", Author: "jim", Visibility: visibilityPrivate},
+	} {
+		_, err := cm.add(c)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		userID    string
+		anonymous bool
+		wantCode  int
+		want      string
+	}{
+		{
+			name:     "it counts the authors of the comments the caller can see",
+			path:     "/v1/books/1/comments/commenters/count",
+			wantCode: http.StatusOK,
+			want:     `{"count":2}`,
+		},
+		{
+			name:     "it counts the private comments of the caller",
+			path:     "/v1/books/1/comments/commenters/count",
+			userID:   "jim",
+			wantCode: http.StatusOK,
+			want:     `{"count":3}`,
+		},
+		{
+			name:      "it counts anonymous comments if configured",
+			path:      "/v1/books/1/comments/commenters/count",
+			anonymous: true,
+			wantCode:  http.StatusOK,
+			want:      `{"count":3}`,
+		},
+		{
+			name:     "it responds with error if the resource does not exist",
+			path:     "/v1/books/2/comments/commenters/count",
+			wantCode: http.StatusNotFound,
+			want:     buildNotFoundResp("books", "2"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CountAnonymousCommenters = tt.anonymous
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.userID != "" {
+				r.Header.Set(userIDHeader, tt.userID)
+			}
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -1,6 +1,202 @@
 package main
 
+import (
+	"regexp"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
 type config struct {
-	Port int    `default:"50050"`
-	DSN  string `default:"db/comments.db"`
+	Port      int    `default:"50050"`
+	DSN       string `default:"db/comments.db"`
+	APIPrefix string `default:"/v1"` // set empty to serve the api from the root
+	ReadOnly  bool   // reject all mutating requests, e.g. during maintenance
+
+	// how long to wait at startup for the lock on the db files, which another process may still hold,
+	// e.g. the previous instance during a rolling restart. It is waited for as long as it takes if 0.
+	DBOpenTimeout time.Duration `default:"1s"`
+
+	// how long /readyz reports the shutdown before the server stops listening,
+	// so that probes get to steer traffic away first
+	ShutdownDelay time.Duration `default:"5s"`
+
+	// take the client ip from the X-Forwarded-For or X-Real-IP headers set by the proxy in front of the service.
+	// Only set it behind a proxy that sets them, clients could claim any ip otherwise.
+	TrustProxy bool
+
+	// directory of one bolt file per commentable type, named after the type, so that writes to different types
+	// don't wait on each other. All types are kept in the DSN file if empty. Snapshots cover every file.
+	ShardDir string
+
+	// what to do at startup about the types in the db that are no longer configured, off, warn or remove.
+	// remove deletes them along with all their comments, so only set it once the warning was checked.
+	ReconcileTypes reconcileMode `default:"warn"`
+
+	// serve the runtime profiles under /debug/pprof, only to admins if an admin token is set
+	Pprof bool
+
+	// send headers that help debugging clients, e.g. X-Rejected-By naming the middleware that rejected
+	// a request. They tell how requests are checked, so keep them off in production.
+	DebugHeaders bool
+
+	// file of KEY=value lines overriding the env vars. It is read again on SIGHUP to apply the settings
+	// that don't require a restart: LOGLEVEL, ACCESSLOGLEVEL, MAXKEYLENGTH, RESERVEDKEYS, MAXPOLLWAIT,
+	// MAXCOMMENTWORDS, COMMENTPATTERN, CATEGORIES, ATTACHMENTHOSTS, MAXATTACHMENTS, DEFAULTPAGESIZE, MAXPAGESIZE,
+	// MAXCOMMENTSPERRESOURCE, COMMENTLIMITWARNING, MAXBULKGETIDS, MAXSEARCHSCAN, MAXPINNEDCOMMENTS,
+	// the SPAM and the DUPLICATE settings. Lines removed from the file revert their setting.
+	// SIGHUP is ignored if no file is set, as the env vars of the process can't change while it runs.
+	ConfigFile string
+
+	// longest resource key in bytes, longer ones are rejected with a 400. Any length is allowed if 0.
+	MaxKeyLength int `default:"128"`
+
+	// glob patterns of resource keys reserved by the operator, e.g. admin or internal-*,
+	// matching keys are rejected with a 400
+	ReservedKeys keyPatterns
+
+	// sent with every response, the header is left out if empty
+	ContentSecurityPolicy string `default:"default-src 'none'; frame-ancestors 'none'"`
+
+	// origins allowed to call the api from browsers, e.g. https://example.com or * for any, and the methods
+	// they may use. Browsers keep to their same-origin policy if no origin is set.
+	CORSOrigins []string
+	CORSMethods []string `default:"GET,HEAD,POST,PATCH"`
+
+	// origins replacing CORSORIGINS for reads, i.e. GET and HEAD, and origins and methods replacing
+	// the global ones for every other method, e.g. to serve comments to any site but take them from one
+	CORSReadOrigins  []string
+	CORSWriteOrigins []string
+	CORSWriteMethods []string
+
+	// level of the logger, entries below it are dropped
+	LogLevel zapcore.Level `default:"info"`
+
+	// how log entries are encoded, json or console
+	LogFormat logFormat `default:"json"`
+
+	// level every completed request is logged at, set it below the logger's level,
+	// e.g. to debug, to stop logging requests
+	AccessLogLevel zapcore.Level `default:"info"`
+
+	// bearer token identifying admins, no request is treated as an admin's if empty
+	AdminToken string
+
+	// create the resource when a comment is added to an unknown key
+	// rather than responding with a 404
+	AutoCreateResources bool `default:"true"`
+
+	// create the comments bucket of a resource along with it rather than on its first saved comment,
+	// e.g. for deployments pre-provisioning their resources
+	EagerCommentsBucket bool
+
+	// replace invalid UTF-8 in comments with U+FFFD rather than rejecting the comment
+	SanitizeUTF8 bool
+
+	// store comments in unicode normalization form C, so that visually identical comments are stored alike
+	// whether their accents were sent composed or decomposed. Disable it to store the value as sent.
+	NormalizeUnicode bool `default:"true"`
+
+	// html tags comments may be formatted with, e.g. b,i,a,code, every other tag is stripped.
+	// Comments are plain text stripped of all html if empty.
+	AllowedHTMLTags htmlTags
+
+	// most words, separated by whitespace, a comment may have, longer ones are rejected with a 422.
+	// Any number is allowed if 0.
+	MaxCommentWords int
+
+	// spam score at or above which added and updated comments are hidden from the list, from 0 to 1.
+	// Comments are scored but never hidden if 0.
+	SpamThreshold float64
+
+	// words that mark a comment as likely spam, matched case-insensitively
+	SpamBlocklist []string
+
+	// what to do about a comment by the same author with the same value as a recent one, off, reject or collapse.
+	// Recent ones are among the last DUPLICATELOOKBACK comments added within the last DUPLICATEWINDOW,
+	// either bound is lifted if 0.
+	DuplicateMode     duplicateMode `default:"off"`
+	DuplicateLookback int           `default:"20"`
+	DuplicateWindow   time.Duration `default:"10m"`
+
+	// regular expression every comment must match, e.g. to reject urls, any comment is allowed if empty
+	CommentPattern pattern
+
+	// how the ids of new comments are generated, one of betterguid, ulid or uuid.
+	// Comments are listed in the order of their ids, which only ulid and betterguid follow.
+	IDScheme idScheme `default:"betterguid"`
+
+	// re-key the comments whose ids are not ulids to ulids of when they were created at startup,
+	// so that they are listed in the order they were added. Requires the ulid id scheme.
+	MigrateIDs bool
+
+	// the categories a comment can be tagged with, any category is allowed if empty
+	Categories []string `default:"question,review,spoiler"`
+
+	// hosts the urls of attachments must be on, any host is allowed if empty,
+	// and the most attachments a comment may have, any number if 0
+	AttachmentHosts []string
+	MaxAttachments  int `default:"5"`
+
+	// number of comments listed, or of audit entries, if the limit query parameter is not set, everything if 0,
+	// and the largest limit allowed, larger ones are cut down to it, any limit if 0
+	DefaultPageSize int
+	MaxPageSize     int `default:"500"`
+
+	// how lists are sent, wrapped in an object, e.g. {"comments":[...]}, or bare as a top-level array
+	// with their metadata, e.g. the total count, in headers only
+	ListEnvelope listEnvelope `default:"wrapped"`
+
+	// most comments a resource may have, further ones are rejected with a 409, any number if 0,
+	// and the percentage of it from which added comments are answered with a Warning header, never if 0
+	MaxCommentsPerResource int
+	CommentLimitWarning    int `default:"90"`
+
+	// most comments that can be got at once by id, more are rejected with a 400, any number if 0
+	MaxBulkGetIDs int `default:"100"`
+
+	// most comments a search reads, however few of them matched, so that it can't read a whole type, any number if 0
+	MaxSearchScan int `default:"10000"`
+
+	// most comments that can be pinned per resource, any number if 0
+	MaxPinnedComments int `default:"3"`
+
+	// blank out the comments of erased authors rather than removing them
+	SoftErase bool
+
+	// count all anonymous comments as one commenter rather than leaving them out of the count
+	CountAnonymousCommenters bool
+
+	// how often expired comments are removed, they are never removed but still hidden if 0
+	SweepInterval time.Duration `default:"1m"`
+
+	// how long deleted comments can be restored before the sweep purges them, they are kept if 0
+	TrashRetention time.Duration `default:"720h"`
+
+	// number of comments and comment lists kept in memory to spare reads from the db, the cache is disabled if 0
+	CacheSize int
+
+	// the longest a long-poll for new comments is held open, longer waits are cut down to it
+	MaxPollWait time.Duration `default:"30s"`
+}
+
+// pattern is a regular expression compiled once when the config is processed,
+// so that an invalid one fails the startup rather than the requests
+type pattern struct {
+	*regexp.Regexp
+}
+
+// Decode implements envconfig.Decoder
+func (p *pattern) Decode(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	p.Regexp = re
+	return nil
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// corsExposedHeaders are the response headers browsers let pages of other origins read,
+// besides the ones they always do, e.g. Last-Modified
+var corsExposedHeaders = []string{"ETag", "Warning", totalCountHeader}
+
+// corsPolicy is which origins may call the api from browsers, and with which methods
+type corsPolicy struct {
+	origins []string // * allows any
+	methods []string
+}
+
+// corsPolicies returns the policy of reads, i.e. GET and HEAD, and that of every other method.
+// Both are the global policy of CORSORIGINS and CORSMETHODS unless configured apart.
+func (cfg config) corsPolicies() (read, write corsPolicy) {
+	read = corsPolicy{origins: cfg.CORSOrigins, methods: cfg.CORSMethods}
+	write = read
+	if len(cfg.CORSReadOrigins) > 0 {
+		read.origins = cfg.CORSReadOrigins
+	}
+	if len(cfg.CORSWriteOrigins) > 0 {
+		write.origins = cfg.CORSWriteOrigins
+	}
+	if len(cfg.CORSWriteMethods) > 0 {
+		write.methods = cfg.CORSWriteMethods
+	}
+
+	return read, write
+}
+
+// allows reports whether the origin may make requests of the method
+func (p corsPolicy) allows(origin, method string) bool {
+	return anyFold(p.origins, origin) && anyFold(p.methods, method)
+}
+
+// anyFold reports whether any of the values is * or the given one, ignoring case
+func anyFold(values []string, value string) bool {
+	for _, v := range values {
+		if v == "*" || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cors answers the preflights of browsers and lets them share the responses of the api with the allowed origins,
+// following the read policy for GET, HEAD and bulk gets and the write policy for other methods, see corsPolicies.
+// Writes from other origins are refused with a 403 rather than only kept from the page, as browsers make some
+// of them without a preflight. Requests without an Origin, or from that of the service, are left alone,
+// and so is every request if no origin is configured.
+func (svc *service) cors(next http.Handler) http.Handler {
+	read, write := svc.cfg.corsPolicies()
+	if len(read.origins) == 0 && len(write.origins) == 0 {
+		return next
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Method
+		preflight := method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			method = r.Header.Get("Access-Control-Request-Method")
+		}
+
+		p, writes := write, true
+		if method == http.MethodGet || method == http.MethodHead || isBulkGet(method, r.URL.Path) {
+			p, writes = read, false
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !p.allows(origin, method) {
+			if preflight || writes {
+				svc.fail(w, svc.logger, errCORSNotAllowed.withArgs(origin, method), nil,
+					zap.String("origin", origin), zap.String("path", r.URL.Path))
+				return
+			}
+
+			// served as without CORS, the browser keeps the response from the page
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", origin)
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// sameOrigin reports whether the origin is that of the service, as browsers send it with some same-origin requests too
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
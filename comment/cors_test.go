@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_config_corsPolicies(t *testing.T) {
+	t.Parallel()
+
+	cfg := config{CORSOrigins: []string{"https://a.example"}, CORSMethods: []string{"GET", "POST"}}
+	read, write := cfg.corsPolicies()
+	assert.Equal(t, corsPolicy{origins: []string{"https://a.example"}, methods: []string{"GET", "POST"}}, read)
+	assert.Equal(t, read, write, "both should be the global policy unless configured apart")
+
+	cfg.CORSReadOrigins = []string{"*"}
+	cfg.CORSWriteMethods = []string{"POST", "DELETE"}
+	read, write = cfg.corsPolicies()
+	assert.Equal(t, corsPolicy{origins: []string{"*"}, methods: []string{"GET", "POST"}}, read)
+	assert.Equal(t, corsPolicy{origins: []string{"https://a.example"}, methods: []string{"POST", "DELETE"}}, write)
+}
+
+func Test_service_cors(t *testing.T) {
+	t.Parallel()
+
+	split := config{
+		CORSOrigins:      []string{"https://site.example"},
+		CORSMethods:      []string{"GET", "HEAD", "POST", "PATCH"},
+		CORSReadOrigins:  []string{"*"},
+		CORSWriteOrigins: []string{"https://site.example"},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config
+		method     string
+		origin     string
+		preflight  string // the method asked for in the preflight
+		pass       bool
+		wantCode   int
+		wantOrigin string
+		wantBody   string
+	}{
+		{
+			name:   "it leaves every request alone if no origin is configured",
+			method: http.MethodDelete,
+			origin: "https://other.example",
+			pass:   true,
+		},
+		{
+			name:   "it leaves requests without an origin alone",
+			cfg:    split,
+			method: http.MethodDelete,
+			pass:   true,
+		},
+		{
+			name:   "it leaves requests from the origin of the service alone",
+			cfg:    split,
+			method: http.MethodDelete,
+			origin: "https://example.com",
+			pass:   true,
+		},
+		{
+			name:       "it shares reads with any origin allowed to read",
+			cfg:        split,
+			method:     http.MethodGet,
+			origin:     "https://other.example",
+			pass:       true,
+			wantOrigin: "https://other.example",
+		},
+		{
+			name:       "it shares writes with the origins allowed to write",
+			cfg:        split,
+			method:     http.MethodPost,
+			origin:     "https://site.example",
+			pass:       true,
+			wantOrigin: "https://site.example",
+		},
+		{
+			name:     "it refuses writes from origins only allowed to read",
+			cfg:      split,
+			method:   http.MethodPost,
+			origin:   "https://other.example",
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errCORSNotAllowed.withArgs("https://other.example", http.MethodPost)),
+		},
+		{
+			name:     "it refuses methods that are not allowed, even to allowed origins",
+			cfg:      split,
+			method:   http.MethodDelete,
+			origin:   "https://site.example",
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errCORSNotAllowed.withArgs("https://site.example", http.MethodDelete)),
+		},
+		{
+			name:   "it serves reads to other origins without sharing them",
+			cfg:    config{CORSOrigins: []string{"https://site.example"}, CORSMethods: []string{"GET"}},
+			method: http.MethodGet,
+			origin: "https://other.example",
+			pass:   true,
+		},
+		{
+			name:       "it answers allowed preflights itself",
+			cfg:        split,
+			method:     http.MethodOptions,
+			origin:     "https://site.example",
+			preflight:  http.MethodPatch,
+			wantCode:   http.StatusNoContent,
+			wantOrigin: "https://site.example",
+		},
+		{
+			name:      "it refuses preflights of methods that are not allowed",
+			cfg:       split,
+			method:    http.MethodOptions,
+			origin:    "https://other.example",
+			preflight: http.MethodDelete,
+			wantCode:  http.StatusForbidden,
+			wantBody:  buildErrResp(errCORSNotAllowed.withArgs("https://other.example", http.MethodDelete)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: tt.cfg}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			r := httptest.NewRequest(tt.method, "/v1/posts/my-key/comments", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.preflight)
+				r.Header.Set("Access-Control-Request-Headers", "content-type, x-user-id")
+			}
+			w := httptest.NewRecorder()
+
+			svc.cors(http.HandlerFunc(fn)).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.pass, passed)
+			assert.Equal(t, tt.wantOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			if tt.wantCode != 0 {
+				assert.Equal(t, tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.preflight != "" && tt.wantCode == http.StatusNoContent {
+				assert.Equal(t, "GET, HEAD, POST, PATCH", w.Header().Get("Access-Control-Allow-Methods"))
+				assert.Equal(t, "content-type, x-user-id", w.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
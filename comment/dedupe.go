@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// errDedupeKeyTaken is returned by addOnce if the resource has a comment with the same dedupe key
+var errDedupeKeyTaken = errors.New(commentExistsErr)
+
+// createOnly reports whether the request asks to add the comment only if none with its dedupe key exists,
+// i.e. sends If-None-Match: *. Other values of the header can't match a comment that isn't added yet.
+func createOnly(r *http.Request) bool {
+	return strings.TrimSpace(r.Header.Get("If-None-Match")) == "*"
+}
+
+// addOnce adds the comment unless the resource has a live comment with the same dedupe key. The comments are
+// checked in the transaction adding the comment, so that of concurrent adds with the same key only one succeeds.
+func (cm *commentable) addOnce(c *comment) (*comment, error) {
+	return cm.addIf(c, func(comments *bolt.Bucket) error {
+		now := time.Now()
+		return comments.ForEach(func(_, v []byte) error {
+			var stored comment
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+
+			// expired comments are gone even before they are swept
+			if stored.DedupeKey == c.DedupeKey && !stored.expired(now) {
+				return errDedupeKeyTaken
+			}
+
+			return nil
+		})
+	})
+}
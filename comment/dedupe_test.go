@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_commentable_addOnce(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, setup(db, []string{"posts"}))
+	assert.NoError(t, cm.ensure())
+
+	past := time.Now().Add(-time.Minute)
+	_, err := cm.add(&comment{Value: "gone", DedupeKey: "expired", ExpiresAt: &past})
+	assert.NoError(t, err)
+
+	first, err := cm.addOnce(&comment{Value: "hello", DedupeKey: "abc"})
+	assert.NoError(t, err)
+	assert.NotNil(t, first)
+
+	_, err = cm.addOnce(&comment{Value: "hello again", DedupeKey: "abc"})
+	assert.Equal(t, errDedupeKeyTaken, err)
+
+	_, err = cm.addOnce(&comment{Value: "hello", DedupeKey: "def"})
+	assert.NoError(t, err, "other dedupe keys should not be taken")
+
+	_, err = cm.addOnce(&comment{Value: "back", DedupeKey: "expired"})
+	assert.NoError(t, err, "the dedupe keys of expired comments should not be taken")
+
+	// the expired comment is left out of the list
+	cmts, err := cm.list()
+	assert.NoError(t, err)
+	var keys []string
+	for _, c := range cmts {
+		keys = append(keys, c.DedupeKey)
+	}
+	assert.Equal(t, []string{"abc", "def", "expired"}, keys)
+}
+
+func Test_service_handleAdd_ifNoneMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		dedupeKey   string
+		wantCode    int
+		wantBody    string
+		wantCount   int
+	}{
+		{
+			name:      "it adds the comment again without If-None-Match",
+			dedupeKey: "abc",
+			wantCode:  http.StatusOK,
+			wantCount: 2,
+		},
+		{
+			name:        "it rejects the comment if one with the same dedupe key exists",
+			ifNoneMatch: "*",
+			dedupeKey:   "abc",
+			wantCode:    http.StatusPreconditionFailed,
+			wantBody:    buildErrResp(errCommentExists),
+			wantCount:   1,
+		},
+		{
+			name:        "it adds the comment if the dedupe key differs",
+			ifNoneMatch: "*",
+			dedupeKey:   "def",
+			wantCode:    http.StatusOK,
+			wantCount:   2,
+		},
+		{
+			name:        "it requires a dedupe key with If-None-Match",
+			ifNoneMatch: "*",
+			wantCode:    http.StatusPreconditionRequired,
+			wantBody:    buildErrResp(errCommentDedupeKeyRequired),
+			wantCount:   1,
+		},
+		{
+			name:        "it ignores If-None-Match with an etag",
+			ifNoneMatch: `"abc"`,
+			dedupeKey:   "abc",
+			wantCode:    http.StatusOK,
+			wantCount:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+			assert.NoError(t, setup(db, []string{"posts"}))
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			add := func(ifNoneMatch, dedupeKey string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", bytes.NewBufferString(`{"value": "first!"}`))
+				r.Header.Set(userIDHeader, "jane") // the dedupe key is only sent back to the author
+				if ifNoneMatch != "" {
+					r.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				if dedupeKey != "" {
+					r.Header.Set(dedupeKeyHeader, dedupeKey)
+				}
+				mux.ServeHTTP(w, r)
+				return w
+			}
+
+			first := &comment{}
+			assert.NoError(t, json.Unmarshal(add("*", "abc").Body.Bytes(), first))
+			assert.Equal(t, "abc", first.DedupeKey)
+
+			w := add(tt.ifNoneMatch, tt.dedupeKey)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+
+			cmts, err := (&commentable{db: db, kind: "posts", key: "my-key"}).list()
+			assert.NoError(t, err)
+			assert.Len(t, cmts, tt.wantCount)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// startDraining makes drain reject all further requests, to be called once the shutdown starts
+func (svc *service) startDraining() {
+	atomic.StoreInt32(&svc.draining, 1)
+}
+
+// drain rejects requests with a 503 once the service is shutting down, while requests that
+// arrived before keep being served. The connection is closed so that clients, e.g. load balancers,
+// send their retries to another instance rather than down the same connection. The probes are left
+// to answer for themselves, see handleReadyz.
+func (svc *service) drain(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&svc.draining) == 1 && !isProbe(r) {
+			w.Header().Set("Connection", "close")
+			svc.fail(w, svc.logger, errServiceShuttingDown, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_drain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		draining bool
+		wantCode int
+	}{
+		{
+			name:     "it serves requests while running",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it rejects requests while shutting down",
+			draining: true,
+			wantCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(nil, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+			if tt.draining {
+				svc.startDraining()
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.draining {
+				assert.Equal(t, "close", w.Header().Get("Connection"))
+				assert.Equal(t, buildErrResp(errServiceShuttingDown), w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	duplicateOff      = "off"      // add duplicate comments like any other
+	duplicateReject   = "reject"   // reject them with a 409
+	duplicateCollapse = "collapse" // respond with the earlier comment instead of adding another
+)
+
+// duplicateMode is what handleAdd does about a comment that duplicates a recent one
+type duplicateMode string
+
+// Decode implements envconfig.Decoder so that an unknown mode fails the startup
+func (m *duplicateMode) Decode(value string) error {
+	switch value {
+	case duplicateOff, duplicateReject, duplicateCollapse:
+		*m = duplicateMode(value)
+	default:
+		return fmt.Errorf("unknown duplicate mode %q, expected one of %s, %s or %s",
+			value, duplicateOff, duplicateReject, duplicateCollapse)
+	}
+
+	return nil
+}
+
+// findDuplicate returns the recent comment on the resource that the given one duplicates, nil if there is none
+func (svc *service) findDuplicate(c *commentable, co *comment, now time.Time) (*comment, error) {
+	cmts, err := svc.listAllComments(c)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := svc.config()
+	return duplicateOf(cmts, co, cfg.DuplicateLookback, cfg.DuplicateWindow, now), nil
+}
+
+// duplicateOf returns the most recent of the comments by the same author with the same value as co,
+// ignoring surrounding whitespace, among the last lookback comments added within window before now.
+// Either bound is lifted if 0. Comments without a creation time are the oldest and never within a window.
+func duplicateOf(cmts []*comment, co *comment, lookback int, window time.Duration, now time.Time) *comment {
+	recent := make([]*comment, len(cmts))
+	copy(recent, cmts)
+	sort.SliceStable(recent, func(i, j int) bool {
+		a, b := recent[i].CreatedAt, recent[j].CreatedAt
+		return a != nil && (b == nil || a.After(*b))
+	})
+
+	if lookback > 0 && len(recent) > lookback {
+		recent = recent[:lookback]
+	}
+
+	value := strings.TrimSpace(co.Value)
+	for _, c := range recent {
+		if window > 0 && (c.CreatedAt == nil || c.CreatedAt.Before(now.Add(-window))) {
+			break // the rest are older still
+		}
+
+		if c.Author == co.Author && strings.TrimSpace(c.Value) == value {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_duplicateMode_Decode(t *testing.T) {
+	t.Parallel()
+
+	var m duplicateMode
+	assert.NoError(t, m.Decode(duplicateCollapse))
+	assert.Equal(t, duplicateMode(duplicateCollapse), m)
+	assert.EqualError(t, m.Decode("drop"), `unknown duplicate mode "drop", expected one of off, reject or collapse`)
+}
+
+func Test_duplicateOf(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time { t := now.Add(-d); return &t }
+
+	// listed in id order, which needn't be the order they were added in
+	older := &comment{ID: "1", Value: "same", Author: "jane", CreatedAt: ago(10 * time.Minute)}
+	other := &comment{ID: "2", Value: "other", Author: "jane", CreatedAt: ago(time.Minute)}
+	byJohn := &comment{ID: "3", Value: "same", Author: "john", CreatedAt: ago(2 * time.Minute)}
+	undated := &comment{ID: "4", Value: "undated", Author: "jane"}
+	cmts := []*comment{other, older, undated, byJohn}
+
+	tests := []struct {
+		name     string
+		value    string
+		author   string
+		lookback int
+		window   time.Duration
+		want     *comment
+	}{
+		{
+			name:   "it finds a comment by the same author with the same value",
+			value:  "same",
+			author: "jane",
+			want:   older,
+		},
+		{
+			name:   "it ignores surrounding whitespace",
+			value:  "  same\n",
+			author: "john",
+			want:   byJohn,
+		},
+		{
+			name:   "it does not take comments by other authors for duplicates",
+			value:  "other",
+			author: "john",
+		},
+		{
+			name:   "it finds a comment added right at the start of the window",
+			value:  "same",
+			author: "jane",
+			window: 10 * time.Minute,
+			want:   older,
+		},
+		{
+			name:   "it does not find a comment added before the window",
+			value:  "same",
+			author: "jane",
+			window: 10*time.Minute - time.Millisecond,
+		},
+		{
+			name:     "it finds the last of the comments within the lookback",
+			value:    "same",
+			author:   "jane",
+			lookback: 3,
+			want:     older,
+		},
+		{
+			name:     "it does not find comments beyond the lookback",
+			value:    "same",
+			author:   "jane",
+			lookback: 2,
+		},
+		{
+			name:   "it finds comments without a creation time only without a window",
+			value:  "undated",
+			author: "jane",
+			want:   undated,
+		},
+		{
+			name:   "it never finds comments without a creation time within a window",
+			value:  "undated",
+			author: "jane",
+			window: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			co := &comment{Value: tt.value, Author: tt.author}
+			assert.Equal(t, tt.want, duplicateOf(cmts, co, tt.lookback, tt.window, now))
+		})
+	}
+}
+
+func Test_service_handleAdd_duplicate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mode       duplicateMode
+		wantCode   int
+		wantBody   string
+		wantSame   bool
+		wantCount  int
+		wantLogged string
+	}{
+		{
+			name:      "it adds duplicates if off",
+			mode:      duplicateOff,
+			wantCode:  http.StatusOK,
+			wantCount: 2,
+		},
+		{
+			name:       "it rejects duplicates if configured to",
+			mode:       duplicateReject,
+			wantCode:   http.StatusConflict,
+			wantBody:   buildErrResp(errCommentDuplicate),
+			wantCount:  1,
+			wantLogged: commentDuplicateErr,
+		},
+		{
+			name:       "it responds with the earlier comment if configured to collapse duplicates",
+			mode:       duplicateCollapse,
+			wantCode:   http.StatusOK,
+			wantSame:   true,
+			wantCount:  1,
+			wantLogged: "collapsed a duplicate comment into the earlier one",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+			assert.NoError(t, setup(db, []string{"posts"}))
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			cfg := testConfig()
+			cfg.DuplicateMode = tt.mode
+			mux := chi.NewRouter()
+			svc := newService(db, zap.New(core), cfg)
+			svc.registerRoutes(mux)
+
+			add := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", bytes.NewBufferString(`{"value": "first!"}`))
+				r.Header.Set(userIDHeader, "jane")
+				mux.ServeHTTP(w, r)
+				return w
+			}
+
+			first := &comment{}
+			assert.NoError(t, json.Unmarshal(add().Body.Bytes(), first))
+
+			w := add()
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+
+			if tt.wantCode == http.StatusOK {
+				second := &comment{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), second))
+				assert.Equal(t, tt.wantSame, first.ID == second.ID)
+			}
+
+			cmts, err := (&commentable{db: db, kind: "posts", key: "my-key"}).list()
+			assert.NoError(t, err)
+			assert.Len(t, cmts, tt.wantCount)
+
+			if tt.wantLogged != "" {
+				entries := logs.FilterMessage(tt.wantLogged).All()
+				if assert.Len(t, entries, 1) {
+					assert.Equal(t, string(tt.mode), entries[0].ContextMap()["duplicate_mode"])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// handleEraseAuthor erases the comments of an author, e.g. to comply with a deletion request.
+// The comments are removed, or blanked out if the service is configured to erase softly.
+func (svc *service) handleEraseAuthor(w http.ResponseWriter, r *http.Request) {
+	author := chi.URLParam(r, authorParam)
+	l := svc.logger.With(zap.String(authorParam, author), zap.Bool("soft", svc.cfg.SoftErase))
+
+	var n int
+	var err error
+	for _, db := range svc.dbs() {
+		var affected int
+		affected, err = eraseAuthor(db, author, svc.cfg.SoftErase)
+		n += affected
+		if err != nil {
+			break
+		}
+	}
+	// the author may have commented anywhere
+	svc.cache.clear()
+	if err != nil {
+		svc.fail(w, l, errAuthorErase, err, zap.Int("affected", n))
+		return
+	}
+
+	l.Info("erased comments of author", zap.Int("affected", n))
+	svc.respondWithPayload(w, struct {
+		Affected int `json:"affected"`
+	}{n}, http.StatusOK)
+}
+
+// eraseAuthor erases the comments of the author across all commentables, and the author from the audit
+// trail, see redactAudit, and returns how many comments were affected.
+// Each commentable is erased in its own transaction so that a prolific author does not
+// lock the db for one giant write, which means that a failure can leave the erasure partially done.
+func eraseAuthor(db *bolt.DB, author string, soft bool) (int, error) {
+	cms, err := commentablesOf(db, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int
+	for _, cm := range cms {
+		n, err := cm.eraseAuthor(author, soft)
+		affected += n
+		if err != nil {
+			return affected, err
+		}
+	}
+
+	_, err = redactAudit(db, author)
+	return affected, err
+}
+
+// eraseAuthor removes the comments of the author on the commentable, or blanks out their value,
+// author, tags, mentions, attachments and dedupe key if soft. The author is also cleared as the editor of other comments.
+// Trashed comments of the author are always removed.
+func (cm *commentable) eraseAuthor(author string, soft bool) (int, error) {
+	var affected int
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		affected = 0
+
+		cmBucket := tx.Bucket([]byte(cm.kind))
+		if cmBucket == nil {
+			return nil
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key))
+		if rBucket == nil {
+			return nil
+		}
+
+		if trash := rBucket.Bucket(trashKey); trash != nil {
+			n, err := removeWhere(trash, func(c *comment) bool { return c.Author == author })
+			affected += n
+			if err != nil {
+				return err
+			}
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return nil
+		}
+
+		// the bucket can't be modified while iterating over it so the changes are collected first
+		updates := map[string]*comment{}
+		var removals []string
+		err := comments.ForEach(func(id, data []byte) error {
+			var c comment
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+
+			switch {
+			case c.Author == author && !soft:
+				removals = append(removals, string(id))
+			case c.Author == author:
+				c.Value, c.Author, c.Tags = "", "", nil
+				c.Mentions = nil // found in the value, they can tell who the author talked to
+				c.Attachments, c.DedupeKey = nil, ""
+				if c.EditedBy == author {
+					c.EditedBy = ""
+				}
+				updates[string(id)] = &c
+			case c.EditedBy == author:
+				// not counted as the comment is someone else's
+				c.EditedBy = ""
+				updates[string(id)] = &c
+				return nil
+			default:
+				return nil
+			}
+
+			affected++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range removals {
+			if err = comments.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		for id, c := range updates {
+			c.UpdatedAt = &now
+			c.Version++
+
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+
+			if err = comments.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return affected, err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupAuthors adds comments by jane and john to a book and an author
+func setupAuthors(t *testing.T, db *bolt.DB) (books, authors *commentable) {
+	err := setup(db, []string{"books", "authors"})
+	assert.NoError(t, err)
+
+	books = &commentable{db: db, kind: "books", key: "1"}
+	authors = &commentable{db: db, kind: "authors", key: "1"}
+	for _, cm := range []*commentable{books, authors, {db: db, kind: "books", key: "2"}} {
+		assert.NoError(t, cm.ensure())
+	}
+
+	_, err = books.add(&comment{Value: "by jane @john", Author: "jane", Tags: []string{"go"}, Mentions: []string{"john"},
+		Attachments: []string{"https://img.example.com/jane.png"}, DedupeKey: "jane-1"})
+	assert.NoError(t, err)
+	_, err = books.add(&comment{Value: "by john", Author: "john", EditedBy: "jane"})
+	assert.NoError(t, err)
+	_, err = authors.add(&comment{Value: "also by jane", Author: "jane"})
+	assert.NoError(t, err)
+
+	return books, authors
+}
+
+func Test_eraseAuthor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		author       string
+		soft         bool
+		wantAffected int
+		wantBooks    []string // the values and authors of the remaining comments
+		wantAuthors  []string
+	}{
+		{
+			name:         "it removes the comments of the author",
+			author:       "jane",
+			wantAffected: 2,
+			wantBooks:    []string{"by john/john"},
+			wantAuthors:  []string{},
+		},
+		{
+			name:         "it blanks out the comments of the author if soft",
+			author:       "jane",
+			soft:         true,
+			wantAffected: 2,
+			wantBooks:    []string{"/", "by john/john"},
+			wantAuthors:  []string{"/"},
+		},
+		{
+			name:        "it affects nothing if the author has no comments",
+			author:      "jim",
+			wantBooks:   []string{"by jane @john/jane", "by john/john"},
+			wantAuthors: []string{"also by jane/jane"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			books, authors := setupAuthors(t, db)
+
+			affected, err := eraseAuthor(db, tt.author, tt.soft)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAffected, affected)
+
+			for cm, want := range map[*commentable][]string{books: tt.wantBooks, authors: tt.wantAuthors} {
+				cmts, err := cm.list()
+				assert.NoError(t, err)
+
+				got := []string{}
+				for _, c := range cmts {
+					got = append(got, c.Value+"/"+c.Author)
+					if tt.author == "jane" {
+						assert.Empty(t, c.EditedBy, "the author should be cleared as editor")
+					}
+					if c.Author == "" {
+						assert.Empty(t, c.Tags)
+						assert.Empty(t, c.Mentions, "the mentions should be blanked out along with the value")
+						assert.Empty(t, c.Attachments)
+						assert.Empty(t, c.DedupeKey)
+					}
+				}
+				assert.ElementsMatch(t, want, got)
+			}
+		})
+	}
+}
+
+func Test_eraseAuthor_trash(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	books, _ := setupAuthors(t, db)
+	c, err := books.add(&comment{Value: "deleted by jane", Author: "jane"})
+	assert.NoError(t, err)
+	assert.NoError(t, books.remove(c.ID, caller{id: "jane"}))
+
+	affected, err := eraseAuthor(db, "jane", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, affected)
+
+	_, err = books.restore(c.ID, caller{admin: true})
+	assert.Equal(t, errNotInTrash, err, "trashed comments of the author should be removed even if soft")
+}
+
+func Test_eraseAuthor_audit(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	books, _ := setupAuthors(t, db)
+	own, err := books.add(&comment{Value: "deleted by jane", Author: "jane"})
+	assert.NoError(t, err)
+	assert.NoError(t, books.remove(own.ID, caller{id: "jane", ip: "203.0.113.7"}))
+
+	moderated, err := books.add(&comment{Value: "moderated", Author: "jane"})
+	assert.NoError(t, err)
+	assert.NoError(t, books.remove(moderated.ID, caller{id: "mod", admin: true, ip: "198.51.100.1"}))
+
+	other, err := books.add(&comment{Value: "by john", Author: "john"})
+	assert.NoError(t, err)
+	assert.NoError(t, books.remove(other.ID, caller{id: "mod", admin: true, ip: "198.51.100.1"}))
+
+	_, err = eraseAuthor(db, "jane", false)
+	assert.NoError(t, err)
+
+	entries, err := recentAudit(db, 0)
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 3, "the entries should be redacted rather than removed") {
+		return
+	}
+
+	// the most recent first
+	assert.Equal(t, "mod", entries[0].Actor, "the changes to comments of others should be kept as they were")
+	assert.Contains(t, string(entries[0].Comment), "by john")
+
+	assert.Equal(t, "mod", entries[1].Actor)
+	assert.Equal(t, "198.51.100.1", entries[1].IP)
+	assert.Equal(t, "null", string(entries[1].Comment), "the comments of the author should be cleared")
+
+	assert.Empty(t, entries[2].Actor, "the author should be cleared as the actor")
+	assert.Empty(t, entries[2].IP)
+	assert.Equal(t, "null", string(entries[2].Comment))
+	assert.Equal(t, auditActionDelete, entries[2].Action)
+}
+
+func Test_service_handleEraseAuthor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:     "it does not erase the comments if the caller is not an admin",
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errForbidden),
+		},
+		{
+			name:       "it erases the comments of the author",
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"affected":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			setupAuthors(t, db)
+
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/admin/authors/%s", "jane"), nil)
+			r.Header.Set("Authorization", tt.authHeader)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+// apiError describes a failure mode as the client sees it.
+// Handlers respond with and log the same apiError so that both always line up.
+type apiError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// the failure modes of the service and how each one is reported to clients
+var (
+	errCommentInvalid           = apiError{http.StatusBadRequest, "COMMENT_INVALID", commentIsInvalid}
+	errCommentEmpty             = apiError{http.StatusUnprocessableEntity, "COMMENT_EMPTY", commentEmptyErr}
+	errCommentNotFound          = apiError{http.StatusNotFound, "COMMENT_NOT_FOUND", commentNotFoundErr}
+	errCommentList              = apiError{http.StatusInternalServerError, "COMMENT_LIST_FAILED", commentListErr}
+	errCommentSave              = apiError{http.StatusInternalServerError, "COMMENT_SAVE_FAILED", commentSaveErr}
+	errCommentDelete            = apiError{http.StatusInternalServerError, "COMMENT_DELETE_FAILED", commentDeleteErr}
+	errCommentClear             = apiError{http.StatusInternalServerError, "COMMENT_CLEAR_FAILED", commentClearErr}
+	errCommentRestore           = apiError{http.StatusInternalServerError, "COMMENT_RESTORE_FAILED", commentRestoreErr}
+	errCommentNotInTrash        = apiError{http.StatusNotFound, "COMMENT_NOT_IN_TRASH", commentNotInTrashErr}
+	errCommentRestoreConflict   = apiError{http.StatusConflict, "COMMENT_RESTORE_CONFLICT", commentRestoreConflictErr}
+	errCommentMove              = apiError{http.StatusInternalServerError, "COMMENT_MOVE_FAILED", commentMoveErr}
+	errCommentMoveInvalid       = apiError{http.StatusBadRequest, "COMMENT_MOVE_INVALID", commentMoveInvalidErr}
+	errCommentMoveConflict      = apiError{http.StatusConflict, "COMMENT_MOVE_CONFLICT", commentMoveConflictErr}
+	errCommentInvalidUTF8       = apiError{http.StatusBadRequest, "COMMENT_INVALID_UTF8", commentInvalidUTF8Err}
+	errCommentExpiryInvalid     = apiError{http.StatusUnprocessableEntity, "COMMENT_EXPIRY_INVALID", commentExpiryInvalidErr}
+	errCommentPatternMismatch   = apiError{http.StatusUnprocessableEntity, "COMMENT_PATTERN_MISMATCH", commentPatternMismatchErr}
+	errCommentCategoryInvalid   = apiError{http.StatusUnprocessableEntity, "COMMENT_CATEGORY_INVALID", commentCategoryInvalidFmt}
+	errCommentVisibilityInvalid = apiError{http.StatusUnprocessableEntity, "COMMENT_VISIBILITY_INVALID", commentVisibilityInvalidFmt}
+	errCommentSinceInvalid      = apiError{http.StatusBadRequest, "COMMENT_SINCE_INVALID", commentSinceInvalidFmt}
+	errCommentWaitInvalid       = apiError{http.StatusBadRequest, "COMMENT_WAIT_INVALID", commentWaitInvalidFmt}
+	errCommentVersionRequired   = apiError{http.StatusPreconditionRequired, "COMMENT_VERSION_REQUIRED", commentVersionRequiredErr}
+	errCommentVersionConflict   = apiError{http.StatusConflict, "COMMENT_VERSION_CONFLICT", commentVersionConflictErr}
+	errCommentableSave          = apiError{http.StatusNotAcceptable, "COMMENTABLE_SAVE_FAILED", commentableSaveErr}
+	errCommentableNotFound      = apiError{http.StatusNotFound, "COMMENTABLE_NOT_FOUND", commentableNotFoundFmt}
+	errCommentableKeyInvalid    = apiError{http.StatusBadRequest, "COMMENTABLE_KEY_INVALID", commentableKeyInvalidFmt}
+	errCommentableTypeNotFound  = apiError{http.StatusNotAcceptable, "COMMENTABLE_TYPE_NOT_FOUND", commentableTypeNotFoundFmt}
+	errAuditList                = apiError{http.StatusInternalServerError, "AUDIT_LIST_FAILED", auditListErr}
+	errAuditLimitInvalid        = apiError{http.StatusBadRequest, "AUDIT_LIMIT_INVALID", auditLimitInvalidFmt}
+	errAuthorErase              = apiError{http.StatusInternalServerError, "AUTHOR_ERASE_FAILED", authorEraseErr}
+	errForbidden                = apiError{http.StatusForbidden, "FORBIDDEN", forbiddenErr}
+	errSnapshotExport           = apiError{http.StatusInternalServerError, "SNAPSHOT_EXPORT_FAILED", snapshotExportErr}
+	errSnapshotImport           = apiError{http.StatusInternalServerError, "SNAPSHOT_IMPORT_FAILED", snapshotImportErr}
+	errSnapshotInvalid          = apiError{http.StatusBadRequest, "SNAPSHOT_INVALID", snapshotInvalidErr}
+	errSnapshotStructure        = apiError{http.StatusUnprocessableEntity, "SNAPSHOT_STRUCTURE_INVALID", snapshotStructureFmt}
+	errServiceReadOnly          = apiError{http.StatusServiceUnavailable, "READ_ONLY", serviceReadOnlyErr}
+	errDBUnavailable            = apiError{http.StatusServiceUnavailable, "DB_UNAVAILABLE", dbUnavailableErr}
+	errServiceShuttingDown      = apiError{http.StatusServiceUnavailable, "SHUTTING_DOWN", serviceShuttingDownErr}
+	errCORSNotAllowed           = apiError{http.StatusForbidden, "CORS_NOT_ALLOWED", corsNotAllowedFmt}
+	errTrendingList             = apiError{http.StatusInternalServerError, "TRENDING_LIST_FAILED", trendingListErr}
+	errTrendingWindowInvalid    = apiError{http.StatusBadRequest, "TRENDING_WINDOW_INVALID", trendingWindowInvalidFmt}
+	errSearch                   = apiError{http.StatusInternalServerError, "SEARCH_FAILED", searchErr}
+	errSearchQueryMissing       = apiError{http.StatusBadRequest, "SEARCH_QUERY_MISSING", searchQueryMissingErr}
+	errCommentStatsByInvalid    = apiError{http.StatusBadRequest, "COMMENT_STATS_BY_INVALID", commentStatsByInvalidFmt}
+	errCommentPin               = apiError{http.StatusInternalServerError, "COMMENT_PIN_FAILED", commentPinErr}
+	errCommentPinLimit          = apiError{http.StatusUnprocessableEntity, "COMMENT_PIN_LIMIT", commentPinLimitFmt}
+	errCommentUnhide            = apiError{http.StatusInternalServerError, "COMMENT_UNHIDE_FAILED", commentUnhideErr}
+	errCommentTooManyWords      = apiError{http.StatusUnprocessableEntity, "COMMENT_TOO_MANY_WORDS", commentTooManyWordsFmt}
+	errCommentFieldsInvalid     = apiError{http.StatusBadRequest, "COMMENT_FIELDS_INVALID", commentFieldsInvalidErr}
+	errCommentDuplicate         = apiError{http.StatusConflict, "COMMENT_DUPLICATE", commentDuplicateErr}
+	errCommentLimitReached      = apiError{http.StatusConflict, "COMMENT_LIMIT_REACHED", commentLimitFmt}
+	errCommentBulkInvalid       = apiError{http.StatusBadRequest, "COMMENT_BULK_INVALID", commentBulkInvalidErr}
+	errCommentBulkLimit         = apiError{http.StatusBadRequest, "COMMENT_BULK_LIMIT", commentBulkLimitFmt}
+	errCommentExists            = apiError{http.StatusPreconditionFailed, "COMMENT_EXISTS", commentExistsErr}
+	errCommentDedupeKeyRequired = apiError{http.StatusPreconditionRequired, "COMMENT_DEDUPE_KEY_REQUIRED", commentDedupeKeyRequiredErr}
+	errOverview                 = apiError{http.StatusInternalServerError, "OVERVIEW_FAILED", overviewErr}
+	errCommentValidation        = apiError{http.StatusUnprocessableEntity, "VALIDATION", commentValidationErr}
+	errCommentLimitInvalid      = apiError{http.StatusBadRequest, "COMMENT_LIMIT_INVALID", commentLimitInvalidFmt}
+	errCommentOffsetInvalid     = apiError{http.StatusBadRequest, "COMMENT_OFFSET_INVALID", commentOffsetInvalidFmt}
+	errCommentAttachmentInvalid = apiError{http.StatusUnprocessableEntity, "COMMENT_ATTACHMENT_INVALID", commentAttachmentInvalidFmt}
+	errCommentAttachmentHost    = apiError{http.StatusUnprocessableEntity, "COMMENT_ATTACHMENT_HOST_NOT_ALLOWED", commentAttachmentHostFmt}
+	errCommentAttachmentLimit   = apiError{http.StatusUnprocessableEntity, "COMMENT_ATTACHMENT_LIMIT", commentAttachmentLimitFmt}
+)
+
+// withArgs formats the message of errors whose message is a format string
+func (e apiError) withArgs(args ...interface{}) apiError {
+	e.Message = fmt.Sprintf(e.Message, args...)
+	return e
+}
+
+// fail responds with the given error and logs it along with its cause under the same message.
+// Failures of the db itself, see isDBUnavailable, are reported as errDBUnavailable instead so that
+// clients know to retry, e.g. against another instance.
+func (svc *service) fail(w http.ResponseWriter, l *zap.Logger, e apiError, cause error, fields ...zap.Field) {
+	if isDBUnavailable(cause) {
+		e = errDBUnavailable
+	}
+
+	svc.respondWithError(w, e)
+
+	fields = append(fields, zap.Error(cause))
+	if e.status >= http.StatusInternalServerError {
+		l.Error(e.Message, fields...)
+	} else {
+		l.Warn(e.Message, fields...)
+	}
+}
+
+// isDBUnavailable tells whether the db could not be used at all, i.e. it is closed or its file is locked by
+// another process. Neither passes by retrying the operation within the service, bolt runs writes one at
+// a time without ever timing out, but another instance may still serve the request.
+func isDBUnavailable(err error) bool {
+	return err == bolt.ErrTimeout || err == bolt.ErrDatabaseNotOpen
+}
+
+func (svc *service) respondWithError(w http.ResponseWriter, e apiError) {
+	payload := struct {
+		Error apiError `json:"error"`
+	}{e}
+
+	svc.respondWithPayload(w, payload, e.status)
+}
+
+// failFields responds with the error along with the fields of the payload that failed
+// the validation, either a schemaError or a validationError, and logs them
+func (svc *service) failFields(w http.ResponseWriter, l *zap.Logger, e apiError, fields error) {
+	payload := struct {
+		Error struct {
+			apiError
+			Fields error `json:"fields"`
+		} `json:"error"`
+	}{}
+	payload.Error.apiError = e
+	payload.Error.Fields = fields
+
+	svc.respondWithPayload(w, payload, e.status)
+	l.Warn(e.Message, zap.Error(fields))
+}
+
+// failNotFound responds with the error along with which of the type and the resource exist, and logs it
+func (svc *service) failNotFound(w http.ResponseWriter, l *zap.Logger, e apiError, found existence, fields ...zap.Field) {
+	payload := struct {
+		Error struct {
+			apiError
+			existence
+		} `json:"error"`
+	}{}
+	payload.Error.apiError = e
+	payload.Error.existence = found
+
+	svc.respondWithPayload(w, payload, e.status)
+	l.Warn(e.Message, append(fields, zap.Bool("type_exists", found.TypeExists))...)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_fail(t *testing.T) {
+	t.Parallel()
+
+	e := apiError{http.StatusInternalServerError, "SOMETHING_FAILED", "something went wrong"}
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "it responds with 503 if the db is locked",
+			err:      bolt.ErrTimeout,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: buildErrResp(errDBUnavailable),
+		},
+		{
+			name:     "it responds with 503 if the db is not open",
+			err:      bolt.ErrDatabaseNotOpen,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: buildErrResp(errDBUnavailable),
+		},
+		{
+			name:     "it responds with the given error for other causes",
+			err:      fmt.Errorf("some error"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: buildErrResp(e),
+		},
+		{
+			name:     "it responds with the given error if there is no cause",
+			wantCode: http.StatusInternalServerError,
+			wantBody: buildErrResp(e),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svc := &service{}
+			svc.fail(w, zap.NewNop(), e, tt.err)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_service_respondWithError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      apiError
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "it nests the error under the error field",
+			err:      errCommentInvalid,
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":{"code":"COMMENT_INVALID","message":"comment could not be parsed"}}`,
+		},
+		{
+			name:     "it formats the message of the error",
+			err:      errCommentableNotFound.withArgs("books", "1234"),
+			wantCode: http.StatusNotFound,
+			wantBody: `{"error":{"code":"COMMENTABLE_NOT_FOUND","message":"books not found with key 1234"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svc := &service{}
+			svc.respondWithError(w, tt.err)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
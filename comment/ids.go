@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kjk/betterguid"
+)
+
+// idGenerator generates the ids of new comments. Comments are listed in the byte order
+// of their ids, so the scheme decides whether they are listed in the order they were added:
+// betterguid and ulid ids are prefixed with the time they were generated at and so are guaranteed
+// to sort chronologically, to the millisecond, without comparing the timestamps of the comments.
+type idGenerator interface {
+	newID() string
+}
+
+const (
+	idSchemeBetterguid = "betterguid" // time ordered, 20 chars
+	idSchemeULID       = "ulid"       // time ordered to the millisecond, 26 chars
+	idSchemeUUID       = "uuid"       // random version 4 uuids, 36 chars
+)
+
+// idScheme is the configured idGenerator, picked by name when the config is processed
+// so that an unknown scheme fails the startup
+type idScheme struct {
+	idGenerator
+}
+
+// Decode implements envconfig.Decoder
+func (s *idScheme) Decode(value string) error {
+	switch value {
+	case idSchemeBetterguid:
+		s.idGenerator = betterguidGenerator{}
+	case idSchemeULID:
+		s.idGenerator = ulidGenerator{}
+	case idSchemeUUID:
+		s.idGenerator = uuidGenerator{}
+	default:
+		return fmt.Errorf("unknown id scheme %q, expected one of %s, %s or %s",
+			value, idSchemeBetterguid, idSchemeULID, idSchemeUUID)
+	}
+
+	return nil
+}
+
+type betterguidGenerator struct{}
+
+func (betterguidGenerator) newID() string {
+	return betterguid.New()
+}
+
+// crockford is the base32 alphabet of ulids, which sorts in the same order as the bytes it encodes
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type ulidGenerator struct{}
+
+// newID returns a ulid, a 48 bit millisecond timestamp followed by 80 random bits
+func (ulidGenerator) newID() string {
+	return ulidAt(time.Now())
+}
+
+// ulidAt returns a ulid of the given time, e.g. to re-key a comment by when it was created
+func ulidAt(t time.Time) string {
+	var id [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(id[0:], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:], uint32(ms))
+	mustReadRandom(id[6:])
+
+	// 128 bits are encoded in 26 chars of 5 bits each, the first of which only holds 3
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(s[:])
+}
+
+// isULID reports whether the id is a ulid, the first char of which only holds its top 3 bits
+func isULID(id string) bool {
+	if len(id) != 26 || id[0] > '7' {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if strings.IndexByte(crockford, id[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) newID() string {
+	var id [16]byte
+	mustReadRandom(id[:])
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// mustReadRandom fills b with random bytes. The system's randomness failing is unrecoverable.
+func mustReadRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_idScheme_Decode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		want    idGenerator
+		wantErr bool
+	}{
+		{name: "it picks betterguid", value: "betterguid", want: betterguidGenerator{}},
+		{name: "it picks ulid", value: "ulid", want: ulidGenerator{}},
+		{name: "it picks uuid", value: "uuid", want: uuidGenerator{}},
+		{name: "it returns error for an unknown scheme", value: "snowflake", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s idScheme
+			err := s.Decode(tt.value)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, s.idGenerator)
+		})
+	}
+}
+
+func Test_idGenerators(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		gen      idGenerator
+		format   *regexp.Regexp
+		sortable bool
+	}{
+		{
+			name:     "betterguid",
+			gen:      betterguidGenerator{},
+			sortable: true,
+		},
+		{
+			name:     "ulid",
+			gen:      ulidGenerator{},
+			format:   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+			sortable: true,
+		},
+		{
+			name:   "uuid",
+			gen:    uuidGenerator{},
+			format: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := tt.gen.newID()
+			time.Sleep(2 * time.Millisecond)
+			second := tt.gen.newID()
+
+			if tt.format != nil {
+				assert.Regexp(t, tt.format, first)
+				assert.Regexp(t, tt.format, second)
+			}
+			assert.NotEqual(t, first, second)
+			if tt.sortable {
+				assert.True(t, first < second, "ids should sort in the order they were generated")
+			}
+		})
+	}
+}
+
+func Test_ulidGenerator_timestamp(t *testing.T) {
+	t.Parallel()
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	id := ulidGenerator{}.newID()
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+
+	// the first 10 chars encode the millisecond timestamp
+	var ms int64
+	for i := 0; i < 10; i++ {
+		ms = ms<<5 | int64(strings.IndexByte(crockford, id[i]))
+	}
+	assert.True(t, before <= ms && ms <= after)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// handleLatest responds with the comment added most recently to the resource that the caller can see,
+// e.g. for "last activity" indicators, or with a 404 if there is none. With a time ordered id scheme it is
+// read from the end of the bucket, while with uuids every comment is read to compare their creation times.
+func (svc *service) handleLatest(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+	l := svc.logger.With(
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+	)
+
+	cl := callerOf(r)
+	var cmt *comment
+	var err error
+	if _, random := svc.cfg.IDScheme.idGenerator.(uuidGenerator); random {
+		var cmts []*comment
+		cmts, err = svc.listAllComments(c)
+		cmt = newest(filter(cmts, cl.canSee))
+	} else {
+		cmt, err = c.latest(cl.canSee)
+	}
+
+	if err != nil {
+		svc.fail(w, l, errCommentList, err)
+		return
+	}
+
+	if cmt == nil {
+		svc.fail(w, l, errCommentNotFound, fmt.Errorf("no comments on %s with key %s yet", c.kind, c.key))
+		return
+	}
+
+	if modified := cmt.lastModified(); modified != nil {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	svc.respondWithPayload(w, newCommentResponse(cmt, cl), http.StatusOK)
+}
+
+// newest returns the comment created last, the last one in the order of list among those created at
+// the same time, nil if there are no comments. Comments without a creation time are the oldest.
+func newest(cmts []*comment) *comment {
+	var newest *comment
+	for _, c := range cmts {
+		if newest == nil || !createdBefore(c, newest) {
+			newest = c
+		}
+	}
+
+	return newest
+}
+
+// createdBefore reports whether a was created before b, which is the case if only b has a creation time
+func createdBefore(a, b *comment) bool {
+	if a.CreatedAt == nil || b.CreatedAt == nil {
+		return a.CreatedAt == nil && b.CreatedAt != nil
+	}
+
+	return a.CreatedAt.Before(*b.CreatedAt)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleLatest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		scheme   idGenerator
+		comments []*comment
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it responds with 404 if there are no comments",
+			scheme:   betterguidGenerator{},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:   "it responds with the last comment added",
+			scheme: betterguidGenerator{},
+			comments: []*comment{
+				{Value: "first", CreatedAt: &earlier},
+				{Value: "second", CreatedAt: &now},
+			},
+			wantCode: http.StatusOK,
+			want:     "second",
+		},
+		{
+			name:   "it skips the comments the caller can't see",
+			scheme: betterguidGenerator{},
+			comments: []*comment{
+				{Value: "first", CreatedAt: &earlier},
+				{Value: "private", CreatedAt: &now, Visibility: visibilityPrivate, Author: "jane"},
+				{Value: "hidden", CreatedAt: &now, Hidden: true},
+			},
+			wantCode: http.StatusOK,
+			want:     "first",
+		},
+		{
+			name:     "it responds with 404 if the caller can see none of the comments",
+			scheme:   betterguidGenerator{},
+			comments: []*comment{{Value: "private", Visibility: visibilityPrivate, Author: "jane"}},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:   "it compares the creation times with random ids",
+			scheme: uuidGenerator{},
+			comments: []*comment{
+				{Value: "first", CreatedAt: &now},
+				{Value: "second", CreatedAt: &earlier},
+				{Value: "third"},
+			},
+			wantCode: http.StatusOK,
+			want:     "first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+			assert.NoError(t, setup(db, []string{"posts"}))
+
+			cm := &commentable{db: db, kind: "posts", key: "my-key", ids: tt.scheme}
+			assert.NoError(t, cm.ensure())
+			for _, c := range tt.comments {
+				_, err := cm.add(c)
+				assert.NoError(t, err)
+			}
+
+			cfg := testConfig()
+			cfg.IDScheme = idScheme{tt.scheme}
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments/latest", nil))
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				assert.Equal(t, buildErrResp(errCommentNotFound), w.Body.String())
+				return
+			}
+
+			var got comment
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, tt.want, got.Value)
+		})
+	}
+}
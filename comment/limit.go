@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// commentLimitError is returned when a comment would be added to a commentable that has the most comments it may have
+type commentLimitError struct {
+	kind, key string
+	max       int
+}
+
+func (e commentLimitError) Error() string {
+	return fmt.Sprintf(commentLimitFmt, e.kind, e.key, e.max)
+}
+
+// warnNearLimit sets a Warning header on the response if the commentable has at least the configured share
+// of the most comments it may have, so that clients can tell users before further comments are rejected.
+// It is best effort, no header is set if the comments can't be counted.
+func (svc *service) warnNearLimit(w http.ResponseWriter, c *commentable) {
+	cfg := svc.config()
+	max, percent := cfg.MaxCommentsPerResource, cfg.CommentLimitWarning
+	if max <= 0 || percent <= 0 {
+		return
+	}
+
+	n, err := c.count()
+	if err != nil {
+		svc.logger.Warn("could not count the comments to warn about the limit", zap.Error(err),
+			zap.String(commentableKeyParam, c.key), zap.String(commentableTypeParam, c.kind))
+		return
+	}
+
+	if n*100 >= max*percent {
+		w.Header().Set("Warning", fmt.Sprintf(`199 - "%d%% of the comment limit reached, %d of %d comments"`,
+			n*100/max, n, max))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_commentable_add_maxComments(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key", maxComments: 2}
+	assert.NoError(t, cm.ensure())
+
+	_, err := cm.add(&comment{Value: "first"})
+	assert.NoError(t, err)
+	second, err := cm.add(&comment{Value: "second"})
+	assert.NoError(t, err, "comments should be allowed up to the limit")
+
+	_, err = cm.add(&comment{Value: "third"})
+	assert.Equal(t, commentLimitError{"posts", "my-key", 2}, err)
+
+	second.Value = "edited"
+	_, err = cm.save(second)
+	assert.NoError(t, err, "comments should still be updated at the limit")
+
+	n, err := cm.count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func Test_service_handleAdd_limit(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cfg := testConfig()
+	cfg.MaxCommentsPerResource = 4
+	cfg.CommentLimitWarning = 75
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	tests := []struct {
+		wantCode    int
+		wantWarning string
+	}{
+		{wantCode: http.StatusOK},
+		{wantCode: http.StatusOK},
+		{wantCode: http.StatusOK, wantWarning: `199 - "75% of the comment limit reached, 3 of 4 comments"`},
+		{wantCode: http.StatusOK, wantWarning: `199 - "100% of the comment limit reached, 4 of 4 comments"`},
+		{wantCode: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", bytes.NewBufferString(`{"value": "hi"}`))
+		mux.ServeHTTP(w, r)
+
+		assert.Equal(t, tt.wantCode, w.Code)
+		assert.Equal(t, tt.wantWarning, w.Header().Get("Warning"))
+		if tt.wantCode == http.StatusConflict {
+			assert.Equal(t, buildErrResp(errCommentLimitReached.withArgs("posts", "my-key", 4)), w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_logFormat_Decode(t *testing.T) {
+	t.Parallel()
+
+	var f logFormat
+	assert.NoError(t, f.Decode(logFormatConsole))
+	assert.Equal(t, logFormat(logFormatConsole), f)
+	assert.EqualError(t, f.Decode("text"), `unknown log format "text", expected json or console`)
+}
+
+func Test_newLogger(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []logFormat{logFormatJSON, logFormatConsole} {
+		level := zap.NewAtomicLevelAt(zapcore.WarnLevel)
+		logger, err := newLogger(format, level)
+		assert.NoError(t, err)
+		assert.False(t, logger.Core().Enabled(zapcore.InfoLevel))
+
+		level.SetLevel(zapcore.DebugLevel)
+		assert.True(t, logger.Core().Enabled(zapcore.DebugLevel), "the level should be changeable")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// notifier wakes up the requests long-polling a commentable whenever a comment is added to it
+type notifier struct {
+	mu      sync.Mutex
+	waiters map[string]*waiters // by commentable kind and key
+}
+
+// waiters are the polls waiting on a commentable, which all share the channel closed on the next comment
+type waiters struct {
+	ch chan struct{}
+	n  int
+}
+
+func newNotifier() *notifier {
+	return &notifier{waiters: map[string]*waiters{}}
+}
+
+func topic(kind, key string) string {
+	return kind + "/" + key
+}
+
+// wait returns a channel that is closed on the next comment added to the commentable,
+// and the func to call once done waiting, which forgets the commentable once nobody waits on it anymore
+func (n *notifier) wait(kind, key string) (<-chan struct{}, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t := topic(kind, key)
+	ws, ok := n.waiters[t]
+	if !ok {
+		ws = &waiters{ch: make(chan struct{})}
+		n.waiters[t] = ws
+	}
+	ws.n++
+
+	return ws.ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		// the waiters are already gone if they were notified
+		ws.n--
+		if ws.n == 0 && n.waiters[t] == ws {
+			delete(n.waiters, t)
+		}
+	}
+}
+
+// notify wakes up everyone waiting on the commentable
+func (n *notifier) notify(kind, key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t := topic(kind, key)
+	if ws, ok := n.waiters[t]; ok {
+		close(ws.ch)
+		delete(n.waiters, t)
+	}
+}
+
+// releaseAll wakes up everyone waiting, e.g. so that polls don't hold up a shutdown
+func (n *notifier) releaseAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for t, ws := range n.waiters {
+		close(ws.ch)
+		delete(n.waiters, t)
+	}
+}
+
+// pollParams parses the since and wait query parameters of a long-poll.
+// A zero since means the request is a plain list, and wait is capped at the configured maximum.
+func (svc *service) pollParams(r *http.Request) (since time.Time, wait time.Duration, e *apiError) {
+	q := r.URL.Query()
+	if s := q.Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			e := errCommentSinceInvalid.withArgs(s)
+			return since, 0, &e
+		}
+	}
+
+	if s := q.Get("wait"); s != "" {
+		var err error
+		if wait, err = time.ParseDuration(s); err != nil || wait < 0 {
+			e := errCommentWaitInvalid.withArgs(s)
+			return since, 0, &e
+		}
+	}
+
+	if max := svc.config().MaxPollWait; wait > max {
+		wait = max
+	}
+
+	return since, wait, nil
+}
+
+// addedSince reports whether the comment was added after the given time.
+// Comments saved before creation times were recorded never are.
+func addedSince(since time.Time) func(*comment) bool {
+	return func(c *comment) bool {
+		return c.CreatedAt != nil && c.CreatedAt.After(since)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_notifier(t *testing.T) {
+	t.Parallel()
+
+	n := newNotifier()
+	books, doneBooks := n.wait("books", "1")
+	again, doneAgain := n.wait("books", "1")
+	assert.Equal(t, books, again)
+	authors, doneAuthors := n.wait("authors", "1")
+
+	n.notify("books", "1")
+	assert.True(t, isClosed(books))
+	assert.False(t, isClosed(authors))
+	doneBooks()
+	doneAgain()
+	next, doneNext := n.wait("books", "1")
+	assert.False(t, isClosed(next))
+
+	doneNext()
+	assert.NotContains(t, n.waiters, topic("books", "1"))
+
+	n.releaseAll()
+	assert.True(t, isClosed(authors))
+	doneAuthors()
+	assert.Empty(t, n.waiters)
+}
+
+func Test_notifier_done(t *testing.T) {
+	t.Parallel()
+
+	n := newNotifier()
+	_, first := n.wait("books", "1")
+	_, second := n.wait("books", "1")
+
+	first()
+	assert.Contains(t, n.waiters, topic("books", "1"))
+
+	second()
+	assert.Empty(t, n.waiters)
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func Test_service_pollParams(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		query     string
+		wantSince time.Time
+		wantWait  time.Duration
+		wantErr   *apiError
+	}{
+		{
+			name: "it returns zero values if the parameters are not set",
+		},
+		{
+			name:      "it parses the parameters",
+			query:     "?since=2018-05-01T10:00:00Z&wait=5s",
+			wantSince: since,
+			wantWait:  5 * time.Second,
+		},
+		{
+			name:      "it caps the wait at the configured maximum",
+			query:     "?since=2018-05-01T10:00:00Z&wait=1h",
+			wantSince: since,
+			wantWait:  30 * time.Second,
+		},
+		{
+			name:    "it returns error if since is not an RFC 3339 timestamp",
+			query:   "?since=yesterday",
+			wantErr: func() *apiError { e := errCommentSinceInvalid.withArgs("yesterday"); return &e }(),
+		},
+		{
+			name:    "it returns error if wait is not a duration",
+			query:   "?since=2018-05-01T10:00:00Z&wait=30",
+			wantErr: func() *apiError { e := errCommentWaitInvalid.withArgs("30"); return &e }(),
+		},
+		{
+			name:    "it returns error if wait is negative",
+			query:   "?since=2018-05-01T10:00:00Z&wait=-1s",
+			wantErr: func() *apiError { e := errCommentWaitInvalid.withArgs("-1s"); return &e }(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newService(nil, zap.NewNop(), testConfig())
+			r := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+
+			since, wait, e := svc.pollParams(r)
+			assert.Equal(t, tt.wantErr, e)
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.wantSince, since)
+				assert.Equal(t, tt.wantWait, wait)
+			}
+		})
+	}
+}
+
+func Test_service_handleList_longPoll(t *testing.T) {
+	t.Parallel()
+
+	kind := "posts"
+	key := "my-key"
+	tests := []struct {
+		name      string
+		query     string
+		add       bool
+		wantCode  int
+		wantCount int
+	}{
+		{
+			name:     "it returns error if since is invalid",
+			query:    "?since=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "it returns immediately with the comments added since",
+			query:     "?since=2018-05-01T10:00:00Z&wait=10s",
+			wantCode:  http.StatusOK,
+			wantCount: 1,
+		},
+		{
+			name:     "it returns empty once the wait is over without new comments",
+			query:    "?since=%s&wait=50ms",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "it returns the comment added while waiting",
+			query:     "?since=%s&wait=10s",
+			add:       true,
+			wantCode:  http.StatusOK,
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			err := db.Update(func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte(kind))
+				if err != nil {
+					return err
+				}
+
+				_, err = b.CreateBucket([]byte(key))
+				return err
+			})
+			assert.NoError(t, err)
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			path := fmt.Sprintf("/v1/%s/%s/comments", kind, key)
+			post := func() {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"value": "my-comment"}`))
+				mux.ServeHTTP(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+			post()
+
+			query := tt.query
+			if strings.Contains(query, "%s") {
+				// only comments added from now on are new
+				query = fmt.Sprintf(query, time.Now().UTC().Format(time.RFC3339Nano))
+			}
+			if tt.add {
+				// wait for the poll to subscribe before adding the comment
+				go func() {
+					for {
+						svc.added.mu.Lock()
+						_, waiting := svc.added.waiters[topic(kind, key)]
+						svc.added.mu.Unlock()
+						if waiting {
+							post()
+							return
+						}
+						time.Sleep(time.Millisecond)
+					}
+				}()
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, path+query, nil)
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusOK {
+				var data struct {
+					Comments []*comment `json:"comments"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+				assert.Len(t, data.Comments, tt.wantCount)
+			}
+			// the poll no longer waits once answered
+			assert.Empty(t, svc.added.waiters)
+		})
+	}
+}
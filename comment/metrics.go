@@ -0,0 +1,12 @@
+package main
+
+import "net/http"
+
+// handleMetrics responds with the counters operators monitor the service by
+func (svc *service) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Cache cacheStats `json:"cache"`
+	}{svc.cache.stats()}
+
+	svc.respondWithPayload(w, payload, http.StatusOK)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+var errMigrateIDsScheme = errors.New("MIGRATEIDS requires IDSCHEME=ulid")
+
+// idMigration is a comment that was re-keyed, so that clients holding its old id can be told the new one
+type idMigration struct {
+	kind, key string
+	from, to  string
+}
+
+// migrateIDs re-keys the comments whose ids are not ulids, e.g. uuids, to ulids of when they were created
+// if configured to, so that they are listed in the order they were added along with the comments added since
+func (svc *service) migrateIDs() error {
+	if !svc.cfg.MigrateIDs {
+		return nil
+	}
+
+	if _, ok := svc.cfg.IDScheme.idGenerator.(ulidGenerator); !ok {
+		return errMigrateIDsScheme
+	}
+
+	var migrated []idMigration
+	for _, db := range svc.dbs() {
+		m, err := migrateIDs(db)
+		if err != nil {
+			return err
+		}
+
+		migrated = append(migrated, m...)
+	}
+
+	for _, m := range migrated {
+		svc.logger.Info("migrated the id of a comment",
+			zap.String(commentableTypeParam, m.kind),
+			zap.String(commentableKeyParam, m.key),
+			zap.String("from", m.from),
+			zap.String("to", m.to),
+		)
+	}
+
+	svc.logger.Info("migrated comment ids to ulids", zap.Int("migrated", len(migrated)))
+	return nil
+}
+
+// migrateIDs re-keys every comment, including deleted ones, whose id is not a ulid in a single transaction,
+// along with the comments of the audit trail. Comments saved before their creation was recorded are keyed
+// by the unix epoch and so listed first.
+func migrateIDs(db *bolt.DB) ([]idMigration, error) {
+	var migrated []idMigration
+	err := db.Update(func(tx *bolt.Tx) error {
+		migrated = nil
+		err := tx.ForEach(func(kind []byte, cmBucket *bolt.Bucket) error {
+			if strings.HasPrefix(string(kind), "_") { // reserved for the service, e.g. the audit trail
+				return nil
+			}
+
+			var keys [][]byte
+			cmBucket.ForEach(func(k, v []byte) error {
+				if v == nil { // a nested bucket, i.e. a resource
+					keys = append(keys, k)
+				}
+				return nil
+			})
+
+			for _, key := range keys {
+				rBucket := cmBucket.Bucket(key)
+				for _, name := range [][]byte{commentsKey, trashKey} {
+					b := rBucket.Bucket(name)
+					if b == nil {
+						continue
+					}
+
+					ms, err := migrateBucketIDs(b)
+					if err != nil {
+						return err
+					}
+
+					for _, m := range ms {
+						m.kind, m.key = string(kind), string(key)
+						migrated = append(migrated, m)
+					}
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return migrateAuditIDs(tx, migrated)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return migrated, nil
+}
+
+// migrateAuditIDs changes the ids of the re-keyed comments in the audit trail, so that the changes made to
+// a comment before it was re-keyed can still be found by its id
+func migrateAuditIDs(tx *bolt.Tx, migrated []idMigration) error {
+	b := tx.Bucket(auditKey)
+	if b == nil || len(migrated) == 0 {
+		return nil
+	}
+
+	ids := map[string]string{}
+	for _, m := range migrated {
+		ids[topic(m.kind, m.key)+"/"+m.from] = m.to
+	}
+
+	// the bucket can't be modified while iterating over it so the changes are collected first
+	updates := map[string][]byte{}
+	err := b.ForEach(func(k, v []byte) error {
+		var e auditEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+
+		// only the id is changed so that the comment is kept as it was otherwise
+		var c map[string]json.RawMessage
+		if len(e.Comment) == 0 || json.Unmarshal(e.Comment, &c) != nil || c == nil {
+			return nil
+		}
+
+		var id string
+		if err := json.Unmarshal(c["id"], &id); err != nil {
+			return nil
+		}
+
+		to, ok := ids[topic(e.Kind, e.Key)+"/"+id]
+		if !ok {
+			return nil
+		}
+
+		var err error
+		if c["id"], err = json.Marshal(to); err != nil {
+			return err
+		}
+		if e.Comment, err = json.Marshal(c); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, data := range updates {
+		if err = b.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateBucketIDs re-keys the comments of the bucket whose ids are not ulids
+func migrateBucketIDs(b *bolt.Bucket) ([]idMigration, error) {
+	// the bucket can't be changed while iterating over it
+	var ids []string
+	b.ForEach(func(k, _ []byte) error {
+		if !isULID(string(k)) {
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+
+	var migrated []idMigration
+	for _, id := range ids {
+		var c comment
+		if err := json.Unmarshal(b.Get([]byte(id)), &c); err != nil {
+			return nil, err
+		}
+
+		created := time.Unix(0, 0)
+		if c.CreatedAt != nil {
+			created = *c.CreatedAt
+		}
+
+		c.ID = ulidAt(created)
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = b.Put([]byte(c.ID), data); err != nil {
+			return nil, err
+		}
+
+		if err = b.Delete([]byte(id)); err != nil {
+			return nil, err
+		}
+
+		migrated = append(migrated, idMigration{from: id, to: c.ID})
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_setup_migrateIDs(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key", ids: uuidGenerator{}}
+	assert.NoError(t, cm.ensure())
+
+	// added in the reverse order of their creation so that the order of their uuids can't pass for it
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	var added []*comment
+	for i, value := range []string{"third", "second", "first"} {
+		created := now.Add(time.Duration(-i-1) * time.Hour)
+		c, err := cm.add(&comment{Value: value, CreatedAt: &created})
+		assert.NoError(t, err)
+		added = append(added, c)
+	}
+
+	legacy, err := cm.add(&comment{Value: "legacy"}) // saved before the creation was recorded
+	assert.NoError(t, err)
+
+	cm.ids = ulidGenerator{}
+	current, err := cm.add(&comment{Value: "current"})
+	assert.NoError(t, err)
+
+	deleted, err := (&commentable{db: db, kind: "posts", key: "my-key", ids: uuidGenerator{}}).add(&comment{Value: "deleted"})
+	assert.NoError(t, err)
+	assert.NoError(t, cm.remove(deleted.ID, caller{id: "jane"}))
+
+	cfg := testConfig()
+	cfg.IDScheme = idScheme{ulidGenerator{}}
+	cfg.MigrateIDs = true
+	assert.NoError(t, newService(db, zap.NewNop(), cfg).setup([]string{"posts"}))
+
+	cmts, err := cm.list()
+	assert.NoError(t, err)
+
+	var values []string
+	for _, c := range cmts {
+		assert.True(t, isULID(c.ID), "the id %s should be a ulid", c.ID)
+		values = append(values, c.Value)
+	}
+	assert.Equal(t, []string{"legacy", "first", "second", "third", "current"}, values)
+
+	assert.Equal(t, current.ID, cmts[4].ID, "ulids should be kept")
+	assert.Equal(t, ulidAt(*added[0].CreatedAt)[:10], cmts[3].ID[:10], "ids should be prefixed with the creation time")
+	assert.NotEqual(t, legacy.ID, cmts[0].ID)
+
+	db.View(func(tx *bolt.Tx) error {
+		trash := tx.Bucket([]byte("posts")).Bucket([]byte("my-key")).Bucket(trashKey)
+		assert.Nil(t, trash.Get([]byte(deleted.ID)))
+
+		k, v := trash.Cursor().First()
+		var c comment
+		assert.NoError(t, json.Unmarshal(v, &c))
+		assert.True(t, isULID(string(k)), "deleted comments should be migrated too")
+		assert.Equal(t, string(k), c.ID)
+
+		_, v = tx.Bucket(auditKey).Cursor().First()
+		var e auditEntry
+		assert.NoError(t, json.Unmarshal(v, &e))
+		assert.NoError(t, json.Unmarshal(e.Comment, &c))
+		assert.Equal(t, string(k), c.ID, "the audit trail should be migrated too")
+		assert.Equal(t, "deleted", c.Value)
+		return nil
+	})
+}
+
+func Test_service_setup_migrateIDs_scheme(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	cfg := testConfig()
+	cfg.MigrateIDs = true
+	assert.Equal(t, errMigrateIDsScheme, newService(db, zap.NewNop(), cfg).setup([]string{"posts"}))
+}
+
+func Test_isULID(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isULID(ulidGenerator{}.newID()))
+	assert.False(t, isULID(uuidGenerator{}.newID()))
+	assert.False(t, isULID(betterguidGenerator{}.newID()))
+	assert.False(t, isULID("8ZZZZZZZZZZZZZZZZZZZZZZZZZ"), "the first char only holds 3 bits")
+	assert.False(t, isULID("01ARZ3NDEKTSV4RRFFQ69G5FAU"), "U is not in the alphabet")
+}
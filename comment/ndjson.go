@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// formatNDJSON lists comments as newline delimited json, one comment per line
+const formatNDJSON = "ndjson"
+
+// streamBatchSize is the number of comments streamComments reads from the db at a time
+const streamBatchSize = 100
+
+// errStreamDone stops reading the comments once a page of them was streamed
+var errStreamDone = errors.New("stream done")
+
+// streamComments writes the comments of the commentable that are kept to the response as newline
+// delimited json while reading them from the db, so that any number of comments is listed in bounded memory.
+// The response is sent chunked as its length is unknown up front, which is why it has no total count either.
+// Comments are read in batches and written between the reads, so that a slow client doesn't hold up writes
+// to the db. They are streamed in the order of their ids, pinned ones are not moved first, and new ones
+// can't be waited for. The page is of the kept comments like that of the list, all of them from offset on
+// if limit is 0.
+func (svc *service) streamComments(w http.ResponseWriter, l *zap.Logger, c *commentable, cl caller,
+	keep func(*comment) bool, offset, limit int) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	skipped, written := 0, 0
+	enc := json.NewEncoder(w) // which ends every comment with a newline
+	err := c.eachBatch(streamBatchSize, func(cmts []*comment) error {
+		for _, cmt := range cmts {
+			if !keep(cmt) {
+				continue
+			}
+
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			written++
+			if err := enc.Encode(newCommentResponse(cmt, cl)); err != nil {
+				return err
+			}
+
+			if written == limit {
+				return errStreamDone
+			}
+		}
+		return nil
+	})
+	if err == errStreamDone {
+		err = nil
+	}
+
+	// the status has been sent along with the first comment, so later failures can only cut the stream short
+	if err != nil && written == 0 {
+		svc.fail(w, l, errCommentList, err)
+		return
+	}
+
+	if err != nil {
+		l.Error("could not stream all comments", zap.Error(err), zap.Int("streamed", written))
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleList_ndjson(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	// enough comments for the response not to fit the server's buffer
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	for i := 0; i < 300; i++ {
+		category := "review"
+		if i%3 == 0 {
+			category = "question"
+		}
+		_, err := cm.add(&comment{Value: fmt.Sprintf("comment %d", i), Category: category})
+		assert.NoError(t, err)
+	}
+	_, err := cm.add(&comment{Value: "a note", Author: "jane", Visibility: visibilityPrivate})
+	assert.NoError(t, err)
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		query     string
+		userID    string
+		wantLines int
+		wantFirst string
+	}{
+		{
+			name:      "it streams the comments the caller can see one per line",
+			query:     "format=ndjson",
+			wantLines: 300,
+		},
+		{
+			name:      "it streams the private comments of the caller",
+			query:     "format=ndjson",
+			userID:    "jane",
+			wantLines: 301,
+		},
+		{
+			name:      "it applies the filters of the list",
+			query:     "format=ndjson&category=question",
+			wantLines: 100,
+		},
+		{
+			name:      "it streams the page of the limit and offset across batches",
+			query:     "format=ndjson&limit=150&offset=120",
+			wantLines: 150,
+			wantFirst: "comment 120",
+		},
+		{
+			name:      "it streams the rest of the comments from the offset without a limit",
+			query:     "format=ndjson&offset=290",
+			wantLines: 10,
+			wantFirst: "comment 290",
+		},
+		{
+			name:      "it pages the filtered comments",
+			query:     "format=ndjson&category=question&limit=50&offset=80",
+			wantLines: 20,
+			wantFirst: "comment 240",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/posts/my-key/comments?"+tt.query, nil)
+			assert.NoError(t, err)
+			if tt.userID != "" {
+				r.Header.Set(userIDHeader, tt.userID)
+			}
+
+			resp, err := http.DefaultClient.Do(r)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+			assert.Empty(t, resp.Header.Get(totalCountHeader), "the total is unknown up front")
+			if tt.wantLines >= 100 { // smaller pages fit the server's buffer and are sent with their length
+				assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+			}
+
+			lines := 0
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var c comment
+				assert.NoError(t, json.Unmarshal(scanner.Bytes(), &c))
+				assert.NotEmpty(t, c.ID)
+				if lines == 0 && tt.wantFirst != "" {
+					assert.Equal(t, tt.wantFirst, c.Value)
+				}
+				lines++
+			}
+			assert.NoError(t, scanner.Err())
+			assert.Equal(t, tt.wantLines, lines)
+		})
+	}
+}
+
+func Test_service_handleList_ndjson_empty(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+	assert.NoError(t, (&commentable{db: db, kind: "posts", key: "my-key"}).ensure())
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments?format=ndjson", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "", strings.TrimSpace(w.Body.String()))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// typeOverview counts the resources of a type and the comments on them, e.g. for dashboards
+type typeOverview struct {
+	Resources int `json:"resources"`
+	Comments  int `json:"comments"`
+}
+
+// handleOverview responds with the overview of every type, keyed by type
+func (svc *service) handleOverview(w http.ResponseWriter, r *http.Request) {
+	types := map[string]typeOverview{}
+	for _, db := range svc.dbs() {
+		if err := overview(db, types); err != nil {
+			svc.fail(w, svc.logger, errOverview, err)
+			return
+		}
+	}
+
+	svc.respondWithPayload(w, struct {
+		Types map[string]typeOverview `json:"types"`
+	}{types}, http.StatusOK)
+}
+
+// overview adds the overview of every type in the db to types, all of them within a single read.
+// Like count, it counts the comments without reading them, expired and hidden ones included.
+func overview(db *bolt.DB, types map[string]typeOverview) error {
+	return db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(kind []byte, cmBucket *bolt.Bucket) error {
+			if strings.HasPrefix(string(kind), "_") { // reserved for the service, e.g. the audit trail
+				return nil
+			}
+
+			var o typeOverview
+			err := cmBucket.ForEach(func(key, v []byte) error {
+				if v != nil { // only the nested buckets are commentables
+					return nil
+				}
+
+				o.Resources++
+				if comments := cmBucket.Bucket(key).Bucket(commentsKey); comments != nil {
+					o.Comments += comments.Stats().KeyN
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			types[string(kind)] = o
+			return nil
+		})
+	})
+}
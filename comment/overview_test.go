@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleOverview(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	books := setupDB()
+	defer cleanup(books)
+
+	cfg := testConfig()
+	cfg.AdminToken = "secret"
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.shards = map[string]*bolt.DB{"books": books}
+	assert.NoError(t, svc.setup([]string{"authors", "books", "posts"}))
+
+	cmts := map[string]int{"first": 2, "second": 1, "empty": 0}
+	for k, n := range cmts {
+		cm := &commentable{db: books, kind: "books", key: k}
+		assert.NoError(t, cm.ensure())
+		for i := 0; i < n; i++ {
+			_, err := cm.add(&comment{Value: "a"})
+			assert.NoError(t, err)
+		}
+	}
+
+	cm := &commentable{db: db, kind: "authors", key: "jane"}
+	assert.NoError(t, cm.ensure())
+	c, err := cm.add(&comment{Value: "a"})
+	assert.NoError(t, err)
+	assert.NoError(t, cm.remove(c.ID, caller{}))
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/overview", nil)
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/v1/admin/overview", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"types":{
+		"authors":{"resources":1,"comments":0},
+		"books":{"resources":3,"comments":3},
+		"posts":{"resources":0,"comments":0}
+	}}`, w.Body.String())
+}
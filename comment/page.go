@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	envelopeWrapped = "wrapped"
+	envelopeBare    = "bare"
+)
+
+// listEnvelope is how lists are sent, see respondWithList
+type listEnvelope string
+
+// Decode implements envconfig.Decoder so that an unknown envelope fails the startup
+func (e *listEnvelope) Decode(value string) error {
+	switch value {
+	case envelopeWrapped, envelopeBare:
+		*e = listEnvelope(value)
+	default:
+		return fmt.Errorf("unknown list envelope %q, expected %s or %s", value, envelopeWrapped, envelopeBare)
+	}
+
+	return nil
+}
+
+// respondWithList responds with the items wrapped in an object under name,
+// or as a top-level array with the bare envelope
+func (svc *service) respondWithList(w http.ResponseWriter, name string, items interface{}) {
+	if svc.cfg.ListEnvelope == envelopeBare {
+		svc.respondWithPayload(w, items, http.StatusOK)
+		return
+	}
+
+	svc.respondWithPayload(w, map[string]interface{}{name: items}, http.StatusOK)
+}
+
+// pageSize returns the number of items the limit query parameter asks for, the configured default if it is
+// not set, cut down to the configured max. It fails with the given error if the limit is not a positive number.
+// There is no limit if it returns 0, which is the case if no limit is given and no default is configured,
+// so that clients that don't page keep getting every item.
+func (svc *service) pageSize(r *http.Request, invalid apiError) (int, *apiError) {
+	limit := svc.config().DefaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			e := invalid.withArgs(s)
+			return 0, &e
+		}
+
+		limit = n
+	}
+
+	if max := svc.config().MaxPageSize; max > 0 && limit > max {
+		svc.logger.Debug("cut the page size down to the max", zap.Int("limit", limit), zap.Int("max", max))
+		limit = max
+	}
+
+	return limit, nil
+}
+
+// pageOffset returns the number of items to skip the offset query parameter asks for, 0 if it is not set.
+// It fails with errCommentOffsetInvalid if the offset is not a number or negative.
+func pageOffset(r *http.Request) (int, *apiError) {
+	s := r.URL.Query().Get("offset")
+	if s == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		e := errCommentOffsetInvalid.withArgs(s)
+		return 0, &e
+	}
+
+	return n, nil
+}
+
+// page returns the comments of the page starting at offset, at most limit of them or all if limit is 0
+func page(cmts []*comment, offset, limit int) []*comment {
+	if offset >= len(cmts) {
+		return []*comment{}
+	}
+
+	cmts = cmts[offset:]
+	if limit > 0 && len(cmts) > limit {
+		cmts = cmts[:limit]
+	}
+
+	return cmts
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_service_pageSize(t *testing.T) {
+	t.Parallel()
+
+	limitErr := errCommentLimitInvalid.withArgs("none")
+	zeroErr := errCommentLimitInvalid.withArgs("0")
+	tests := []struct {
+		name        string
+		query       string
+		defaultSize int
+		maxSize     int
+		want        int
+		wantErr     *apiError
+		wantClamped bool
+	}{
+		{
+			name:        "it returns the default if no limit is given",
+			defaultSize: 50,
+			maxSize:     500,
+			want:        50,
+		},
+		{
+			name:        "it returns the limit",
+			query:       "?limit=20",
+			defaultSize: 50,
+			maxSize:     500,
+			want:        20,
+		},
+		{
+			name:        "it returns the limit at the max",
+			query:       "?limit=500",
+			defaultSize: 50,
+			maxSize:     500,
+			want:        500,
+		},
+		{
+			name:        "it cuts a limit over the max down to it",
+			query:       "?limit=1000000",
+			defaultSize: 50,
+			maxSize:     500,
+			want:        500,
+			wantClamped: true,
+		},
+		{
+			name:        "it cuts the default down to the max",
+			defaultSize: 50,
+			maxSize:     10,
+			want:        10,
+			wantClamped: true,
+		},
+		{
+			name:    "it returns no limit if there is no default, whatever the max",
+			maxSize: 10,
+		},
+		{
+			name:  "it returns any limit if there is no max",
+			query: "?limit=1000000",
+			want:  1000000,
+		},
+		{
+			name: "it returns no limit if there is neither a default nor a max",
+		},
+		{
+			name:    "it fails if the limit is not a number",
+			query:   "?limit=none",
+			maxSize: 500,
+			wantErr: &limitErr,
+		},
+		{
+			name:    "it fails if the limit is not positive",
+			query:   "?limit=0",
+			maxSize: 500,
+			wantErr: &zeroErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			svc := &service{logger: zap.New(core), cfg: config{DefaultPageSize: tt.defaultSize, MaxPageSize: tt.maxSize}}
+
+			got, err := svc.pageSize(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), errCommentLimitInvalid)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+
+			if tt.wantClamped {
+				assert.Equal(t, 1, logs.FilterMessage("cut the page size down to the max").Len())
+			} else {
+				assert.Equal(t, 0, logs.Len())
+			}
+		})
+	}
+}
+
+func Test_service_handleList_page(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	for i := 0; i < 5; i++ {
+		_, err := cm.add(&comment{Value: fmt.Sprintf("comment %d", i)})
+		assert.NoError(t, err)
+	}
+
+	cfg := testConfig()
+	cfg.DefaultPageSize = 2
+	cfg.MaxPageSize = 3
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		want     []string
+		wantBody string
+	}{
+		{
+			name:     "it lists the default number of comments",
+			wantCode: http.StatusOK,
+			want:     []string{"comment 0", "comment 1"},
+		},
+		{
+			name:     "it lists the page at the offset",
+			query:    "?limit=2&offset=3",
+			wantCode: http.StatusOK,
+			want:     []string{"comment 3", "comment 4"},
+		},
+		{
+			name:     "it lists at most the max number of comments",
+			query:    "?limit=1000000",
+			wantCode: http.StatusOK,
+			want:     []string{"comment 0", "comment 1", "comment 2"},
+		},
+		{
+			name:     "it lists no comments past the last one",
+			query:    "?offset=5",
+			wantCode: http.StatusOK,
+			want:     []string{},
+		},
+		{
+			name:     "it responds with error if the offset is negative",
+			query:    "?offset=-1",
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentOffsetInvalid.withArgs("-1")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments"+tt.query, nil)
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+				return
+			}
+
+			var data struct {
+				Comments []comment `json:"comments"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+			got := []string{}
+			for _, c := range data.Comments {
+				got = append(got, c.Value)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, "5", w.Header().Get(totalCountHeader))
+		})
+	}
+}
+
+func Test_listEnvelope_Decode(t *testing.T) {
+	t.Parallel()
+
+	var e listEnvelope
+	assert.NoError(t, e.Decode(envelopeBare))
+	assert.Equal(t, listEnvelope(envelopeBare), e)
+	assert.EqualError(t, e.Decode("array"), `unknown list envelope "array", expected wrapped or bare`)
+}
+
+func Test_service_respondWithList(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	c, err := cm.add(&comment{Value: "hello"})
+	assert.NoError(t, err)
+	assert.NoError(t, cm.remove(c.ID, caller{id: "jane"}))
+	_, err = cm.add(&comment{Value: "hello again"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		envelope listEnvelope
+		path     string
+		wantKey  string
+	}{
+		{
+			name:     "it wraps the comments",
+			envelope: envelopeWrapped,
+			path:     "/v1/posts/my-key/comments",
+			wantKey:  "comments",
+		},
+		{
+			name:     "it wraps the audit entries",
+			envelope: envelopeWrapped,
+			path:     "/v1/admin/audit",
+			wantKey:  "entries",
+		},
+		{
+			name:     "it sends bare comments",
+			envelope: envelopeBare,
+			path:     "/v1/posts/my-key/comments",
+		},
+		{
+			name:     "it sends bare audit entries",
+			envelope: envelopeBare,
+			path:     "/v1/admin/audit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+			cfg.ListEnvelope = tt.envelope
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer secret")
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var items []json.RawMessage
+			if tt.wantKey != "" {
+				var wrapped map[string][]json.RawMessage
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &wrapped))
+				assert.Len(t, wrapped, 1)
+				items = wrapped[tt.wantKey]
+			} else {
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+			}
+			assert.Len(t, items, 1)
+		})
+	}
+}
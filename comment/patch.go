@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// commentPatch is a json merge patch (RFC 7386) of a comment, i.e. the fields of the comment
+// a client wants to change, along with which of them were sent
+type commentPatch struct {
+	*comment
+	sent map[string]json.RawMessage
+}
+
+// decodePatch decodes the patch in the request body, returning a schemaError if it does not match commentPatchSchema
+func (svc *service) decodePatch(r *http.Request) (*commentPatch, error) {
+	data, err := svc.readPayload(r, commentPatchPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &commentPatch{comment: &comment{}}
+	if err = json.Unmarshal(data, &p.sent); err != nil {
+		return nil, err
+	}
+
+	return p, json.Unmarshal(data, p.comment)
+}
+
+// has reports whether the field was sent, be it null
+func (p *commentPatch) has(field string) bool {
+	_, ok := p.sent[field]
+	return ok
+}
+
+// apply changes the fields of the comment that were sent and keeps the others.
+// The fields sent as null are decoded to their zero value, which clears them.
+func (p *commentPatch) apply(c *comment) {
+	if p.has("value") {
+		c.Value = p.Value
+		c.Mentions = mentions(p.Value)
+	}
+	if p.has("category") {
+		c.Category = p.Category
+	}
+	if p.has("tags") {
+		c.Tags = normalizeTags(p.Tags)
+	}
+	if p.has("attachments") {
+		c.Attachments = p.Attachments
+	}
+	if p.has("visibility") {
+		c.Visibility = p.Visibility
+		if c.Visibility == "" {
+			c.Visibility = visibilityPublic
+		}
+	}
+	if p.has("expires_at") {
+		c.ExpiresAt = p.ExpiresAt
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// errTooManyPinned is returned when pinning a comment on a resource that has as many pinned as allowed
+var errTooManyPinned = fmt.Errorf("too many pinned comments")
+
+// handlePin pins the comment to the top of the list of the resource's comments
+func (svc *service) handlePin(w http.ResponseWriter, r *http.Request) {
+	svc.setPinned(w, r, true)
+}
+
+// handleUnpin lets the comment take its place in the list of the resource's comments again
+func (svc *service) handleUnpin(w http.ResponseWriter, r *http.Request) {
+	svc.setPinned(w, r, false)
+}
+
+func (svc *service) setPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+	cKey := chi.URLParam(r, commentKeyParam)
+	l := svc.logger.With(
+		zap.String(commentKeyParam, cKey),
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+		zap.Bool("pinned", pinned),
+	)
+
+	if _, err := c.get(cKey); err != nil {
+		svc.fail(w, l, errCommentNotFound, err)
+		return
+	}
+
+	max := svc.config().MaxPinnedComments
+	cmt, err := c.pin(cKey, pinned, max, callerOf(r))
+	svc.cache.invalidate(c.kind, c.key, cKey)
+	if err != nil {
+		e := errCommentPin
+		if err == errTooManyPinned {
+			e = errCommentPinLimit.withArgs(max)
+		}
+
+		svc.fail(w, l, e, err)
+		return
+	}
+
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
+}
+
+// pin pins or unpins the comment with the given key and returns it, recording the change in the
+// audit trail along with when it was pinned. Pinning fails with errTooManyPinned if max comments are pinned already, unless max is 0.
+// The version of the comment is incremented so that edits made concurrently don't undo the change.
+func (cm *commentable) pin(cKey string, pinned bool, max int, by caller) (*comment, error) {
+	var c comment
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return cm.commentNotFound(cKey)
+		}
+
+		data := comments.Get([]byte(cKey))
+		if data == nil {
+			return cm.commentNotFound(cKey)
+		}
+
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		if c.Pinned == pinned {
+			return nil
+		}
+
+		if pinned && max > 0 {
+			n, err := countPinned(comments, time.Now())
+			if err != nil {
+				return err
+			}
+
+			if n >= max {
+				return errTooManyPinned
+			}
+		}
+
+		action := auditActionPin
+		if !pinned {
+			action = auditActionUnpin
+		}
+
+		err := audit(tx, auditEntry{
+			Action:  action,
+			Kind:    cm.kind,
+			Key:     cm.key,
+			Actor:   by.id,
+			Admin:   by.admin,
+			IP:      by.ip,
+			At:      time.Now().UTC(),
+			Comment: json.RawMessage(data),
+		})
+		if err != nil {
+			return err
+		}
+
+		c.Pinned = pinned
+		c.PinnedAt = nil
+		if pinned {
+			now := time.Now().UTC()
+			c.PinnedAt = &now
+		}
+		c.Version++
+		data, err = json.Marshal(&c)
+		if err != nil {
+			return err
+		}
+
+		return comments.Put([]byte(cKey), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// countPinned counts the pinned comments in the bucket that have not expired by now
+func countPinned(comments *bolt.Bucket, now time.Time) (int, error) {
+	var n int
+	err := comments.ForEach(func(_, data []byte) error {
+		var c comment
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		if c.Pinned && !c.expired(now) {
+			n++
+		}
+		return nil
+	})
+
+	return n, err
+}
+
+// pinnedFirst moves the pinned comments to the front in the order they were pinned, keeping the order
+// of the comments otherwise. Comments pinned before the time was recorded come first, as they were pinned
+// earlier, and comments pinned at the same time keep their order, so that the order is the same on every list.
+func pinnedFirst(cmts []*comment) {
+	sort.SliceStable(cmts, func(i, j int) bool {
+		a, b := cmts[i], cmts[j]
+		if !a.Pinned || !b.Pinned {
+			return a.Pinned && !b.Pinned
+		}
+
+		if a.PinnedAt == nil || b.PinnedAt == nil {
+			return a.PinnedAt == nil && b.PinnedAt != nil
+		}
+
+		return a.PinnedAt.Before(*b.PinnedAt)
+	})
+}
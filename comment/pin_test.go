@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_commentable_pin(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+
+	past := time.Now().Add(-time.Minute)
+	var ids []string
+	for _, c := range []*comment{{Value: "a"}, {Value: "b"}, {Value: "c"}, {Value: "expired", ExpiresAt: &past}} {
+		added, err := cm.add(c)
+		assert.NoError(t, err)
+		ids = append(ids, added.ID)
+	}
+
+	// expired pinned comments don't count towards the max
+	_, err := cm.pin(ids[3], true, 0, caller{})
+	assert.NoError(t, err)
+
+	admin := caller{id: "mod", admin: true}
+	c, err := cm.pin(ids[0], true, 2, admin)
+	assert.NoError(t, err)
+	assert.True(t, c.Pinned)
+	assert.NotNil(t, c.PinnedAt, "pinning should record when")
+	assert.Equal(t, 2, c.Version, "pinning should increment the version")
+
+	c, err = cm.pin(ids[0], true, 2, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Version, "pinning a pinned comment should change nothing")
+
+	_, err = cm.pin(ids[1], true, 2, admin)
+	assert.NoError(t, err)
+
+	_, err = cm.pin(ids[2], true, 2, admin)
+	assert.Equal(t, errTooManyPinned, err)
+
+	c, err = cm.pin(ids[0], false, 2, admin)
+	assert.NoError(t, err)
+	assert.False(t, c.Pinned)
+	assert.Nil(t, c.PinnedAt)
+
+	_, err = cm.pin(ids[2], true, 2, admin)
+	assert.NoError(t, err, "unpinning should make room for another pinned comment")
+
+	_, err = cm.pin("unknown", true, 2, admin)
+	assert.EqualError(t, err, fmt.Sprintf(commentNotFoundFmt, "unknown", "posts", "my-key"))
+
+	entries, err := recentAudit(db, 10)
+	assert.NoError(t, err)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{"pin", "unpin", "pin", "pin", "pin"}, actions)
+	assert.Equal(t, "mod", entries[0].Actor)
+}
+
+func Test_pinnedFirst(t *testing.T) {
+	t.Parallel()
+
+	earlier := time.Now().Add(-time.Hour)
+	later := time.Now()
+
+	tests := []struct {
+		name string
+		cmts []*comment
+		want []string
+	}{
+		{
+			name: "it moves the pinned comments first and keeps the order otherwise",
+			cmts: []*comment{{ID: "1"}, {ID: "2", Pinned: true}, {ID: "3"}, {ID: "4", Pinned: true}},
+			want: []string{"2", "4", "1", "3"},
+		},
+		{
+			name: "it orders the pinned comments by when they were pinned",
+			cmts: []*comment{
+				{ID: "1"},
+				{ID: "2", Pinned: true, PinnedAt: &later},
+				{ID: "3", Pinned: true, PinnedAt: &earlier},
+				{ID: "4", Pinned: true},
+				{ID: "5", Pinned: true, PinnedAt: &later},
+			},
+			want: []string{"4", "3", "2", "5", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinnedFirst(tt.cmts)
+
+			var ids []string
+			for _, c := range tt.cmts {
+				ids = append(ids, c.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func Test_service_handleList_pinnedPages(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+
+	var ids []string
+	for _, c := range []*comment{{Value: "a"}, {Value: "b", Category: "question"}, {Value: "c"}, {Value: "d"}, {Value: "e"}} {
+		added, err := cm.add(c)
+		assert.NoError(t, err)
+		ids = append(ids, added.ID)
+	}
+
+	// pin d before b, so that d is listed first, waiting a moment so that they are not pinned at the same time
+	_, err := cm.pin(ids[3], true, 0, caller{})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = cm.pin(ids[1], true, 0, caller{})
+	assert.NoError(t, err)
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments?"+query, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var data struct {
+			Comments []comment `json:"comments"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+
+		values := []string{}
+		for _, c := range data.Comments {
+			assert.Equal(t, c.Pinned, c.PinnedAt != nil, "pinned comments should carry when they were pinned")
+			values = append(values, c.Value)
+		}
+		return values
+	}
+
+	assert.Equal(t, []string{"d", "b", "a", "c", "e"}, list(""))
+
+	var paged []string
+	for offset := 0; offset < 5; offset += 2 {
+		paged = append(paged, list(fmt.Sprintf("limit=2&offset=%d", offset))...)
+	}
+	assert.Equal(t, list(""), paged, "the pages should hold every comment once, pinned ones on the first")
+
+	assert.Equal(t, []string{"b"}, list("category=question"), "pinned comments should still be filtered")
+	assert.Equal(t, []string{"a", "c"}, list("limit=2&offset=2"))
+}
+
+func Test_service_handlePin(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	cfg := testConfig()
+	cfg.AdminToken = "secret"
+	cfg.MaxPinnedComments = 1
+
+	svc := newService(db, zap.NewNop(), cfg)
+	assert.NoError(t, svc.setup([]string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	first, err := cm.add(&comment{Value: "first"})
+	assert.NoError(t, err)
+	second, err := cm.add(&comment{Value: "second"})
+	assert.NoError(t, err)
+
+	path := func(id, action string) string {
+		return fmt.Sprintf("/v1/posts/my-key/comments/%s/%s", id, action)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		wantCode int
+		want     string
+		wantPin  bool // whether the response is the pinned comment, which is checked apart from its time of pinning
+	}{
+		{
+			name:     "it only lets admins pin comments",
+			path:     path(second.ID, "pin"),
+			wantCode: http.StatusForbidden,
+			want:     buildErrResp(errForbidden),
+		},
+		{
+			name:     "it responds with error if the comment does not exist",
+			path:     path("unknown", "pin"),
+			token:    "secret",
+			wantCode: http.StatusNotFound,
+			want:     buildErrResp(errCommentNotFound),
+		},
+		{
+			name:     "it pins the comment",
+			path:     path(second.ID, "pin"),
+			token:    "secret",
+			wantCode: http.StatusOK,
+			wantPin:  true,
+		},
+		{
+			name:     "it responds with error if as many comments as allowed are pinned",
+			path:     path(first.ID, "pin"),
+			token:    "secret",
+			wantCode: http.StatusUnprocessableEntity,
+			want:     buildErrResp(errCommentPinLimit.withArgs(1)),
+		},
+	}
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	// run in order since the cases depend on the comments pinned before
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+
+		mux.ServeHTTP(w, r)
+
+		assert.Equal(t, tt.wantCode, w.Code, tt.name)
+		if tt.wantPin {
+			var c comment
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &c), tt.name)
+			assert.Equal(t, second.ID, c.ID, tt.name)
+			assert.True(t, c.Pinned, tt.name)
+			assert.NotNil(t, c.PinnedAt, tt.name)
+			assert.Equal(t, 2, c.Version, tt.name)
+			continue
+		}
+
+		assert.Equal(t, tt.want, w.Body.String(), tt.name)
+	}
+
+	list := func() []string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments", nil))
+
+		var data struct {
+			Comments []*comment `json:"comments"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &data))
+
+		var values []string
+		for _, c := range data.Comments {
+			values = append(values, c.Value)
+		}
+		return values
+	}
+	assert.Equal(t, []string{"second", "first"}, list(), "pinned comments should be listed first")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path(second.ID, "unpin"), nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"first", "second"}, list())
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/go-chi/chi"
+)
+
+// pprofPrefix is where the profiles are served, which go tool pprof expects
+const pprofPrefix = "/debug/pprof"
+
+// registerPprofRoutes serves the runtime profiles, e.g. go tool pprof http://host/debug/pprof/heap.
+// They are only served to admins if an admin token is configured.
+func (svc *service) registerPprofRoutes(r chi.Router) {
+	if svc.cfg.AdminToken != "" {
+		r.Use(svc.adminOnly)
+	}
+
+	r.HandleFunc("/cmdline", pprof.Cmdline)
+	r.HandleFunc("/profile", pprof.Profile)
+	r.HandleFunc("/symbol", pprof.Symbol)
+	r.HandleFunc("/trace", pprof.Trace)
+	r.HandleFunc("/*", pprof.Index) // the index at /debug/pprof/ and the named profiles, e.g. heap
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_pprof(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		pprof      bool
+		adminToken string
+		token      string
+		path       string
+		wantCode   int
+	}{
+		{
+			name:     "it does not serve the profiles by default",
+			path:     "/debug/pprof/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it serves the index if enabled",
+			pprof:    true,
+			path:     "/debug/pprof/",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the named profiles if enabled",
+			pprof:    true,
+			path:     "/debug/pprof/heap",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the command line if enabled",
+			pprof:    true,
+			path:     "/debug/pprof/cmdline",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "it rejects callers that are not admins if an admin token is set",
+			pprof:      true,
+			adminToken: "secret",
+			path:       "/debug/pprof/heap",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "it serves the profiles to admins if an admin token is set",
+			pprof:      true,
+			adminToken: "secret",
+			token:      "secret",
+			path:       "/debug/pprof/heap",
+			wantCode:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Pprof = tt.pprof
+			cfg.AdminToken = tt.adminToken
+
+			mux := chi.NewRouter()
+			svc := newService(nil, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const prettyHeader = "X-Pretty"
+
+// prettyWriter marks a response whose payload is indented, see pretty
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+// pretty has the payload of the response indented if asked for with ?pretty=true or the X-Pretty header,
+// e.g. to read raw responses while debugging. Responses are compact otherwise to keep them small.
+func (svc *service) pretty(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+		if header, _ := strconv.ParseBool(r.Header.Get(prettyHeader)); header {
+			pretty = true
+		}
+
+		if pretty {
+			w = prettyWriter{w}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	livezPath  = "/livez"
+	readyzPath = "/readyz"
+
+	probeOK           = "OK"
+	probeFailed       = "FAILED"
+	probeUnavailable  = "UNAVAILABLE"
+	probeShuttingDown = "SHUTTING_DOWN"
+)
+
+// probeCheck is the outcome of checking a dependency the service needs to serve
+type probeCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// probeResponse is the payload of the liveness and readiness probes
+type probeResponse struct {
+	Status string                `json:"status"`
+	Checks map[string]probeCheck `json:"checks,omitempty"`
+}
+
+// isProbe reports whether the request is to one of the probes, which answer for themselves during the shutdown
+func isProbe(r *http.Request) bool {
+	return r.URL.Path == livezPath || r.URL.Path == readyzPath
+}
+
+// handleLivez responds with OK as long as the process serves requests, even while shutting down,
+// so that it is not restarted for a failing dependency a restart wouldn't fix
+func (svc *service) handleLivez(w http.ResponseWriter, r *http.Request) {
+	svc.respondWithPayload(w, probeResponse{Status: probeOK}, http.StatusOK)
+}
+
+// handleReadyz responds with OK if every db can be read from, and with a 503 otherwise or once the shutdown
+// started, so that traffic is steered away from the instance before it exits
+func (svc *service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&svc.draining) == 1 {
+		svc.respondWithPayload(w, probeResponse{Status: probeShuttingDown}, http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := probeResponse{Status: probeOK, Checks: map[string]probeCheck{"db": svc.checkDB(svc.db)}}
+	for kind, db := range svc.shards {
+		resp.Checks["db:"+kind] = svc.checkDB(db)
+	}
+
+	code := http.StatusOK
+	for _, c := range resp.Checks {
+		if c.Status != probeOK {
+			resp.Status = probeUnavailable
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	svc.respondWithPayload(w, resp, code)
+}
+
+// checkDB reads the first bucket of db, which fails if the file is closed or can't be read
+func (svc *service) checkDB(db *bolt.DB) probeCheck {
+	err := db.View(func(tx *bolt.Tx) error {
+		tx.Cursor().First()
+		return nil
+	})
+	if err != nil {
+		svc.logger.Warn("readiness check of the db failed", zap.Error(err), zap.String("path", db.Path()))
+		return probeCheck{Status: probeFailed, Error: err.Error()}
+	}
+
+	return probeCheck{Status: probeOK}
+}
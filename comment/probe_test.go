@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleLivez(t *testing.T) {
+	t.Parallel()
+
+	for _, draining := range []bool{false, true} {
+		mux := chi.NewRouter()
+		svc := newService(nil, zap.NewNop(), testConfig())
+		svc.registerRoutes(mux)
+		if draining {
+			svc.startDraining()
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"OK"}`, w.Body.String())
+	}
+}
+
+func Test_service_handleReadyz(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		closeDB    bool
+		draining   bool
+		wantCode   int
+		wantStatus string
+		wantDB     string
+	}{
+		{
+			name:       "it responds with OK if the db can be read from",
+			wantCode:   http.StatusOK,
+			wantStatus: probeOK,
+			wantDB:     probeOK,
+		},
+		{
+			name:       "it responds with 503 if the db can't be read from",
+			closeDB:    true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: probeUnavailable,
+			wantDB:     probeFailed,
+		},
+		{
+			name:       "it responds with 503 while shutting down",
+			draining:   true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: probeShuttingDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			path := db.Path()
+			defer os.Remove(path)
+			defer db.Close()
+
+			if tt.closeDB {
+				assert.NoError(t, db.Close())
+			}
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+			if tt.draining {
+				svc.startDraining()
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Empty(t, w.Header().Get("Connection"))
+
+			var got probeResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.wantDB, got.Checks["db"].Status)
+			if tt.wantDB == probeFailed {
+				assert.NotEmpty(t, got.Checks["db"].Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	reconcileOff    = "off"    // leave the buckets of types that are no longer configured alone
+	reconcileWarn   = "warn"   // log them at startup
+	reconcileRemove = "remove" // remove them along with all their comments
+)
+
+// reconcileMode is what setup does about the buckets of types that are no longer configured
+type reconcileMode string
+
+// Decode implements envconfig.Decoder so that an unknown mode fails the startup
+func (m *reconcileMode) Decode(value string) error {
+	switch value {
+	case reconcileOff, reconcileWarn, reconcileRemove:
+		*m = reconcileMode(value)
+	default:
+		return fmt.Errorf("unknown reconcile mode %q, expected one of %s, %s or %s",
+			value, reconcileOff, reconcileWarn, reconcileRemove)
+	}
+
+	return nil
+}
+
+// reconcile logs the buckets of types that are in a db but not among the kinds kept in it,
+// and removes them if configured to
+func (svc *service) reconcile(kinds []string) error {
+	if svc.cfg.ReconcileTypes == reconcileOff {
+		return nil
+	}
+
+	var stale []string
+	staleIn := map[*bolt.DB][]string{}
+	for _, db := range svc.dbs() {
+		s, err := staleTypes(db, svc.kindsIn(db, kinds))
+		if err != nil {
+			return err
+		}
+
+		stale = append(stale, s...)
+		staleIn[db] = s
+	}
+
+	if len(stale) == 0 {
+		return nil
+	}
+
+	if svc.cfg.ReconcileTypes != reconcileRemove {
+		svc.logger.Warn("found types that are no longer configured, set RECONCILETYPES=remove to remove them",
+			zap.Strings("stale", stale))
+		return nil
+	}
+
+	for db, s := range staleIn {
+		if err := removeTypes(db, s); err != nil {
+			return err
+		}
+	}
+
+	svc.logger.Warn("removed types that are no longer configured", zap.Strings("removed", stale))
+	return nil
+}
+
+// staleTypes returns the types that have a bucket in the db but are not among kinds
+func staleTypes(db *bolt.DB, kinds []string) ([]string, error) {
+	configured := map[string]bool{}
+	for _, k := range kinds {
+		configured[k] = true
+	}
+
+	var stale []string
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if strings.HasPrefix(string(name), "_") { // reserved for the service, e.g. the audit trail
+				return nil
+			}
+
+			if !configured[string(name)] {
+				stale = append(stale, string(name))
+			}
+			return nil
+		})
+	})
+
+	return stale, err
+}
+
+// removeTypes removes the buckets of the types along with everything in them
+func removeTypes(db *bolt.DB, kinds []string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, k := range kinds {
+			if err := tx.DeleteBucket([]byte(k)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_reconcileMode_Decode(t *testing.T) {
+	t.Parallel()
+
+	var m reconcileMode
+	assert.NoError(t, m.Decode(reconcileRemove))
+	assert.Equal(t, reconcileMode(reconcileRemove), m)
+	assert.EqualError(t, m.Decode("delete"), `unknown reconcile mode "delete", expected one of off, warn or remove`)
+}
+
+func Test_service_setup_reconcile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mode       reconcileMode
+		wantLogged string
+		wantField  string // holding the stale types in the log entry
+		wantTypes  []string
+	}{
+		{
+			name:      "it leaves stale types alone if off",
+			mode:      reconcileOff,
+			wantTypes: []string{string(auditKey), "authors", "books", "posts"},
+		},
+		{
+			name:       "it warns about stale types by default",
+			mode:       reconcileWarn,
+			wantLogged: "found types that are no longer configured, set RECONCILETYPES=remove to remove them",
+			wantField:  "stale",
+			wantTypes:  []string{string(auditKey), "authors", "books", "posts"},
+		},
+		{
+			name:       "it removes stale types if configured to",
+			mode:       reconcileRemove,
+			wantLogged: "removed types that are no longer configured",
+			wantField:  "removed",
+			wantTypes:  []string{string(auditKey), "books"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+			assert.NoError(t, setup(db, []string{string(auditKey), "authors", "books", "posts"}))
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			cfg := testConfig()
+			cfg.ReconcileTypes = tt.mode
+			svc := newService(db, zap.New(core), cfg)
+
+			assert.NoError(t, svc.setup([]string{"books"}))
+
+			var types []string
+			db.View(func(tx *bolt.Tx) error {
+				return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+					types = append(types, string(name))
+					return nil
+				})
+			})
+			assert.Equal(t, tt.wantTypes, types)
+
+			if tt.wantLogged == "" {
+				assert.Equal(t, 0, logs.Len())
+				return
+			}
+
+			entries := logs.All()
+			assert.Len(t, entries, 1)
+			assert.Equal(t, tt.wantLogged, entries[0].Message)
+			assert.Equal(t, []interface{}{"authors", "posts"}, entries[0].ContextMap()[tt.wantField])
+		})
+	}
+}
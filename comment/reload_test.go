@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_service_reload(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.MaxKeyLength = 10
+	cfg.MaxPollWait = time.Second
+	svc := newService(nil, zap.NewNop(), cfg)
+	assert.Equal(t, cfg, svc.config())
+
+	next := cfg
+	next.Port = 8080
+	next.DSN = "db/other.db"
+	next.LogLevel = zapcore.DebugLevel
+	next.AccessLogLevel = zapcore.WarnLevel
+	next.MaxKeyLength = 20
+	next.MaxPollWait = time.Minute
+	next.MaxCommentWords = 100
+	next.Categories = []string{"review"}
+	next.MaxCommentsPerResource = 1000
+	next.SpamThreshold = 0.5
+	next.DuplicateMode = duplicateReject
+	svc.reload(next)
+
+	want := cfg
+	want.LogLevel = zapcore.DebugLevel
+	want.AccessLogLevel = zapcore.WarnLevel
+	want.MaxKeyLength = 20
+	want.MaxPollWait = time.Minute
+	want.MaxCommentWords = 100
+	want.Categories = []string{"review"}
+	want.MaxCommentsPerResource = 1000
+	want.SpamThreshold = 0.5
+	want.DuplicateMode = duplicateReject
+	assert.Equal(t, want, svc.config(), "only the reloadable settings should change")
+	assert.Equal(t, cfg, svc.cfg, "the config the service was started with should be kept")
+}
+
+// not parallel as it changes the environment of the process
+func Test_applyEnvFile(t *testing.T) {
+	for _, k := range []string{"COMMENT_TEST_RELOAD_SAME", "COMMENT_TEST_RELOAD_OLD", "COMMENT_TEST_RELOAD_NEW"} {
+		defer os.Unsetenv(k)
+	}
+	defer func() { fileEnv = map[string]envValue{} }()
+
+	os.Setenv("COMMENT_TEST_RELOAD_SAME", "same")
+	os.Setenv("COMMENT_TEST_RELOAD_OLD", "old")
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("# limits\nCOMMENT_TEST_RELOAD_SAME=same\n\nCOMMENT_TEST_RELOAD_OLD = new\nCOMMENT_TEST_RELOAD_NEW=a=b\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	changed, err := applyEnvFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"COMMENT_TEST_RELOAD_NEW", "COMMENT_TEST_RELOAD_OLD"}, changed)
+	assert.Equal(t, "new", os.Getenv("COMMENT_TEST_RELOAD_OLD"))
+	assert.Equal(t, "a=b", os.Getenv("COMMENT_TEST_RELOAD_NEW"))
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte("COMMENT_TEST_RELOAD_SAME=same\n"), 0600))
+
+	changed, err = applyEnvFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"COMMENT_TEST_RELOAD_NEW", "COMMENT_TEST_RELOAD_OLD"}, changed)
+	assert.Equal(t, "old", os.Getenv("COMMENT_TEST_RELOAD_OLD"), "removed lines should revert to the previous value")
+	_, ok := os.LookupEnv("COMMENT_TEST_RELOAD_NEW")
+	assert.False(t, ok, "removed lines should unset the env vars that were not set before")
+	assert.Equal(t, "same", os.Getenv("COMMENT_TEST_RELOAD_SAME"))
+}
+
+func Test_reloadConfig_noConfigFile(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.ConfigFile = ""
+	svc := newService(nil, zap.NewNop(), cfg)
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	reloadConfig(zap.New(core), zap.NewAtomicLevelAt(zapcore.InfoLevel), svc)
+
+	assert.Equal(t, 1, logs.FilterMessage("ignored the config reload, it requires CONFIGFILE to be set").Len())
+	assert.Nil(t, svc.live.Load(), "the config should not be reloaded")
+}
+
+func Test_applyEnvFile_invalid(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("COMMENT_TEST_RELOAD_INVALID\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	_, err = applyEnvFile(f.Name())
+	assert.EqualError(t, err, f.Name()+":1: expected KEY=value, got COMMENT_TEST_RELOAD_INVALID")
+
+	_, err = applyEnvFile(f.Name() + ".missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/unicode/norm"
+)
+
+// unsafeHTMLTags can't be allowed in comments, as they run scripts or embed other documents
+var unsafeHTMLTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "object": true, "embed": true,
+	"form": true, "input": true, "button": true, "textarea": true, "select": true, "link": true,
+	"meta": true, "base": true, "svg": true, "math": true, "template": true,
+}
+
+// voidHTMLTags have no content and so are never closed
+var voidHTMLTags = map[string]bool{"br": true, "hr": true, "img": true, "wbr": true}
+
+// safeURLSchemes are the schemes links in comments may have, relative links have none
+var safeURLSchemes = map[string]bool{"": true, "http": true, "https": true, "mailto": true}
+
+// htmlTags is the set of html tags comments may be formatted with, e.g. b,i,a,code.
+// Unsafe tags, e.g. script, fail the startup.
+type htmlTags map[string]bool
+
+// Decode implements envconfig.Decoder
+func (t *htmlTags) Decode(value string) error {
+	tags := htmlTags{}
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		if unsafeHTMLTags[tag] {
+			return fmt.Errorf("html tag %q can't be allowed in comments", tag)
+		}
+		tags[tag] = true
+	}
+
+	*t = tags
+	return nil
+}
+
+// sanitizeHTML strips every html tag of the value that is not allowed, along with the content of
+// scripts and styles. Without allowed tags the value is plain text: entities are decoded and the text is
+// kept unescaped, e.g. "a < b &amp; c" becomes "a < b & c", as it is only ever html once a client renders
+// it, which must escape it. With allowed tags the value is html: text is escaped, so that tags nested in
+// stripped ones, as in "<<b>img src=x onerror=y>", can't come together as live html, allowed tags lose
+// every attribute but the href of links with a safe scheme, and tags left open are closed so that they
+// can't spill over the page.
+func sanitizeHTML(value string, allowed htmlTags) string {
+	escape := html.EscapeString
+	if len(allowed) == 0 {
+		escape = func(text string) string { return text }
+	}
+
+	var b strings.Builder
+	var open []string // allowed tags that have not been closed yet
+	skip := 0         // depth of script and style tags, whose content is dropped
+
+	z := html.NewTokenizer(strings.NewReader(value))
+	for {
+		tt := z.Next()
+		raw := string(z.Raw()) // read first as it may change once the token is read
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF { // the tokenizer only fails reading, which a string never does
+				return ""
+			}
+
+			// a tag left unfinished at the end is no tag, e.g. in "if x<y then", so it is kept as text
+			if skip == 0 {
+				b.WriteString(escape(html.UnescapeString(raw)))
+			}
+			break
+		}
+
+		tok := z.Token()
+		switch tt {
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(escape(tok.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if tok.Data == "script" || tok.Data == "style" {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+
+			if skip > 0 || !allowed[tok.Data] {
+				continue
+			}
+
+			b.WriteString(startTag(tok))
+			if tt == html.StartTagToken && !voidHTMLTags[tok.Data] {
+				open = append(open, tok.Data)
+			}
+		case html.EndTagToken:
+			if tok.Data == "script" || tok.Data == "style" {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+
+			if skip > 0 || !allowed[tok.Data] {
+				continue
+			}
+
+			// closes the tags opened within the closed one, and is dropped if it was never opened
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.Data {
+					for _, tag := range reversed(open[i:]) {
+						b.WriteString("</" + tag + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+		// comments and doctypes are always dropped
+	}
+
+	for _, tag := range reversed(open) {
+		b.WriteString("</" + tag + ">")
+	}
+
+	return b.String()
+}
+
+// startTag renders the start tag of an allowed tag, keeping only the href of links with a safe scheme
+func startTag(tok html.Token) string {
+	tag := "<" + tok.Data
+	if tok.Data == "a" {
+		for _, attr := range tok.Attr {
+			if attr.Namespace != "" || attr.Key != "href" {
+				continue
+			}
+
+			if u, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil && safeURLSchemes[strings.ToLower(u.Scheme)] {
+				tag += ` href="` + html.EscapeString(attr.Val) + `" rel="nofollow noopener"`
+			}
+			break
+		}
+	}
+
+	if tok.Type == html.SelfClosingTagToken {
+		return tag + "/>"
+	}
+
+	return tag + ">"
+}
+
+func reversed(tags []string) []string {
+	r := make([]string, len(tags))
+	for i, tag := range tags {
+		r[len(tags)-1-i] = tag
+	}
+
+	return r
+}
+
+// normalizeUnicode returns the value in unicode normalization form C, e.g. with an e followed by a combining
+// acute accent composed to é, unless disabled, so that duplicate detection and search compare comments alike
+func (svc *service) normalizeUnicode(value string) string {
+	if !svc.cfg.NormalizeUnicode {
+		return value
+	}
+
+	return norm.NFC.String(value)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_htmlTags_Decode(t *testing.T) {
+	t.Parallel()
+
+	var tags htmlTags
+	assert.NoError(t, tags.Decode(" B,i, a ,,code"))
+	assert.Equal(t, htmlTags{"b": true, "i": true, "a": true, "code": true}, tags)
+
+	assert.NoError(t, tags.Decode(""))
+	assert.Empty(t, tags)
+
+	assert.EqualError(t, tags.Decode("b,Script"), `html tag "script" can't be allowed in comments`)
+}
+
+func Test_sanitizeHTML(t *testing.T) {
+	t.Parallel()
+
+	rich := htmlTags{"b": true, "i": true, "a": true, "code": true, "br": true}
+	tests := []struct {
+		name    string
+		value   string
+		allowed htmlTags
+		want    string
+	}{
+		{
+			name:  "it strips all tags from plain text",
+			value: `<p>a <b>bold</b> <a href="https://example.com">link</a></p>`,
+			want:  "a bold link",
+		},
+		{
+			name:  "it keeps plain text unescaped",
+			value: `Tom & Jerry <3 "quotes"`,
+			want:  `Tom & Jerry <3 "quotes"`,
+		},
+		{
+			name:  "it decodes the entities of plain text",
+			value: "a < b && c > d &amp; 3<4",
+			want:  "a < b && c > d & 3<4",
+		},
+		{
+			name:  "it keeps an unfinished tag at the end as text",
+			value: "if x<y then",
+			want:  "if x<y then",
+		},
+		{
+			name:    "it does not let tags nested in stripped ones through html",
+			value:   "<<img src=x onerror=alert(1)>img src=x onerror=alert(1)><b>hi</b>",
+			allowed: htmlTags{"b": true},
+			want:    "&lt;img src=x onerror=alert(1)&gt;<b>hi</b>",
+		},
+		{
+			name:  "it drops scripts and styles along with their content",
+			value: "hi<script>alert(1)</script><style>p{}</style> there",
+			want:  "hi there",
+		},
+		{
+			name:  "it drops html comments",
+			value: "hi<!-- <b>hidden</b> --> there",
+			want:  "hi there",
+		},
+		{
+			name:  "it handles multibyte characters",
+			value: "héllo <i>wörld</i> 👋",
+			want:  "héllo wörld 👋",
+		},
+		{
+			name:    "it keeps allowed tags",
+			value:   "<b>bold</b>, <i>italic</i> and <code>x := 1</code><br/>",
+			allowed: rich,
+			want:    "<b>bold</b>, <i>italic</i> and <code>x := 1</code><br/>",
+		},
+		{
+			name:    "it strips tags that are not allowed but keeps their content",
+			value:   `<div onclick="x()"><u>under</u>lined</div>`,
+			allowed: rich,
+			want:    "underlined",
+		},
+		{
+			name:    "it strips the attributes of allowed tags",
+			value:   `<b onmouseover="alert(1)" style="color:red">bold</b>`,
+			allowed: rich,
+			want:    "<b>bold</b>",
+		},
+		{
+			name:    "it keeps links with a safe scheme",
+			value:   `<a href="https://example.com/?a=1&amp;b=2" target="_blank">link</a>`,
+			allowed: rich,
+			want:    `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener">link</a>`,
+		},
+		{
+			name:    "it drops the href of links with an unsafe scheme",
+			value:   `<a href=" JavaScript:alert(1)">link</a>`,
+			allowed: rich,
+			want:    "<a>link</a>",
+		},
+		{
+			name:    "it escapes text in rich comments",
+			value:   `1 < 2 & "quotes" <b>&lt;script&gt;</b>`,
+			allowed: rich,
+			want:    "1 &lt; 2 &amp; &#34;quotes&#34; <b>&lt;script&gt;</b>",
+		},
+		{
+			name:    "it closes tags left open",
+			value:   "<b>bold <i>and italic",
+			allowed: rich,
+			want:    "<b>bold <i>and italic</i></b>",
+		},
+		{
+			name:    "it closes the tags opened within a closed one and drops closing tags never opened",
+			value:   "</i><b>bold <i>italic</b> after",
+			allowed: rich,
+			want:    "<b>bold <i>italic</i></b> after",
+		},
+		{
+			name:    "it does not let scripts through allowed tags",
+			value:   "<b><script>alert(1)</script></b><script>alert(2)",
+			allowed: rich,
+			want:    "<b></b>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeHTML(tt.value, tt.allowed))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// commentSchema is the json schema of the comments added and updated by clients. It only checks
+// the shape of the payload, the rules of the service, e.g. the allowed categories, are checked by validate.
+// Other fields are allowed since clients send back the comments they got, which carry e.g. their id.
+const commentSchema = `{
+	"type": "object",
+	"properties": {
+		"value": {"type": "string"},
+		"author": {"type": "string"},
+		"category": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"attachments": {"type": "array", "items": {"type": "string"}},
+		"visibility": {"type": "string"},
+		"expires_at": {"type": ["string", "null"], "format": "date-time"},
+		"version": {"type": "integer", "minimum": 0}
+	}
+}`
+
+// commentPatchSchema is the json schema of the merge patches clients update comments with,
+// in which the fields that can be cleared may be null. The value can be sent as null too,
+// so that it is rejected as empty like any other empty value.
+const commentPatchSchema = `{
+	"type": "object",
+	"properties": {
+		"value": {"type": ["string", "null"]},
+		"author": {"type": "string"},
+		"category": {"type": ["string", "null"]},
+		"tags": {"type": ["array", "null"], "items": {"type": "string"}},
+		"attachments": {"type": ["array", "null"], "items": {"type": "string"}},
+		"visibility": {"type": ["string", "null"]},
+		"expires_at": {"type": ["string", "null"], "format": "date-time"},
+		"version": {"type": "integer", "minimum": 0}
+	}
+}`
+
+// compiled once at startup, panicking if a schema is invalid
+var (
+	commentPayload      = mustCompileSchema(commentSchema)
+	commentPatchPayload = mustCompileSchema(commentPatchSchema)
+)
+
+func mustCompileSchema(schema string) *gojsonschema.Schema {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("invalid json schema: %v", err))
+	}
+
+	return s
+}
+
+// fieldError is why a field of a payload was rejected, sent alike for schema and rule failures
+type fieldError struct {
+	Field   string `json:"field"` // e.g. tags.0, (root) for the payload itself
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// schemaError is returned for payloads that are valid json but don't match their schema
+type schemaError []fieldError
+
+func (e schemaError) Error() string {
+	reasons := make([]string, len(e))
+	for i, f := range e {
+		reasons[i] = f.Field + ": " + f.Message
+	}
+
+	return "payload does not match its schema, " + strings.Join(reasons, "; ")
+}
+
+// checkSchema validates the json payload against the schema,
+// returning a schemaError listing every field that failed and why
+func checkSchema(s *gojsonschema.Schema, data []byte) error {
+	res, err := s.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil { // the payload is not json
+		return err
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	fields := make(schemaError, len(res.Errors()))
+	for i, e := range res.Errors() {
+		fields[i] = fieldError{Field: e.Field(), Code: strings.ToUpper(e.Type()), Message: e.Description()}
+	}
+
+	return fields
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantFields schemaError
+		wantErr    bool
+	}{
+		{
+			name:    "it accepts a comment matching the schema",
+			payload: `{"value": "nice", "tags": ["go"], "expires_at": "2030-01-02T15:04:05Z", "version": 2}`,
+		},
+		{
+			name:    "it accepts fields the schema does not know, e.g. of comments sent back",
+			payload: `{"id": "123", "value": "nice", "length": 4}`,
+		},
+		{
+			name:    "it lists every field that does not match the schema",
+			payload: `{"value": ["nice"], "tags": ["go", 1], "version": -1}`,
+			wantFields: schemaError{
+				{Field: "value", Code: "INVALID_TYPE", Message: "Invalid type. Expected: string, given: array"},
+				{Field: "tags.1", Code: "INVALID_TYPE", Message: "Invalid type. Expected: string, given: integer"},
+				{Field: "version", Code: "NUMBER_GTE", Message: "Must be greater than or equal to 0"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "it rejects an invalid timestamp",
+			payload: `{"value": "nice", "expires_at": "tomorrow"}`,
+			wantFields: schemaError{
+				{Field: "expires_at", Code: "FORMAT", Message: "Does not match format 'date-time'"},
+			},
+			wantErr: true,
+		},
+		{
+			name:       "it returns the parse error of a payload that is not json",
+			payload:    `{"value": "}`,
+			wantFields: nil,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSchema(commentPayload, []byte(tt.payload))
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			fields, _ := err.(schemaError)
+			assert.ElementsMatch(t, tt.wantFields, fields)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// errSearchLimitReached stops the search once as many comments matched as asked for,
+// and errSearchScanLimitReached once as many comments were read as it may read
+var (
+	errSearchLimitReached     = errors.New("search limit reached")
+	errSearchScanLimitReached = errors.New("search scan limit reached")
+)
+
+// searchResource holds the comments of a resource that match a search
+type searchResource struct {
+	Key      string            `json:"key"`
+	Comments []commentResponse `json:"comments"`
+}
+
+// handleSearch responds with the comments of every resource of the type whose value contains the q query
+// parameter, grouped by resource, e.g. for a site-wide search within a category. At most as many comments
+// as the limit query parameter asks for are matched, the scan stops once they are found or once MAXSEARCHSCAN
+// comments were read, in which case a Warning header tells that there may be more matches.
+func (svc *service) handleSearch(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, commentableTypeParam)
+
+	// the query is normalized like the comments are, so that it matches them however its accents were sent
+	q := svc.normalizeUnicode(strings.TrimSpace(r.URL.Query().Get("q")))
+	if q == "" {
+		svc.fail(w, svc.logger, errSearchQueryMissing, nil)
+		return
+	}
+
+	limit, e := svc.pageSize(r, errCommentLimitInvalid)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	scan := svc.config().MaxSearchScan
+	resources, complete, err := svc.search(kind, q, limit, scan, callerOf(r))
+	if err != nil {
+		svc.fail(w, svc.logger, errSearch, err,
+			zap.String(commentableTypeParam, kind),
+			zap.String("q", q),
+		)
+		return
+	}
+
+	if !complete {
+		w.Header().Set("Warning", fmt.Sprintf(`199 - "search stopped after reading %d comments"`, scan))
+	}
+
+	svc.respondWithList(w, "resources", resources)
+}
+
+// search returns the comments of the resources of the type that the caller can see and whose value
+// contains q, ignoring case, grouped by resource in the order of their keys and in the order of list within
+// each. The type is read in a single transaction, which stops once limit comments matched unless limit is 0,
+// or once maxScan comments were read unless maxScan is 0, in which case it reports that it is not complete.
+// Resources without matches are left out.
+func (svc *service) search(kind, q string, limit, maxScan int, cl caller) ([]searchResource, bool, error) {
+	q = strings.ToLower(q)
+	resources := []searchResource{}
+	matched, scanned := 0, 0
+	err := svc.dbOf(kind).View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(kind)) // bucket for posts
+		if cmBucket == nil {
+			return (&commentable{kind: kind}).typeNotFound()
+		}
+
+		now := time.Now()
+		return cmBucket.ForEach(func(rKey, v []byte) error {
+			if v != nil { // only the nested buckets are commentables
+				return nil
+			}
+
+			comments := cmBucket.Bucket(rKey).Bucket(commentsKey)
+			if comments == nil {
+				return nil
+			}
+
+			var found []*comment
+			err := comments.ForEach(func(_, data []byte) error {
+				if maxScan > 0 && scanned >= maxScan {
+					return errSearchScanLimitReached
+				}
+				scanned++
+
+				var c comment
+				if err := json.Unmarshal(data, &c); err != nil {
+					return err
+				}
+
+				// hidden comments are left out like they are from lists
+				if c.expired(now) || c.Hidden || !cl.canSee(&c) || !strings.Contains(strings.ToLower(c.Value), q) {
+					return nil
+				}
+
+				found = append(found, &c)
+				matched++
+				if limit > 0 && matched >= limit {
+					return errSearchLimitReached
+				}
+				return nil
+			})
+
+			if len(found) > 0 {
+				resources = append(resources, searchResource{Key: string(rKey), Comments: newCommentResponses(found, cl)})
+			}
+			return err
+		})
+	})
+	if err == errSearchScanLimitReached {
+		return resources, false, nil
+	}
+
+	if err != nil && err != errSearchLimitReached {
+		return nil, false, err
+	}
+
+	return resources, true, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleSearch(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts", "books"}))
+
+	past := time.Now().Add(-time.Minute)
+	cmts := map[string][]*comment{
+		"a": {{Value: "Great plot"}, {Value: "boring"}, {Value: "the PLOT twist"}},
+		"b": {{Value: "no spoilers"}, {Value: "plot hole", ExpiresAt: &past}},
+		"c": {{Value: "my plot theory", Author: "jane", Visibility: visibilityPrivate}},
+		"d": {{Value: "buy plot pills", Hidden: true}},
+		"e": {},
+		"f": {{Value: "caf\u00e9 au lait"}},
+	}
+	for k, cs := range cmts {
+		cm := &commentable{db: db, kind: "posts", key: k}
+		assert.NoError(t, cm.ensure())
+		for _, c := range cs {
+			_, err := cm.add(c)
+			assert.NoError(t, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		userID   string
+		wantCode int
+		want     map[string][]string // values of the matching comments by resource key, in order
+		wantKeys []string
+		wantBody string
+	}{
+		{
+			name:     "it groups the matching comments by resource, ignoring case",
+			path:     "/v1/posts/comments/search?q=plot",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"a"},
+			want:     map[string][]string{"a": {"Great plot", "the PLOT twist"}},
+		},
+		{
+			name:     "it searches the private comments the caller can see",
+			path:     "/v1/posts/comments/search?q=plot",
+			userID:   "jane",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"a", "c"},
+			want:     map[string][]string{"a": {"Great plot", "the PLOT twist"}, "c": {"my plot theory"}},
+		},
+		{
+			name:     "it stops once as many comments as the limit matched",
+			path:     "/v1/posts/comments/search?q=plot&limit=1",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"a"},
+			want:     map[string][]string{"a": {"Great plot"}},
+		},
+		{
+			name:     "it matches the comments however the accents of the query were sent",
+			path:     "/v1/posts/comments/search?q=cafe%CC%81",
+			wantCode: http.StatusOK,
+			wantKeys: []string{"f"},
+			want:     map[string][]string{"f": {"caf\u00e9 au lait"}},
+		},
+		{
+			name:     "it responds with no resources if nothing matches",
+			path:     "/v1/books/comments/search?q=plot",
+			wantCode: http.StatusOK,
+			wantKeys: []string{},
+		},
+		{
+			name:     "it responds with error if the query is missing",
+			path:     "/v1/posts/comments/search?q=%20",
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errSearchQueryMissing),
+		},
+		{
+			name:     "it responds with error if the limit is invalid",
+			path:     "/v1/posts/comments/search?q=plot&limit=0",
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentLimitInvalid.withArgs("0")),
+		},
+		{
+			name:     "it responds with error if the commentable type does not exist",
+			path:     "/v1/unknown/comments/search?q=plot",
+			wantCode: http.StatusNotAcceptable,
+			wantBody: buildErrResp(errCommentableTypeNotFound.withArgs("unknown")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(userIDHeader, tt.userID)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+				return
+			}
+
+			var body struct {
+				Resources []struct {
+					Key      string    `json:"key"`
+					Comments []comment `json:"comments"`
+				} `json:"resources"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+			keys := []string{}
+			for _, res := range body.Resources {
+				keys = append(keys, res.Key)
+
+				var values []string
+				for _, c := range res.Comments {
+					values = append(values, c.Value)
+				}
+				assert.Equal(t, tt.want[res.Key], values, res.Key)
+			}
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+}
+
+func Test_service_handleSearch_maxScan(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	cfg := testConfig()
+	cfg.MaxSearchScan = 3
+	cfg.ListEnvelope = envelopeBare
+	svc := newService(db, zap.NewNop(), cfg)
+	assert.NoError(t, svc.setup([]string{"posts"}))
+
+	for k, values := range map[string][]string{"a": {"plot", "boring"}, "b": {"boring", "plot"}} {
+		cm := &commentable{db: db, kind: "posts", key: k}
+		assert.NoError(t, cm.ensure())
+		for _, v := range values {
+			_, err := cm.add(&comment{Value: v})
+			assert.NoError(t, err)
+		}
+	}
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/comments/search?q=plot", nil))
+
+	// the second match of b is never read, however few comments matched
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `199 - "search stopped after reading 3 comments"`, w.Header().Get("Warning"))
+
+	var resources []struct {
+		Key      string    `json:"key"`
+		Comments []comment `json:"comments"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resources))
+	if assert.Len(t, resources, 1) {
+		assert.Equal(t, "a", resources[0].Key)
+		assert.Len(t, resources[0].Comments, 1)
+	}
+}
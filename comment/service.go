@@ -4,11 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-chi/chi"
+	"github.com/xeipuuv/gojsonschema"
 	"go.uber.org/zap"
 )
 
@@ -18,83 +25,335 @@ type key string
 type service struct {
 	logger *zap.Logger
 	db     *bolt.DB
+	shards map[string]*bolt.DB // db of each commentable type kept in a file of its own, see dbOf
+	cfg    config
+	added  *notifier     // wakes up long-polls on new comments
+	cache  *commentCache // nil unless enabled
+
+	draining int32        // set once the shutdown started, see drain
+	live     atomic.Value // config, as last reloaded
 }
 
 const (
-	commentIsInvalid   = "comment could not be parsed"
-	commentNotFoundErr = "comment not found"
-	commentListErr     = "could not load comments"
-	commentDeleteErr   = "comment could not be deleted"
-	commentSaveErr     = "comment could not be saved"
-	commentableSaveErr = "could not provision comments"
+	commentIsInvalid      = "comment could not be parsed"
+	commentEmptyErr       = "comment must not be empty"
+	commentInvalidUTF8Err = "comment must be valid UTF-8"
+	commentNotFoundErr    = "comment not found"
+	commentListErr        = "could not load comments"
+	commentDeleteErr      = "comment could not be deleted"
+	commentSaveErr        = "comment could not be saved"
+	commentableSaveErr    = "could not provision comments"
+	commentClearErr       = "comments could not be deleted"
+
+	auditListErr           = "could not load the audit trail"
+	auditLimitInvalidFmt   = "limit must be a positive number, got %s"
+	commentMoveErr         = "comments could not be moved"
+	commentMoveInvalidErr  = "move must name another resource of the same type in to"
+	commentMoveConflictErr = "target resource already has comments, set merge to move them anyway"
+
+	commentExpiryInvalidErr   = "comment expiry must be in the future"
+	commentPatternMismatchErr = "comment is not in the required format"
+	commentVersionRequiredErr = "comment version is required, set it in the If-Match header or the version field"
+	commentVersionConflictErr = "comment has been modified since the given version"
+	commentSinceInvalidFmt    = "since must be an RFC 3339 timestamp, got %s"
+	commentWaitInvalidFmt     = "wait must be a non-negative duration, e.g. 30s, got %s"
+
+	authorEraseErr     = "comments of the author could not be erased"
+	forbiddenErr       = "only admins are allowed to do this"
+	serviceReadOnlyErr = "service is read-only"
+	dbUnavailableErr   = "service is temporarily unavailable, please retry"
+
+	commentRestoreErr         = "comment could not be restored"
+	commentNotInTrashErr      = "comment not found in the trash"
+	commentRestoreConflictErr = "a comment with the same key already exists"
+
+	snapshotExportErr    = "could not export the db"
+	snapshotImportErr    = "could not import the snapshot"
+	snapshotInvalidErr   = "snapshot could not be parsed"
+	snapshotStructureFmt = "snapshot can't be restored, %s"
 
 	commentableTypeParam = "commentableType"
 	commentableKeyParam  = "commentableKey"
 	commentKeyParam      = "commentKey"
+	authorParam          = "author"
+
+	userIDHeader     = "X-User-ID"
+	totalCountHeader = "X-Total-Count"
+	dedupeKeyHeader  = "X-Dedupe-Key"
+)
+
+const serviceShuttingDownErr = "service is shutting down, please retry"
+
+const corsNotAllowedFmt = "origin %s is not allowed to make %s requests"
+
+const (
+	trendingListErr          = "could not rank the resources"
+	trendingWindowInvalidFmt = "window must be a positive duration, e.g. 24h, got %s"
+)
+
+const (
+	searchErr             = "could not search the comments"
+	searchQueryMissingErr = "q must be set to the text to search for"
 )
 
-func newService(db *bolt.DB, logger *zap.Logger) *service {
-	return &service{db: db, logger: logger}
+const commentStatsByInvalidFmt = "by must be one of hour, day or month, got %s"
+
+const commentTooManyWordsFmt = "comment must not have more than %d words"
+
+const commentFieldsInvalidErr = "comment has invalid fields"
+
+const commentValidationErr = "comment breaks the rules of the service"
+
+const (
+	commentLimitInvalidFmt  = "limit must be a positive number, got %s"
+	commentOffsetInvalidFmt = "offset must be a non-negative number, got %s"
+)
+
+const commentDuplicateErr = "comment duplicates a recent one"
+
+const commentLimitFmt = "%s with key %s has the most comments allowed, %d"
+
+const (
+	commentBulkInvalidErr = "bulk get must list the ids of the comments in an ids array"
+	commentBulkLimitFmt   = "at most %d comments can be got at once"
+)
+
+const (
+	commentExistsErr            = "a comment with the same dedupe key already exists"
+	commentDedupeKeyRequiredErr = "a dedupe key is required with If-None-Match: *, set it in the X-Dedupe-Key header"
+)
+
+const (
+	commentPinErr      = "comment could not be pinned"
+	commentPinLimitFmt = "at most %d comments can be pinned per resource, unpin one first"
+)
+
+const commentUnhideErr = "comment could not be unhidden"
+
+const overviewErr = "could not compute the overview"
+
+const (
+	commentAttachmentInvalidFmt = "attachment, %s, must be an http or https url"
+	commentAttachmentHostFmt    = "attachment host, %s, is not allowed"
+	commentAttachmentLimitFmt   = "comment must not have more than %d attachments"
+)
+
+func newService(db *bolt.DB, logger *zap.Logger, cfg config) *service {
+	return &service{
+		db:     db,
+		logger: logger,
+		cfg:    cfg,
+		added:  newNotifier(),
+		cache:  newCommentCache(cfg.CacheSize),
+	}
 }
 
 func (svc *service) registerRoutes(r chi.Router) {
+	// preflights are answered by cors, before they could be taken for writes or lack the admin token
+	r.Use(svc.accessLog, svc.drain, svc.secureHeaders, svc.cors, svc.redirectSlashes, svc.readOnly, svc.auth, svc.pretty)
+
+	// the api routes are versioned under the configured prefix
+	// while the operational routes stay at the root
+	if svc.cfg.APIPrefix == "" {
+		svc.registerAPIRoutes(r)
+	} else {
+		r.Route(svc.cfg.APIPrefix, svc.registerAPIRoutes)
+	}
+
+	r.Get("/status", svc.handleStatus)
+	r.Get(livezPath, svc.handleLivez)
+	r.Get(readyzPath, svc.handleReadyz)
+	r.Get("/metrics", svc.handleMetrics)
+
+	if svc.cfg.Pprof {
+		r.Route(pprofPrefix, svc.registerPprofRoutes)
+	}
+}
+
+func (svc *service) registerAPIRoutes(r chi.Router) {
+	// DELETE /v1/admin/authors/jane
+	// GET /v1/admin/audit
+	// GET /v1/admin/export
+	// POST /v1/admin/import/full
+	// GET /v1/admin/overview
+	r.With(svc.adminOnly).Route("/admin", func(r chi.Router) {
+		r.Delete(fmt.Sprintf("/authors/{%s}", authorParam), svc.handleEraseAuthor)
+		r.Get("/audit", svc.handleAudit)
+		r.Get("/overview", svc.handleOverview)
+		r.Get("/export", svc.handleExportSnapshot)
+		r.Post("/import/full", svc.handleImportSnapshot)
+	})
+
 	r.With(svc.verifier).Route(fmt.Sprintf("/{%s}", commentableTypeParam), func(r chi.Router) {
-		// create resource comment bucket if not exists
+		// create resource comment bucket if not exists, unless disabled
 		// validate resourceKey
-		r.With(svc.creator, svc.validator).
+		adders := chi.Middlewares{svc.validator}
+		if svc.cfg.AutoCreateResources {
+			adders = chi.Middlewares{svc.creator, svc.validator}
+		}
+		r.With(adders...).
 			Post(fmt.Sprintf("/{%s}/comments", commentableKeyParam), svc.handleAdd)
 
+		// GET /v1/books/comments/trending?window=24h
+		r.Get("/comments/trending", svc.handleTrending)
+
+		// GET /v1/books/comments/search?q=plot&limit=20
+		r.Get("/comments/search", svc.handleSearch)
+
 		// validate resourceKey
 		pathWithParam := fmt.Sprintf("/comments/{%s}", commentKeyParam)
 		r.With(svc.validator).Route(fmt.Sprintf("/{%s}", commentableKeyParam), func(r chi.Router) {
 			r.Get("/comments", svc.handleList)
+			r.Get("/comments/commenters/count", svc.handleCountCommenters)
+			r.Get("/comments/stats", svc.handleStats)
+			r.Get("/comments/latest", svc.handleLatest)
+			r.With(svc.adminOnly).Get("/comments/hidden", svc.handleListHidden)
+			r.With(svc.adminOnly).Delete("/comments", svc.handleClear)
+			r.With(svc.adminOnly).Post("/comments/move", svc.handleMove)
+			r.Post(bulkGetPath, svc.handleBulkGet)
 			r.Get(pathWithParam, svc.handleGet)
 			r.Delete(pathWithParam, svc.handleRemove)
+			r.Post(pathWithParam+"/restore", svc.handleRestore)
+			r.With(svc.adminOnly).Post(pathWithParam+"/pin", svc.handlePin)
+			r.With(svc.adminOnly).Post(pathWithParam+"/unpin", svc.handleUnpin)
+			r.With(svc.adminOnly).Post(pathWithParam+"/unhide", svc.handleUnhide)
 			r.Patch(pathWithParam, svc.handleUpdate)
 		})
 	})
-
-	r.Get("/status", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, "OK")
-	})
 }
 
 func (svc *service) setup(cm []string) error {
-	return setup(svc.db, cm)
+	// every db is set up with the types it keeps
+	for _, db := range svc.dbs() {
+		if err := setup(db, svc.kindsIn(db, cm)); err != nil {
+			return err
+		}
+	}
+
+	if err := svc.reconcile(cm); err != nil {
+		return err
+	}
+
+	return svc.migrateIDs()
 }
 
 func (svc *service) handleAdd(w http.ResponseWriter, r *http.Request) {
-	co := &comment{}
-	err := json.NewDecoder(r.Body).Decode(co)
-	if err != nil || co.Value == "" {
-		svc.respondWithMsg(w, commentIsInvalid, http.StatusBadRequest)
-		svc.logger.Error(commentIsInvalid, zap.Error(err))
+	co, err := svc.decodeComment(r)
+	if err == errInvalidUTF8 {
+		svc.fail(w, svc.logger, errCommentInvalidUTF8, err)
+		return
+	}
+
+	if fields, ok := err.(schemaError); ok {
+		svc.failFields(w, svc.logger, errCommentFieldsInvalid, fields)
+		return
+	}
+
+	if err != nil {
+		svc.fail(w, svc.logger, errCommentInvalid, err)
+		return
+	}
+
+	co.Value = sanitizeHTML(svc.normalizeUnicode(co.Value), svc.cfg.AllowedHTMLTags)
+	if v := svc.validate(co); v != nil {
+		svc.failFields(w, svc.logger, errCommentValidation, v)
 		return
 	}
 
 	k := chi.URLParam(r, commentableKeyParam)
 	c := r.Context().Value(key(k)).(*commentable)
 
-	co, err = c.add(co)
+	// the dedupe key is only ever taken from the header, not from comments sent back as they were got
+	co.DedupeKey = r.Header.Get(dedupeKeyHeader)
+	once := createOnly(r)
+	if once && co.DedupeKey == "" {
+		svc.fail(w, svc.logger, errCommentDedupeKeyRequired, nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	co.CreatedAt = &now
+	co.EditedBy, co.UpdatedAt, co.DeletedAt = "", nil, nil // a new comment has not been edited or deleted yet
+	co.Author = userID(r)
+	co.Tags = normalizeTags(co.Tags)
+	co.Pinned, co.PinnedAt = false, nil // only moderators pin comments
+	co.Mentions = mentions(co.Value)
+	svc.flagSpam(co)
+	if co.Visibility == "" {
+		co.Visibility = visibilityPublic
+	}
+
+	if mode := svc.config().DuplicateMode; mode != duplicateOff {
+		dup, err := svc.findDuplicate(c, co, now)
+		if err != nil {
+			svc.fail(w, svc.logger, errCommentList, err)
+			return
+		}
+
+		if dup != nil {
+			l := svc.logger.With(zap.String("duplicate_mode", string(mode)), zap.String(commentKeyParam, dup.ID))
+			if mode == duplicateReject {
+				svc.fail(w, l, errCommentDuplicate, nil)
+				return
+			}
+
+			l.Info("collapsed a duplicate comment into the earlier one")
+			svc.respondWithPayload(w, newCommentResponse(dup, callerOf(r)), http.StatusOK)
+			return
+		}
+	}
+
+	add := c.add
+	if once {
+		add = c.addOnce
+	}
+
+	c.maxComments = svc.config().MaxCommentsPerResource
+	cmt, err := add(co)
+	svc.cache.invalidate(c.kind, c.key, "")
+	if err == errDedupeKeyTaken {
+		svc.fail(w, svc.logger, errCommentExists, err, zap.String("dedupe_key", co.DedupeKey))
+		return
+	}
+
+	if limitErr, limited := err.(commentLimitError); limited {
+		svc.fail(w, svc.logger, errCommentLimitReached.withArgs(limitErr.kind, limitErr.key, limitErr.max), err)
+		return
+	}
+
 	if err != nil {
-		svc.respondWithMsg(w, commentSaveErr, http.StatusInternalServerError)
-		svc.logger.Error(commentSaveErr, zap.Error(err), zap.String("comment", co.Value))
+		svc.fail(w, svc.logger, errCommentSave, err, zap.String("comment", co.Value))
 		return
 	}
+	svc.added.notify(c.kind, c.key)
 
-	svc.respondWithPayload(w, co, http.StatusOK)
+	svc.warnNearLimit(w, c)
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
 }
 
+// handleUpdate applies the json merge patch in the body to the comment, see commentPatch.
+// The value can't be cleared, so an empty or null one is rejected like on add.
 func (svc *service) handleUpdate(w http.ResponseWriter, r *http.Request) {
-	co := &comment{}
-	err := json.NewDecoder(r.Body).Decode(co)
-	if err != nil || co.Value == "" {
-		svc.respondWithMsg(w, commentIsInvalid, http.StatusBadRequest)
-		svc.logger.Error(commentIsInvalid, zap.Error(err))
+	co, err := svc.decodePatch(r)
+	if err == errInvalidUTF8 {
+		svc.fail(w, svc.logger, errCommentInvalidUTF8, err)
+		return
+	}
+
+	if fields, ok := err.(schemaError); ok {
+		svc.failFields(w, svc.logger, errCommentFieldsInvalid, fields)
+		return
+	}
+
+	if err != nil {
+		svc.fail(w, svc.logger, errCommentInvalid, err)
 		return
 	}
 
+	if co.has("value") {
+		co.Value = sanitizeHTML(svc.normalizeUnicode(co.Value), svc.cfg.AllowedHTMLTags)
+	}
+
 	k := chi.URLParam(r, commentableKeyParam)
 	c := r.Context().Value(key(k)).(*commentable)
 	cKey := chi.URLParam(r, commentKeyParam)
@@ -105,54 +364,170 @@ func (svc *service) handleUpdate(w http.ResponseWriter, r *http.Request) {
 	)
 	cmt, err := c.get(cKey)
 	if err != nil {
-		svc.respondWithMsg(w, commentNotFoundErr, http.StatusBadRequest)
-		l.Error(commentNotFoundErr, zap.Error(err))
+		svc.fail(w, l, errCommentNotFound, err)
 		return
 	}
 
-	cmt.Value = co.Value
+	if !callerOf(r).canSee(cmt) {
+		// private and hidden comments are reported as missing to not leak their existence
+		svc.fail(w, l, errCommentNotFound, fmt.Errorf("comment with key %s can't be seen by the caller", cKey))
+		return
+	}
+
+	version, ok := expectedVersion(r, co.comment, cmt)
+	if !ok {
+		svc.fail(w, l, errCommentVersionRequired, nil)
+		return
+	}
+
+	// the comment is validated as patched since the fields that weren't sent are kept
+	co.apply(cmt)
+	if v := svc.validate(cmt); v != nil {
+		svc.failFields(w, l, errCommentValidation, v)
+		return
+	}
+
+	now := time.Now().UTC()
+	svc.flagSpam(cmt)
+	cmt.UpdatedAt = &now
+	cmt.EditedBy = userID(r)
+	cmt.Version = version
 	cmt, err = c.save(cmt)
+	svc.cache.invalidate(c.kind, c.key, cKey)
 	if err != nil {
-		svc.respondWithMsg(w, commentSaveErr, http.StatusInternalServerError)
-		l.Error(commentSaveErr, zap.Error(err), zap.String("comment", cmt.Value))
+		e := errCommentSave
+		if err == errVersionMismatch {
+			e = errCommentVersionConflict
+		}
+
+		svc.fail(w, l, e, err, zap.String("comment", co.Value))
 		return
 	}
 
-	svc.respondWithPayload(w, cmt, http.StatusOK)
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
 }
 
 func (svc *service) handleList(w http.ResponseWriter, r *http.Request) {
 	k := chi.URLParam(r, commentableKeyParam)
 	c := r.Context().Value(key(k)).(*commentable)
+	l := svc.logger.With(
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+	)
+
+	category := r.URL.Query().Get("category")
+	if category != "" && !svc.allowedCategory(category) {
+		svc.fail(w, svc.logger, errCommentCategoryInvalid.withArgs(category), nil)
+		return
+	}
+
+	since, wait, e := svc.pollParams(r)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	limit, e := svc.pageSize(r, errCommentLimitInvalid)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	offset, e := pageOffset(r)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	if r.URL.Query().Get("format") == formatNDJSON {
+		svc.streamComments(w, l, c, callerOf(r), listFilter(r, category, since), offset, limit)
+		return
+	}
+
+	// start waiting before listing so that a comment added in between is not missed
+	poll := !since.IsZero() && wait > 0
+	var added <-chan struct{}
+	if poll {
+		var done func()
+		added, done = svc.added.wait(c.kind, c.key)
+		defer done()
+	}
 
 	var data struct {
 		Comments []*comment `json:"comments"`
 	}
+	var total int
 	var err error
-	data.Comments, err = c.list()
+	data.Comments, total, err = svc.listComments(r, c, category, since)
 	if err != nil {
-		svc.respondWithMsg(w, fmt.Sprintf("error fetching comments: %v", err), http.StatusInternalServerError)
-		svc.logger.Error(
-			commentListErr,
-			zap.Error(err),
-			zap.String(commentableKeyParam, c.key),
-			zap.String(commentableTypeParam, c.kind),
-		)
+		svc.fail(w, l, errCommentList, err)
+		return
+	}
+
+	// long-poll for the next comment if there are none newer than since yet
+	if poll && len(data.Comments) == 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-added:
+			data.Comments, total, err = svc.listComments(r, c, category, since)
+			if err != nil {
+				svc.fail(w, l, errCommentList, err)
+				return
+			}
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
 	}
 
-	svc.respondWithPayload(w, data, http.StatusOK)
+	// the total is of all comments on the resource the caller can see, regardless of the filters and the page
+	w.Header().Set(totalCountHeader, strconv.Itoa(total))
+	svc.respondWithList(w, "comments", newCommentResponses(page(data.Comments, offset, limit), callerOf(r)))
+}
+
+// listComments lists the comments of the commentable that the caller can see,
+// narrowed down by the category and tag query parameters and to those added after since if set,
+// along with the number of all comments the caller can see
+func (svc *service) listComments(r *http.Request, c *commentable, category string,
+	since time.Time) ([]*comment, int, error) {
+	cmts, err := svc.listAllComments(c)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(filter(cmts, callerOf(r).canSee))
+	cmts = filter(cmts, listFilter(r, category, since))
+	pinnedFirst(cmts)
+	return cmts, total, nil
+}
+
+// listFilter keeps the comments the caller can see that are in the category and have the tag
+// of the query parameters, and that were added after since, each if set
+func listFilter(r *http.Request, category string, since time.Time) func(*comment) bool {
+	cl := callerOf(r)
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	return func(cmt *comment) bool {
+		return cl.canSee(cmt) &&
+			(category == "" || cmt.Category == category) &&
+			(tag == "" || cmt.hasTag(tag)) &&
+			(since.IsZero() || addedSince(since)(cmt))
+	}
 }
 
 func (svc *service) handleGet(w http.ResponseWriter, r *http.Request) {
 	k := chi.URLParam(r, commentableKeyParam)
 	c := r.Context().Value(key(k)).(*commentable)
 	cKey := chi.URLParam(r, commentKeyParam)
-	cmt, err := c.get(cKey)
+	cmt, err := svc.getComment(c, cKey)
+	if err == nil && !callerOf(r).canSee(cmt) {
+		// private and hidden comments are reported as missing to not leak their existence
+		err = fmt.Errorf("comment with key %s can't be seen by the caller", cKey)
+	}
+
 	if err != nil {
-		svc.respondWithMsg(w, commentNotFoundErr, http.StatusBadRequest)
-		svc.logger.Error(
-			commentNotFoundErr,
-			zap.Error(err),
+		svc.fail(w, svc.logger, errCommentNotFound, err,
 			zap.String(commentKeyParam, cKey),
 			zap.String(commentableKeyParam, c.key),
 			zap.String(commentableTypeParam, c.kind),
@@ -160,7 +535,56 @@ func (svc *service) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	svc.respondWithPayload(w, cmt, http.StatusOK)
+	modified := cmt.lastModified()
+	if modified != nil {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	etag, err := cmt.etag()
+	if err != nil {
+		svc.logger.Warn("could not compute the etag of the comment", zap.Error(err), zap.String(commentKeyParam, cKey))
+	} else {
+		w.Header().Set("ETag", etag)
+	}
+
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
+}
+
+// notModified reports whether the client already has the current version of the resource, going by
+// the If-None-Match header if set and by the If-Modified-Since header otherwise.
+// An empty etag or a nil modified time never match.
+func notModified(r *http.Request, etag string, modified *time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if modified == nil {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// the header only has a precision of seconds
+	return !modified.Truncate(time.Second).After(since)
 }
 
 func (svc *service) handleRemove(w http.ResponseWriter, r *http.Request) {
@@ -175,31 +599,214 @@ func (svc *service) handleRemove(w http.ResponseWriter, r *http.Request) {
 
 	cmt, err := c.get(cKey)
 	if err != nil {
-		svc.respondWithMsg(w, commentNotFoundErr, http.StatusBadRequest)
-		l.Error(commentNotFoundErr, zap.Error(err))
+		svc.fail(w, l, errCommentNotFound, err)
+		return
+	}
+
+	if !callerOf(r).canSee(cmt) {
+		// private and hidden comments are reported as missing to not leak their existence
+		svc.fail(w, l, errCommentNotFound, fmt.Errorf("comment with key %s can't be seen by the caller", cKey))
 		return
 	}
 
-	err = c.remove(cmt.ID)
+	err = c.remove(cmt.ID, callerOf(r))
+	svc.cache.invalidate(c.kind, c.key, cmt.ID)
 	if err != nil {
-		svc.respondWithMsg(w, commentDeleteErr, http.StatusInternalServerError)
-		l.Error(commentDeleteErr, zap.Error(err))
+		svc.fail(w, l, errCommentDelete, err)
 		return
 	}
 
 	svc.respondWithMsg(w, fmt.Sprintf("successfully deleted %s comment with id: %s", c.kind, cmt.ID), http.StatusOK)
 }
 
+// handleRestore moves a deleted comment back from the trash, which only admins and its author may do
+func (svc *service) handleRestore(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+	cKey := chi.URLParam(r, commentKeyParam)
+	l := svc.logger.With(
+		zap.String(commentKeyParam, cKey),
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+	)
+
+	cmt, err := c.restore(cKey, callerOf(r))
+	svc.cache.invalidate(c.kind, c.key, cKey)
+	if err != nil {
+		e := errCommentRestore
+		switch err {
+		case errNotInTrash:
+			e = errCommentNotInTrash
+		case errRestoreConflict:
+			e = errCommentRestoreConflict
+		case errRestoreForbidden:
+			e = errForbidden
+		}
+
+		svc.fail(w, l, e, err)
+		return
+	}
+
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
+}
+
+// handleClear removes all comments on the resource, e.g. for moderators to wipe a discussion
+func (svc *service) handleClear(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+	l := svc.logger.With(
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+	)
+
+	n, err := c.clear()
+	svc.cache.invalidate(c.kind, c.key, "")
+	if err != nil {
+		svc.fail(w, l, errCommentClear, err)
+		return
+	}
+
+	l.Info("cleared comments", zap.Int("removed", n))
+	svc.respondWithPayload(w, struct {
+		Removed int `json:"removed"`
+	}{n}, http.StatusOK)
+}
+
+// handleMove moves all comments on the resource to another one, e.g. when resources are merged
+func (svc *service) handleMove(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+
+	var mv struct {
+		To    string `json:"to"`
+		Merge bool   `json:"merge"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&mv)
+	if err != nil || mv.To == "" || mv.To == c.key {
+		svc.fail(w, svc.logger, errCommentMoveInvalid, err)
+		return
+	}
+
+	// the target is created by the move, so its key is held to the rules of the creator
+	if err = checkKey(mv.To, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+		svc.fail(w, svc.logger, errCommentableKeyInvalid.withArgs(err), err,
+			zap.String(commentableKeyParam, c.key),
+			zap.String(commentableTypeParam, c.kind),
+			zap.String("to", mv.To))
+		return
+	}
+
+	l := svc.logger.With(
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+		zap.String("to", mv.To),
+	)
+
+	n, err := c.move(mv.To, mv.Merge)
+	svc.cache.invalidate(c.kind, c.key, "")
+	svc.cache.invalidate(c.kind, mv.To, "")
+	if err != nil {
+		e := errCommentMove
+		if err == errTargetNotEmpty {
+			e = errCommentMoveConflict
+		}
+
+		svc.fail(w, l, e, err)
+		return
+	}
+
+	l.Info("moved comments", zap.Int("moved", n))
+	svc.respondWithPayload(w, struct {
+		Moved int `json:"moved"`
+	}{n}, http.StatusOK)
+}
+
+// decodeComment decodes the comment in the request body, returning a schemaError if it does not match commentSchema
+func (svc *service) decodeComment(r *http.Request) (*comment, error) {
+	data, err := svc.readPayload(r, commentPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	co := &comment{}
+	return co, json.Unmarshal(data, co)
+}
+
+// readPayload reads the request body, returning a schemaError if it does not match the schema.
+// Since json silently replaces invalid UTF-8 while decoding, the raw body is checked up front
+// and rejected unless the service is configured to sanitize it.
+func (svc *service) readPayload(r *http.Request, schema *gojsonschema.Schema) ([]byte, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !svc.cfg.SanitizeUTF8 && !utf8.Valid(data) {
+		return nil, errInvalidUTF8
+	}
+
+	if err = checkSchema(schema, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// userID identifies the user making the request from the X-User-ID header set by the gateway,
+// empty for anonymous requests. The author in the comment payload is never trusted, as anyone could claim it.
+func userID(r *http.Request) string {
+	return r.Header.Get(userIDHeader)
+}
+
+// expectedVersion returns the version of the comment the client is updating from the If-Match header,
+// falling back to the version in the comment payload. It reports false if no valid version was given.
+// If-Match holds either the version or the ETag of the comment as got from GET, the ETag standing for the
+// version of the stored comment if it is still its ETag and for a version no comment has otherwise, so that
+// the save conflicts.
+func expectedVersion(r *http.Request, co, stored *comment) (int, bool) {
+	if v := r.Header.Get("If-Match"); v != "" {
+		version, err := strconv.Atoi(strings.Trim(v, `"`))
+		if err == nil || len(v) < 2 || !strings.HasPrefix(v, `"`) || !strings.HasSuffix(v, `"`) {
+			return version, err == nil
+		}
+
+		if etag, err := stored.etag(); err == nil && etag == v {
+			return stored.Version, true
+		}
+
+		return -1, true
+	}
+
+	return co.Version, co.Version > 0
+}
+
 // validator validates that a resource of the given key exists for the given resource kind
 func (svc *service) validator(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		cKind := chi.URLParam(r, commentableTypeParam)
 		cKey := chi.URLParam(r, commentableKeyParam)
 
-		c := &commentable{db: svc.db, key: cKey, kind: cKind}
-		if !c.exists() {
-			svc.respondWithMsg(w, fmt.Sprintf(commentableNotFoundFmt, c.kind, c.key), http.StatusNotFound)
-			svc.logger.Warn("commentable validation failed",
+		if err := checkKey(cKey, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+			svc.rejectedBy(w, rejectedByValidator)
+			svc.fail(w, svc.logger, errCommentableKeyInvalid.withArgs(err), err,
+				zap.String(commentableKeyParam, cKey),
+				zap.String(commentableTypeParam, cKind))
+			return
+		}
+
+		c := &commentable{db: svc.dbOf(cKind), key: cKey, kind: cKind, ids: svc.cfg.IDScheme.idGenerator}
+		found, err := c.lookup()
+		if err != nil {
+			svc.rejectedBy(w, rejectedByValidator)
+			svc.fail(w, svc.logger, errDBUnavailable, err,
+				zap.String(commentableKeyParam, cKey),
+				zap.String(commentableTypeParam, cKind))
+			return
+		}
+
+		if !found.ResourceExists {
+			svc.rejectedBy(w, rejectedByValidator)
+			svc.failNotFound(w, svc.logger, errCommentableNotFound.withArgs(c.kind, c.key), found,
 				zap.String(commentableKeyParam, cKey),
 				zap.String(commentableTypeParam, cKind))
 			return
@@ -221,11 +828,19 @@ func (svc *service) creator(next http.Handler) http.Handler {
 		cKind := chi.URLParam(r, commentableTypeParam)
 		cKey := chi.URLParam(r, commentableKeyParam)
 
-		c := &commentable{kind: cKind, key: cKey, db: svc.db}
+		if err := checkKey(cKey, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+			svc.rejectedBy(w, rejectedByCreator)
+			svc.fail(w, svc.logger, errCommentableKeyInvalid.withArgs(err), err,
+				zap.String(commentableKeyParam, cKey),
+				zap.String(commentableTypeParam, cKind))
+			return
+		}
+
+		c := &commentable{kind: cKind, key: cKey, db: svc.dbOf(cKind), eager: svc.cfg.EagerCommentsBucket}
 		err := c.ensure()
 		if err != nil {
-			svc.respondWithMsg(w, commentableSaveErr, http.StatusNotAcceptable)
-			svc.logger.Error(commentableSaveErr,
+			svc.rejectedBy(w, rejectedByCreator)
+			svc.fail(w, svc.logger, errCommentableSave, err,
 				zap.String(commentableKeyParam, cKey),
 				zap.String(commentableTypeParam, cKind))
 			return
@@ -240,9 +855,17 @@ func (svc *service) verifier(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		kind := chi.URLParam(r, commentableTypeParam)
 
-		if !verify(svc.db, kind) {
-			svc.respondWithMsg(w, fmt.Sprintf(commentableTypeNotFoundFmt, kind), http.StatusNotAcceptable)
-			svc.logger.Warn(commentableSaveErr, zap.String(commentableTypeParam, kind))
+		found, err := verify(svc.dbOf(kind), kind)
+		if err != nil {
+			svc.rejectedBy(w, rejectedByVerifier)
+			svc.fail(w, svc.logger, errDBUnavailable, err, zap.String(commentableTypeParam, kind))
+			return
+		}
+
+		if !found {
+			svc.rejectedBy(w, rejectedByVerifier)
+			svc.fail(w, svc.logger, errCommentableTypeNotFound.withArgs(kind), nil,
+				zap.String(commentableTypeParam, kind))
 			return
 		}
 
@@ -252,6 +875,79 @@ func (svc *service) verifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// rejectedByHeader names the middleware that rejected the request, see rejectedBy
+const rejectedByHeader = "X-Rejected-By"
+
+// the middlewares named in the rejectedByHeader
+const (
+	rejectedByVerifier  = "verifier"
+	rejectedByCreator   = "creator"
+	rejectedByValidator = "validator"
+)
+
+// rejectedBy sets the rejectedByHeader to the middleware rejecting the request if debug headers are enabled,
+// so that clients can tell which check failed, e.g. the type check of the verifier from the key check of the
+// validator. It must be called before the response is written.
+func (svc *service) rejectedBy(w http.ResponseWriter, middleware string) {
+	if svc.cfg.DebugHeaders {
+		w.Header().Set(rejectedByHeader, middleware)
+	}
+}
+
+// secureHeaders sets headers hardening the responses against being sniffed or framed by browsers
+func (svc *service) secureHeaders(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Del("Server")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		if svc.cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", svc.cfg.ContentSecurityPolicy)
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// redirectSlashes permanently redirects paths with a trailing slash to the same path without it,
+// so that clients adding one still reach the routes. 308 keeps the method and body of the request.
+// The pprof index is left alone since its links are relative to its trailing slash.
+func (svc *service) redirectSlashes(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") && r.URL.Path != pprofPrefix+"/" {
+			// leading slashes are collapsed too, as browsers follow //evil.com, or /\evil.com, to another host
+			p := "/" + strings.TrimLeft(strings.TrimRight(r.URL.Path, "/"), `/\`)
+			u := url.URL{Path: p, RawQuery: r.URL.RawQuery}
+
+			http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// readOnly rejects mutating requests with a 503 while the service is in read-only mode
+func (svc *service) readOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if svc.cfg.ReadOnly && !isBulkGet(r.Method, r.URL.Path) {
+				svc.respondWithError(w, errServiceReadOnly)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 func (svc *service) respondWithMsg(w http.ResponseWriter, msg string, code int) {
 	payload := struct {
 		Message string `json:"message"`
@@ -261,10 +957,16 @@ func (svc *service) respondWithMsg(w http.ResponseWriter, msg string, code int)
 }
 
 func (svc *service) respondWithPayload(w http.ResponseWriter, payload interface{}, code int) {
-	data, err := json.Marshal(payload)
+	var data []byte
+	var err error
+	if _, pretty := w.(prettyWriter); pretty {
+		data, err = json.MarshalIndent(payload, "", "  ")
+	} else {
+		data, err = json.Marshal(payload)
+	}
 	if err != nil {
 		code = http.StatusInternalServerError
-		data = []byte(`{"message":"failed to prepare response. Please try again"}`)
+		data = []byte(`{"error":{"code":"RESPONSE_FAILED","message":"failed to prepare response. Please try again"}}`)
 	}
 	svc.respond(w, data, code)
 }
@@ -5,19 +5,50 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-chi/chi"
+	"github.com/kelseyhightower/envconfig"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
 
-var buildResp = func(msg string) string {
-	return fmt.Sprintf(`{"message":"%s"}`, msg)
+var buildErrResp = func(e apiError) string {
+	return fmt.Sprintf(`{"error":{"code":"%s","message":"%s"}}`, e.Code, e.Message)
+}
+
+// buildNotFoundResp builds the response to a missing resource of an existing type
+var buildNotFoundResp = func(kind, key string) string {
+	e := errCommentableNotFound.withArgs(kind, key)
+	return fmt.Sprintf(`{"error":{"code":"%s","message":"%s","type_exists":true,"resource_exists":false}}`, e.Code, e.Message)
+}
+
+// buildValidationResp builds the response to a comment breaking the given rules
+var buildValidationResp = func(v ...fieldError) string {
+	fields, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	e := errCommentValidation
+	return fmt.Sprintf(`{"error":{"code":"%s","message":"%s","fields":%s}}`, e.Code, e.Message, fields)
+}
+
+// testConfig returns the config with its defaults applied
+func testConfig() config {
+	var cfg config
+	if err := envconfig.Process("library_test", &cfg); err != nil {
+		panic(err)
+	}
+
+	return cfg
 }
 
 func Test_service_handlerAdd(t *testing.T) {
@@ -26,41 +57,156 @@ func Test_service_handlerAdd(t *testing.T) {
 	kind := "posts"
 	key := "my-key"
 	tests := []struct {
-		name     string
-		path     string
-		payload  []byte
-		wantCode int
+		name              string
+		path              string
+		payload           []byte
+		disableAutoCreate bool
+		sanitizeUTF8      bool
+		rawUnicode        bool
+		wantCode          int
+		wantBody          string
+		wantValue         string
+		wantMentions      []string
 	}{
 		{
 			name:     "it does not add the comment to the resource if comment is empty",
 			payload:  []byte(`{"value": ""}`),
-			path:     fmt.Sprintf("/%s/%s/comments", kind, key),
-			wantCode: http.StatusBadRequest,
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildValidationResp(violation("value", errCommentEmpty)),
 		},
 		{
 			name:     "it does not add the comment to payload is invalid",
 			payload:  []byte(`{"value": "}`),
-			path:     fmt.Sprintf("/%s/%s/comments", kind, key),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
 			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentInvalid),
+		},
+		{
+			name:     "it does not add the comment if its fields do not match the schema",
+			payload:  []byte(`{"value": 5}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"error":{"code":"COMMENT_FIELDS_INVALID","message":"comment has invalid fields",` +
+				`"fields":[{"field":"value","code":"INVALID_TYPE","message":"Invalid type. Expected: string, given: integer"}]}}`,
+		},
+		{
+			name:     "it does not add the comment if it is not valid UTF-8",
+			payload:  []byte("{\"value\": \"my-coment \xff\xfe\"}"),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusBadRequest,
+			wantBody: buildErrResp(errCommentInvalidUTF8),
+		},
+		{
+			name:         "it sanitizes the comment if it is not valid UTF-8 and sanitizing is enabled",
+			payload:      []byte("{\"value\": \"my-coment \xff\"}"),
+			path:         fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			sanitizeUTF8: true,
+			wantCode:     http.StatusOK,
+			wantValue:    "my-coment \uFFFD",
+		},
+		{
+			name:      "it composes the accents of the comment",
+			payload:   []byte(`{"value": "cafe\u0301 cre\u0300me"}`),
+			path:      fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode:  http.StatusOK,
+			wantValue: "caf\u00e9 cr\u00e8me",
+		},
+		{
+			name:       "it keeps the accents of the comment as sent if normalizing is disabled",
+			payload:    []byte(`{"value": "cafe\u0301 cre\u0300me"}`),
+			path:       fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			rawUnicode: true,
+			wantCode:   http.StatusOK,
+			wantValue:  "cafe\u0301 cre\u0300me",
+		},
+		{
+			name:      "it strips html from the comment",
+			payload:   []byte(`{"value": "<b>bold</b> claim<script>alert(1)</script>"}`),
+			path:      fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode:  http.StatusOK,
+			wantValue: "bold claim",
+		},
+		{
+			name:     "it does not add the comment if nothing is left once html is stripped",
+			payload:  []byte(`{"value": "<img src=x onerror=alert(1)>"}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildValidationResp(violation("value", errCommentEmpty)),
+		},
+		{
+			name:     "it does not add the comment if its category is not allowed",
+			payload:  []byte(`{"value": "my-coment", "category": "unknown"}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildValidationResp(violation("category", errCommentCategoryInvalid.withArgs("unknown"))),
+		},
+		{
+			name:     "it does not add the comment if its visibility is unknown",
+			payload:  []byte(`{"value": "my-coment", "visibility": "secret"}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildValidationResp(violation("visibility", errCommentVisibilityInvalid.withArgs("secret"))),
+		},
+		{
+			name:     "it responds with every rule the comment breaks at once",
+			payload:  []byte(`{"value": "", "category": "unknown", "visibility": "secret"}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildValidationResp(
+				violation("value", errCommentEmpty),
+				violation("category", errCommentCategoryInvalid.withArgs("unknown")),
+				violation("visibility", errCommentVisibilityInvalid.withArgs("secret")),
+			),
+		},
+		{
+			name:         "it adds the comment with the users it mentions",
+			payload:      []byte(`{"value": "@jane @john_2, thoughts? cc @jane", "mentions": ["eve"]}`),
+			path:         fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode:     http.StatusOK,
+			wantValue:    "@jane @john_2, thoughts? cc @jane",
+			wantMentions: []string{"jane", "john_2"},
+		},
+		{
+			name:     "it adds the comment with an allowed category",
+			payload:  []byte(`{"value": "my-coment", "category": "question"}`),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusOK,
 		},
 		{
 			name:     "it does not add the comment if resourceType does not exists",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/unknownResourceType/%s/comments", key),
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/comments", key),
 			wantCode: http.StatusNotAcceptable,
+			wantBody: buildErrResp(errCommentableTypeNotFound.withArgs("unknownResourceType")),
 		},
 		{
 			name:     "it creates resource and adds the comment if resource does not exist",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/%s/another-key/comments", kind),
+			path:     fmt.Sprintf("/v1/%s/another-key/comments", kind),
 			wantCode: http.StatusOK,
 		},
 		{
 			name:     "it adds the comment to resource if not empty",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/%s/%s/comments", kind, key),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
 			wantCode: http.StatusOK,
 		},
+		{
+			name:              "it does not create the resource if auto create is disabled",
+			payload:           []byte(`{"value": "my-coment"}`),
+			path:              fmt.Sprintf("/v1/%s/another-key/comments", kind),
+			disableAutoCreate: true,
+			wantCode:          http.StatusNotFound,
+			wantBody:          buildNotFoundResp(kind, "another-key"),
+		},
+		{
+			name:              "it adds the comment to an existing resource if auto create is disabled",
+			payload:           []byte(`{"value": "my-coment"}`),
+			path:              fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			disableAutoCreate: true,
+			wantCode:          http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
@@ -79,14 +225,168 @@ func Test_service_handlerAdd(t *testing.T) {
 			})
 			assert.NoError(t, err)
 
+			cfg := testConfig()
+			cfg.AutoCreateResources = !tt.disableAutoCreate
+			cfg.SanitizeUTF8 = tt.sanitizeUTF8
+			cfg.NormalizeUnicode = !tt.rawUnicode
+
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), cfg)
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
 			body := bytes.NewBuffer(tt.payload)
 			r := httptest.NewRequest(http.MethodPost, tt.path, body)
 
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+
+			if tt.wantValue != "" {
+				got := &comment{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+				assert.Equal(t, tt.wantValue, got.Value)
+				assert.Equal(t, tt.wantMentions, got.Mentions)
+			}
+		})
+	}
+}
+
+func Test_service_handleAdd_editTrail(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", strings.NewReader(`{"value": "hi", `+
+		`"edited_by": "admin", "updated_at": "2020-01-01T00:00:00Z", "deleted_at": "2020-01-02T00:00:00Z"}`))
+	r.Header.Set(userIDHeader, "jane")
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a new comment has no edit trail however it was sent
+	var got comment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Empty(t, got.EditedBy)
+	assert.Nil(t, got.UpdatedAt)
+	assert.Nil(t, got.DeletedAt)
+
+	stored, err := (&commentable{db: db, kind: "posts", key: "my-key"}).get(got.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, stored.EditedBy)
+	assert.Nil(t, stored.UpdatedAt)
+	assert.Nil(t, stored.DeletedAt)
+}
+
+func Test_service_handleAdd_author(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+	svc.registerRoutes(mux)
+
+	add := func(userID string) comment {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", strings.NewReader(`{"value": "hi", "author": "jane"}`))
+		r.Header.Set(userIDHeader, userID)
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var got comment
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got
+	}
+
+	assert.Equal(t, "john", add("john").Author, "the author should be the forwarded user")
+	assert.Empty(t, add("").Author, "the author in the payload should not be trusted")
+}
+
+func Test_service_registerRoutes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	key := "my-key"
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
+
+		_, err = b.CreateBucket([]byte(key))
+		return err
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		prefix   string
+		path     string
+		wantCode int
+	}{
+		{
+			name:     "it serves the api routes under the prefix",
+			prefix:   "/v1",
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it does not serve the api routes outside the prefix",
+			prefix:   "/v1",
+			path:     fmt.Sprintf("/%s/%s/comments", kind, key),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it serves the api routes under a custom prefix",
+			prefix:   "/api/v2",
+			path:     fmt.Sprintf("/api/v2/%s/%s/comments", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the api routes from the root if the prefix is empty",
+			path:     fmt.Sprintf("/%s/%s/comments", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the status route from the root",
+			prefix:   "/v1",
+			path:     "/status",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it does not serve the status route under the prefix",
+			prefix:   "/v1",
+			path:     "/v1/status",
+			wantCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.APIPrefix = tt.prefix
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
 			mux.ServeHTTP(w, r)
 			assert.Equal(t, tt.wantCode, w.Code)
 		})
@@ -102,6 +402,7 @@ func Test_service_handleList(t *testing.T) {
 	kind := "posts"
 	keyOne := "my-key-1"
 	keyTwo := "my-key-2"
+	keyCategorized := "my-key-categorized"
 
 	err := db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucket([]byte(kind))
@@ -115,6 +416,11 @@ func Test_service_handleList(t *testing.T) {
 		}
 
 		_, err = b.CreateBucket([]byte(keyTwo))
+		if err != nil {
+			return err
+		}
+
+		_, err = b.CreateBucket([]byte(keyCategorized))
 		return err
 	})
 	assert.NoError(t, err)
@@ -125,36 +431,102 @@ func Test_service_handleList(t *testing.T) {
 	commentTwo, err := cm.add(&comment{Value: "bar"})
 	assert.NoError(t, err)
 
+	cm = &commentable{db: db, key: keyCategorized, kind: kind}
+	question, err := cm.add(&comment{Value: "why?", Category: "question"})
+	assert.NoError(t, err)
+	_, err = cm.add(&comment{Value: "good", Category: "review"})
+	assert.NoError(t, err)
+	tagged, err := cm.add(&comment{Value: "tagged", Tags: []string{"go", "bolt"}})
+	assert.NoError(t, err)
+	_, err = cm.add(&comment{Value: "a note", Tags: []string{"go"}, Author: "jane", Visibility: visibilityPrivate})
+	assert.NoError(t, err)
+
 	tests := []struct {
-		name     string
-		path     string
-		wantCode int
-		wantBody string
+		name      string
+		path      string
+		wantCode  int
+		userID    string
+		wantBody  string
+		wantTotal string
 	}{
 		{
 			name:     "it returns all the comment for the resource with the given key",
-			path:     fmt.Sprintf("/%s/%s/comments", kind, keyOne),
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, keyOne),
 			wantCode: http.StatusOK,
 			wantBody: fmt.Sprintf(
-				`{"comments":[{"id":"%s","value":"%s"},{"id":"%s","value":"%s"}]}`, commentOne.ID, commentOne.Value,
+				`{"comments":[{"id":"%s","value":"%s","version":1,"pinned":false,"length":3,"words":1},{"id":"%s","value":"%s","version":1,"pinned":false,"length":3,"words":1}]}`, commentOne.ID, commentOne.Value,
 				commentTwo.ID, commentTwo.Value),
+			wantTotal: "2",
+		},
+		{
+			name:      "it returns empty if no comment exists for the resource with the given key",
+			path:      fmt.Sprintf("/v1/%s/%s/comments", kind, keyTwo),
+			wantBody:  `{"comments":[]}`,
+			wantCode:  http.StatusOK,
+			wantTotal: "0",
+		},
+		{
+			name:     "it returns the comments in the given category",
+			path:     fmt.Sprintf("/v1/%s/%s/comments?category=question", kind, keyCategorized),
+			wantCode: http.StatusOK,
+			wantBody: fmt.Sprintf(
+				`{"comments":[{"id":"%s","value":"%s","category":"question","version":1,"pinned":false,"length":4,"words":1}]}`, question.ID, question.Value),
+			wantTotal: "3",
+		},
+		{
+			name:      "it returns empty if no comment is in the given category",
+			path:      fmt.Sprintf("/v1/%s/%s/comments?category=spoiler", kind, keyCategorized),
+			wantCode:  http.StatusOK,
+			wantBody:  `{"comments":[]}`,
+			wantTotal: "3",
+		},
+		{
+			name:     "it returns the comments with the given tag",
+			path:     fmt.Sprintf("/v1/%s/%s/comments?tag=Bolt", kind, keyCategorized),
+			wantCode: http.StatusOK,
+			wantBody: fmt.Sprintf(
+				`{"comments":[{"id":"%s","value":"%s","tags":["go","bolt"],"version":1,"pinned":false,"length":6,"words":1}]}`, tagged.ID, tagged.Value),
+			wantTotal: "3",
 		},
 		{
-			name:     "it returns empty if no comment exists for the resource with the given key",
-			path:     fmt.Sprintf("/%s/%s/comments", kind, keyTwo),
-			wantBody: `{"comments":[]}`,
+			name:     "it does not return private comments of other users",
+			path:     fmt.Sprintf("/v1/%s/%s/comments?tag=go", kind, keyCategorized),
 			wantCode: http.StatusOK,
+			wantBody: fmt.Sprintf(
+				`{"comments":[{"id":"%s","value":"%s","tags":["go","bolt"],"version":1,"pinned":false,"length":6,"words":1}]}`, tagged.ID, tagged.Value),
+			wantTotal: "3",
+		},
+		{
+			name:      "it returns empty if no comment has the given tag",
+			path:      fmt.Sprintf("/v1/%s/%s/comments?tag=chi", kind, keyCategorized),
+			wantCode:  http.StatusOK,
+			wantBody:  `{"comments":[]}`,
+			wantTotal: "3",
+		},
+		{
+			name:      "it counts the private comments of the caller in the total",
+			path:      fmt.Sprintf("/v1/%s/%s/comments?tag=chi", kind, keyCategorized),
+			userID:    "jane",
+			wantCode:  http.StatusOK,
+			wantBody:  `{"comments":[]}`,
+			wantTotal: "4",
+		},
+		{
+			name:     "it returns error if the category is not allowed",
+			path:     fmt.Sprintf("/v1/%s/%s/comments?category=unknown", kind, keyCategorized),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: buildErrResp(errCommentCategoryInvalid.withArgs("unknown")),
 		},
 		{
 			name:     "it returns error if resource with key not found",
-			path:     fmt.Sprintf("/%s/my-key-3/comments", kind),
-			wantBody: buildResp(fmt.Sprintf(commentableNotFoundFmt, kind, "my-key-3")),
+			path:     fmt.Sprintf("/v1/%s/my-key-3/comments", kind),
+			wantBody: buildNotFoundResp(kind, "my-key-3"),
 			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it returns error if resource type does not exist",
-			path:     fmt.Sprintf("/unknownResource/%s/comments", keyTwo),
-			wantBody: buildResp(fmt.Sprintf(commentableTypeNotFoundFmt, "unknownResource")),
+			path:     fmt.Sprintf("/v1/unknownResource/%s/comments", keyTwo),
+			wantBody: buildErrResp(errCommentableTypeNotFound.withArgs("unknownResource")),
 			wantCode: http.StatusNotAcceptable,
 		},
 	}
@@ -162,15 +534,19 @@ func Test_service_handleList(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), testConfig())
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.userID != "" {
+				r.Header.Set(userIDHeader, tt.userID)
+			}
 
 			mux.ServeHTTP(w, r)
 			assert.Equal(t, tt.wantCode, w.Code)
 			assert.Equal(t, tt.wantBody, w.Body.String())
+			assert.Equal(t, tt.wantTotal, w.Header().Get(totalCountHeader))
 		})
 	}
 }
@@ -184,6 +560,8 @@ func Test_service_handleGet(t *testing.T) {
 	kind := "posts"
 	key := "my-key-1"
 	cmt := &comment{ID: "12345", Value: "something"}
+	private := &comment{ID: "67890", Value: "a note", Author: "jane", Visibility: visibilityPrivate}
+	hidden := &comment{ID: "13579", Value: "spam", Author: "jane", SpamScore: 0.5, Hidden: true}
 
 	err := db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucket([]byte(kind))
@@ -201,54 +579,113 @@ func Test_service_handleGet(t *testing.T) {
 			return err
 		}
 
-		data, err := json.Marshal(cmt)
-		if err != nil {
-			return err
+		for _, c := range []*comment{cmt, private, hidden} {
+			data, err := json.Marshal(c)
+			if err != nil {
+				return err
+			}
+
+			if err = ccb.Put([]byte(c.ID), data); err != nil {
+				return err
+			}
 		}
-		return ccb.Put([]byte(cmt.ID), data)
+		return nil
 	})
 	assert.NoError(t, err)
 
+	privateResp := fmt.Sprintf(`{"id":"%s","value":"%s","author":"jane","visibility":"private","version":0,"pinned":false,"length":6,"words":2}`,
+		private.ID, private.Value)
 	tests := []struct {
-		name     string
-		path     string
-		wantCode int
-		want     string
+		name       string
+		path       string
+		userID     string
+		adminToken string
+		wantCode   int
+		want       string
 	}{
 		{
 			name:     "it responds with error if resourceType does not exists",
-			path:     fmt.Sprintf("/unknownResourceType/%s/comments/%s", key, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableTypeNotFoundFmt, "unknownResourceType")),
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/comments/%s", key, cmt.ID),
+			want:     buildErrResp(errCommentableTypeNotFound.withArgs("unknownResourceType")),
 			wantCode: http.StatusNotAcceptable,
 		},
 		{
 			name:     "it responds with error if resource with id does not exist",
-			path:     fmt.Sprintf("/%s/another-key/comments/%s", kind, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableNotFoundFmt, kind, "another-key")),
+			path:     fmt.Sprintf("/v1/%s/another-key/comments/%s", kind, cmt.ID),
+			want:     buildNotFoundResp(kind, "another-key"),
 			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it responds with error if comment for resource with comment id does not exist",
-			path:     fmt.Sprintf("/%s/%s/comments/another-key", kind, key),
-			want:     buildResp(commentNotFoundErr),
-			wantCode: http.StatusBadRequest,
+			path:     fmt.Sprintf("/v1/%s/%s/comments/another-key", kind, key),
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it responds with the comment",
-			path:     fmt.Sprintf("/%s/%s/comments/%s", kind, key, cmt.ID),
-			want:     fmt.Sprintf(`{"id":"%s","value":"%s"}`, cmt.ID, cmt.Value),
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     fmt.Sprintf(`{"id":"%s","value":"%s","version":0,"pinned":false,"length":9,"words":1}`, cmt.ID, cmt.Value),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it responds with error if the comment is private to another user",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, private.ID),
+			userID:   "john",
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it responds with error if the comment is private and the user is anonymous",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, private.ID),
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it responds with the private comment to its author",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, private.ID),
+			userID:   "jane",
+			want:     privateResp,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "it responds with the private comment to admins",
+			path:       fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, private.ID),
+			adminToken: "secret",
+			want:       privateResp,
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:     "it responds with error if the comment is hidden, even to its author",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, hidden.ID),
+			userID:   "jane",
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:       "it responds with the hidden comment to admins",
+			path:       fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, hidden.ID),
+			adminToken: "secret",
+			want: fmt.Sprintf(`{"id":"%s","value":"spam","author":"jane","version":0,"pinned":false,"spam_score":0.5,"hidden":true,"length":4,"words":1}`,
+				hidden.ID),
 			wantCode: http.StatusOK,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), cfg)
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
 			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(userIDHeader, tt.userID)
+			if tt.adminToken != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.adminToken)
+			}
 
 			mux.ServeHTTP(w, r)
 
@@ -258,6 +695,113 @@ func Test_service_handleGet(t *testing.T) {
 	}
 }
 
+func Test_service_handleGet_conditional(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"posts"}))
+	cm := &commentable{db: db, kind: "posts", key: "1"}
+	assert.NoError(t, cm.ensure())
+
+	updatedAt := time.Date(2020, 5, 4, 10, 30, 15, 500, time.UTC)
+	updated, err := cm.add(&comment{Value: "updated", UpdatedAt: &updatedAt})
+	assert.NoError(t, err)
+	undated, err := cm.add(&comment{Value: "undated"})
+	assert.NoError(t, err)
+
+	lastModified := updatedAt.Format(http.TimeFormat)
+	etag, err := updated.etag()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		id               string
+		ifNoneMatch      string
+		ifModifiedSince  string
+		wantCode         int
+		wantLastModified string
+	}{
+		{
+			name:             "it responds with the comment and when it was last modified",
+			id:               updated.ID,
+			wantCode:         http.StatusOK,
+			wantLastModified: lastModified,
+		},
+		{
+			name:             "it responds with not modified if the comment was not modified since",
+			id:               updated.ID,
+			ifModifiedSince:  lastModified,
+			wantCode:         http.StatusNotModified,
+			wantLastModified: lastModified,
+		},
+		{
+			name:             "it responds with not modified if the client has the current etag",
+			id:               updated.ID,
+			ifNoneMatch:      `"stale", W/` + etag,
+			wantCode:         http.StatusNotModified,
+			wantLastModified: lastModified,
+		},
+		{
+			name:             "it responds with the comment if the client has another etag, even if not modified since",
+			id:               updated.ID,
+			ifNoneMatch:      `"stale"`,
+			ifModifiedSince:  lastModified,
+			wantCode:         http.StatusOK,
+			wantLastModified: lastModified,
+		},
+		{
+			name:             "it responds with the comment if it was modified since",
+			id:               updated.ID,
+			ifModifiedSince:  updatedAt.Add(-time.Second).Format(http.TimeFormat),
+			wantCode:         http.StatusOK,
+			wantLastModified: lastModified,
+		},
+		{
+			name:             "it responds with the comment if the header is invalid",
+			id:               updated.ID,
+			ifModifiedSince:  "yesterday",
+			wantCode:         http.StatusOK,
+			wantLastModified: lastModified,
+		},
+		{
+			name:            "it responds with the comment if it is not known when it was modified",
+			id:              undated.ID,
+			ifModifiedSince: lastModified,
+			wantCode:        http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments/"+tt.id, nil)
+			if tt.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantLastModified, w.Header().Get("Last-Modified"))
+			if tt.id == updated.ID {
+				assert.Equal(t, etag, w.Header().Get("ETag"))
+			}
+			if tt.wantCode == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
+
 func Test_service_handleRemove(t *testing.T) {
 	t.Parallel()
 
@@ -300,25 +844,25 @@ func Test_service_handleRemove(t *testing.T) {
 	}{
 		{
 			name:     "it responds with error if resourceType does not exists",
-			path:     fmt.Sprintf("/unknownResourceType/%s/comments/%s", key, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableTypeNotFoundFmt, "unknownResourceType")),
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/comments/%s", key, cmt.ID),
+			want:     buildErrResp(errCommentableTypeNotFound.withArgs("unknownResourceType")),
 			wantCode: http.StatusNotAcceptable,
 		},
 		{
 			name:     "it responds with error if resource with id does not exist",
-			path:     fmt.Sprintf("/%s/another-key/comments/%s", kind, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableNotFoundFmt, kind, "another-key")),
+			path:     fmt.Sprintf("/v1/%s/another-key/comments/%s", kind, cmt.ID),
+			want:     buildNotFoundResp(kind, "another-key"),
 			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it responds with error if comment for resource with comment id does not exist",
-			path:     fmt.Sprintf("/%s/%s/comments/another-key", kind, key),
-			want:     buildResp(commentNotFoundErr),
-			wantCode: http.StatusBadRequest,
+			path:     fmt.Sprintf("/v1/%s/%s/comments/another-key", kind, key),
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it removes the comment and responds with success",
-			path:     fmt.Sprintf("/%s/%s/comments/%s", kind, key, cmt.ID),
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
 			want:     fmt.Sprintf(`{"message":"successfully deleted %s comment with id: %s"}`, kind, cmt.ID),
 			wantCode: http.StatusOK,
 		},
@@ -327,7 +871,7 @@ func Test_service_handleRemove(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), testConfig())
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
@@ -341,21 +885,114 @@ func Test_service_handleRemove(t *testing.T) {
 	}
 }
 
-func Test_service_handleUpdate(t *testing.T) {
+func Test_service_handleRestore(t *testing.T) {
 	t.Parallel()
 
 	db := setupDB()
 	defer cleanup(db)
 
-	kind := "posts"
-	key := "my-key-1"
-	cmt := &comment{ID: "12345", Value: "something"}
+	assert.NoError(t, setup(db, []string{"posts"}))
+	cm := &commentable{db: db, kind: "posts", key: "my-key-1"}
+	assert.NoError(t, cm.ensure())
 
-	err := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucket([]byte(kind))
-		if err != nil {
-			return err
-		}
+	deleted, err := cm.add(&comment{Value: "deleted", Author: "jane"})
+	assert.NoError(t, err)
+	assert.NoError(t, cm.remove(deleted.ID, caller{}))
+
+	moderated, err := cm.add(&comment{Value: "moderated", Author: "jane"})
+	assert.NoError(t, err)
+	assert.NoError(t, cm.remove(moderated.ID, caller{admin: true}))
+
+	kept, err := cm.add(&comment{Value: "kept"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		path     string
+		user     string
+		token    string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it responds with error if the comment is not in the trash",
+			path:     fmt.Sprintf("/v1/posts/my-key-1/comments/%s/restore", kept.ID),
+			want:     buildErrResp(errCommentNotInTrash),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it responds with error if resource with id does not exist",
+			path:     fmt.Sprintf("/v1/posts/another-key/comments/%s/restore", deleted.ID),
+			want:     buildNotFoundResp("posts", "another-key"),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it does not let anonymous callers restore the comment",
+			path:     fmt.Sprintf("/v1/posts/my-key-1/comments/%s/restore", deleted.ID),
+			want:     buildErrResp(errForbidden),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "it does not let other users restore the comment",
+			path:     fmt.Sprintf("/v1/posts/my-key-1/comments/%s/restore", deleted.ID),
+			user:     "john",
+			want:     buildErrResp(errForbidden),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "it restores the comment for its author and responds with it",
+			path: fmt.Sprintf("/v1/posts/my-key-1/comments/%s/restore", deleted.ID),
+			user: "jane",
+			want: fmt.Sprintf(`{"id":"%s","value":"deleted","author":"jane","version":1,"pinned":false,"length":7,"words":1}`,
+				deleted.ID),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:  "it restores the comment for admins",
+			path:  fmt.Sprintf("/v1/posts/my-key-1/comments/%s/restore", moderated.ID),
+			token: "secret",
+			want: fmt.Sprintf(`{"id":"%s","value":"moderated","author":"jane","version":1,"pinned":false,"length":9,"words":1}`,
+				moderated.ID),
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			r.Header.Set(userIDHeader, tt.user)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func Test_service_handleUpdate(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	key := "my-key-1"
+	cmt := &comment{ID: "12345", Value: "something"}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
 
 		cb, err := b.CreateBucket([]byte(key))
 		if err != nil {
@@ -376,74 +1013,272 @@ func Test_service_handleUpdate(t *testing.T) {
 	assert.NoError(t, err)
 
 	tests := []struct {
-		name     string
-		path     string
-		payload  []byte
-		wantCode int
-		want     string
+		name        string
+		path        string
+		payload     []byte
+		userID      string
+		ifMatch     string
+		wantCode    int
+		want        string
+		wantComment *comment
 	}{
 		{
 			name:     "it does not update the resource comment if comment is empty",
 			payload:  []byte(`{"value": ""}`),
-			path:     fmt.Sprintf("/%s/%s/comments/%s", kind, key, cmt.ID),
-			want:     buildResp(commentIsInvalid),
-			wantCode: http.StatusBadRequest,
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildValidationResp(violation("value", errCommentEmpty)),
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "it does not update the resource comment if its category is not allowed",
+			payload:  []byte(`{"value": "my-comment", "category": "unknown"}`),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildValidationResp(violation("category", errCommentCategoryInvalid.withArgs("unknown"))),
+			wantCode: http.StatusUnprocessableEntity,
 		},
 		{
 			name:     "it does not add the comment to payload is invalid",
 			payload:  []byte(`{"value": "}`),
-			path:     fmt.Sprintf("/%s/%s/comments/%s", kind, key, cmt.ID),
-			want:     buildResp(commentIsInvalid),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildErrResp(errCommentInvalid),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "it does not update the comment if it is not valid UTF-8",
+			payload:  []byte("{\"value\": \"\xc3\x28\"}"),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildErrResp(errCommentInvalidUTF8),
 			wantCode: http.StatusBadRequest,
 		},
 		{
 			name:     "it does not add the comment if resourceType does not exists",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/unknownResourceType/%s/comments/%s", key, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableTypeNotFoundFmt, "unknownResourceType")),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/comments/%s", key, cmt.ID),
+			want:     buildErrResp(errCommentableTypeNotFound.withArgs("unknownResourceType")),
 			wantCode: http.StatusNotAcceptable,
 		},
 		{
 			name:     "it returns error if resource with id does not exist",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/%s/another-key/comments/%s", kind, cmt.ID),
-			want:     buildResp(fmt.Sprintf(commentableNotFoundFmt, kind, "another-key")),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/another-key/comments/%s", kind, cmt.ID),
+			want:     buildNotFoundResp(kind, "another-key"),
 			wantCode: http.StatusNotFound,
 		},
 		{
 			name:     "it returns error if comment for resource with comment id does not exist",
 			payload:  []byte(`{"value": "my-coment"}`),
-			path:     fmt.Sprintf("/%s/%s/comments/another-key", kind, key),
-			want:     buildResp(commentNotFoundErr),
-			wantCode: http.StatusBadRequest,
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/another-key", kind, key),
+			want:     buildErrResp(errCommentNotFound),
+			wantCode: http.StatusNotFound,
 		},
 		{
-			name:     "it updates the comment",
+			name:     "it returns error if the version is not given",
 			payload:  []byte(`{"value": "my new comment"}`),
-			path:     fmt.Sprintf("/%s/%s/comments/%s", kind, key, cmt.ID),
-			want:     fmt.Sprintf(`{"id":"%s","value":"my new comment"}`, cmt.ID),
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildErrResp(errCommentVersionRequired),
+			wantCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:     "it returns error if the version is invalid",
+			payload:  []byte(`{"value": "my new comment"}`),
+			ifMatch:  "abc",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildErrResp(errCommentVersionRequired),
+			wantCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:        "it updates the comment",
+			payload:     []byte(`{"value": "my new comment"}`),
+			ifMatch:     "0",
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my new comment", Version: 1},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:     "it returns error if the comment has been modified since the given version",
+			payload:  []byte(`{"value": "my stale comment"}`),
+			ifMatch:  "0",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildErrResp(errCommentVersionConflict),
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:        "it ignores the author in the payload, recording no editor if the user is not forwarded",
+			payload:     []byte(`{"value": "my new comment", "author": "jane"}`),
+			ifMatch:     `"1"`,
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my new comment", Version: 2},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "it records the user in the X-User-ID header as the editor",
+			payload:     []byte(`{"value": "my new comment", "author": "jane", "version": 2}`),
+			userID:      "john",
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my new comment", EditedBy: "john", Version: 3},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "it normalizes and replaces the tags of the comment",
+			payload:     []byte(`{"value": "my new comment", "tags": ["Go", "", "go", "bolt"]}`),
+			ifMatch:     "3",
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my new comment", Tags: []string{"go", "bolt"}, Version: 4},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "it keeps the tags of the comment if none are given",
+			payload:     []byte(`{"value": "my newer comment"}`),
+			ifMatch:     "4",
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my newer comment", Tags: []string{"go", "bolt"}, Version: 5},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:     "it updates the tags and category without touching the value",
+			payload:  []byte(`{"tags": ["news"], "category": "review"}`),
+			ifMatch:  "5",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
 			wantCode: http.StatusOK,
+			wantComment: &comment{ID: cmt.ID, Value: "my newer comment", Category: "review", Tags: []string{"news"},
+				Version: 6},
+		},
+		{
+			name:        "it clears the fields sent as null",
+			payload:     []byte(`{"tags": null, "category": null}`),
+			ifMatch:     "6",
+			path:        fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			wantComment: &comment{ID: cmt.ID, Value: "my newer comment", Version: 7},
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:     "it does not clear the value",
+			payload:  []byte(`{"value": null}`),
+			ifMatch:  "7",
+			path:     fmt.Sprintf("/v1/%s/%s/comments/%s", kind, key, cmt.ID),
+			want:     buildValidationResp(violation("value", errCommentEmpty)),
+			wantCode: http.StatusUnprocessableEntity,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), testConfig())
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
 			body := bytes.NewBuffer(tt.payload)
 			r := httptest.NewRequest(http.MethodPatch, tt.path, body)
+			r.Header.Set(userIDHeader, tt.userID)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
 
+			before := time.Now()
 			mux.ServeHTTP(w, r)
 
 			assert.Equal(t, tt.wantCode, w.Code)
-			assert.Equal(t, tt.want, w.Body.String())
+			if tt.wantComment == nil {
+				assert.Equal(t, tt.want, w.Body.String())
+				return
+			}
+
+			got := &comment{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+			if assert.NotNil(t, got.UpdatedAt) {
+				assert.False(t, got.UpdatedAt.Before(before))
+			}
+
+			got.UpdatedAt = nil
+			assert.Equal(t, tt.wantComment, got)
 		})
 	}
 }
 
+func Test_service_handleUpdate_handleRemove_private(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	cmt, err := cm.add(&comment{Value: "secret", Author: "jane", Visibility: visibilityPrivate})
+	assert.NoError(t, err)
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+	path := "/v1/posts/my-key/comments/" + cmt.ID
+
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"value": "not mine", "version": 1}`))
+		r.Header.Set(userIDHeader, "john")
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNotFound, w.Code, method)
+		assert.JSONEq(t, buildErrResp(errCommentNotFound), w.Body.String(), method)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"value": "still secret", "version": 1}`))
+	r.Header.Set(userIDHeader, "jane")
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "the author should update their private comment")
+}
+
+func Test_service_handleUpdate_etag(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	cmt, err := cm.add(&comment{Value: "something"})
+	assert.NoError(t, err)
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+	path := "/v1/posts/my-key/comments/" + cmt.ID
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// the etag got from GET is sent back as is
+	for _, tt := range []struct {
+		name     string
+		value    string
+		wantCode int
+	}{
+		{"it updates the comment if its etag is unchanged", "edited", http.StatusOK},
+		{"it returns error if the comment has changed since its etag", "stale", http.StatusConflict},
+	} {
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(`{"value": "`+tt.value+`"}`))
+		r.Header.Set("If-Match", etag)
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, tt.wantCode, w.Code, tt.name)
+	}
+
+	got, err := cm.get(cmt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "edited", got.Value)
+}
+
 func Test_servicer_verifier(t *testing.T) {
 	t.Parallel()
 
@@ -458,7 +1293,7 @@ func Test_servicer_verifier(t *testing.T) {
 		{
 			name:     "it returns error if it the resource type does not exist",
 			kind:     kind,
-			wantBody: buildResp(fmt.Sprintf(commentableTypeNotFoundFmt, kind)),
+			wantBody: buildErrResp(errCommentableTypeNotFound.withArgs(kind)),
 		},
 		{
 			name: "it passes on the request if the resource already exists",
@@ -479,7 +1314,7 @@ func Test_servicer_verifier(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			svc := &service{logger: zap.NewNop(), db: db}
+			svc := &service{logger: zap.NewNop(), db: db, cfg: config{DebugHeaders: true}}
 
 			var passed bool
 			fn := func(w http.ResponseWriter, r *http.Request) {
@@ -497,6 +1332,7 @@ func Test_servicer_verifier(t *testing.T) {
 
 			assert.Equal(t, tt.pass, passed)
 			assert.Equal(t, tt.wantBody, w.Body.String())
+			assertRejectedBy(t, w, tt.pass, rejectedByVerifier)
 		})
 	}
 }
@@ -517,16 +1353,62 @@ func Test_service_creator(t *testing.T) {
 		{
 			name:     "it returns error if it the resource type does not exist",
 			kind:     kind,
-			wantBody: buildResp(commentableSaveErr),
+			key:      key,
+			wantBody: buildErrResp(errCommentableSave),
 		},
 		{
 			name: "it returns error if it can't create the resource",
 			kind: kind,
+			key:  key,
+			setupFunc: func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte(kind))
+				if err != nil {
+					return err
+				}
+
+				// a value in place of the resource bucket
+				return b.Put([]byte(key), []byte("value"))
+			},
+			wantBody: buildErrResp(errCommentableSave),
+		},
+		{
+			name: "it returns error if the key is empty",
+			kind: kind,
 			setupFunc: func(tx *bolt.Tx) error {
 				_, err := tx.CreateBucket([]byte(kind))
 				return err
 			},
-			wantBody: buildResp(commentableSaveErr),
+			wantBody: buildErrResp(errCommentableKeyInvalid.withArgs("key is empty")),
+		},
+		{
+			name: "it returns error if the key is too long",
+			kind: kind,
+			key:  strings.Repeat("k", 129),
+			setupFunc: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte(kind))
+				return err
+			},
+			wantBody: buildErrResp(errCommentableKeyInvalid.withArgs("key is longer than 128 bytes")),
+		},
+		{
+			name: "it returns error if the key contains control characters",
+			kind: kind,
+			key:  "my\nkey",
+			setupFunc: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte(kind))
+				return err
+			},
+			wantBody: buildErrResp(errCommentableKeyInvalid.withArgs("key contains control characters")),
+		},
+		{
+			name: "it returns error if the key is reserved",
+			kind: kind,
+			key:  "admin",
+			setupFunc: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte(kind))
+				return err
+			},
+			wantBody: buildErrResp(errCommentableKeyInvalid.withArgs("key matches the reserved pattern admin")),
 		},
 		{
 			name: "it passes on the request if resources is created successfully",
@@ -573,7 +1455,10 @@ func Test_service_creator(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			svc := &service{logger: zap.NewNop(), db: db}
+			cfg := testConfig()
+			cfg.ReservedKeys = keyPatterns{"admin"}
+			cfg.DebugHeaders = true
+			svc := &service{logger: zap.NewNop(), db: db, cfg: cfg}
 
 			var passed bool
 			fn := func(w http.ResponseWriter, r *http.Request) {
@@ -592,6 +1477,80 @@ func Test_service_creator(t *testing.T) {
 
 			assert.Equal(t, tt.pass, passed)
 			assert.Equal(t, tt.wantBody, w.Body.String())
+			assertRejectedBy(t, w, tt.pass, rejectedByCreator)
+		})
+	}
+}
+
+func Test_service_validator_key(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it rejects an empty key",
+			path:     "/v1/books//comments",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errCommentableKeyInvalid.withArgs("key is empty")),
+		},
+		{
+			name:     "it rejects a key over the max length",
+			path:     "/v1/books/" + strings.Repeat("k", 129) + "/comments",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errCommentableKeyInvalid.withArgs("key is longer than 128 bytes")),
+		},
+		{
+			name:     "it rejects a key with control characters",
+			path:     "/v1/books/my%0Akey/comments",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errCommentableKeyInvalid.withArgs("key contains control characters")),
+		},
+		{
+			name:     "it looks up a key at the max length",
+			path:     "/v1/books/" + strings.Repeat("k", 128) + "/comments",
+			wantCode: http.StatusNotFound,
+			want:     buildNotFoundResp("books", strings.Repeat("k", 128)),
+		},
+		{
+			name:     "it rejects a reserved key",
+			path:     "/v1/books/internal-1234/comments",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errCommentableKeyInvalid.withArgs("key matches the reserved pattern internal-*")),
+		},
+		{
+			name:     "it looks up a key that is not reserved",
+			path:     "/v1/books/my-internal-1234/comments",
+			wantCode: http.StatusNotFound,
+			want:     buildNotFoundResp("books", "my-internal-1234"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ReservedKeys = keyPatterns{"internal-*"}
+			cfg.DebugHeaders = true
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+			assert.Equal(t, rejectedByValidator, w.Header().Get(rejectedByHeader))
 		})
 	}
 }
@@ -601,7 +1560,8 @@ func Test_service_validator(t *testing.T) {
 
 	key := "my-key"
 	kind := "resource"
-	errMsg := buildResp(fmt.Sprintf(commentableNotFoundFmt, kind, key))
+	errMsg := buildNotFoundResp(kind, key)
+	e := errCommentableNotFound.withArgs(kind, key)
 	tests := []struct {
 		name      string
 		setupFunc func(*bolt.Tx) error
@@ -609,8 +1569,9 @@ func Test_service_validator(t *testing.T) {
 		pass      bool
 	}{
 		{
-			name:     "it returns error if resource type does not exist",
-			wantBody: errMsg,
+			name: "it returns error if resource type does not exist",
+			wantBody: fmt.Sprintf(`{"error":{"code":"%s","message":"%s","type_exists":false,"resource_exists":false}}`,
+				e.Code, e.Message),
 		},
 		{
 			name: "it returns error if resource does not exist",
@@ -643,7 +1604,7 @@ func Test_service_validator(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			svc := &service{logger: zap.NewNop(), db: db}
+			svc := &service{logger: zap.NewNop(), db: db, cfg: config{DebugHeaders: true}}
 
 			var passed bool
 			fn := func(w http.ResponseWriter, r *http.Request) {
@@ -662,10 +1623,274 @@ func Test_service_validator(t *testing.T) {
 
 			assert.Equal(t, tt.pass, passed)
 			assert.Equal(t, tt.wantBody, w.Body.String())
+			assertRejectedBy(t, w, tt.pass, rejectedByValidator)
+		})
+	}
+}
+
+// assertRejectedBy asserts that the rejectedByHeader names the middleware unless the request passed it
+func assertRejectedBy(t *testing.T, w *httptest.ResponseRecorder, pass bool, middleware string) {
+	t.Helper()
+
+	if pass {
+		middleware = ""
+	}
+	assert.Equal(t, middleware, w.Header().Get(rejectedByHeader))
+}
+
+func Test_service_rejectedBy(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	tests := []struct {
+		name         string
+		debug        bool
+		method       string
+		path         string
+		wantCode     int
+		wantRejected string
+	}{
+		{
+			name:         "it names the verifier if the type does not exist",
+			debug:        true,
+			method:       http.MethodGet,
+			path:         "/v1/unknown/my-key/comments",
+			wantCode:     http.StatusNotAcceptable,
+			wantRejected: rejectedByVerifier,
+		},
+		{
+			name:         "it names the creator if the key of a new comment is invalid",
+			debug:        true,
+			method:       http.MethodPost,
+			path:         "/v1/posts/" + strings.Repeat("k", 129) + "/comments",
+			wantCode:     http.StatusBadRequest,
+			wantRejected: rejectedByCreator,
+		},
+		{
+			name:         "it names the validator if the resource does not exist",
+			debug:        true,
+			method:       http.MethodGet,
+			path:         "/v1/posts/unknown-key/comments",
+			wantCode:     http.StatusNotFound,
+			wantRejected: rejectedByValidator,
+		},
+		{
+			name:     "it names no middleware if debug headers are disabled",
+			method:   http.MethodGet,
+			path:     "/v1/unknown/my-key/comments",
+			wantCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.DebugHeaders = tt.debug
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"value": "hi"}`))
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantRejected, w.Header().Get(rejectedByHeader))
+		})
+	}
+}
+
+func Test_service_readOnly(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		method   string
+		path     string
+		wantBody string
+		pass     bool
+	}{
+		{
+			name:     "it passes on reads when read-only",
+			method:   http.MethodGet,
+			readOnly: true,
+			pass:     true,
+		},
+		{
+			name:     "it rejects POST when read-only",
+			method:   http.MethodPost,
+			readOnly: true,
+			wantBody: buildErrResp(errServiceReadOnly),
+		},
+		{
+			name:     "it rejects PUT when read-only",
+			method:   http.MethodPut,
+			readOnly: true,
+			wantBody: buildErrResp(errServiceReadOnly),
+		},
+		{
+			name:     "it rejects PATCH when read-only",
+			method:   http.MethodPatch,
+			readOnly: true,
+			wantBody: buildErrResp(errServiceReadOnly),
+		},
+		{
+			name:     "it rejects DELETE when read-only",
+			method:   http.MethodDelete,
+			readOnly: true,
+			wantBody: buildErrResp(errServiceReadOnly),
+		},
+		{
+			name:     "it passes on getting comments in bulk when read-only",
+			method:   http.MethodPost,
+			path:     "/v1/posts/my-key" + bulkGetPath,
+			readOnly: true,
+			pass:     true,
+		},
+		{
+			name:     "it rejects other methods on the bulk get path when read-only",
+			method:   http.MethodDelete,
+			path:     "/v1/posts/my-key" + bulkGetPath,
+			readOnly: true,
+			wantBody: buildErrResp(errServiceReadOnly),
+		},
+		{
+			name:   "it passes on writes when not read-only",
+			method: http.MethodPost,
+			pass:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{ReadOnly: tt.readOnly}}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			r := httptest.NewRequest(tt.method, path, nil)
+			w := httptest.NewRecorder()
+
+			handler := svc.readOnly(http.HandlerFunc(fn))
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.pass, passed)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+			if !tt.pass {
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			}
 		})
 	}
 }
 
+func Test_service_secureHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		csp     string
+		wantCSP string
+	}{
+		{
+			name:    "it sets the configured content security policy",
+			csp:     "default-src 'none'",
+			wantCSP: "default-src 'none'",
+		},
+		{
+			name: "it leaves out the content security policy if not configured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{ContentSecurityPolicy: tt.csp}}
+
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "OK")
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+			w.Header().Set("Server", "library")
+
+			handler := svc.secureHeaders(http.HandlerFunc(fn))
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+			assert.Equal(t, tt.wantCSP, w.Header().Get("Content-Security-Policy"))
+			assert.Empty(t, w.Header().Get("Server"))
+		})
+	}
+}
+
+func Test_service_handleGet_dbUnavailable(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	cleanup(db)
+
+	c := &commentable{db: db, kind: "posts", key: "my-key"}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(commentableTypeParam, c.kind)
+	rctx.URLParams.Add(commentableKeyParam, c.key)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	r = r.WithContext(context.WithValue(ctx, key(c.key), c))
+	w := httptest.NewRecorder()
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.handleGet(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildErrResp(errDBUnavailable), w.Body.String())
+}
+
+func Test_service_routes_dbUnavailable(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+	assert.NoError(t, (&commentable{db: db, kind: "posts", key: "my-key"}).ensure())
+	cleanup(db)
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	// the verifier fails with the db rather than telling the type is not found
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments", nil)
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildErrResp(errDBUnavailable), w.Body.String())
+
+	// and so does the validator rather than telling the resource is not found
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(commentableTypeParam, "posts")
+	rctx.URLParams.Add(commentableKeyParam, "my-key")
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+
+	svc.validator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the next handler should not be called")
+	})).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildErrResp(errDBUnavailable), w.Body.String())
+}
+
 func Test_respondWithMsg(t *testing.T) {
 	t.Parallel()
 
@@ -720,7 +1945,7 @@ func Test_respondWithPayload(t *testing.T) {
 		{
 			name:     "it sends an error msg if it fails to marshal payload",
 			payload:  math.Inf(1),
-			wantBody: `{"message":"failed to prepare response. Please try again"}`,
+			wantBody: `{"error":{"code":"RESPONSE_FAILED","message":"failed to prepare response. Please try again"}}`,
 			wantCode: http.StatusInternalServerError,
 		},
 		{
@@ -742,3 +1967,254 @@ func Test_respondWithPayload(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_handleClear(t *testing.T) {
+	t.Parallel()
+
+	kind := "posts"
+	key := "my-key"
+	tests := []struct {
+		name       string
+		path       string
+		authHeader string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:     "it does not remove the comments if the caller is not an admin",
+			path:     fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errForbidden),
+		},
+		{
+			name:       "it responds with error if the resource does not exist",
+			path:       fmt.Sprintf("/v1/%s/another-key/comments", kind),
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusNotFound,
+			wantBody:   buildNotFoundResp(kind, "another-key"),
+		},
+		{
+			name:       "it removes all comments on the resource",
+			path:       fmt.Sprintf("/v1/%s/%s/comments", kind, key),
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"removed":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			assert.NoError(t, setup(db, []string{kind}))
+			cm := &commentable{db: db, kind: kind, key: key}
+			assert.NoError(t, cm.ensure())
+			for _, v := range []string{"foo", "bar"} {
+				_, err := cm.add(&comment{Value: v})
+				assert.NoError(t, err)
+			}
+
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, tt.path, nil)
+			r.Header.Set("Authorization", tt.authHeader)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_service_handleMove(t *testing.T) {
+	t.Parallel()
+
+	kind := "posts"
+	key := "my-key"
+	path := fmt.Sprintf("/v1/%s/%s/comments/move", kind, key)
+	tests := []struct {
+		name       string
+		payload    string
+		authHeader string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:     "it does not move the comments if the caller is not an admin",
+			payload:  `{"to":"other-key"}`,
+			wantCode: http.StatusForbidden,
+			wantBody: buildErrResp(errForbidden),
+		},
+		{
+			name:       "it responds with error if the target is missing",
+			payload:    `{}`,
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusBadRequest,
+			wantBody:   buildErrResp(errCommentMoveInvalid),
+		},
+		{
+			name:       "it responds with error if the target is the resource itself",
+			payload:    fmt.Sprintf(`{"to":"%s"}`, key),
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusBadRequest,
+			wantBody:   buildErrResp(errCommentMoveInvalid),
+		},
+		{
+			name:       "it responds with error if the target key is invalid",
+			payload:    `{"to":"internal-key"}`,
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusBadRequest,
+			wantBody:   buildErrResp(errCommentableKeyInvalid.withArgs("key matches the reserved pattern internal-*")),
+		},
+		{
+			name:       "it responds with error if the target already has comments",
+			payload:    `{"to":"busy-key"}`,
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusConflict,
+			wantBody:   buildErrResp(errCommentMoveConflict),
+		},
+		{
+			name:       "it merges the comments into a target with comments",
+			payload:    `{"to":"busy-key","merge":true}`,
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"moved":2}`,
+		},
+		{
+			name:       "it moves the comments",
+			payload:    `{"to":"other-key"}`,
+			authHeader: "Bearer secret",
+			wantCode:   http.StatusOK,
+			wantBody:   `{"moved":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			assert.NoError(t, setup(db, []string{kind}))
+			for k, values := range map[string][]string{key: {"foo", "bar"}, "busy-key": {"baz"}} {
+				cm := &commentable{db: db, kind: kind, key: k}
+				assert.NoError(t, cm.ensure())
+				for _, v := range values {
+					_, err := cm.add(&comment{Value: v})
+					assert.NoError(t, err)
+				}
+			}
+
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+			cfg.ReservedKeys = keyPatterns{"internal-*"}
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(tt.payload))
+			r.Header.Set("Authorization", tt.authHeader)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_service_redirectSlashes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+	c, err := cm.add(&comment{Value: "hello"})
+	assert.NoError(t, err)
+	commentPath := "/v1/books/1/comments/" + c.ID
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/v1/books/1/comments"},
+		{http.MethodGet, "/v1/books/1/comments"},
+		{http.MethodGet, "/v1/books/1/comments/commenters/count"},
+		{http.MethodDelete, "/v1/books/1/comments"},
+		{http.MethodPost, "/v1/books/1/comments/move"},
+		{http.MethodGet, commentPath},
+		{http.MethodPatch, commentPath},
+		{http.MethodDelete, commentPath},
+		{http.MethodPost, commentPath + "/restore"},
+		{http.MethodDelete, "/v1/admin/authors/jane"},
+		{http.MethodGet, "/v1/admin/audit"},
+		{http.MethodGet, "/status"},
+	}
+
+	for _, rt := range routes {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(rt.method, rt.path+"/?pretty=true", nil)
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code, "the trailing slash should be redirected")
+			assert.Equal(t, rt.path+"?pretty=true", w.Header().Get("Location"))
+
+			// the requests are not valid, but they should reach the handlers rather than the router's 404 or 405
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(rt.method, rt.path, nil)
+			mux.ServeHTTP(w, r)
+
+			assert.NotEqual(t, http.StatusPermanentRedirect, w.Code)
+			assert.NotEqual(t, http.StatusMethodNotAllowed, w.Code)
+			assert.NotContains(t, w.Body.String(), "page not found")
+		})
+	}
+}
+
+func Test_service_redirectSlashes_sameHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "//evil.com/", want: "/evil.com"},
+		{path: "/%2Fevil.com/", want: "/evil.com"},
+		{path: "///evil.com//", want: "/evil.com"},
+		{path: "/%5Cevil.com/", want: "/evil.com"},
+		{path: "/%2F%5Cevil.com/", want: "/evil.com"},
+		{path: "//", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop()}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the request should be redirected")
+			})
+
+			w := httptest.NewRecorder()
+			svc.redirectSlashes(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"), "the redirect should stay on the host")
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// shardPath is the bolt file of the commentable type in the shard directory
+func shardPath(dir, kind string) string {
+	return filepath.Join(dir, kind+".db")
+}
+
+// openShards opens one bolt file per commentable type in dir, creating the directory if needed,
+// so that writes to different types don't wait on each other. The files already opened are closed
+// if one of them fails to open.
+func openShards(dir string, kinds []string, opts *bolt.Options) (map[string]*bolt.DB, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	shards := map[string]*bolt.DB{}
+	for _, kind := range kinds {
+		db, err := bolt.Open(shardPath(dir, kind), 0600, opts)
+		if err != nil {
+			for _, opened := range shards {
+				opened.Close()
+			}
+			return nil, err
+		}
+
+		shards[kind] = db
+	}
+
+	return shards, nil
+}
+
+// dbOf returns the db the commentable type is kept in, its own file if the db is sharded
+func (svc *service) dbOf(kind string) *bolt.DB {
+	if db, ok := svc.shards[kind]; ok {
+		return db
+	}
+
+	return svc.db
+}
+
+// dbs returns every db of the service, the shared one first and then the shards in the order of their types
+func (svc *service) dbs() []*bolt.DB {
+	kinds := make([]string, 0, len(svc.shards))
+	for kind := range svc.shards {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	dbs := []*bolt.DB{svc.db}
+	for _, kind := range kinds {
+		dbs = append(dbs, svc.shards[kind])
+	}
+
+	return dbs
+}
+
+// kindsIn returns those of kinds that are kept in db
+func (svc *service) kindsIn(db *bolt.DB, kinds []string) []string {
+	var in []string
+	for _, kind := range kinds {
+		if svc.dbOf(kind) == db {
+			in = append(in, kind)
+		}
+	}
+
+	return in
+}
+
+// perDB calls fn with every db of the service along with those of kinds kept in it, skipping the dbs
+// keeping none of them, and sums up the counts fn returns. It stops at the first error.
+func (svc *service) perDB(kinds []string, fn func(*bolt.DB, []string) (int, error)) (int, error) {
+	var total int
+	for _, db := range svc.dbs() {
+		in := svc.kindsIn(db, kinds)
+		if len(in) == 0 {
+			continue
+		}
+
+		n, err := fn(db, in)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
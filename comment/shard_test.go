@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_openShards(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "shards-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	shards, err := openShards(dir, []string{"authors", "books"}, nil)
+	assert.NoError(t, err)
+	defer func() {
+		for _, db := range shards {
+			db.Close()
+		}
+	}()
+
+	assert.Len(t, shards, 2)
+	assert.Equal(t, shardPath(dir, "authors"), shards["authors"].Path())
+	assert.Equal(t, shardPath(dir, "books"), shards["books"].Path())
+}
+
+func Test_service_shards(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	books := setupDB()
+	defer cleanup(books)
+
+	cfg := testConfig()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.shards = map[string]*bolt.DB{"books": books}
+	assert.NoError(t, svc.setup([]string{"authors", "books"}))
+
+	for _, v := range []struct {
+		db    *bolt.DB
+		kind  string
+		found bool
+	}{{db, "authors", true}, {db, "books", false}, {books, "books", true}, {books, "authors", false}} {
+		found, err := verify(v.db, v.kind)
+		assert.NoError(t, err)
+		assert.Equal(t, v.found, found, v.kind)
+	}
+	assert.Equal(t, []*bolt.DB{db, books}, svc.dbs())
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	for _, kind := range []string{"authors", "books"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/"+kind+"/my-key/comments", strings.NewReader(`{"value":"hello"}`))
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, kind)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/v1/"+kind+"/my-key/comments", nil)
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, kind)
+		assert.Equal(t, "1", w.Header().Get(totalCountHeader), kind)
+	}
+
+	// the comments are kept in the db of their type
+	n, err := (&commentable{db: books, kind: "books", key: "my-key"}).count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	found, err := (&commentable{db: db, kind: "books", key: "my-key"}).exists()
+	assert.NoError(t, err)
+	assert.False(t, found)
+	found, err = (&commentable{db: db, kind: "authors", key: "my-key"}).exists()
+	assert.NoError(t, err)
+	assert.True(t, found)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+// snapshotVersion is the version of the snapshot format, snapshots of other versions are rejected
+const snapshotVersion = 1
+
+// snapshot is a portable copy of the whole db, shards included, e.g. to migrate between environments where
+// copying the bolt files is not an option. Keys and values are kept as bytes, i.e. base64 in json, as bolt
+// keys and values need not be text, e.g. the sequence keys of the audit trail.
+type snapshot struct {
+	Version int             `json:"version"`
+	Buckets []snapshotEntry `json:"buckets"`
+}
+
+// snapshotEntry is a key of a bucket along with either its value or its nested bucket
+type snapshotEntry struct {
+	Key    []byte          `json:"key"`
+	Value  []byte          `json:"value,omitempty"`
+	Bucket *snapshotBucket `json:"bucket,omitempty"`
+	// the type of the shard a top level bucket was exported from if it is not the one of its own name,
+	// i.e. the audit trail of a shard, empty for the buckets of the shared db and of the types
+	Shard string `json:"shard,omitempty"`
+}
+
+type snapshotBucket struct {
+	Sequence uint64          `json:"sequence,omitempty"`
+	Entries  []snapshotEntry `json:"entries"`
+}
+
+// handleExportSnapshot streams a snapshot of the whole db, shards included, as json
+func (svc *service) handleExportSnapshot(w http.ResponseWriter, r *http.Request) {
+	// every db is read in a transaction of its own, all of them opened before anything is written
+	txs := map[string]*bolt.Tx{}
+	for shard, db := range svc.shardsByType() {
+		tx, err := db.Begin(false)
+		if err != nil {
+			svc.fail(w, svc.logger, errSnapshotExport, err)
+			return
+		}
+		defer tx.Rollback()
+
+		txs[shard] = tx
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="comments-snapshot.json"`)
+
+	if err := writeSnapshot(txs, w); err != nil {
+		// the export is cut short if it fails midway as the status has already been sent
+		svc.logger.Error(errSnapshotExport.Message, zap.Error(err))
+	}
+}
+
+// handleImportSnapshot restores the buckets of a snapshot made by handleExportSnapshot. The snapshot is checked
+// as a whole first, but each db is then written in a transaction of its own, so a db failing to write leaves
+// those before it restored and those after it as they were. As the buckets are replaced rather than merged,
+// importing the same snapshot again finishes the restore.
+func (svc *service) handleImportSnapshot(w http.ResponseWriter, r *http.Request) {
+	var s snapshot
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		svc.fail(w, svc.logger, errSnapshotInvalid, err)
+		return
+	}
+
+	if err := s.validate(); err != nil {
+		svc.fail(w, svc.logger, errSnapshotStructure.withArgs(err), err)
+		return
+	}
+
+	// the buckets are written to the db of their type, the audit trail of a shard back to the shard
+	entries := map[*bolt.DB][]snapshotEntry{}
+	for _, e := range s.Buckets {
+		kind := string(e.Key)
+		if e.Shard != "" {
+			kind = e.Shard
+		}
+
+		db := svc.dbOf(kind)
+		entries[db] = append(entries[db], e)
+	}
+
+	var n int
+	var err error
+	for _, db := range svc.dbs() {
+		if len(entries[db]) == 0 {
+			continue
+		}
+
+		var written int
+		written, err = restoreSnapshot(db, entries[db])
+		n += written
+		if err != nil {
+			err = fmt.Errorf("restoring %s: %v", db.Path(), err)
+			break
+		}
+	}
+	// the cached comments may have been replaced
+	svc.cache.clear()
+	if err != nil {
+		svc.fail(w, svc.logger, errSnapshotImport, err)
+		return
+	}
+
+	svc.logger.Info("imported snapshot", zap.Int("written", n))
+	svc.respondWithPayload(w, struct {
+		Written int `json:"written"`
+	}{n}, http.StatusOK)
+}
+
+// shardsByType returns every db of the service by the type of its shard, the shared db under ""
+func (svc *service) shardsByType() map[string]*bolt.DB {
+	dbs := map[string]*bolt.DB{"": svc.db}
+	for kind, db := range svc.shards {
+		dbs[kind] = db
+	}
+
+	return dbs
+}
+
+// writeSnapshot streams the snapshot of the dbs as seen by txs, by the type of their shard, to w,
+// one key at a time, so that the dbs are never held in memory as a whole. Buckets of sharded types
+// that are left in the shared db, e.g. from before it was sharded, are not served and left out.
+func writeSnapshot(txs map[string]*bolt.Tx, w io.Writer) error {
+	shards := make([]string, 0, len(txs))
+	for shard := range txs {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"version":%d,"buckets":[`, snapshotVersion)
+
+	first := true
+	for _, shard := range shards {
+		err := txs[shard].ForEach(func(name []byte, b *bolt.Bucket) error {
+			if _, sharded := txs[string(name)]; shard == "" && sharded {
+				return nil
+			}
+
+			if !first {
+				bw.WriteByte(',')
+			}
+			first = false
+
+			// the buckets of the type of a shard go back to it by their name alone
+			from := shard
+			if from == string(name) {
+				from = ""
+			}
+			return writeSnapshotEntry(bw, from, name, nil, b)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	bw.WriteString("]}")
+	return bw.Flush()
+}
+
+// writeSnapshotEntry writes the key with its value, or with its nested bucket if b is set,
+// along with the shard it was exported from if set
+func writeSnapshotEntry(w *bufio.Writer, shard string, k, v []byte, b *bolt.Bucket) error {
+	key, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	w.WriteByte('{')
+	if shard != "" {
+		name, err := json.Marshal(shard)
+		if err != nil {
+			return err
+		}
+
+		w.WriteString(`"shard":`)
+		w.Write(name)
+		w.WriteByte(',')
+	}
+
+	w.WriteString(`"key":`)
+	w.Write(key)
+
+	if b == nil {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		w.WriteString(`,"value":`)
+		w.Write(value)
+		return w.WriteByte('}')
+	}
+
+	fmt.Fprintf(w, `,"bucket":{"sequence":%d,"entries":[`, b.Sequence())
+	first := true
+	err = b.ForEach(func(k, v []byte) error {
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+
+		if v == nil {
+			return writeSnapshotEntry(w, "", k, nil, b.Bucket(k))
+		}
+		return writeSnapshotEntry(w, "", k, v, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteString("]}}")
+	return err
+}
+
+// validate checks that the snapshot can be restored as a whole before anything is written
+func (s *snapshot) validate() error {
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, snapshotVersion)
+	}
+
+	// the same name may be in several shards, e.g. the audit trail, but only once in each
+	shards := map[string][]snapshotEntry{}
+	for _, e := range s.Buckets {
+		if e.Bucket == nil {
+			return fmt.Errorf("top level key %q is not a bucket", e.Key)
+		}
+		shards[e.Shard] = append(shards[e.Shard], e)
+	}
+
+	for _, entries := range shards {
+		if err := validateEntries(entries); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateEntries(entries []snapshotEntry) error {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		switch {
+		case len(e.Key) == 0:
+			return errors.New("snapshot has an empty key")
+		case seen[string(e.Key)]:
+			return fmt.Errorf("key %q is in the snapshot more than once", e.Key)
+		case (e.Value == nil) == (e.Bucket == nil):
+			return fmt.Errorf("key %q should have either a value or a bucket", e.Key)
+		}
+		seen[string(e.Key)] = true
+
+		if e.Bucket != nil {
+			if err := validateEntries(e.Bucket.Entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreSnapshot writes the given top level buckets of a snapshot to db in one transaction, each replacing
+// the bucket of the same name. Buckets that are not in the snapshot are left as they are.
+// It returns how many keys were written, including those of the buckets.
+func restoreSnapshot(db *bolt.DB, entries []snapshotEntry) (int, error) {
+	var written int
+	err := db.Update(func(tx *bolt.Tx) error {
+		written = 0
+		for _, e := range entries {
+			if tx.Bucket(e.Key) != nil {
+				if err := tx.DeleteBucket(e.Key); err != nil {
+					return err
+				}
+			}
+
+			b, err := tx.CreateBucket(e.Key)
+			if err != nil {
+				return err
+			}
+
+			n, err := restoreBucket(b, e.Bucket)
+			written += n + 1
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return written, err
+}
+
+func restoreBucket(b *bolt.Bucket, sb *snapshotBucket) (int, error) {
+	if err := b.SetSequence(sb.Sequence); err != nil {
+		return 0, err
+	}
+
+	var written int
+	for _, e := range sb.Entries {
+		if e.Bucket == nil {
+			if err := b.Put(e.Key, e.Value); err != nil {
+				return written, err
+			}
+			written++
+			continue
+		}
+
+		nested, err := b.CreateBucket(e.Key)
+		if err != nil {
+			return written, err
+		}
+
+		n, err := restoreBucket(nested, e.Bucket)
+		written += n + 1
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_snapshot_validate(t *testing.T) {
+	t.Parallel()
+
+	bucket := &snapshotBucket{}
+	tests := []struct {
+		name    string
+		s       snapshot
+		wantErr bool
+	}{
+		{
+			name: "it accepts an empty snapshot",
+			s:    snapshot{Version: snapshotVersion},
+		},
+		{
+			name: "it accepts nested buckets and values",
+			s: snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{
+				{Key: []byte("books"), Bucket: &snapshotBucket{Sequence: 2, Entries: []snapshotEntry{
+					{Key: []byte("1"), Bucket: bucket},
+					{Key: []byte("a"), Value: []byte{}},
+				}}},
+			}},
+		},
+		{
+			name:    "it rejects other versions",
+			s:       snapshot{Version: snapshotVersion + 1},
+			wantErr: true,
+		},
+		{
+			name:    "it rejects top level values",
+			s:       snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{{Key: []byte("a"), Value: []byte("1")}}},
+			wantErr: true,
+		},
+		{
+			name:    "it rejects empty keys",
+			s:       snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{{Bucket: bucket}}},
+			wantErr: true,
+		},
+		{
+			name: "it rejects duplicate keys",
+			s: snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{
+				{Key: []byte("a"), Bucket: bucket},
+				{Key: []byte("a"), Bucket: bucket},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "it accepts the same key in different shards",
+			s: snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{
+				{Key: []byte("_audit"), Bucket: bucket},
+				{Key: []byte("_audit"), Bucket: bucket, Shard: "books"},
+			}},
+		},
+		{
+			name: "it rejects keys with both a value and a bucket",
+			s: snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{
+				{Key: []byte("a"), Bucket: &snapshotBucket{Entries: []snapshotEntry{{Key: []byte("b"), Value: []byte("1"), Bucket: bucket}}}},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "it rejects keys with neither a value nor a bucket",
+			s: snapshot{Version: snapshotVersion, Buckets: []snapshotEntry{
+				{Key: []byte("a"), Bucket: &snapshotBucket{Entries: []snapshotEntry{{Key: []byte("b")}}}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.s.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_service_snapshot(t *testing.T) {
+	t.Parallel()
+
+	from := setupDB()
+	defer cleanup(from)
+
+	err := from.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("books"))
+		if err != nil {
+			return err
+		}
+
+		if err = b.SetSequence(7); err != nil {
+			return err
+		}
+
+		nested, err := b.CreateBucket([]byte("1"))
+		if err != nil {
+			return err
+		}
+
+		if err = nested.Put([]byte{0, 0, 0, 1}, []byte{0xff, 0xfe}); err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte("authors"))
+		return err
+	})
+	assert.NoError(t, err)
+
+	to := setupDB()
+	defer cleanup(to)
+
+	// what is not in the snapshot is kept while the buckets in it are replaced
+	err = to.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("books"))
+		if err != nil {
+			return err
+		}
+
+		if err = b.Put([]byte("stale"), []byte("1")); err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte("notes"))
+		return err
+	})
+	assert.NoError(t, err)
+
+	serve := func(db *bolt.DB, method, path, token string, body []byte) *httptest.ResponseRecorder {
+		cfg := testConfig()
+		cfg.AdminToken = "secret"
+
+		mux := chi.NewRouter()
+		svc := newService(db, zap.NewNop(), cfg)
+		svc.registerRoutes(mux)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(from, http.MethodGet, "/v1/admin/export", "not-the-secret", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serve(from, http.MethodGet, "/v1/admin/export", "secret", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	exported := w.Body.Bytes()
+
+	w = serve(to, http.MethodPost, "/v1/admin/import/full", "secret", []byte(`{"version":`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(to, http.MethodPost, "/v1/admin/import/full", "secret", []byte(`{"version":2,"buckets":[]}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = serve(to, http.MethodPost, "/v1/admin/import/full", "secret", exported)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"written":4}`, w.Body.String())
+
+	err = to.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("books"))
+		assert.Equal(t, uint64(7), b.Sequence())
+		assert.Nil(t, b.Get([]byte("stale")), "the replaced bucket should not keep its keys")
+		assert.Equal(t, []byte{0xff, 0xfe}, b.Bucket([]byte("1")).Get([]byte{0, 0, 0, 1}))
+		assert.NotNil(t, tx.Bucket([]byte("authors")))
+		assert.NotNil(t, tx.Bucket([]byte("notes")), "buckets that are not in the snapshot should be kept")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func Test_service_snapshot_shards(t *testing.T) {
+	t.Parallel()
+
+	serve := func(svc *service, method, path string, body []byte) *httptest.ResponseRecorder {
+		mux := chi.NewRouter()
+		svc.registerRoutes(mux)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	cfg := testConfig()
+	cfg.AdminToken = "secret"
+	newSharded := func() (*service, *bolt.DB, *bolt.DB) {
+		db, books := setupDB(), setupDB()
+		svc := newService(db, zap.NewNop(), cfg)
+		svc.shards = map[string]*bolt.DB{"books": books}
+		assert.NoError(t, svc.setup([]string{"authors", "books"}))
+		return svc, db, books
+	}
+
+	from, db, books := newSharded()
+	defer cleanup(db)
+	defer cleanup(books)
+
+	for _, kind := range []string{"authors", "books"} {
+		cm := &commentable{db: from.dbOf(kind), kind: kind, key: "1"}
+		assert.NoError(t, cm.ensure())
+		c, err := cm.add(&comment{Value: "hello"})
+		assert.NoError(t, err)
+		_, err = cm.add(&comment{Value: "bye"})
+		assert.NoError(t, err)
+		assert.NoError(t, cm.remove(c.ID, caller{admin: true}))
+	}
+
+	w := serve(from, http.MethodGet, "/v1/admin/export", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	exported := w.Body.Bytes()
+	assert.Contains(t, string(exported), `"shard":"books"`, "the audit trail of the shard should be told apart")
+
+	to, toDB, toBooks := newSharded()
+	defer cleanup(toDB)
+	defer cleanup(toBooks)
+
+	w = serve(to, http.MethodPost, "/v1/admin/import/full", exported)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// every type is restored to its own db, along with its audit trail
+	for _, tt := range []struct {
+		db   *bolt.DB
+		kind string
+	}{{toDB, "authors"}, {toBooks, "books"}} {
+		n, err := (&commentable{db: tt.db, kind: tt.kind, key: "1"}).count()
+		assert.NoError(t, err, tt.kind)
+		assert.Equal(t, 1, n, tt.kind)
+
+		entries, err := recentAudit(tt.db, 0)
+		assert.NoError(t, err, tt.kind)
+		assert.Len(t, entries, 1, tt.kind)
+	}
+
+	found, err := verify(toDB, "books")
+	assert.NoError(t, err)
+	assert.False(t, found, "the sharded type should not be restored to the shared db")
+}
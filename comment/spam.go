@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// the weights of the signals of spam, a comment scores the sum of those it shows, capped at 1
+const (
+	spamLinkWeight     = 0.25 // per link, e.g. a single link in a comment is common enough
+	spamRepeatWeight   = 0.2  // for runs of the same character, e.g. !!!!! or sooooo
+	spamCapsWeight     = 0.3  // for shouting, scaled by the share of uppercase letters
+	spamBlockedWeight  = 0.5  // per blocklisted word
+	spamMinRepeat      = 5    // characters in a row that count as a run
+	spamMinCapsLetters = 10   // letters a comment needs before its caps count as shouting
+	spamMinCapsRatio   = 0.7
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://|\bwww\.`)
+
+// spamScore rates how likely the comment value is spam, from 0 for none of the signals to 1.
+// Blocked words are matched case-insensitively as whole words, so that e.g. class doesn't match ass.
+func spamScore(value string, blocked []string) float64 {
+	score := spamLinkWeight * float64(len(linkPattern.FindAllStringIndex(value, -1)))
+
+	if hasRepeatedRune(value, spamMinRepeat) {
+		score += spamRepeatWeight
+	}
+
+	var letters, upper int
+	for _, r := range value {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= spamMinCapsLetters {
+		if ratio := float64(upper) / float64(letters); ratio >= spamMinCapsRatio {
+			score += spamCapsWeight * ratio
+		}
+	}
+
+	lower := strings.ToLower(value)
+	for _, word := range blocked {
+		if word != "" && containsWord(lower, strings.ToLower(word)) {
+			score += spamBlockedWeight
+		}
+	}
+
+	if score > 1 {
+		return 1
+	}
+	return score
+}
+
+// containsWord reports whether the word is in the value with neither a letter nor a digit right before or after it
+func containsWord(value, word string) bool {
+	for i := 0; i <= len(value)-len(word); {
+		j := strings.Index(value[i:], word)
+		if j < 0 {
+			return false
+		}
+
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(value[:start])
+		after, _ := utf8.DecodeRuneInString(value[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+
+		// the next match may overlap this one
+		_, size := utf8.DecodeRuneInString(value[start:])
+		i = start + size
+	}
+
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// hasRepeatedRune reports whether the value has n of the same character in a row, whitespace aside
+func hasRepeatedRune(value string, n int) bool {
+	var prev rune
+	run := 0
+	for _, r := range value {
+		if r == prev && !unicode.IsSpace(r) {
+			run++
+		} else {
+			prev, run = r, 1
+		}
+
+		if run >= n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flagSpam scores the comment and hides it if it scores at or above the configured threshold
+func (svc *service) flagSpam(c *comment) {
+	cfg := svc.config()
+	c.SpamScore = spamScore(c.Value, cfg.SpamBlocklist)
+	c.Hidden = cfg.SpamThreshold > 0 && c.SpamScore >= cfg.SpamThreshold
+}
+
+// handleListHidden lists the hidden comments of the resource, e.g. likely spam, so that admins can review them
+func (svc *service) handleListHidden(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+
+	limit, e := svc.pageSize(r, errCommentLimitInvalid)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	offset, e := pageOffset(r)
+	if e != nil {
+		svc.fail(w, svc.logger, *e, nil)
+		return
+	}
+
+	cmts, err := c.hidden()
+	if err != nil {
+		svc.fail(w, svc.logger, errCommentList, err,
+			zap.String(commentableKeyParam, c.key),
+			zap.String(commentableTypeParam, c.kind),
+		)
+		return
+	}
+
+	w.Header().Set(totalCountHeader, strconv.Itoa(len(cmts)))
+	svc.respondWithList(w, "comments", newCommentResponses(page(cmts, offset, limit), callerOf(r)))
+}
+
+// handleUnhide shows a hidden comment in the list of the resource's comments again,
+// e.g. once an admin found it was wrongly taken for spam
+func (svc *service) handleUnhide(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+	cKey := chi.URLParam(r, commentKeyParam)
+	l := svc.logger.With(
+		zap.String(commentKeyParam, cKey),
+		zap.String(commentableKeyParam, c.key),
+		zap.String(commentableTypeParam, c.kind),
+	)
+
+	if _, err := c.get(cKey); err != nil {
+		svc.fail(w, l, errCommentNotFound, err)
+		return
+	}
+
+	cmt, err := c.unhide(cKey, callerOf(r))
+	svc.cache.invalidate(c.kind, c.key, cKey)
+	if err != nil {
+		svc.fail(w, l, errCommentUnhide, err)
+		return
+	}
+
+	svc.respondWithPayload(w, newCommentResponse(cmt, callerOf(r)), http.StatusOK)
+}
+
+// hidden returns the hidden comments that have not expired in the order of list
+func (cm *commentable) hidden() ([]*comment, error) {
+	comments := []*comment{}
+	err := cm.db.View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		komments := rBucket.Bucket(commentsKey)
+		if komments == nil {
+			return nil
+		}
+
+		now := time.Now()
+		return komments.ForEach(func(_, data []byte) error {
+			var c comment
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+
+			if c.Hidden && !c.expired(now) {
+				comments = append(comments, &c)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// unhide shows the hidden comment with the given key and returns it, recording the change in the audit trail.
+// Its spam score is kept, so it is hidden again if it still scores at or above the threshold once updated.
+// The version of the comment is incremented so that edits made concurrently don't undo the change.
+func (cm *commentable) unhide(cKey string, by caller) (*comment, error) {
+	var c comment
+	err := cm.db.Update(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		comments := rBucket.Bucket(commentsKey)
+		if comments == nil {
+			return cm.commentNotFound(cKey)
+		}
+
+		data := comments.Get([]byte(cKey))
+		if data == nil {
+			return cm.commentNotFound(cKey)
+		}
+
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		if !c.Hidden {
+			return nil
+		}
+
+		err := audit(tx, auditEntry{
+			Action:  auditActionUnhide,
+			Kind:    cm.kind,
+			Key:     cm.key,
+			Actor:   by.id,
+			Admin:   by.admin,
+			IP:      by.ip,
+			At:      time.Now().UTC(),
+			Comment: json.RawMessage(data),
+		})
+		if err != nil {
+			return err
+		}
+
+		c.Hidden = false
+		c.Version++
+		data, err = json.Marshal(&c)
+		if err != nil {
+			return err
+		}
+
+		return comments.Put([]byte(cKey), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_spamScore(t *testing.T) {
+	t.Parallel()
+
+	blocked := []string{"pills", "Casino"}
+	tests := []struct {
+		name  string
+		value string
+		want  float64
+	}{
+		{
+			name:  "it scores a clear ham comment 0",
+			value: "Great article, thanks for sharing! I learned a lot about bolt.",
+			want:  0,
+		},
+		{
+			name:  "it scores a clear spam comment 1",
+			value: "BUY CHEAP PILLS NOW!!!!!! http://pills.example www.casino.example",
+			want:  1,
+		},
+		{
+			name:  "it scores links",
+			value: "the docs at https://example.com/docs and HTTP://example.com/faq",
+			want:  2 * spamLinkWeight,
+		},
+		{
+			name:  "it scores runs of the same character",
+			value: "sooooo good",
+			want:  spamRepeatWeight,
+		},
+		{
+			name:  "it does not score runs of whitespace",
+			value: "so      good",
+			want:  0,
+		},
+		{
+			name:  "it scores shouting by the share of uppercase letters",
+			value: "THIS IS AMAZING NEWS",
+			want:  spamCapsWeight,
+		},
+		{
+			name:  "it does not score short or mostly lowercase comments for caps",
+			value: "OK, Hello World From Go",
+			want:  0,
+		},
+		{
+			name:  "it scores blocklisted words regardless of case",
+			value: "try my casino",
+			want:  spamBlockedWeight,
+		},
+		{
+			name:  "it scores blocklisted words next to punctuation",
+			value: "casino! and (pills)",
+			want:  2 * spamBlockedWeight,
+		},
+		{
+			name:  "it does not score blocklisted words within other words",
+			value: "the casinos of pillsbury",
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, spamScore(tt.value, blocked), 1e-9)
+		})
+	}
+}
+
+func Test_service_handleAdd_spam(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cfg := testConfig()
+	cfg.SpamThreshold = 0.5
+	cfg.SpamBlocklist = []string{"casino"}
+	cfg.AdminToken = "secret"
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	tests := []struct {
+		name       string
+		value      string
+		wantScore  float64
+		wantHidden bool
+	}{
+		{
+			name:  "it adds ham as it is",
+			value: "nice post",
+		},
+		{
+			name:      "it keeps comments scoring below the threshold listed",
+			value:     "see https://example.com",
+			wantScore: spamLinkWeight,
+		},
+		{
+			name:       "it hides comments scoring at or above the threshold",
+			value:      "best casino https://casino.example",
+			wantScore:  spamBlockedWeight + spamLinkWeight,
+			wantHidden: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			payload := fmt.Sprintf(`{"value": %q, "spam_score": 0, "hidden": false}`, tt.value)
+			r := httptest.NewRequest(http.MethodPost, "/v1/posts/my-key/comments", bytes.NewBufferString(payload))
+			r.Header.Set("Authorization", "Bearer secret") // the score is only sent to admins
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			got := &comment{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+			assert.InDelta(t, tt.wantScore, got.SpamScore, 1e-9)
+			assert.Equal(t, tt.wantHidden, got.Hidden)
+
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/comments", nil))
+			assert.Equal(t, !tt.wantHidden, bytes.Contains(w.Body.Bytes(), []byte(got.ID)),
+				"only comments that are not hidden should be listed")
+		})
+	}
+}
+
+func Test_service_handleListHidden_handleUnhide(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	ham, err := cm.add(&comment{Value: "nice post"})
+	assert.NoError(t, err)
+	spam, err := cm.add(&comment{Value: "best casino", SpamScore: 0.5, Hidden: true})
+	assert.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.AdminToken = "secret"
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/v1/posts/my-key/comments"+path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/hidden", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/"+spam.ID+"/unhide", "").Code)
+
+	w := serve(http.MethodGet, "/hidden", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(totalCountHeader))
+	assert.True(t, bytes.Contains(w.Body.Bytes(), []byte(spam.ID)), "the hidden comment should be listed")
+	assert.False(t, bytes.Contains(w.Body.Bytes(), []byte(ham.ID)), "only hidden comments should be listed")
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/unknown/unhide", "secret").Code)
+
+	w = serve(http.MethodPost, "/"+spam.ID+"/unhide", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	got := &comment{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), got))
+	assert.False(t, got.Hidden)
+	assert.Equal(t, 0.5, got.SpamScore, "the score should be kept")
+	assert.Equal(t, spam.Version+1, got.Version)
+
+	w = serve(http.MethodGet, "/hidden", "secret")
+	assert.Equal(t, "0", w.Header().Get(totalCountHeader))
+	w = serve(http.MethodGet, "", "")
+	assert.True(t, bytes.Contains(w.Body.Bytes(), []byte(spam.ID)), "the unhidden comment should be listed")
+
+	entries, err := recentAudit(db, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, auditActionUnhide, entries[0].Action)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+// statsPeriods are the layouts of the periods comments can be counted by, in UTC
+var statsPeriods = map[string]string{
+	"hour":  "2006-01-02T15",
+	"day":   "2006-01-02",
+	"month": "2006-01",
+}
+
+// handleStats responds with the number of comments on the resource that the caller can see,
+// per hour, day or month they were added in as set by the by query parameter, e.g. {"2024-01-01":12}.
+// Periods without comments are left out.
+func (svc *service) handleStats(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, commentableKeyParam)
+	c := r.Context().Value(key(k)).(*commentable)
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "day"
+	}
+
+	layout, ok := statsPeriods[by]
+	if !ok {
+		svc.fail(w, svc.logger, errCommentStatsByInvalid.withArgs(by), nil)
+		return
+	}
+
+	counts, err := c.countBy(layout, callerOf(r).canSee)
+	if err != nil {
+		svc.fail(w, svc.logger, errCommentList, err,
+			zap.String(commentableKeyParam, c.key),
+			zap.String(commentableTypeParam, c.kind),
+		)
+		return
+	}
+
+	svc.respondWithPayload(w, counts, http.StatusOK)
+}
+
+// countBy counts the comments on the commentable that keep returns true for by the time they
+// were added, formatted in UTC with the layout. The comments are counted while they are read,
+// those that expired, are hidden or were saved before creation times were recorded are left out.
+func (cm *commentable) countBy(layout string, keep func(*comment) bool) (map[string]int, error) {
+	counts := map[string]int{}
+	err := cm.db.View(func(tx *bolt.Tx) error {
+		cmBucket := tx.Bucket([]byte(cm.kind)) // bucket for posts
+		if cmBucket == nil {
+			return cm.typeNotFound()
+		}
+
+		rBucket := cmBucket.Bucket([]byte(cm.key)) // subbucket for post with key
+		if rBucket == nil {
+			return cm.notFound()
+		}
+
+		komments := rBucket.Bucket(commentsKey)
+		if komments == nil {
+			return nil
+		}
+
+		now := time.Now()
+		return komments.ForEach(func(_, data []byte) error {
+			var c comment
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+
+			// hidden comments are left out like they are from lists
+			if c.CreatedAt != nil && !c.expired(now) && !c.Hidden && keep(&c) {
+				counts[c.CreatedAt.UTC().Format(layout)]++
+			}
+			return nil
+		})
+	})
+
+	return counts, err
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleStats(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	at := func(s string) *time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return &t
+	}
+	past := time.Now().Add(-time.Minute)
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+
+	cm := &commentable{db: db, kind: "posts", key: "my-key"}
+	assert.NoError(t, cm.ensure())
+	assert.NoError(t, (&commentable{db: db, kind: "posts", key: "empty"}).ensure())
+	for _, c := range []*comment{
+		{Value: "a", CreatedAt: at("2024-01-01T10:15:00Z")},
+		{Value: "b", CreatedAt: at("2024-01-01T10:45:00Z")},
+		{Value: "c", CreatedAt: at("2024-01-01T23:30:00-02:00")}, // the next day in UTC
+		{Value: "d", CreatedAt: at("2024-02-10T08:00:00Z")},
+		{Value: "e", CreatedAt: at("2024-02-10T09:00:00Z"), Author: "jane", Visibility: visibilityPrivate},
+		{Value: "f", CreatedAt: at("2024-02-10T09:00:00Z"), ExpiresAt: &past},
+		{Value: "spam", CreatedAt: at("2024-02-10T09:00:00Z"), Hidden: true},
+		{Value: "g"},
+	} {
+		_, err := cm.add(c)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		userID   string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it counts the comments per day by default",
+			path:     "/v1/posts/my-key/comments/stats",
+			wantCode: http.StatusOK,
+			want:     `{"2024-01-01":2,"2024-01-02":1,"2024-02-10":1}`,
+		},
+		{
+			name:     "it counts the comments per hour",
+			path:     "/v1/posts/my-key/comments/stats?by=hour",
+			wantCode: http.StatusOK,
+			want:     `{"2024-01-01T10":2,"2024-01-02T01":1,"2024-02-10T08":1}`,
+		},
+		{
+			name:     "it counts the comments per month",
+			path:     "/v1/posts/my-key/comments/stats?by=month",
+			wantCode: http.StatusOK,
+			want:     `{"2024-01":3,"2024-02":1}`,
+		},
+		{
+			name:     "it counts the private comments the caller can see",
+			path:     "/v1/posts/my-key/comments/stats?by=month",
+			userID:   "jane",
+			wantCode: http.StatusOK,
+			want:     `{"2024-01":3,"2024-02":2}`,
+		},
+		{
+			name:     "it responds with no counts if there are no comments",
+			path:     "/v1/posts/empty/comments/stats",
+			wantCode: http.StatusOK,
+			want:     `{}`,
+		},
+		{
+			name:     "it responds with error if the period is unknown",
+			path:     "/v1/posts/my-key/comments/stats?by=week",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errCommentStatsByInvalid.withArgs("week")),
+		},
+		{
+			name:     "it responds with error if the resource does not exist",
+			path:     "/v1/posts/another-key/comments/stats",
+			wantCode: http.StatusNotFound,
+			want:     buildNotFoundResp("posts", "another-key"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(userIDHeader, tt.userID)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// dbStatus describes the bolt file, e.g. for operators to watch for runaway growth before compacting it
+type dbStatus struct {
+	Path  string `json:"path"`
+	Size  *int64 `json:"size,omitempty"`  // in bytes, left out if the file could not be stat'ed
+	Error string `json:"error,omitempty"` // why the file could not be stat'ed
+}
+
+// handleStatus responds with OK along with the status of the db and of the shards of the types kept apart.
+// Failing to stat a db file is reported in the payload rather than failing the check, as the service can still serve.
+func (svc *service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var shards map[string]dbStatus
+	for kind, db := range svc.shards {
+		if shards == nil {
+			shards = map[string]dbStatus{}
+		}
+		shards[kind] = svc.dbStatus(db.Path())
+	}
+
+	svc.respondWithPayload(w, struct {
+		Status string              `json:"status"`
+		DB     dbStatus            `json:"db"`
+		Shards map[string]dbStatus `json:"shards,omitempty"`
+	}{"OK", svc.dbStatus(svc.db.Path()), shards}, http.StatusOK)
+}
+
+// dbStatus stats the db file at path
+func (svc *service) dbStatus(path string) dbStatus {
+	db := dbStatus{Path: path}
+	fi, err := os.Stat(path)
+	if err != nil {
+		svc.logger.Warn("failed to stat the db file", zap.Error(err), zap.String("path", path))
+		db.Error = err.Error()
+	} else {
+		size := fi.Size()
+		db.Size = &size
+	}
+
+	return db
+}
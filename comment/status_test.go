@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		removeFile bool
+		wantSize   bool
+	}{
+		{
+			name:     "it responds with the path and size of the db file",
+			wantSize: true,
+		},
+		{
+			name:       "it responds with OK and the error if the db file can't be stat'ed",
+			removeFile: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			if tt.removeFile {
+				assert.NoError(t, os.Remove(db.Path()))
+			}
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/status", nil)
+
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var got struct {
+				Status string   `json:"status"`
+				DB     dbStatus `json:"db"`
+			}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, "OK", got.Status)
+			assert.Equal(t, db.Path(), got.DB.Path)
+
+			if tt.wantSize {
+				fi, err := os.Stat(db.Path())
+				assert.NoError(t, err)
+				if assert.NotNil(t, got.DB.Size) {
+					assert.Equal(t, fi.Size(), *got.DB.Size)
+				}
+				assert.Empty(t, got.DB.Error)
+			} else {
+				assert.Nil(t, got.DB.Size)
+				assert.NotEmpty(t, got.DB.Error)
+			}
+		})
+	}
+}
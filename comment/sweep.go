@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+// sweep periodically removes the expired comments of the given commentable types, along with
+// the comments trashed longer than the retention ago, until ctx is done
+func (svc *service) sweep(ctx context.Context, kinds []string) {
+	ticker := time.NewTicker(svc.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := svc.perDB(kinds, func(db *bolt.DB, kinds []string) (int, error) {
+				return sweepExpired(db, kinds, now)
+			})
+			if err != nil {
+				svc.logger.Error("failed to sweep expired comments", zap.Error(err), zap.Int("removed", n))
+				continue
+			}
+
+			if n > 0 {
+				svc.logger.Info("swept expired comments", zap.Int("removed", n))
+			}
+
+			if svc.cfg.TrashRetention <= 0 {
+				continue
+			}
+
+			before := now.Add(-svc.cfg.TrashRetention)
+			n, err = svc.perDB(kinds, func(db *bolt.DB, kinds []string) (int, error) {
+				return purgeTrash(db, kinds, before)
+			})
+			if err != nil {
+				svc.logger.Error("failed to purge trashed comments", zap.Error(err), zap.Int("removed", n))
+				continue
+			}
+
+			if n > 0 {
+				svc.logger.Info("purged trashed comments", zap.Int("removed", n))
+			}
+		}
+	}
+}
+
+// sweepExpired removes the comments of the given commentable types that expired by now
+// and returns how many were removed. Each commentable is swept in its own transaction
+// so that the sweep does not lock the db for one giant write.
+func sweepExpired(db *bolt.DB, kinds []string, now time.Time) (int, error) {
+	cms, err := commentablesOf(db, kinds)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, cm := range cms {
+		n, err := cm.removeExpired(now)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// purgeTrash removes the comments of the given commentable types that were trashed before the
+// given time and returns how many were removed, each commentable in its own transaction
+func purgeTrash(db *bolt.DB, kinds []string, before time.Time) (int, error) {
+	cms, err := commentablesOf(db, kinds)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, cm := range cms {
+		n, err := cm.purgeTrash(before)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// commentablesOf lists the commentables of the given types, or of all types if nil
+func commentablesOf(db *bolt.DB, kinds []string) ([]*commentable, error) {
+	var cms []*commentable
+	err := db.View(func(tx *bolt.Tx) error {
+		if kinds == nil {
+			err := tx.ForEach(func(kind []byte, _ *bolt.Bucket) error {
+				if !strings.HasPrefix(string(kind), "_") { // skip internal buckets like the audit trail
+					kinds = append(kinds, string(kind))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, kind := range kinds {
+			b := tx.Bucket([]byte(kind))
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(key, v []byte) error {
+				if v == nil { // only the nested buckets are commentables
+					cms = append(cms, &commentable{db: db, kind: kind, key: string(key)})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return cms, err
+}
+
+// removeExpired removes the comments on the commentable that expired by now
+func (cm *commentable) removeExpired(now time.Time) (int, error) {
+	return cm.removeFrom(commentsKey, func(c *comment) bool { return c.expired(now) })
+}
+
+// purgeTrash removes the comments in the trash of the commentable that were deleted before the given time
+func (cm *commentable) purgeTrash(before time.Time) (int, error) {
+	return cm.removeFrom(trashKey, func(c *comment) bool { return c.DeletedAt != nil && c.DeletedAt.Before(before) })
+}
+
+// removeFrom removes the comments in the given subbucket of the commentable for which match returns true.
+// Most commentables have nothing to remove on a sweep, so they are scanned in a read first and only written
+// to if a comment matches, rather than locking the db for a write per commentable on every tick.
+func (cm *commentable) removeFrom(sub []byte, match func(*comment) bool) (int, error) {
+	var found bool
+	err := cm.db.View(func(tx *bolt.Tx) error {
+		b := cm.subBucket(tx, sub)
+		if b == nil {
+			return nil
+		}
+
+		cur := b.Cursor()
+		for id, data := cur.First(); id != nil && !found; id, data = cur.Next() {
+			var c comment
+			if err := json.Unmarshal(data, &c); err != nil {
+				return err
+			}
+			found = match(&c)
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return 0, err
+	}
+
+	var removed int
+	err = cm.db.Update(func(tx *bolt.Tx) error {
+		removed = 0
+
+		b := cm.subBucket(tx, sub)
+		if b == nil {
+			return nil
+		}
+
+		var err error
+		removed, err = removeWhere(b, match)
+		return err
+	})
+
+	return removed, err
+}
+
+// subBucket returns the given subbucket of the commentable, nil if it or the commentable does not exist
+func (cm *commentable) subBucket(tx *bolt.Tx, sub []byte) *bolt.Bucket {
+	cmBucket := tx.Bucket([]byte(cm.kind))
+	if cmBucket == nil {
+		return nil
+	}
+
+	rBucket := cmBucket.Bucket([]byte(cm.key))
+	if rBucket == nil {
+		return nil
+	}
+
+	return rBucket.Bucket(sub)
+}
+
+// removeWhere removes the comments in the bucket for which match returns true
+func removeWhere(b *bolt.Bucket, match func(*comment) bool) (int, error) {
+	// the bucket can't be modified while iterating over it so the matching ids are collected first
+	var ids [][]byte
+	err := b.ForEach(func(id, data []byte) error {
+		var c comment
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+
+		if match(&c) {
+			ids = append(ids, append([]byte(nil), id...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, id := range ids {
+		if err = b.Delete(id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
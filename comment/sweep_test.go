@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_sweepExpired(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books", "notes"}))
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	books := &commentable{db: db, kind: "books", key: "1"}
+	notes := &commentable{db: db, kind: "notes", key: "1"}
+	for _, cm := range []*commentable{books, notes} {
+		assert.NoError(t, cm.ensure())
+		for _, expiresAt := range []*time.Time{nil, &past, &future} {
+			_, err := cm.add(&comment{Value: "hello", ExpiresAt: expiresAt})
+			assert.NoError(t, err)
+		}
+	}
+
+	removed, err := sweepExpired(db, []string{"notes", "unknown"}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	n, err := notes.count()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n, "the comments that did not expire should be kept")
+
+	n, err = books.count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n, "the comments of types that are not swept should be kept")
+}
+
+func Test_sweepExpired_readOnly(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	now := time.Now()
+	future := now.Add(time.Minute)
+	for _, key := range []string{"1", "2", "3"} {
+		cm := &commentable{db: db, kind: "books", key: key}
+		assert.NoError(t, cm.ensure())
+		_, err := cm.add(&comment{Value: "hello", ExpiresAt: &future})
+		assert.NoError(t, err)
+	}
+
+	writes := db.Stats().TxStats.Write
+	removed, err := sweepExpired(db, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, writes, db.Stats().TxStats.Write, "nothing should be written if no comment expired")
+
+	removed, err = purgeTrash(db, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, writes, db.Stats().TxStats.Write, "nothing should be written if no comment was trashed")
+}
+
+func Test_purgeTrash(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	cm := &commentable{db: db, kind: "books", key: "1"}
+	assert.NoError(t, cm.ensure())
+
+	var ids []string
+	for _, v := range []string{"first", "second"} {
+		c, err := cm.add(&comment{Value: v})
+		assert.NoError(t, err)
+		assert.NoError(t, cm.remove(c.ID, caller{}))
+		ids = append(ids, c.ID)
+	}
+
+	removed, err := purgeTrash(db, nil, time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed, "recently deleted comments should be kept")
+
+	removed, err = purgeTrash(db, nil, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	for _, id := range ids {
+		_, err = cm.restore(id, caller{admin: true})
+		assert.Equal(t, errNotInTrash, err, "purged comments can't be restored")
+	}
+}
+
+func Test_service_sweep(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"notes"}))
+	cm := &commentable{db: db, kind: "notes", key: "1"}
+	assert.NoError(t, cm.ensure())
+	past := time.Now().Add(-time.Minute)
+	_, err := cm.add(&comment{Value: "hello", ExpiresAt: &past})
+	assert.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.SweepInterval = time.Millisecond
+	svc := newService(db, zap.NewNop(), cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.sweep(ctx, []string{"notes"})
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		n, err := cm.count()
+		assert.NoError(t, err)
+		if n == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the expired comment should be swept")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the sweep should stop once cancelled")
+	}
+}
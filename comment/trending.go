@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+const (
+	trendingDefaultWindow = 24 * time.Hour
+	trendingMaxResources  = 10
+)
+
+type trendingResource struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// handleTrending responds with the resources of the type that received the most comments
+// within the window query parameter, up to trendingMaxResources of them
+func (svc *service) handleTrending(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, commentableTypeParam)
+
+	window := trendingDefaultWindow
+	if s := r.URL.Query().Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			svc.fail(w, svc.logger, errTrendingWindowInvalid.withArgs(s), err)
+			return
+		}
+
+		window = d
+	}
+
+	resources, err := svc.trending(kind, time.Now().Add(-window), callerOf(r).canSee)
+	if err != nil {
+		svc.fail(w, svc.logger, errTrendingList, err,
+			zap.String(commentableTypeParam, kind),
+			zap.Duration("window", window),
+		)
+		return
+	}
+
+	if len(resources) > trendingMaxResources {
+		resources = resources[:trendingMaxResources]
+	}
+
+	svc.respondWithPayload(w, struct {
+		Resources []trendingResource `json:"resources"`
+	}{resources}, http.StatusOK)
+}
+
+// trending ranks the resources of the type by how many of their comments that keep returns true for
+// were added after since, most first and by key on ties. Resources without such comments are left out.
+// Every resource of the type is read, so it is meant for types with a moderate number of resources.
+func (svc *service) trending(kind string, since time.Time, keep func(*comment) bool) ([]trendingResource, error) {
+	cms, err := commentablesOf(svc.dbOf(kind), []string{kind})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []trendingResource{}
+	for _, cm := range cms {
+		cmts, err := svc.listAllComments(cm)
+		if err != nil {
+			return nil, err
+		}
+
+		n := len(filter(filter(cmts, keep), addedSince(since)))
+		if n > 0 {
+			resources = append(resources, trendingResource{Key: cm.key, Count: n})
+		}
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Count != resources[j].Count {
+			return resources[i].Count > resources[j].Count
+		}
+
+		return resources[i].Key < resources[j].Key
+	})
+
+	return resources, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleTrending(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	now := time.Now()
+	hoursAgo := func(h int) *time.Time {
+		t := now.Add(-time.Duration(h) * time.Hour)
+		return &t
+	}
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts", "books"}))
+
+	cmts := map[string][]*comment{
+		"quiet":   {{Value: "old", CreatedAt: hoursAgo(48)}},
+		"popular": {{Value: "a", CreatedAt: hoursAgo(1)}, {Value: "b", CreatedAt: hoursAgo(2)}, {Value: "c", CreatedAt: hoursAgo(30)}},
+		"rising":  {{Value: "a", CreatedAt: hoursAgo(1)}, {Value: "b", CreatedAt: hoursAgo(3)}},
+		"hidden":  {{Value: "a", CreatedAt: hoursAgo(1), Author: "jane", Visibility: visibilityPrivate}},
+		"another": {{Value: "a", CreatedAt: hoursAgo(5)}},
+	}
+	for k, cs := range cmts {
+		cm := &commentable{db: db, kind: "posts", key: k}
+		assert.NoError(t, cm.ensure())
+		for _, c := range cs {
+			_, err := cm.add(c)
+			assert.NoError(t, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		userID   string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it ranks the resources by their comments of the last day",
+			path:     "/v1/posts/comments/trending",
+			wantCode: http.StatusOK,
+			want:     `{"resources":[{"key":"popular","count":2},{"key":"rising","count":2},{"key":"another","count":1}]}`,
+		},
+		{
+			name:     "it ranks the resources by their comments within the window",
+			path:     "/v1/posts/comments/trending?window=2h30m",
+			wantCode: http.StatusOK,
+			want:     `{"resources":[{"key":"popular","count":2},{"key":"rising","count":1}]}`,
+		},
+		{
+			name:     "it counts the private comments the caller can see",
+			path:     "/v1/posts/comments/trending?window=90m",
+			userID:   "jane",
+			wantCode: http.StatusOK,
+			want:     `{"resources":[{"key":"hidden","count":1},{"key":"popular","count":1},{"key":"rising","count":1}]}`,
+		},
+		{
+			name:     "it responds with no resources if none were commented on",
+			path:     "/v1/books/comments/trending",
+			wantCode: http.StatusOK,
+			want:     `{"resources":[]}`,
+		},
+		{
+			name:     "it responds with error if the window is invalid",
+			path:     "/v1/posts/comments/trending?window=yesterday",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errTrendingWindowInvalid.withArgs("yesterday")),
+		},
+		{
+			name:     "it responds with error if the window is not positive",
+			path:     "/v1/posts/comments/trending?window=-1h",
+			wantCode: http.StatusBadRequest,
+			want:     buildErrResp(errTrendingWindowInvalid.withArgs("-1h")),
+		},
+		{
+			name:     "it responds with error if the commentable type does not exist",
+			path:     "/v1/unknown/comments/trending",
+			wantCode: http.StatusNotAcceptable,
+			want:     buildErrResp(errCommentableTypeNotFound.withArgs("unknown")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set(userIDHeader, tt.userID)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func Test_service_handleTrending_capped(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	assert.NoError(t, svc.setup([]string{"posts"}))
+
+	now := time.Now()
+	for i := 0; i < trendingMaxResources+5; i++ {
+		cm := &commentable{db: db, kind: "posts", key: string(rune('a' + i))}
+		assert.NoError(t, cm.ensure())
+		_, err := cm.add(&comment{Value: "hi", CreatedAt: &now})
+		assert.NoError(t, err)
+	}
+
+	resources, err := svc.trending("posts", now.Add(-time.Hour), func(*comment) bool { return true })
+	assert.NoError(t, err)
+	assert.Len(t, resources, trendingMaxResources+5)
+
+	mux := chi.NewRouter()
+	svc.registerRoutes(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/posts/comments/trending", nil))
+
+	var body struct {
+		Resources []trendingResource `json:"resources"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Len(t, body.Resources, trendingMaxResources)
+	assert.Equal(t, "a", body.Resources[0].Key)
+}
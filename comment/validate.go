@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var errInvalidUTF8 = errors.New("comment is not valid UTF-8")
+
+// violation is the field of a comment that breaks a rule of the service
+func violation(field string, e apiError) fieldError {
+	return fieldError{Field: field, Code: e.Code, Message: e.Message}
+}
+
+// validationError lists every rule a comment breaks, so that clients can fix them all in one round trip
+type validationError []fieldError
+
+func (e validationError) Error() string {
+	reasons := make([]string, len(e))
+	for i, v := range e {
+		reasons[i] = v.Field + ": " + v.Message
+	}
+
+	return "comment breaks the rules of the service, " + strings.Join(reasons, "; ")
+}
+
+// validate checks a comment sent to be added or updated against the configured rules,
+// returning every rule it breaks, nil if it breaks none
+func (svc *service) validate(co *comment) validationError {
+	var v validationError
+	if co.Value == "" {
+		v = append(v, violation("value", errCommentEmpty))
+	} else {
+		if p := svc.config().CommentPattern.Regexp; p != nil && !p.MatchString(co.Value) {
+			v = append(v, violation("value", errCommentPatternMismatch))
+		}
+
+		if max := svc.config().MaxCommentWords; max > 0 && countWords(co.Value) > max {
+			v = append(v, violation("value", errCommentTooManyWords.withArgs(max)))
+		}
+	}
+
+	if co.Category != "" && !svc.allowedCategory(co.Category) {
+		v = append(v, violation("category", errCommentCategoryInvalid.withArgs(co.Category)))
+	}
+
+	if co.ExpiresAt != nil && co.expired(time.Now()) {
+		v = append(v, violation("expires_at", errCommentExpiryInvalid))
+	}
+
+	switch co.Visibility {
+	case "", visibilityPublic, visibilityPrivate:
+	default:
+		v = append(v, violation("visibility", errCommentVisibilityInvalid.withArgs(co.Visibility)))
+	}
+
+	v = append(v, svc.checkAttachments(co.Attachments)...)
+
+	return v
+}
+
+// allowedCategory reports whether the category is one of the configured categories.
+// Every category is allowed if none are configured.
+func (svc *service) allowedCategory(category string) bool {
+	categories := svc.config().Categories
+	if len(categories) == 0 {
+		return true
+	}
+
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
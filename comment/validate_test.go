@@ -0,0 +1,136 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_validate(t *testing.T) {
+	t.Parallel()
+
+	categoryErr := violation("category", errCommentCategoryInvalid.withArgs("unknown"))
+	visibilityErr := violation("visibility", errCommentVisibilityInvalid.withArgs("secret"))
+	patternErr := violation("value", errCommentPatternMismatch)
+	expiryErr := violation("expires_at", errCommentExpiryInvalid)
+	wordsErr := violation("value", errCommentTooManyWords.withArgs(3))
+	emptyErr := violation("value", errCommentEmpty)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	tests := []struct {
+		name       string
+		categories []string
+		pattern    string
+		maxWords   int
+		co         *comment
+		want       validationError
+	}{
+		{
+			name:       "it passes a comment without a category",
+			categories: []string{"question"},
+			co:         &comment{Value: "hello"},
+		},
+		{
+			name:       "it passes a comment with an allowed category",
+			categories: []string{"question", "review"},
+			co:         &comment{Value: "hello", Category: "review"},
+		},
+		{
+			name:       "it fails a comment with a category that is not allowed",
+			categories: []string{"question", "review"},
+			co:         &comment{Value: "hello", Category: "unknown"},
+			want:       validationError{categoryErr},
+		},
+		{
+			name: "it passes a comment with any category if no categories are configured",
+			co:   &comment{Value: "hello", Category: "unknown"},
+		},
+		{
+			name: "it passes a public comment",
+			co:   &comment{Value: "hello", Visibility: visibilityPublic},
+		},
+		{
+			name: "it passes a private comment",
+			co:   &comment{Value: "hello", Visibility: visibilityPrivate},
+		},
+		{
+			name: "it fails a comment with an unknown visibility",
+			co:   &comment{Value: "hello", Visibility: "secret"},
+			want: validationError{visibilityErr},
+		},
+		{
+			name: "it passes a comment expiring in the future",
+			co:   &comment{Value: "hello", ExpiresAt: &future},
+		},
+		{
+			name: "it fails a comment that has already expired",
+			co:   &comment{Value: "hello", ExpiresAt: &past},
+			want: validationError{expiryErr},
+		},
+		{
+			name:    "it passes a comment matching the pattern",
+			pattern: `^[^/]*$`,
+			co:      &comment{Value: "hello"},
+		},
+		{
+			name:    "it fails a comment not matching the pattern",
+			pattern: `^[^/]*$`,
+			co:      &comment{Value: "see http://example.com"},
+			want:    validationError{patternErr},
+		},
+		{
+			name:     "it passes a comment with as many words as allowed",
+			maxWords: 3,
+			co:       &comment{Value: "  one\ttwo\n three  "},
+		},
+		{
+			name:     "it fails a comment with more words than allowed",
+			maxWords: 3,
+			co:       &comment{Value: "one two\u00a0three four"},
+			want:     validationError{wordsErr},
+		},
+		{
+			name: "it passes a comment with any number of words if no max is configured",
+			co:   &comment{Value: "one two three four"},
+		},
+		{
+			name: "it fails an empty comment",
+			co:   &comment{},
+			want: validationError{emptyErr},
+		},
+		{
+			name:       "it fails a comment with every rule it breaks",
+			categories: []string{"question"},
+			pattern:    `^[^/]*$`,
+			maxWords:   3,
+			co:         &comment{Value: "see http://example.com right now", Category: "unknown", Visibility: "secret"},
+			want:       validationError{patternErr, wordsErr, categoryErr, visibilityErr},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config{Categories: tt.categories, MaxCommentWords: tt.maxWords}
+			if tt.pattern != "" {
+				cfg.CommentPattern.Regexp = regexp.MustCompile(tt.pattern)
+			}
+
+			svc := &service{cfg: cfg}
+			assert.Equal(t, tt.want, svc.validate(tt.co))
+		})
+	}
+}
+
+func Test_pattern_Decode(t *testing.T) {
+	t.Parallel()
+
+	var p pattern
+	assert.NoError(t, p.Decode(""))
+	assert.Nil(t, p.Regexp)
+
+	assert.NoError(t, p.Decode(`^\w+$`))
+	assert.True(t, p.MatchString("hello"))
+
+	assert.Error(t, (&pattern{}).Decode(`(`))
+}
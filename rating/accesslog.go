@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// responseRecorder records the status and size of a response as it is written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.status == 0 {
+		rr.status = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// accessLog logs every completed request at the configured level. The log is skipped without
+// recording the response if the level is disabled, e.g. debug with the production logger.
+func (svc *service) accessLog(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		level := svc.config().AccessLogLevel
+		if !svc.logger.Core().Enabled(level) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rr := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rr, r)
+
+		if rr.status == 0 {
+			rr.status = http.StatusOK
+		}
+
+		if ce := svc.logger.Check(level, "request completed"); ce != nil {
+			ce.Write(
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("client_ip", clientIP(r, svc.cfg.TrustProxy)),
+				zap.Int("status", rr.status),
+				zap.Int("bytes", rr.bytes),
+				zap.Duration("duration", time.Since(start)),
+			)
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
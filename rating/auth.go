@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const forbiddenErr = "only admins are allowed to do this"
+
+// adminOnly rejects requests that do not carry the configured admin token as a bearer token.
+// Every request is rejected if no admin token is configured.
+func (svc *service) adminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if svc.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(svc.cfg.AdminToken)) != 1 {
+			svc.respondWithMsg(w, forbiddenErr, http.StatusForbidden)
+			svc.logger.Warn(forbiddenErr, zap.String("path", r.URL.Path))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_adminOnly(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		adminToken string
+		authHeader string
+		pass       bool
+	}{
+		{
+			name:       "it rejects requests without a token",
+			adminToken: "secret",
+		},
+		{
+			name:       "it rejects requests with the wrong token",
+			adminToken: "secret",
+			authHeader: "Bearer not-the-secret",
+		},
+		{
+			name:       "it rejects every request if no token is configured",
+			authHeader: "Bearer ",
+		},
+		{
+			name:       "it passes on requests of admins",
+			adminToken: "secret",
+			authHeader: "Bearer secret",
+			pass:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{AdminToken: tt.adminToken}}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Authorization", tt.authHeader)
+			w := httptest.NewRecorder()
+
+			svc.adminOnly(http.HandlerFunc(fn)).ServeHTTP(w, r)
+			assert.Equal(t, tt.pass, passed)
+			if !tt.pass {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.Equal(t, buildResp(forbiddenErr), w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ratingCache is an LRU cache of the ratings of rateables, keyed by their kind and key.
+// A nil *ratingCache is a disabled cache which never hits.
+type ratingCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	recency *list.List // most recently used at the front
+
+	// gen is bumped on every invalidation so that a rating read from the db before
+	// a write is not cached after the write invalidated it
+	gen uint64
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key string
+	rt  rating
+}
+
+// newRatingCache returns a cache holding up to size ratings, or nil if size is not positive
+func newRatingCache(size int) *ratingCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &ratingCache{size: size, entries: map[string]*list.Element{}, recency: list.New()}
+}
+
+func cacheKey(kind, key string) string {
+	return kind + "/" + key
+}
+
+// lookup returns the cached rating of the rateable. On a miss it returns the generation
+// to store the rating read from the db with.
+func (c *ratingCache) lookup(kind, key string) (rt *rating, gen uint64, ok bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[cacheKey(kind, key)]
+	if !ok {
+		c.misses++
+		return nil, c.gen, false
+	}
+
+	c.hits++
+	c.recency.MoveToFront(el)
+	cached := el.Value.(*cacheEntry).rt
+	return &cached, c.gen, true
+}
+
+// store caches the rating of the rateable unless the cache was invalidated since gen
+func (c *ratingCache) store(kind, key string, rt rating, gen uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	k := cacheKey(kind, key)
+	if el, ok := c.entries[k]; ok {
+		el.Value.(*cacheEntry).rt = rt
+		c.recency.MoveToFront(el)
+		return
+	}
+
+	c.entries[k] = c.recency.PushFront(&cacheEntry{key: k, rt: rt})
+	if c.recency.Len() > c.size {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate drops the cached rating of the rateable, to be called whenever it is written
+func (c *ratingCache) invalidate(kind, key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	k := cacheKey(kind, key)
+	if el, ok := c.entries[k]; ok {
+		c.recency.Remove(el)
+		delete(c.entries, k)
+	}
+}
+
+// clear drops all cached ratings, to be called when ratings are written in bulk
+func (c *ratingCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = map[string]*list.Element{}
+	c.recency.Init()
+}
+
+type cacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Size    int    `json:"size"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+func (c *ratingCache) stats() cacheStats {
+	if c == nil {
+		return cacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return cacheStats{Enabled: true, Size: c.recency.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// getRating reads the rating of the rateable through the cache
+func (svc *service) getRating(rte *rateable) (*rating, error) {
+	rt, gen, ok := svc.cache.lookup(rte.kind, rte.key)
+	if ok {
+		return rt, nil
+	}
+
+	rt, err := rte.get()
+	if err != nil {
+		return nil, err
+	}
+
+	svc.cache.store(rte.kind, rte.key, *rt, gen)
+	return rt, nil
+}
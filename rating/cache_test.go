@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_newRatingCache(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, newRatingCache(0))
+	assert.Nil(t, newRatingCache(-1))
+	assert.NotNil(t, newRatingCache(1))
+}
+
+func Test_ratingCache(t *testing.T) {
+	t.Parallel()
+
+	c := newRatingCache(2)
+	_, gen, ok := c.lookup("posts", "1")
+	assert.False(t, ok)
+
+	c.store("posts", "1", rating{FiveStars: 1}, gen)
+	rt, _, ok := c.lookup("posts", "1")
+	assert.True(t, ok)
+	assert.Equal(t, &rating{FiveStars: 1}, rt)
+
+	// posts/1 was used last so posts/2 is evicted for posts/3
+	_, gen, _ = c.lookup("posts", "2")
+	c.store("posts", "2", rating{FiveStars: 2}, gen)
+	c.lookup("posts", "1")
+	_, gen, _ = c.lookup("posts", "3")
+	c.store("posts", "3", rating{FiveStars: 3}, gen)
+
+	_, _, ok = c.lookup("posts", "2")
+	assert.False(t, ok)
+	_, _, ok = c.lookup("posts", "1")
+	assert.True(t, ok)
+
+	c.invalidate("posts", "1")
+	_, _, ok = c.lookup("posts", "1")
+	assert.False(t, ok)
+
+	assert.Equal(t, cacheStats{Enabled: true, Size: 1, Hits: 3, Misses: 5}, c.stats())
+}
+
+func Test_ratingCache_staleStore(t *testing.T) {
+	t.Parallel()
+
+	c := newRatingCache(1)
+	_, gen, _ := c.lookup("posts", "1")
+	c.invalidate("posts", "1")
+	c.store("posts", "1", rating{FiveStars: 1}, gen)
+
+	_, _, ok := c.lookup("posts", "1")
+	assert.False(t, ok, "a rating read before an invalidation should not be cached")
+}
+
+func Test_ratingCache_clear(t *testing.T) {
+	t.Parallel()
+
+	c := newRatingCache(2)
+	_, gen, _ := c.lookup("posts", "1")
+	c.store("posts", "1", rating{FiveStars: 1}, gen)
+	c.store("posts", "2", rating{FiveStars: 2}, gen)
+
+	_, stale, _ := c.lookup("posts", "3")
+	c.clear()
+	c.store("posts", "3", rating{FiveStars: 3}, stale)
+
+	for _, k := range []string{"1", "2", "3"} {
+		_, _, ok := c.lookup("posts", k)
+		assert.False(t, ok, "posts/%s should not be cached after clearing", k)
+	}
+	assert.Equal(t, 0, c.stats().Size)
+}
+
+func Test_ratingCache_disabled(t *testing.T) {
+	t.Parallel()
+
+	var c *ratingCache
+	c.store("posts", "1", rating{FiveStars: 1}, 0)
+	c.invalidate("posts", "1")
+	c.clear()
+
+	_, _, ok := c.lookup("posts", "1")
+	assert.False(t, ok)
+	assert.Equal(t, cacheStats{}, c.stats())
+}
+
+func Test_service_handleGet_cached(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	key := "my-key"
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(kind))
+		return err
+	})
+	assert.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.CacheSize = 10
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	path := fmt.Sprintf("/v1/%s/%s/ratings", kind, key)
+	serve := func(method, payload string) string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(payload)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	serve(http.MethodPut, `{"five_stars": 1}`)
+	assert.Equal(t, serve(http.MethodGet, ""), serve(http.MethodGet, ""))
+	assert.Equal(t, cacheStats{Enabled: true, Size: 1, Hits: 1, Misses: 1}, svc.cache.stats())
+
+	// the rating is read from the db again after it changed
+	want := serve(http.MethodPut, `{"five_stars": 1}`)
+	assert.Equal(t, strings.TrimSuffix(want, "}")+`,"median":5,"percentages":`+
+		`{"five_stars":100,"four_stars":0,"three_stars":0,"two_stars":0,"one_stars":0}}`, serve(http.MethodGet, ""))
+	assert.Equal(t, cacheStats{Enabled: true, Size: 1, Hits: 1, Misses: 2}, svc.cache.stats())
+}
+
+func Test_service_handleMetrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cacheSize int
+		want      string
+	}{
+		{
+			name: "it reports the cache as disabled",
+			want: `{"cache":{"enabled":false,"size":0,"hits":0,"misses":0}}`,
+		},
+		{
+			name:      "it reports the cache counters",
+			cacheSize: 10,
+			want:      `{"cache":{"enabled":true,"size":0,"hits":0,"misses":0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CacheSize = tt.cacheSize
+
+			mux := chi.NewRouter()
+			svc := newService(nil, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
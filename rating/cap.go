@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	ratingVoteCapFmt          = "%s with key %s has the most votes allowed, %d"
+	ratingNormalizeErr        = "rating could not be normalized"
+	ratingNormalizeInvalidErr = "normalization must name a rateable type, key and a positive total"
+)
+
+// voteCapError is returned when a save would add votes to a rateable beyond the most it may have
+type voteCapError struct {
+	kind, key string
+	max       int64
+}
+
+func (e voteCapError) Error() string {
+	return fmt.Sprintf(ratingVoteCapFmt, e.kind, e.key, e.max)
+}
+
+// normalized returns the rating rescaled to total votes, keeping the share of each star level as close
+// as whole votes allow. The votes lost to rounding down the shares go to the levels with the largest
+// remainders, higher ones first on ties, so that they add up to total. A rating without votes is returned as is.
+func (r rating) normalized(total int64) rating {
+	votes := r.total()
+	if votes <= 0 {
+		return r
+	}
+
+	n := r
+	levels := []*int64{&n.FiveStars, &n.FourStars, &n.ThreeStars, &n.TwoStars, &n.OneStars}
+	remainders := make([]*big.Int, len(levels))
+	left := total
+	for i, l := range levels {
+		// computed exactly as the product could overflow int64
+		share := new(big.Int).Mul(big.NewInt(*l), big.NewInt(total))
+		q, m := share.QuoRem(share, big.NewInt(votes), new(big.Int))
+		*l, remainders[i] = q.Int64(), m
+		left -= *l
+	}
+
+	order := []int{0, 1, 2, 3, 4}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]].Cmp(remainders[order[j]]) > 0 })
+	for _, i := range order {
+		if left <= 0 {
+			break
+		}
+
+		*levels[i]++
+		left--
+	}
+
+	return n
+}
+
+// normalize rescales the stored rating of the rateable to total votes in a single update, see normalized
+func (r *rateable) normalize(total int64) (*rating, error) {
+	var normalized rating
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		rtBucket := tx.Bucket([]byte(r.kind))
+		if rtBucket == nil {
+			return fmt.Errorf(rateableTypeNotFoundFmt, r.kind)
+		}
+
+		rBucket := rtBucket.Bucket([]byte(r.key))
+		if rBucket == nil {
+			return rateableNotFoundError{r.kind, r.key}
+		}
+
+		var current rating
+		if data := rBucket.Get(ratingsKey); data != nil {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return err
+			}
+		}
+
+		normalized = current.normalized(total)
+		data, err := json.Marshal(normalized)
+		if err != nil {
+			return err
+		}
+
+		return rBucket.Put(ratingsKey, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &normalized, nil
+}
+
+// handleNormalize rescales the rating of a resource to the given total of votes while keeping the share
+// of each star level, e.g. to cut down a resource flooded with votes before MAXVOTESPERRESOURCE was set
+func (svc *service) handleNormalize(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Type  string `json:"type"`
+		Key   string `json:"key"`
+		Total int64  `json:"total"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Type == "" || req.Total <= 0 {
+		svc.respondWithMsg(w, ratingNormalizeInvalidErr, http.StatusBadRequest)
+		svc.logger.Error(ratingNormalizeInvalidErr, zap.Error(err))
+		return
+	}
+
+	found, err := verify(svc.db, req.Type)
+	if err != nil {
+		svc.respondWithMsg(w, dbUnavailableErr, http.StatusServiceUnavailable)
+		svc.logger.Error("could not verify rateable type", zap.Error(err), zap.String(rateableTypeParam, req.Type))
+		return
+	}
+
+	if !found {
+		svc.respondWithMsg(w, fmt.Sprintf(rateableTypeNotFoundFmt, req.Type), http.StatusNotAcceptable)
+		svc.logger.Warn("could not verify rateable type", zap.String(rateableTypeParam, req.Type))
+		return
+	}
+
+	if err := checkKey(req.Key, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+		svc.respondWithMsg(w, fmt.Sprintf(rateableKeyInvalidFmt, err), http.StatusBadRequest)
+		svc.logger.Warn("invalid rateable key", zap.Error(err), zap.String(rateableKeyParam, req.Key))
+		return
+	}
+
+	rte := &rateable{db: svc.db, kind: req.Type, key: req.Key}
+	rt, err := rte.normalize(req.Total)
+	svc.cache.invalidate(rte.kind, rte.key)
+	if _, notFound := err.(rateableNotFoundError); notFound {
+		svc.respondWithMsg(w, err.Error(), http.StatusNotFound)
+		svc.logger.Warn("rejected normalizing unknown rateable", zap.String(rateableKeyParam, rte.key),
+			zap.String(rateableTypeParam, rte.kind))
+		return
+	}
+
+	if err != nil {
+		svc.respondWithStoreErr(w, err, ratingNormalizeErr, http.StatusInternalServerError)
+		svc.logger.Error(ratingNormalizeErr, zap.Error(err), zap.String(rateableKeyParam, rte.key),
+			zap.String(rateableTypeParam, rte.kind))
+		return
+	}
+
+	svc.logger.Info("normalized rating", zap.String(rateableKeyParam, rte.key),
+		zap.String(rateableTypeParam, rte.kind), zap.Int64("total", req.Total))
+	svc.respondWithPayload(w, svc.ratingDTO(rt), http.StatusOK)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_rating_normalized(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		rt    rating
+		total int64
+		want  rating
+	}{
+		{
+			name:  "it scales the votes down",
+			rt:    rating{FiveStars: 600, FourStars: 300, OneStars: 100},
+			total: 10,
+			want:  rating{FiveStars: 6, FourStars: 3, OneStars: 1},
+		},
+		{
+			name:  "it scales the votes up",
+			rt:    rating{FiveStars: 2, TwoStars: 1},
+			total: 30,
+			want:  rating{FiveStars: 20, TwoStars: 10},
+		},
+		{
+			name:  "it gives the votes lost to rounding to the largest remainders",
+			rt:    rating{FiveStars: 10, FourStars: 5, OneStars: 1},
+			total: 8,
+			want:  rating{FiveStars: 5, FourStars: 3},
+		},
+		{
+			name:  "it gives the votes lost to rounding to the higher levels on ties",
+			rt:    rating{FiveStars: 1, FourStars: 1, ThreeStars: 1},
+			total: 10,
+			want:  rating{FiveStars: 4, FourStars: 3, ThreeStars: 3},
+		},
+		{
+			name:  "it does not overflow",
+			rt:    rating{FiveStars: 1 << 40, OneStars: 1 << 40},
+			total: 1 << 40,
+			want:  rating{FiveStars: 1 << 39, OneStars: 1 << 39},
+		},
+		{
+			name:  "it keeps a rating without votes",
+			total: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rt.normalized(tt.total)
+			assert.Equal(t, tt.want, got)
+			if tt.rt.total() > 0 {
+				assert.Equal(t, tt.total, got.total())
+			}
+		})
+	}
+}
+
+func Test_rateable_save_maxVotes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"books"}))
+
+	rte := &rateable{db: db, kind: "books", key: "1", maxVotes: 10}
+	_, err := rte.save(rating{FiveStars: 10})
+	assert.NoError(t, err, "the votes should be allowed up to the cap")
+
+	_, err = rte.save(rating{OneStars: 1})
+	assert.Equal(t, voteCapError{"books", "1", 10}, err)
+
+	got, err := rte.get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FiveStars: 10, Submissions: 1}, got, "the rejected votes should not be saved")
+
+	rte.maxVotes = 5
+	got, err = rte.save(rating{FiveStars: -2, OneStars: 1})
+	assert.NoError(t, err, "removing votes should be allowed beyond the cap")
+	assert.Equal(t, &rating{FiveStars: 8, OneStars: 1, Submissions: 2}, got)
+}
+
+func Test_service_handlePut_maxVotes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"books"}))
+
+	cfg := testConfig()
+	cfg.MaxVotesPerResource = 3
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	for _, want := range []int{http.StatusOK, http.StatusConflict} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/v1/books/1/ratings", strings.NewReader(`{"five_stars":2}`))
+		mux.ServeHTTP(w, r)
+		assert.Equal(t, want, w.Code)
+		if want == http.StatusConflict {
+			assert.Equal(t, buildResp(fmt.Sprintf(ratingVoteCapFmt, "books", "1", 3)), w.Body.String())
+		}
+	}
+}
+
+func Test_service_handleNormalize(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	_, err := (&rateable{db: db, kind: "books", key: "1"}).save(rating{FiveStars: 600, FourStars: 300, OneStars: 100})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		payload  string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it rejects requests of non admins",
+			payload:  `{"type":"books","key":"1","total":10}`,
+			wantCode: http.StatusForbidden,
+			want:     buildResp(forbiddenErr),
+		},
+		{
+			name:     "it responds with error if the total is not positive",
+			token:    "secret",
+			payload:  `{"type":"books","key":"1","total":0}`,
+			wantCode: http.StatusBadRequest,
+			want:     buildResp(ratingNormalizeInvalidErr),
+		},
+		{
+			name:     "it responds with error if the type does not exist",
+			token:    "secret",
+			payload:  `{"type":"unknown","key":"1","total":10}`,
+			wantCode: http.StatusNotAcceptable,
+			want:     buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknown")),
+		},
+		{
+			name:     "it responds with error if the key is invalid",
+			token:    "secret",
+			payload:  `{"type":"books","total":10}`,
+			wantCode: http.StatusBadRequest,
+			want:     buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key is empty")),
+		},
+		{
+			name:     "it responds with error if the resource does not exist",
+			token:    "secret",
+			payload:  `{"type":"books","key":"2","total":10}`,
+			wantCode: http.StatusNotFound,
+			want:     buildResp(fmt.Sprintf(rateableNotFoundFmt, "books", "2")),
+		},
+		{
+			name:     "it rescales the rating and responds with it",
+			token:    "secret",
+			payload:  `{"type":"books","key":"1","total":10}`,
+			wantCode: http.StatusOK,
+			want:     `{"five_stars":6,"four_stars":3,"three_stars":0,"two_stars":0,"one_stars":1,"submissions":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/admin/ratings/normalize", bytes.NewBufferString(tt.payload))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+
+	got, err := (&rateable{db: db, kind: "books", key: "1"}).get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FiveStars: 6, FourStars: 3, OneStars: 1, Submissions: 1}, got)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the ip of the client making the request. Behind a proxy the remote address
+// is the proxy's, so if trustProxy is set the ip is taken from the X-Forwarded-For header,
+// falling back to X-Real-IP. Only the last address of the last X-Forwarded-For line is taken, the
+// one appended by the proxy in front of the service, as the client can make up any of the ones
+// before it, including whole lines of their own. The remote address is returned if neither header
+// holds a valid ip.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if lines := r.Header["X-Forwarded-For"]; len(lines) > 0 {
+			hops := strings.Split(lines[len(lines)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -1,6 +1,88 @@
 package main
 
+import (
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
 type config struct {
-	Port int    `default:"50050"`
-	DSN  string `default:"db/ratings.db"`
+	Port      int    `default:"50050"`
+	DSN       string `default:"db/ratings.db"`
+	APIPrefix string `default:"/v1"` // set empty to serve the api from the root
+	ReadOnly  bool   // reject all mutating requests, e.g. during maintenance
+
+	// how long to wait at startup for the lock on the db file, which another process may still hold,
+	// e.g. the previous instance during a rolling restart. It is waited for as long as it takes if 0.
+	DBOpenTimeout time.Duration `default:"1s"`
+
+	// how long /readyz reports the shutdown before the server stops listening,
+	// so that probes get to steer traffic away first
+	ShutdownDelay time.Duration `default:"5s"`
+
+	// take the client ip from the X-Forwarded-For or X-Real-IP headers set by the proxy in front of the service.
+	// Only set it behind a proxy that sets them, clients could claim any ip otherwise.
+	TrustProxy bool
+
+	// what to do at startup about the types in the db that are no longer configured, off, warn or remove.
+	// remove deletes them along with all their ratings, so only set it once the warning was checked.
+	ReconcileTypes reconcileMode `default:"warn"`
+
+	// serve the runtime profiles under /debug/pprof, only to admins if an admin token is set
+	Pprof bool
+
+	// file of KEY=value lines overriding the env vars. It is read again on SIGHUP to apply the settings
+	// that don't require a restart: LOGLEVEL, ACCESSLOGLEVEL, MAXKEYLENGTH, RESERVEDKEYS, MAXSTARSPERPUT
+	// and MAXVOTESPERRESOURCE. Lines removed from the file revert their setting.
+	// SIGHUP is ignored if no file is set, as the env vars of the process can't change while it runs.
+	ConfigFile string
+
+	// longest resource key in bytes, longer ones are rejected with a 400. Any length is allowed if 0.
+	MaxKeyLength int `default:"128"`
+
+	// glob patterns of resource keys reserved by the operator, e.g. admin or internal-*,
+	// matching keys are rejected with a 400
+	ReservedKeys keyPatterns
+
+	// sent with every response, the header is left out if empty
+	ContentSecurityPolicy string `default:"default-src 'none'; frame-ancestors 'none'"`
+
+	// level of the logger, entries below it are dropped
+	LogLevel zapcore.Level `default:"info"`
+
+	// how log entries are encoded, json or console
+	LogFormat logFormat `default:"json"`
+
+	// level every completed request is logged at, set it below the logger's level,
+	// e.g. to debug, to stop logging requests
+	AccessLogLevel zapcore.Level `default:"info"`
+
+	// bearer token of admins, e.g. to import ratings, no request is treated as an admin's if empty
+	AdminToken string
+
+	// create the resource when it is first rated rather than responding with a 404
+	AutoCreateResources bool `default:"true"`
+
+	// most votes a single PUT may add to or remove from any star level, a PUT over it is rejected.
+	// Any number is allowed if 0.
+	MaxStarsPerPut int64 `default:"100"`
+
+	// most votes a resource may have across all star levels, a PUT adding votes beyond it is rejected
+	// while one removing votes is not. Any number is allowed if 0.
+	MaxVotesPerResource int64
+
+	// how the fields of ratings are named in responses, snake_case or camelCase
+	FieldNaming fieldNaming `default:"snake_case"`
+
+	// decimal places the average rating is rounded to in responses, halves to the even neighbour.
+	// It is not rounded if negative.
+	AveragePrecision int `default:"1"`
+
+	// number of ratings kept in memory to spare reads from the db, the cache is disabled if 0
+	CacheSize int
+
+	// base url of the comment service api, e.g. http://comments:50050/v1,
+	// the summaries are sent without comment counts if empty
+	CommentServiceURL string
+	PeerTimeout       time.Duration `default:"2s"`
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+const (
+	ratingExportErr            = "could not export ratings"
+	ratingMinAverageInvalidFmt = "min_average must be a number from 0 to 5, got %s"
+)
+
+var csvHeader = []string{"key", "five_stars", "four_stars", "three_stars", "two_stars", "one_stars", "total", "average"}
+
+// handleExportCSV streams the ratings of all resources of a type as csv, one row per resource.
+// Resources that have not been rated yet are exported with zero votes. With the min_average query
+// parameter only the resources whose average is at least that are exported, which leaves out the unrated ones.
+func (svc *service) handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, rateableTypeParam)
+	l := svc.logger.With(zap.String(rateableTypeParam, kind))
+
+	// the resources are only filtered if a min average is given, even if it is 0
+	var minAverage float64
+	s := r.URL.Query().Get("min_average")
+	if s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f > 5 {
+			msg := fmt.Sprintf(ratingMinAverageInvalidFmt, s)
+			svc.respondWithMsg(w, msg, http.StatusBadRequest)
+			l.Warn(msg, zap.Error(err))
+			return
+		}
+
+		minAverage = f
+	}
+
+	var written bool
+	err := svc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(kind))
+		if b == nil {
+			return fmt.Errorf(rateableTypeNotFoundFmt, kind)
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-ratings.csv"`, kind))
+		written = true
+
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+
+		err := b.ForEach(func(k, v []byte) error {
+			if v != nil { // only the nested buckets are rateables
+				return nil
+			}
+
+			var rt rating
+			if data := b.Bucket(k).Get(ratingsKey); data != nil {
+				if err := json.Unmarshal(data, &rt); err != nil {
+					return err
+				}
+			}
+
+			// resources without votes have no average to meet the minimum with, the others meet it as exported
+			average := svc.average(&rt)
+			if s != "" && (rt.total() == 0 || average < minAverage) {
+				return nil
+			}
+
+			return cw.Write(csvRow(string(k), &rt, average))
+		})
+		if err != nil {
+			return err
+		}
+
+		cw.Flush()
+		return cw.Error()
+	})
+
+	if err != nil && !written {
+		svc.respondWithStoreErr(w, err, ratingExportErr, http.StatusInternalServerError)
+	}
+
+	if err != nil {
+		// the export is cut short if it fails midway as the status has already been sent
+		l.Error(ratingExportErr, zap.Error(err))
+	}
+}
+
+func csvRow(key string, rt *rating, average float64) []string {
+	return []string{
+		key,
+		strconv.FormatInt(rt.FiveStars, 10),
+		strconv.FormatInt(rt.FourStars, 10),
+		strconv.FormatInt(rt.ThreeStars, 10),
+		strconv.FormatInt(rt.TwoStars, 10),
+		strconv.FormatInt(rt.OneStars, 10),
+		strconv.FormatInt(rt.total(), 10),
+		strconv.FormatFloat(average, 'f', -1, 64),
+	}
+}
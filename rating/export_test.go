@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleExportCSV(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.CreateBucket([]byte("empty")); err != nil {
+			return err
+		}
+
+		if _, err = b.CreateBucket([]byte("unrated")); err != nil {
+			return err
+		}
+
+		ratings := map[string]rating{
+			"rated":    {FiveStars: 3, FourStars: 1, OneStars: 1},
+			"lukewarm": {TwoStars: 2},
+		}
+		for k, rt := range ratings {
+			rb, err := b.CreateBucket([]byte(k))
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(rt)
+			if err != nil {
+				return err
+			}
+
+			if err = rb.Put(ratingsKey, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		path            string
+		wantCode        int
+		wantType        string
+		wantDisposition string
+		want            string
+	}{
+		{
+			name:     "it responds with error if rateableType does not exists",
+			path:     "/v1/unknownResourceType/ratings.csv",
+			wantCode: http.StatusNotAcceptable,
+			wantType: "application/json",
+			want:     buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknownResourceType")),
+		},
+		{
+			name:            "it exports only the header if there are no resources",
+			path:            "/v1/empty/ratings.csv",
+			wantCode:        http.StatusOK,
+			wantType:        "text/csv",
+			wantDisposition: `attachment; filename="empty-ratings.csv"`,
+			want:            "key,five_stars,four_stars,three_stars,two_stars,one_stars,total,average\n",
+		},
+		{
+			name:            "it exports the ratings of all resources",
+			path:            "/v1/posts/ratings.csv",
+			wantCode:        http.StatusOK,
+			wantType:        "text/csv",
+			wantDisposition: `attachment; filename="posts-ratings.csv"`,
+			want: "key,five_stars,four_stars,three_stars,two_stars,one_stars,total,average\n" +
+				"lukewarm,0,0,0,2,0,2,2\n" +
+				"rated,3,1,0,0,1,5,4\n" +
+				"unrated,0,0,0,0,0,0,0\n",
+		},
+		{
+			name:            "it exports only the resources with at least the min average",
+			path:            "/v1/posts/ratings.csv?min_average=3.5",
+			wantCode:        http.StatusOK,
+			wantType:        "text/csv",
+			wantDisposition: `attachment; filename="posts-ratings.csv"`,
+			want: "key,five_stars,four_stars,three_stars,two_stars,one_stars,total,average\n" +
+				"rated,3,1,0,0,1,5,4\n",
+		},
+		{
+			name:            "it exports the resources at the min average but never the unrated ones",
+			path:            "/v1/posts/ratings.csv?min_average=2",
+			wantCode:        http.StatusOK,
+			wantType:        "text/csv",
+			wantDisposition: `attachment; filename="posts-ratings.csv"`,
+			want: "key,five_stars,four_stars,three_stars,two_stars,one_stars,total,average\n" +
+				"lukewarm,0,0,0,2,0,2,2\n" +
+				"rated,3,1,0,0,1,5,4\n",
+		},
+		{
+			name:     "it responds with error if the min average is not a star level",
+			path:     "/v1/posts/ratings.csv?min_average=6",
+			wantCode: http.StatusBadRequest,
+			wantType: "application/json",
+			want:     buildResp(fmt.Sprintf(ratingMinAverageInvalidFmt, "6")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantDisposition, w.Header().Get("Content-Disposition"))
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func Test_service_handleExportCSV_dbUnavailable(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	cleanup(db)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(rateableTypeParam, "posts")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.handleExportCSV(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildResp(dbUnavailableErr), w.Body.String())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	ratingImportErr        = "ratings could not be imported"
+	ratingImportInvalidErr = "import must name a rateable type and map its keys to ratings"
+	ratingImportNegFmt     = "rating of %s has negative votes"
+)
+
+// handleImport writes the given ratings of resources of a type as they are, replacing the ratings
+// the resources had, e.g. to seed the db from an export. The ratings are written in one transaction
+// so that a failed import leaves the db untouched.
+func (svc *service) handleImport(w http.ResponseWriter, r *http.Request) {
+	var imp struct {
+		Type    string            `json:"type"`
+		Ratings map[string]rating `json:"ratings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&imp); err != nil || imp.Type == "" {
+		svc.respondWithMsg(w, ratingImportInvalidErr, http.StatusBadRequest)
+		svc.logger.Error(ratingImportInvalidErr, zap.Error(err))
+		return
+	}
+
+	found, err := verify(svc.db, imp.Type)
+	if err != nil {
+		svc.respondWithMsg(w, dbUnavailableErr, http.StatusServiceUnavailable)
+		svc.logger.Error("could not verify rateable type", zap.Error(err), zap.String(rateableTypeParam, imp.Type))
+		return
+	}
+
+	if !found {
+		svc.respondWithMsg(w, fmt.Sprintf(rateableTypeNotFoundFmt, imp.Type), http.StatusNotAcceptable)
+		svc.logger.Warn("could not verify rateable type", zap.String(rateableTypeParam, imp.Type))
+		return
+	}
+
+	for k, rt := range imp.Ratings {
+		msg := ""
+		if err := checkKey(k, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+			msg = fmt.Sprintf(rateableKeyInvalidFmt, err)
+		} else if rt.negative() {
+			msg = fmt.Sprintf(ratingImportNegFmt, k)
+		}
+
+		if msg != "" {
+			svc.respondWithMsg(w, msg, http.StatusUnprocessableEntity)
+			svc.logger.Error(msg, zap.String(rateableKeyParam, k))
+			return
+		}
+	}
+
+	n, err := importRatings(svc.db, imp.Type, imp.Ratings)
+	for k := range imp.Ratings {
+		svc.cache.invalidate(imp.Type, k)
+	}
+	if err != nil {
+		svc.respondWithStoreErr(w, err, ratingImportErr, http.StatusInternalServerError)
+		svc.logger.Error(ratingImportErr, zap.Error(err), zap.String(rateableTypeParam, imp.Type))
+		return
+	}
+
+	svc.logger.Info("imported ratings", zap.String(rateableTypeParam, imp.Type), zap.Int("written", n))
+	svc.respondWithPayload(w, struct {
+		Written int `json:"written"`
+	}{n}, http.StatusOK)
+}
+
+// importRatings writes the ratings of the resources of the given type, replacing their current ones,
+// in one transaction and returns how many were written
+func importRatings(db *bolt.DB, kind string, ratings map[string]rating) (int, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		rtBucket := tx.Bucket([]byte(kind))
+		if rtBucket == nil {
+			return fmt.Errorf(rateableTypeNotFoundFmt, kind)
+		}
+
+		for k, rt := range ratings {
+			rBucket, err := rtBucket.CreateBucketIfNotExists([]byte(k))
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(rt)
+			if err != nil {
+				return err
+			}
+
+			if err = rBucket.Put(ratingsKey, data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ratings), nil
+}
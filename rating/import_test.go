@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_importRatings(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+	existing := &rateable{db: db, kind: "books", key: "1"}
+	_, err := existing.save(rating{FiveStars: 3})
+	assert.NoError(t, err)
+
+	n, err := importRatings(db, "books", map[string]rating{
+		"1": {FiveStars: 10, OneStars: 2},
+		"2": {FourStars: 1},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	got, err := existing.get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FiveStars: 10, OneStars: 2}, got, "the imported rating should replace the existing one")
+
+	got, err = (&rateable{db: db, kind: "books", key: "2"}).get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FourStars: 1}, got)
+
+	_, err = importRatings(db, "unknown", map[string]rating{"1": {}})
+	assert.Error(t, err)
+}
+
+func Test_service_handleImport(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"books"}))
+
+	tests := []struct {
+		name     string
+		token    string
+		payload  string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it rejects requests of non admins",
+			payload:  `{"type":"books","ratings":{"1":{"five_stars":10}}}`,
+			wantCode: http.StatusForbidden,
+			want:     buildResp(forbiddenErr),
+		},
+		{
+			name:     "it responds with error if the payload is invalid",
+			token:    "secret",
+			payload:  `{"type":"books","ratings":[]}`,
+			wantCode: http.StatusBadRequest,
+			want:     buildResp(ratingImportInvalidErr),
+		},
+		{
+			name:     "it responds with error if the type is missing",
+			token:    "secret",
+			payload:  `{"ratings":{"1":{"five_stars":10}}}`,
+			wantCode: http.StatusBadRequest,
+			want:     buildResp(ratingImportInvalidErr),
+		},
+		{
+			name:     "it responds with error if the type does not exist",
+			token:    "secret",
+			payload:  `{"type":"unknown","ratings":{"1":{"five_stars":10}}}`,
+			wantCode: http.StatusNotAcceptable,
+			want:     buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknown")),
+		},
+		{
+			name:     "it responds with error if a key is invalid",
+			token:    "secret",
+			payload:  fmt.Sprintf(`{"type":"books","ratings":{"%s":{"five_stars":10}}}`, strings.Repeat("k", 129)),
+			wantCode: http.StatusUnprocessableEntity,
+			want:     buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key is longer than 128 bytes")),
+		},
+		{
+			name:     "it responds with error if a rating has negative votes",
+			token:    "secret",
+			payload:  `{"type":"books","ratings":{"1":{"five_stars":-1}}}`,
+			wantCode: http.StatusUnprocessableEntity,
+			want:     buildResp(fmt.Sprintf(ratingImportNegFmt, "1")),
+		},
+		{
+			name:     "it writes the ratings and responds with how many were written",
+			token:    "secret",
+			payload:  `{"type":"books","ratings":{"1":{"five_stars":10},"2":{"one_stars":4}}}`,
+			wantCode: http.StatusOK,
+			want:     `{"written":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/admin/ratings/import", bytes.NewBufferString(tt.payload))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+
+	got, err := (&rateable{db: db, kind: "books", key: "2"}).get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{OneStars: 4}, got)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const (
+	logFormatJSON    = "json"    // one json object per entry, for log collectors
+	logFormatConsole = "console" // human readable, for local development
+)
+
+// logFormat is how log entries are encoded
+type logFormat string
+
+// Decode implements envconfig.Decoder so that an unknown format fails the startup
+func (f *logFormat) Decode(value string) error {
+	switch value {
+	case logFormatJSON, logFormatConsole:
+		*f = logFormat(value)
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", value, logFormatJSON, logFormatConsole)
+	}
+
+	return nil
+}
+
+// newLogger builds the production logger, encoding entries in the format and dropping those below
+// the level, which can be changed while the logger is in use
+func newLogger(format logFormat, level zap.AtomicLevel) (*zap.Logger, error) {
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = level
+	if format == logFormatConsole {
+		zcfg.Encoding = logFormatConsole
+		zcfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+
+	return zcfg.Build()
+}
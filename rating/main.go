@@ -12,31 +12,40 @@ import (
 
 	"github.com/boltdb/bolt"
 	"github.com/go-chi/chi"
-	"github.com/kelseyhightower/envconfig"
 	"go.uber.org/zap"
 )
 
 var rateables = []string{"authors", "books"}
 
 func main() {
-	logger, err := zap.NewProduction()
+	// the logger is built from the config, so failing to process it can't be logged with it
+	cfg, _, err := loadConfig()
 	if err != nil {
-		log.Fatalf("can't initialize zap logger: %v", err)
+		log.Fatalf("failed to process env vars: %v", err)
 	}
-	defer logger.Sync()
 
-	var cfg config
-	err = envconfig.Process("", &cfg)
+	level := zap.NewAtomicLevelAt(cfg.LogLevel)
+	logger, err := newLogger(cfg.LogFormat, level)
 	if err != nil {
-		logger.Fatal("failed to process env vars", zap.Error(err))
+		log.Fatalf("can't initialize zap logger: %v", err)
 	}
+	defer logger.Sync()
 
-	db, err := bolt.Open(cfg.DSN, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	logger.Info("opening db", zap.String("dsn", cfg.DSN), zap.Duration("open_timeout", cfg.DBOpenTimeout))
+	db, err := bolt.Open(cfg.DSN, 0600, &bolt.Options{Timeout: cfg.DBOpenTimeout})
+	if err == bolt.ErrTimeout {
+		logger.Fatal("failed to lock db in time, another process holds it",
+			zap.String("dsn", cfg.DSN), zap.Duration("open_timeout", cfg.DBOpenTimeout))
+	}
 	if err != nil {
 		logger.Fatal("failed to setup db", zap.Error(err))
 	}
 
-	svc := newService(db, logger)
+	if cfg.ReadOnly {
+		logger.Warn("read-only mode is active, mutating requests will be rejected")
+	}
+
+	svc := newService(db, logger, cfg)
 	err = svc.setup(rateables)
 	if err != nil {
 		logger.Fatal("failed to setup rateables", zap.Error(err), zap.Any("rateables", rateables))
@@ -51,20 +60,41 @@ func main() {
 	}
 
 	logger.Info("starting service", zap.Int("port", cfg.Port))
-	go prepareGracefulShutdown(logger, server)
+	shutdown := make(chan struct{})
+	go prepareGracefulShutdown(logger, level, server, svc, shutdown)
 
 	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		logger.Fatal("http server error occurred", zap.Error(err))
 	}
 
+	// ListenAndServe returns as soon as the shutdown starts, while the requests in flight are still served
+	<-shutdown
+	if err := db.Close(); err != nil {
+		logger.Error("failed to close db", zap.Error(err), zap.String("path", db.Path()))
+	}
 	logger.Info("service shutdown successful")
 }
 
-func prepareGracefulShutdown(logger *zap.Logger, srv *http.Server) {
+// prepareGracefulShutdown reloads the config on SIGHUP and shuts the server down on any other signal,
+// closing done once the requests in flight were served
+func prepareGracefulShutdown(logger *zap.Logger, level zap.AtomicLevel, srv *http.Server, svc *service,
+	done chan<- struct{}) {
+	defer close(done)
+
 	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-signalChannel
+	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
+	// the config is reloaded on every SIGHUP until the service is told to stop
+	for sig := <-signalChannel; sig == syscall.SIGHUP; sig = <-signalChannel {
+		reloadConfig(logger, level, svc)
+	}
+
+	// Shutdown waits for in-flight requests but new ones would still be served meanwhile
+	svc.startDraining()
+
+	// the listeners are closed by Shutdown, so /readyz only gets to report it until then
+	logger.Info("draining before shutting down", zap.Duration("shutdown_delay", svc.cfg.ShutdownDelay))
+	time.Sleep(svc.cfg.ShutdownDelay)
 
 	// allow 15 seconds to shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -0,0 +1,104 @@
+package main
+
+import "fmt"
+
+const (
+	fieldNamingSnake = "snake_case" // e.g. five_stars
+	fieldNamingCamel = "camelCase"  // e.g. fiveStars
+)
+
+// fieldNaming is how the fields of ratings are named in responses. The ratings are always
+// stored and accepted in snake_case, only the responses are mapped to camelCase DTOs.
+type fieldNaming string
+
+// Decode implements envconfig.Decoder so that an unknown naming fails the startup
+func (n *fieldNaming) Decode(value string) error {
+	switch value {
+	case fieldNamingSnake, fieldNamingCamel:
+		*n = fieldNaming(value)
+	default:
+		return fmt.Errorf("unknown field naming %q, expected %s or %s", value, fieldNamingSnake, fieldNamingCamel)
+	}
+
+	return nil
+}
+
+// camelRating is a rating as sent in responses with camelCase field names.
+// It has the same fields as rating so that one converts to the other.
+type camelRating struct {
+	FiveStars  int64 `json:"fiveStars"`
+	FourStars  int64 `json:"fourStars"`
+	ThreeStars int64 `json:"threeStars"`
+	TwoStars   int64 `json:"twoStars"`
+	OneStars   int64 `json:"oneStars"`
+
+	Submissions int64 `json:"submissions"`
+}
+
+// camelPercentages are star percentages as sent in responses with camelCase field names
+type camelPercentages struct {
+	FiveStars  float64 `json:"fiveStars"`
+	FourStars  float64 `json:"fourStars"`
+	ThreeStars float64 `json:"threeStars"`
+	TwoStars   float64 `json:"twoStars"`
+	OneStars   float64 `json:"oneStars"`
+}
+
+// camelSummary is a summary as sent in responses with camelCase field names
+type camelSummary struct {
+	CommentCount *int          `json:"commentCount"`
+	Rating       ratingSummary `json:"rating"`
+}
+
+// ratingDTO returns the rating as sent in responses in the configured field naming
+func (svc *service) ratingDTO(rt *rating) interface{} {
+	if svc.cfg.FieldNaming == fieldNamingCamel {
+		c := camelRating(*rt)
+		return &c
+	}
+
+	return rt
+}
+
+// average returns the average of the rating as sent in responses, rounded to the configured precision
+func (svc *service) average(rt *rating) float64 {
+	return roundHalfEven(rt.average(), svc.cfg.AveragePrecision)
+}
+
+// summarize returns the rating with its average as sent in responses in the configured field naming
+func (svc *service) summarize(rt *rating) ratingSummary {
+	s := ratingSummary{Submissions: rt.Submissions, Average: svc.average(rt)}
+	if svc.cfg.FieldNaming == fieldNamingCamel {
+		c := camelRating(*rt)
+		s.camelRating = &c
+	} else {
+		s.rating = rt
+	}
+
+	return s
+}
+
+// ratingDetail is a rating along with its median and star percentages as sent in responses
+type ratingDetail struct {
+	*rating
+	*camelRating
+	Submissions int64       `json:"submissions"` // see ratingSummary
+	Median      int64       `json:"median"`
+	Percentages interface{} `json:"percentages"`
+}
+
+// detail returns the rating with its median and star percentages as sent in responses
+// in the configured field naming
+func (svc *service) detail(rt *rating) ratingDetail {
+	d := ratingDetail{Submissions: rt.Submissions, Median: rt.median()}
+	if svc.cfg.FieldNaming == fieldNamingCamel {
+		c := camelRating(*rt)
+		d.camelRating = &c
+		d.Percentages = camelPercentages(rt.percentages())
+	} else {
+		d.rating = rt
+		d.Percentages = rt.percentages()
+	}
+
+	return d
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_fieldNaming_Decode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		want    fieldNaming
+		wantErr bool
+	}{
+		{value: "snake_case", want: fieldNamingSnake},
+		{value: "camelCase", want: fieldNamingCamel},
+		{value: "kebab-case", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var n fieldNaming
+			err := n.Decode(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, n)
+		})
+	}
+}
+
+func Test_service_fieldNaming(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"posts"}))
+	_, err := (&rateable{db: db, kind: "posts", key: "1"}).save(rating{FiveStars: 1, OneStars: 1})
+	assert.NoError(t, err)
+
+	snake := `"five_stars":1,"four_stars":0,"three_stars":0,"two_stars":0,"one_stars":1,"submissions":1`
+	camel := `"fiveStars":1,"fourStars":0,"threeStars":0,"twoStars":0,"oneStars":1,"submissions":1`
+	// the put comes last so that it does not change the aggregate
+	tests := []struct {
+		name    string
+		naming  fieldNaming
+		method  string
+		path    string
+		payload string
+		want    string
+	}{
+		{
+			name:   "it responds with snake_case ratings by default",
+			naming: fieldNamingSnake,
+			method: http.MethodGet,
+			path:   "/v1/posts/1/ratings",
+			want: "{" + snake + `,"median":1,"percentages":` +
+				`{"five_stars":50,"four_stars":0,"three_stars":0,"two_stars":0,"one_stars":50}}`,
+		},
+		{
+			name:   "it responds with camelCase ratings if configured",
+			naming: fieldNamingCamel,
+			method: http.MethodGet,
+			path:   "/v1/posts/1/ratings",
+			want: "{" + camel + `,"median":1,"percentages":` +
+				`{"fiveStars":50,"fourStars":0,"threeStars":0,"twoStars":0,"oneStars":50}}`,
+		},
+		{
+			name:   "it responds with camelCase summaries if configured",
+			naming: fieldNamingCamel,
+			method: http.MethodGet,
+			path:   "/v1/posts/1/summary",
+			want:   `{"commentCount":null,"rating":{` + camel + `,"average":3}}`,
+		},
+		{
+			name:   "it responds with camelCase aggregates if configured",
+			naming: fieldNamingCamel,
+			method: http.MethodGet,
+			path:   "/v1/posts/ratings/aggregate",
+			want:   `{` + camel + `,"average":3,"votes":2,"resources":1}`,
+		},
+		{
+			name:    "it accepts snake_case ratings and responds with camelCase ones if configured",
+			naming:  fieldNamingCamel,
+			method:  http.MethodPut,
+			path:    "/v1/posts/2/ratings",
+			payload: `{"four_stars":1}`,
+			want:    `{"fiveStars":0,"fourStars":1,"threeStars":0,"twoStars":0,"oneStars":0,"submissions":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FieldNaming = tt.naming
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.payload))
+
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const ratingOverviewErr = "could not compute the overview"
+
+// typeOverview sums up the ratings of a type along with the comments on it, e.g. for dashboards
+type typeOverview struct {
+	// nil when the comment service is not configured or could not be reached
+	Comments *int    `json:"comments"`
+	Ratings  int     `json:"ratings"` // resources of the type, each holding a rating
+	Votes    int64   `json:"votes"`
+	Average  float64 `json:"average"`
+}
+
+// handleOverview responds with the overview of every type, keyed by type. The types only known to the
+// comment service, when one is configured, are included without ratings and vice versa.
+func (svc *service) handleOverview(w http.ResponseWriter, r *http.Request) {
+	kinds, err := ratedTypes(svc.db)
+	if err != nil {
+		svc.respondWithStoreErr(w, err, ratingOverviewErr, http.StatusInternalServerError)
+		svc.logger.Error(ratingOverviewErr, zap.Error(err))
+		return
+	}
+
+	types := map[string]*typeOverview{}
+	for _, kind := range kinds {
+		rt, resources, err := aggregate(svc.db, kind)
+		if err != nil {
+			svc.respondWithStoreErr(w, err, ratingOverviewErr, http.StatusInternalServerError)
+			svc.logger.Error(ratingOverviewErr, zap.Error(err), zap.String(rateableTypeParam, kind))
+			return
+		}
+
+		types[kind] = &typeOverview{Ratings: resources, Votes: rt.total(), Average: svc.average(rt)}
+	}
+
+	if svc.cfg.CommentServiceURL != "" {
+		counts, err := svc.countCommentsByType(r.Context(), r.Header.Get("Authorization"))
+		if err != nil {
+			// the ratings are still useful without the comments so the overview is sent without them
+			svc.logger.Warn("could not count comments", zap.Error(err))
+		}
+
+		for kind, n := range counts {
+			n := n
+			if types[kind] == nil {
+				types[kind] = &typeOverview{}
+			}
+			types[kind].Comments = &n
+		}
+
+		// the types without comments are known to have none
+		if err == nil {
+			for _, o := range types {
+				if o.Comments == nil {
+					o.Comments = new(int)
+				}
+			}
+		}
+	}
+
+	svc.respondWithPayload(w, struct {
+		Types map[string]*typeOverview `json:"types"`
+	}{types}, http.StatusOK)
+}
+
+// ratedTypes returns the types that have a bucket in the db
+func ratedTypes(db *bolt.DB) ([]string, error) {
+	var kinds []string
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			kinds = append(kinds, string(name))
+			return nil
+		})
+	})
+
+	return kinds, err
+}
+
+// countCommentsByType fetches the number of comments on each type from the overview of the comment service,
+// which is only served to admins, so the authorization of the request is passed on
+func (svc *service) countCommentsByType(ctx context.Context, authorization string) (map[string]int, error) {
+	req, err := http.NewRequest(http.MethodGet, svc.cfg.CommentServiceURL+"/admin/overview", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := svc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("comment service responded with %d", resp.StatusCode)
+	}
+
+	var data struct {
+		Types map[string]struct {
+			Comments int `json:"comments"`
+		} `json:"types"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for kind, o := range data.Types {
+		counts[kind] = o.Comments
+	}
+
+	return counts, nil
+}
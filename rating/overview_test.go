@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleOverview(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"authors", "books"}))
+
+	ratings := map[string]rating{"jane": {FiveStars: 2, OneStars: 1}, "john": {FourStars: 1}}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for k, rt := range ratings {
+			b, err := tx.Bucket([]byte("authors")).CreateBucket([]byte(k))
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(rt)
+			if err != nil {
+				return err
+			}
+
+			if err = b.Put(ratingsKey, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// comments stands in for the comment service
+	comments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/admin/overview" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		io.WriteString(w, `{"types":{"books":{"resources":2,"comments":3},"posts":{"resources":1,"comments":1}}}`)
+	}))
+	defer comments.Close()
+
+	tests := []struct {
+		name       string
+		commentURL string
+		want       string
+	}{
+		{
+			name:       "it responds with the ratings and comments of every type",
+			commentURL: comments.URL + "/v1",
+			want: `{"types":{
+				"authors":{"comments":0,"ratings":2,"votes":4,"average":3.8},
+				"books":{"comments":3,"ratings":0,"votes":0,"average":0},
+				"posts":{"comments":1,"ratings":0,"votes":0,"average":0}
+			}}`,
+		},
+		{
+			name:       "it responds without the comments if the comment service fails",
+			commentURL: comments.URL + "/broken",
+			want: `{"types":{
+				"authors":{"comments":null,"ratings":2,"votes":4,"average":3.8},
+				"books":{"comments":null,"ratings":0,"votes":0,"average":0}
+			}}`,
+		},
+		{
+			name: "it responds without the comments if the comment service is not configured",
+			want: `{"types":{
+				"authors":{"comments":null,"ratings":2,"votes":4,"average":3.8},
+				"books":{"comments":null,"ratings":0,"votes":0,"average":0}
+			}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AdminToken = "secret"
+			cfg.CommentServiceURL = tt.commentURL
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/admin/overview", nil)
+			r.Header.Set("Authorization", "Bearer secret")
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, tt.want, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_pretty(t *testing.T) {
+	t.Parallel()
+
+	payload := map[string]int{"count": 1}
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   string
+	}{
+		{
+			name: "it responds with compact json by default",
+			want: `{"count":1}`,
+		},
+		{
+			name:  "it indents the json if pretty is set in the query",
+			query: "?pretty=true",
+			want:  "{\n  \"count\": 1\n}",
+		},
+		{
+			name:   "it indents the json if the pretty header is set",
+			header: "true",
+			want:   "{\n  \"count\": 1\n}",
+		},
+		{
+			name:  "it responds with compact json if pretty is false",
+			query: "?pretty=false",
+			want:  `{"count":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop()}
+			handler := svc.pretty(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				svc.respondWithPayload(w, payload, http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/books/1234"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set(prettyHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
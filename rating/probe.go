@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+const (
+	livezPath  = "/livez"
+	readyzPath = "/readyz"
+
+	probeOK           = "OK"
+	probeFailed       = "FAILED"
+	probeUnavailable  = "UNAVAILABLE"
+	probeShuttingDown = "SHUTTING_DOWN"
+)
+
+// probeCheck is the outcome of checking a dependency the service needs to serve
+type probeCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// probeResponse is the payload of the liveness and readiness probes
+type probeResponse struct {
+	Status string                `json:"status"`
+	Checks map[string]probeCheck `json:"checks,omitempty"`
+}
+
+// isProbe reports whether the request is to one of the probes, which answer for themselves during the shutdown
+func isProbe(r *http.Request) bool {
+	return r.URL.Path == livezPath || r.URL.Path == readyzPath
+}
+
+// handleLivez responds with OK as long as the process serves requests, even while shutting down,
+// so that it is not restarted for a failing dependency a restart wouldn't fix
+func (svc *service) handleLivez(w http.ResponseWriter, r *http.Request) {
+	svc.respondWithPayload(w, probeResponse{Status: probeOK}, http.StatusOK)
+}
+
+// handleReadyz responds with OK if the db can be read from, and with a 503 otherwise or once the shutdown
+// started, so that traffic is steered away from the instance before it exits. The comment service, if configured,
+// is checked as well but doesn't fail the probe, as ratings are still served without comment counts.
+func (svc *service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&svc.draining) == 1 {
+		svc.respondWithPayload(w, probeResponse{Status: probeShuttingDown}, http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := probeResponse{Status: probeOK, Checks: map[string]probeCheck{"db": svc.checkDB()}}
+	code := http.StatusOK
+	if resp.Checks["db"].Status != probeOK {
+		resp.Status = probeUnavailable
+		code = http.StatusServiceUnavailable
+	}
+
+	if svc.cfg.CommentServiceURL != "" {
+		resp.Checks["comment_service"] = svc.checkCommentService(r.Context())
+	}
+
+	svc.respondWithPayload(w, resp, code)
+}
+
+// checkDB reads the first bucket of the db, which fails if the file is closed or can't be read
+func (svc *service) checkDB() probeCheck {
+	err := svc.db.View(func(tx *bolt.Tx) error {
+		tx.Cursor().First()
+		return nil
+	})
+	if err != nil {
+		svc.logger.Warn("readiness check of the db failed", zap.Error(err), zap.String("path", svc.db.Path()))
+		return probeCheck{Status: probeFailed, Error: err.Error()}
+	}
+
+	return probeCheck{Status: probeOK}
+}
+
+// checkCommentService asks for the liveness of the comment service, which is served from the root
+// of its host rather than under the api prefix of COMMENTSERVICEURL
+func (svc *service) checkCommentService(ctx context.Context) probeCheck {
+	err := func() error {
+		u, err := url.Parse(svc.cfg.CommentServiceURL)
+		if err != nil {
+			return err
+		}
+		u.Path, u.RawQuery = livezPath, ""
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := svc.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("comment service responded with %d", resp.StatusCode)
+		}
+
+		return nil
+	}()
+	if err != nil {
+		svc.logger.Warn("readiness check of the comment service failed", zap.Error(err))
+		return probeCheck{Status: probeFailed, Error: err.Error()}
+	}
+
+	return probeCheck{Status: probeOK}
+}
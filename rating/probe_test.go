@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleLivez(t *testing.T) {
+	t.Parallel()
+
+	for _, draining := range []bool{false, true} {
+		mux := chi.NewRouter()
+		svc := newService(nil, zap.NewNop(), testConfig())
+		svc.registerRoutes(mux)
+		if draining {
+			svc.startDraining()
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"OK"}`, w.Body.String())
+	}
+}
+
+func Test_service_handleReadyz(t *testing.T) {
+	t.Parallel()
+
+	comments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/livez" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"status":"OK"}`))
+	}))
+	defer comments.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	tests := []struct {
+		name        string
+		commentsURL string
+		closeDB     bool
+		draining    bool
+		wantCode    int
+		wantStatus  string
+		wantChecks  map[string]string
+	}{
+		{
+			name:       "it responds with OK if the db can be read from",
+			wantCode:   http.StatusOK,
+			wantStatus: probeOK,
+			wantChecks: map[string]string{"db": probeOK},
+		},
+		{
+			name:        "it checks the liveness of the comment service at the root of its host",
+			commentsURL: comments.URL + "/v1",
+			wantCode:    http.StatusOK,
+			wantStatus:  probeOK,
+			wantChecks:  map[string]string{"db": probeOK, "comment_service": probeOK},
+		},
+		{
+			name:        "it responds with OK if only the comment service fails",
+			commentsURL: down.URL + "/v1",
+			wantCode:    http.StatusOK,
+			wantStatus:  probeOK,
+			wantChecks:  map[string]string{"db": probeOK, "comment_service": probeFailed},
+		},
+		{
+			name:       "it responds with 503 if the db can't be read from",
+			closeDB:    true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: probeUnavailable,
+			wantChecks: map[string]string{"db": probeFailed},
+		},
+		{
+			name:       "it responds with 503 while shutting down",
+			draining:   true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: probeShuttingDown,
+			wantChecks: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			path := db.Path()
+			defer os.Remove(path)
+			defer db.Close()
+
+			if tt.closeDB {
+				assert.NoError(t, db.Close())
+			}
+
+			cfg := testConfig()
+			cfg.CommentServiceURL = tt.commentsURL
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+			if tt.draining {
+				svc.startDraining()
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tt.wantCode, w.Code)
+
+			var got probeResponse
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, tt.wantStatus, got.Status)
+
+			checks := map[string]string{}
+			for name, c := range got.Checks {
+				checks[name] = c.Status
+				if c.Status == probeFailed {
+					assert.NotEmpty(t, c.Error, name)
+				}
+			}
+			assert.Equal(t, tt.wantChecks, checks)
+		})
+	}
+}
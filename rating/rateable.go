@@ -2,7 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"unicode"
 
 	"github.com/boltdb/bolt"
 )
@@ -10,9 +14,75 @@ import (
 var (
 	rateableTypeNotFoundFmt = "rateable type, %s, not found"
 	rateableNotFoundFmt     = "%s not found with key %s"
+	rateableKeyInvalidFmt   = "resource key is invalid, %s"
 	ratingsKey              = []byte("ratings")
 )
 
+// rateableNotFoundError is returned when no rating has been saved for the rateable
+type rateableNotFoundError struct {
+	kind, key string
+}
+
+func (e rateableNotFoundError) Error() string {
+	return fmt.Sprintf(rateableNotFoundFmt, e.kind, e.key)
+}
+
+// checkKey reports why the resource key can't be used as a bucket name, nil if it can.
+// Keys come straight from the url so they are kept short and printable, and must not match
+// any of the reserved patterns.
+func checkKey(key string, maxLen int, reserved keyPatterns) error {
+	if key == "" {
+		return errors.New("key is empty")
+	}
+
+	if maxLen > 0 && len(key) > maxLen {
+		return fmt.Errorf("key is longer than %d bytes", maxLen)
+	}
+
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return errors.New("key contains control characters")
+		}
+	}
+
+	if p, ok := reserved.match(key); ok {
+		return fmt.Errorf("key matches the reserved pattern %s", p)
+	}
+
+	return nil
+}
+
+// keyPatterns are glob patterns of keys, see path.Match, e.g. admin or internal-*
+type keyPatterns []string
+
+// Decode implements envconfig.Decoder so that an invalid pattern fails the startup
+func (ps *keyPatterns) Decode(value string) error {
+	*ps = nil
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid key pattern %q, %v", p, err)
+		}
+		*ps = append(*ps, p)
+	}
+
+	return nil
+}
+
+// match returns the first pattern the key matches
+func (ps keyPatterns) match(key string) (string, bool) {
+	for _, p := range ps {
+		if ok, _ := path.Match(p, key); ok {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
 func setup(db *bolt.DB, cmts []string) error {
 	return db.Update(func(tx *bolt.Tx) error {
 		for _, b := range cmts {
@@ -25,8 +95,9 @@ func setup(db *bolt.DB, cmts []string) error {
 	})
 }
 
-func verify(db *bolt.DB, kind string) (found bool) {
-	db.View(func(tx *bolt.Tx) error {
+// verify tells whether the type exists, failing if the db could not be read, e.g. once it is closed
+func verify(db *bolt.DB, kind string) (found bool, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(kind))
 		found = b != nil
 		return nil
@@ -36,11 +107,28 @@ func verify(db *bolt.DB, kind string) (found bool) {
 }
 
 type rateable struct {
-	kind string // author, books
-	key  string // resource id
-	db   *bolt.DB
+	kind      string // author, books
+	key       string // resource id
+	db        *bolt.DB
+	mustExist bool  // save fails with a rateableNotFoundError rather than creating the rateable
+	maxVotes  int64 // save fails with a voteCapError rather than adding votes beyond it, unlimited if 0
 }
 
+func (r *rateable) exists() (found bool, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(r.kind))
+		if bucket != nil && bucket.Bucket([]byte(r.key)) != nil {
+			found = true
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// save adds the votes of rt to the stored rating and returns the result. The rating is read and written
+// back within a single update, which bolt runs one at a time, so that concurrent saves never lose votes.
 func (r *rateable) save(rt rating) (*rating, error) {
 	var newRating *rating
 	err := r.db.Update(func(tx *bolt.Tx) error {
@@ -49,6 +137,11 @@ func (r *rateable) save(rt rating) (*rating, error) {
 			return fmt.Errorf(rateableTypeNotFoundFmt, r.kind)
 		}
 
+		// checked within the transaction so that only registered rateables are ever rated
+		if r.mustExist && rtBucket.Bucket([]byte(r.key)) == nil {
+			return rateableNotFoundError{r.kind, r.key}
+		}
+
 		rBucket, err := rtBucket.CreateBucketIfNotExists([]byte(r.key))
 		if err != nil {
 			return err
@@ -62,7 +155,15 @@ func (r *rateable) save(rt rating) (*rating, error) {
 			}
 		}
 
+		total := currentRating.total()
 		newRating = currentRating.add(rt).ensureNotNegative()
+		// removing votes is still allowed beyond the cap, e.g. after it was lowered
+		if r.maxVotes > 0 && newRating.total() > r.maxVotes && newRating.total() > total {
+			newRating = nil
+			return voteCapError{r.kind, r.key, r.maxVotes}
+		}
+		newRating.Submissions = addClamped(newRating.Submissions, 1)
+
 		data, err = json.Marshal(newRating)
 		if err != nil {
 			return err
@@ -85,7 +186,7 @@ func (r *rateable) get() (*rating, error) {
 
 		rBucket := rtBucket.Bucket([]byte(r.key))
 		if rBucket == nil {
-			return fmt.Errorf(rateableNotFoundFmt, r.kind, r.key)
+			return rateableNotFoundError{r.kind, r.key}
 		}
 
 		rt = &rating{}
@@ -99,3 +200,43 @@ func (r *rateable) get() (*rating, error) {
 
 	return rt, err
 }
+
+// aggregate sums up the ratings of all resources of the given kind in a single read,
+// returning the combined rating along with the number of resources
+func aggregate(db *bolt.DB, kind string) (*rating, int, error) {
+	total := &rating{}
+	var resources int
+
+	err := db.View(func(tx *bolt.Tx) error {
+		rtBucket := tx.Bucket([]byte(kind)) // bucket for resource type
+		if rtBucket == nil {
+			return fmt.Errorf(rateableTypeNotFoundFmt, kind)
+		}
+
+		return rtBucket.ForEach(func(k, v []byte) error {
+			if v != nil { // only the nested buckets are rateables
+				return nil
+			}
+
+			resources++
+			data := rtBucket.Bucket(k).Get(ratingsKey)
+			if data == nil {
+				return nil
+			}
+
+			var rt rating
+			if err := json.Unmarshal(data, &rt); err != nil {
+				return err
+			}
+
+			total.add(rt)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return total, resources, nil
+}
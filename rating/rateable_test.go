@@ -42,6 +42,43 @@ func cleanup(db *bolt.DB) {
 	}
 }
 
+func Test_keyPatterns_Decode(t *testing.T) {
+	t.Parallel()
+
+	var ps keyPatterns
+	assert.NoError(t, ps.Decode("admin, internal-*,,"))
+	assert.Equal(t, keyPatterns{"admin", "internal-*"}, ps)
+	assert.EqualError(t, ps.Decode("admin,[a-"), `invalid key pattern "[a-", syntax error in pattern`)
+}
+
+func Test_checkKey_reserved(t *testing.T) {
+	t.Parallel()
+
+	reserved := keyPatterns{"admin", "internal-*", "tmp?"}
+	tests := []struct {
+		key     string
+		wantErr string
+	}{
+		{key: "admin", wantErr: "key matches the reserved pattern admin"},
+		{key: "internal-1234", wantErr: "key matches the reserved pattern internal-*"},
+		{key: "tmp1", wantErr: "key matches the reserved pattern tmp?"},
+		{key: "administrator"},
+		{key: "my-internal-1234"},
+		{key: "tmp12"},
+	}
+
+	for _, tt := range tests {
+		err := checkKey(tt.key, 128, reserved)
+		if tt.wantErr == "" {
+			assert.NoError(t, err, tt.key)
+		} else {
+			assert.EqualError(t, err, tt.wantErr, tt.key)
+		}
+	}
+
+	assert.NoError(t, checkKey("admin", 128, nil), "no key should be reserved by default")
+}
+
 func Test_setup(t *testing.T) {
 	t.Parallel()
 
@@ -79,7 +116,8 @@ func Test_setup(t *testing.T) {
 			assert.Equal(t, tt.want, got)
 
 			for i, name := range tt.args {
-				assert.Equal(t, tt.exp[i], verify(db, name))
+				found, _ := verify(db, name)
+				assert.Equal(t, tt.exp[i], found)
 			}
 		})
 	}
@@ -120,7 +158,69 @@ func Test_verify(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			got := verify(db, kind)
+			got, err := verify(db, kind)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_rateable_exists(t *testing.T) {
+	t.Parallel()
+
+	kind := "resource"
+	key := "resourceID"
+	tests := []struct {
+		name      string
+		setupFunc func(*bolt.Tx) error
+		want      bool
+	}{
+		{
+			name: "it returns true if resource type with key exists",
+			setupFunc: func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte(kind))
+				if err != nil {
+					return err
+				}
+
+				_, err = b.CreateBucket([]byte(key))
+				return err
+			},
+			want: true,
+		},
+		{
+			name: "it returns false if resource type does not exist",
+			setupFunc: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte("some-other-kind"))
+				return err
+			},
+		},
+		{
+			name: "it returns false if resource with key does not exist for the resource type",
+			setupFunc: func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte(kind))
+				if err != nil {
+					return err
+				}
+
+				_, err = b.CreateBucket([]byte("some-other-key"))
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			if tt.setupFunc != nil {
+				assert.NoError(t, db.Update(tt.setupFunc))
+			}
+
+			rt := &rateable{db: db, key: key, kind: kind}
+			got, err := rt.exists()
+			assert.NoError(t, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -142,6 +242,7 @@ func Test_rateable_save(t *testing.T) {
 	tests := []struct {
 		name      string
 		key       string
+		mustExist bool
 		setupFunc func(*bolt.Tx) error
 		want      *rating
 		wantErr   error
@@ -151,14 +252,31 @@ func Test_rateable_save(t *testing.T) {
 			key:     key,
 			wantErr: fmt.Errorf(rateableTypeNotFoundFmt, kind),
 		},
+		{
+			name: "it returns error if rateable does not exist and must",
+			setupFunc: func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucket([]byte(kind))
+				return err
+			},
+			key:       key,
+			mustExist: true,
+			wantErr:   rateableNotFoundError{kind, key},
+		},
 		{
 			name: "it creates and saves rating if rateable does not already exist",
 			setupFunc: func(tx *bolt.Tx) error {
 				_, err := tx.CreateBucket([]byte(kind))
 				return err
 			},
-			key:  key,
-			want: &rt,
+			key: key,
+			want: &rating{
+				FiveStars:   1,
+				FourStars:   2,
+				ThreeStars:  3,
+				TwoStars:    4,
+				OneStars:    5,
+				Submissions: 1,
+			},
 		},
 		{
 			name: "it returns error if it cannot create rateably that does not exist",
@@ -186,11 +304,12 @@ func Test_rateable_save(t *testing.T) {
 			},
 			key: key,
 			want: &rating{
-				FiveStars:  6,
-				FourStars:  6,
-				ThreeStars: 6,
-				TwoStars:   6,
-				OneStars:   6,
+				FiveStars:   6,
+				FourStars:   6,
+				ThreeStars:  6,
+				TwoStars:    6,
+				OneStars:    6,
+				Submissions: 1,
 			},
 		},
 	}
@@ -204,7 +323,7 @@ func Test_rateable_save(t *testing.T) {
 				assert.NoError(t, db.Update(tt.setupFunc))
 			}
 
-			r := &rateable{db: db, kind: kind, key: tt.key}
+			r := &rateable{db: db, kind: kind, key: tt.key, mustExist: tt.mustExist}
 			got, err := r.save(rt)
 			assert.Equal(t, tt.want, got)
 			assert.Equal(t, tt.wantErr, err)
@@ -241,7 +360,7 @@ func Test_rateable_get(t *testing.T) {
 				_, err := tx.CreateBucket([]byte(kind))
 				return err
 			},
-			wantErr: fmt.Errorf(rateableNotFoundFmt, kind, key),
+			wantErr: rateableNotFoundError{kind, key},
 		},
 		{
 			name: "it returns rating if empty",
@@ -287,3 +406,70 @@ func Test_rateable_get(t *testing.T) {
 		})
 	}
 }
+
+func Test_aggregate(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.CreateBucket([]byte("empty")); err != nil {
+			return err
+		}
+
+		if _, err = b.CreateBucket([]byte("unrated")); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, key := range []string{"one", "two"} {
+		rt := &rateable{db: db, kind: kind, key: key}
+		_, err = rt.save(rating{FiveStars: 1, TwoStars: 2})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name          string
+		kind          string
+		want          *rating
+		wantResources int
+		wantErr       error
+	}{
+		{
+			name:    "it returns error if the rateable type does not exist",
+			kind:    "unknown",
+			wantErr: fmt.Errorf(rateableTypeNotFoundFmt, "unknown"),
+		},
+		{
+			name: "it returns an empty rating if there are no resources",
+			kind: "empty",
+			want: &rating{},
+		},
+		{
+			name:          "it sums up the ratings of all resources",
+			kind:          kind,
+			want:          &rating{FiveStars: 2, TwoStars: 4, Submissions: 2},
+			wantResources: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, resources, err := aggregate(db, tt.kind)
+
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantResources, resources)
+		})
+	}
+}
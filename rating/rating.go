@@ -1,23 +1,42 @@
 package main
 
+import "math"
+
 type rating struct {
-	FiveStars  int `json:"five_stars"`
-	FourStars  int `json:"four_stars"`
-	ThreeStars int `json:"three_stars"`
-	TwoStars   int `json:"two_stars"`
-	OneStars   int `json:"one_stars"`
+	FiveStars  int64 `json:"five_stars"`
+	FourStars  int64 `json:"four_stars"`
+	ThreeStars int64 `json:"three_stars"`
+	TwoStars   int64 `json:"two_stars"`
+	OneStars   int64 `json:"one_stars"`
+
+	// Submissions is the number of puts the votes were made in, as opposed to the number of votes,
+	// counted by rateable.save. Ratings stored before it was counted have none.
+	Submissions int64 `json:"submissions"`
 }
 
+// add accumulates the votes and submissions of rt, clamping each at the int64 bounds instead of wrapping
 func (r *rating) add(rt rating) *rating {
-	r.FiveStars += rt.FiveStars
-	r.FourStars += rt.FourStars
-	r.ThreeStars += rt.ThreeStars
-	r.TwoStars += rt.TwoStars
-	r.OneStars += rt.OneStars
+	r.FiveStars = addClamped(r.FiveStars, rt.FiveStars)
+	r.FourStars = addClamped(r.FourStars, rt.FourStars)
+	r.ThreeStars = addClamped(r.ThreeStars, rt.ThreeStars)
+	r.TwoStars = addClamped(r.TwoStars, rt.TwoStars)
+	r.OneStars = addClamped(r.OneStars, rt.OneStars)
+	r.Submissions = addClamped(r.Submissions, rt.Submissions)
 
 	return r
 }
 
+func addClamped(a, b int64) int64 {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64
+	}
+
+	return a + b
+}
+
 func (r *rating) ensureNotNegative() *rating {
 	if r.FiveStars < 0 {
 		r.FiveStars = 0
@@ -37,3 +56,105 @@ func (r *rating) ensureNotNegative() *rating {
 
 	return r
 }
+
+// negative reports whether any star level of the rating is below zero
+func (r *rating) negative() bool {
+	return r.FiveStars < 0 || r.FourStars < 0 || r.ThreeStars < 0 || r.TwoStars < 0 || r.OneStars < 0
+}
+
+// exceeds reports whether any star level of the rating is beyond max in either direction
+func (r *rating) exceeds(max int64) bool {
+	for _, stars := range []int64{r.FiveStars, r.FourStars, r.ThreeStars, r.TwoStars, r.OneStars} {
+		if stars > max || stars < -max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// total returns the number of votes across all star levels
+func (r *rating) total() int64 {
+	total := addClamped(r.FiveStars, r.FourStars)
+	total = addClamped(total, r.ThreeStars)
+	total = addClamped(total, r.TwoStars)
+	return addClamped(total, r.OneStars)
+}
+
+// average returns the mean star level of the votes, 0 if there are none
+func (r *rating) average() float64 {
+	if r.total() == 0 {
+		return 0
+	}
+
+	// summed as floats since the weighted stars could overflow int64
+	stars := 5*float64(r.FiveStars) + 4*float64(r.FourStars) + 3*float64(r.ThreeStars) +
+		2*float64(r.TwoStars) + float64(r.OneStars)
+	votes := float64(r.FiveStars) + float64(r.FourStars) + float64(r.ThreeStars) +
+		float64(r.TwoStars) + float64(r.OneStars)
+	return stars / votes
+}
+
+// roundHalfEven rounds x to the given number of decimal places, halves to the even neighbour, e.g. 4.25 to 4.2
+// and 4.75 to 4.8 at one place. x is returned as is if places is negative or beyond the precision of a float64.
+func roundHalfEven(x float64, places int) float64 {
+	if places < 0 || places > 15 {
+		return x
+	}
+
+	scale := math.Pow(10, float64(places))
+	return math.RoundToEven(x*scale) / scale
+}
+
+// starPercentages is the share of the votes of each star level in percent
+type starPercentages struct {
+	FiveStars  float64 `json:"five_stars"`
+	FourStars  float64 `json:"four_stars"`
+	ThreeStars float64 `json:"three_stars"`
+	TwoStars   float64 `json:"two_stars"`
+	OneStars   float64 `json:"one_stars"`
+}
+
+// percentages returns the share of the votes of each star level in percent, all 0 if there are none
+func (r *rating) percentages() starPercentages {
+	if r.total() == 0 {
+		return starPercentages{}
+	}
+
+	// summed as floats like in average since the total could have been clamped
+	votes := float64(r.FiveStars) + float64(r.FourStars) + float64(r.ThreeStars) +
+		float64(r.TwoStars) + float64(r.OneStars)
+	return starPercentages{
+		FiveStars:  100 * float64(r.FiveStars) / votes,
+		FourStars:  100 * float64(r.FourStars) / votes,
+		ThreeStars: 100 * float64(r.ThreeStars) / votes,
+		TwoStars:   100 * float64(r.TwoStars) / votes,
+		OneStars:   100 * float64(r.OneStars) / votes,
+	}
+}
+
+// median returns the star level of the middle vote, 0 if there are none. If the votes split evenly
+// between two star levels, e.g. one one star and one five stars vote, the lower one is returned.
+func (r *rating) median() int64 {
+	if r.total() <= 0 {
+		return 0
+	}
+
+	levels := []int64{r.OneStars, r.TwoStars, r.ThreeStars, r.FourStars, r.FiveStars}
+	var atMost int64 // votes up to the current star level
+	for i, votes := range levels {
+		atMost = addClamped(atMost, votes)
+
+		var above int64
+		for _, v := range levels[i+1:] {
+			above = addClamped(above, v)
+		}
+
+		// compared rather than halving the total, which may have been clamped
+		if atMost > 0 && atMost >= above {
+			return int64(i + 1)
+		}
+	}
+
+	return 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,16 @@ func Test_rating_add(t *testing.T) {
 			arg:  rating{FiveStars: -2, FourStars: 1, ThreeStars: 10, TwoStars: -6, OneStars: 0},
 			want: &rating{FiveStars: -1, FourStars: 3, ThreeStars: 13, TwoStars: -2, OneStars: 5},
 		},
+		{
+			name: "it clamps it's values at the int64 bounds instead of overflowing",
+			arg:  rating{FiveStars: math.MaxInt64, FourStars: math.MaxInt64 - 2, ThreeStars: math.MaxInt64 - 2, TwoStars: math.MinInt64},
+			want: &rating{FiveStars: math.MaxInt64, FourStars: math.MaxInt64, ThreeStars: math.MaxInt64, TwoStars: math.MinInt64 + 4, OneStars: 5},
+		},
+		{
+			name: "it sums up the submissions",
+			arg:  rating{FiveStars: 1, Submissions: 2},
+			want: &rating{FiveStars: 2, FourStars: 2, ThreeStars: 3, TwoStars: 4, OneStars: 5, Submissions: 2},
+		},
 	}
 
 	for _, tt := range tests {
@@ -68,3 +79,223 @@ func Test_rating_ensureNotNegative(t *testing.T) {
 		})
 	}
 }
+
+func Test_rating_exceeds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		arg  rating
+		max  int64
+		want bool
+	}{
+		{
+			name: "it does not exceed the max with every level within it",
+			arg:  rating{FiveStars: 1, FourStars: -1, OneStars: 1},
+			max:  1,
+		},
+		{
+			name: "it exceeds the max with any level above it",
+			arg:  rating{FiveStars: 1, TwoStars: 2},
+			max:  1,
+			want: true,
+		},
+		{
+			name: "it exceeds the max with any level below its negative",
+			arg:  rating{OneStars: -2},
+			max:  1,
+			want: true,
+		},
+		{
+			name: "it exceeds the max with a level at the int64 bounds",
+			arg:  rating{ThreeStars: math.MinInt64},
+			max:  100,
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.arg.exceeds(tt.max))
+		})
+	}
+}
+
+func Test_rating_total(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, int64(0), (&rating{}).total())
+	assert.Equal(t, int64(15), (&rating{FiveStars: 1, FourStars: 2, ThreeStars: 3, TwoStars: 4, OneStars: 5}).total())
+	assert.Equal(t, int64(math.MaxInt64), (&rating{FiveStars: math.MaxInt64, OneStars: 1}).total())
+}
+
+func Test_rating_average(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rt   rating
+		want float64
+	}{
+		{
+			name: "it returns zero if there are no votes",
+			rt:   rating{},
+			want: 0,
+		},
+		{
+			name: "it returns the star level if all votes are the same",
+			rt:   rating{FourStars: 7},
+			want: 4,
+		},
+		{
+			name: "it returns the mean star level of the votes",
+			rt:   rating{FiveStars: 1, FourStars: 2, ThreeStars: 3, TwoStars: 4, OneStars: 5},
+			want: 35.0 / 15.0,
+		},
+		{
+			name: "it does not overflow with votes near the int64 bounds",
+			rt:   rating{FiveStars: math.MaxInt64, FourStars: math.MaxInt64},
+			want: 4.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rt.average())
+		})
+	}
+}
+
+func Test_roundHalfEven(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		x      float64
+		places int
+		want   float64
+	}{
+		{x: 3.75, places: 1, want: 3.8},
+		{x: 4.25, places: 1, want: 4.2},
+		{x: 35.0 / 15.0, places: 1, want: 2.3},
+		{x: 35.0 / 15.0, places: 2, want: 2.33},
+		{x: 4.5, places: 0, want: 4},
+		{x: 3.5, places: 0, want: 4},
+		{x: 35.0 / 15.0, places: -1, want: 35.0 / 15.0},
+		{x: 35.0 / 15.0, places: 400, want: 35.0 / 15.0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, roundHalfEven(tt.x, tt.places), "%v to %d places", tt.x, tt.places)
+	}
+}
+
+func Test_rating_median(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rt   rating
+		want int64
+	}{
+		{
+			name: "it returns zero if there are no votes",
+			rt:   rating{},
+			want: 0,
+		},
+		{
+			name: "it returns the star level if all votes are the same",
+			rt:   rating{TwoStars: 7},
+			want: 2,
+		},
+		{
+			name: "it returns the star level of the middle vote",
+			rt:   rating{FiveStars: 1, FourStars: 2, ThreeStars: 3, TwoStars: 4, OneStars: 5},
+			want: 2,
+		},
+		{
+			name: "it is not skewed by a few outliers",
+			rt:   rating{FiveStars: 10, FourStars: 11, OneStars: 9},
+			want: 4,
+		},
+		{
+			name: "it returns the star level most votes are at or beyond",
+			rt:   rating{FiveStars: 51, OneStars: 49},
+			want: 5,
+		},
+		{
+			name: "it returns the lower star level if the votes split evenly",
+			rt:   rating{FiveStars: 50, OneStars: 50},
+			want: 1,
+		},
+		{
+			name: "it skips star levels without votes",
+			rt:   rating{FiveStars: 3, TwoStars: 2},
+			want: 5,
+		},
+		{
+			name: "it does not overflow with votes near the int64 bounds",
+			rt:   rating{FiveStars: math.MaxInt64, FourStars: math.MaxInt64, OneStars: 1},
+			want: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rt.median())
+		})
+	}
+}
+
+func Test_rating_percentages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rt   rating
+		want starPercentages
+	}{
+		{
+			name: "it returns zero percentages, not NaN, if there are no votes",
+			rt:   rating{},
+			want: starPercentages{},
+		},
+		{
+			name: "it returns the share of the votes of each star level",
+			rt:   rating{FiveStars: 2, FourStars: 1, OneStars: 1},
+			want: starPercentages{FiveStars: 50, FourStars: 25, OneStars: 25},
+		},
+		{
+			name: "it does not overflow with votes near the int64 bounds",
+			rt:   rating{FiveStars: math.MaxInt64, OneStars: math.MaxInt64},
+			want: starPercentages{FiveStars: 50, OneStars: 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rt.percentages())
+		})
+	}
+}
+
+func Test_addClamped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a, b int64
+		want int64
+	}{
+		{name: "it adds values within bounds", a: 3, b: -5, want: -2},
+		{name: "it adds up to the upper bound", a: math.MaxInt64 - 1, b: 1, want: math.MaxInt64},
+		{name: "it clamps past the upper bound", a: math.MaxInt64 - 1, b: 2, want: math.MaxInt64},
+		{name: "it adds down to the lower bound", a: math.MinInt64 + 1, b: -1, want: math.MinInt64},
+		{name: "it clamps past the lower bound", a: math.MinInt64 + 1, b: -2, want: math.MinInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, addClamped(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+)
+
+// reloadable are the env vars of the settings that are applied without a restart, see reload
+var reloadable = map[string]bool{
+	"LOGLEVEL":            true,
+	"ACCESSLOGLEVEL":      true,
+	"MAXKEYLENGTH":        true,
+	"RESERVEDKEYS":        true,
+	"MAXSTARSPERPUT":      true,
+	"MAXVOTESPERRESOURCE": true,
+}
+
+// config returns the current config, which differs from the one the service was started with
+// in the reloadable settings once the config was reloaded
+func (svc *service) config() config {
+	if cfg, ok := svc.live.Load().(config); ok {
+		return cfg
+	}
+
+	return svc.cfg
+}
+
+// reload applies the reloadable settings of next, every other setting keeps its value
+func (svc *service) reload(next config) {
+	cfg := svc.config()
+	cfg.LogLevel = next.LogLevel
+	cfg.AccessLogLevel = next.AccessLogLevel
+	cfg.MaxKeyLength = next.MaxKeyLength
+	cfg.ReservedKeys = next.ReservedKeys
+	cfg.MaxStarsPerPut = next.MaxStarsPerPut
+	cfg.MaxVotesPerResource = next.MaxVotesPerResource
+	svc.live.Store(cfg)
+}
+
+// loadConfig processes the config from the env vars, overridden by those in the config file if set.
+// It returns the names of the env vars the file changed.
+func loadConfig() (config, []string, error) {
+	var cfg config
+	if err := envconfig.Process("", &cfg); err != nil || cfg.ConfigFile == "" {
+		return cfg, nil, err
+	}
+
+	changed, err := applyEnvFile(cfg.ConfigFile)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	cfg = config{}
+	err = envconfig.Process("", &cfg)
+	return cfg, changed, err
+}
+
+// envValue is the value of an env var before the config file set it, ok is false if it was unset
+type envValue struct {
+	value string
+	ok    bool
+}
+
+// fileEnv holds the env vars the config file set on its last load along with their previous values,
+// so that those removed from the file are reverted on the next load
+var fileEnv = map[string]envValue{}
+
+// applyEnvFile sets the env vars in the file of KEY=value lines, skipping blank lines and comments
+// starting with #, and reverts those it set on the last load that are no longer in it to their previous value.
+// It returns the sorted names of those whose value changed. Nothing is changed if the file is invalid.
+func applyEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value, got %s", path, n, line)
+		}
+
+		vars[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for k, prev := range fileEnv {
+		if _, ok := vars[k]; ok {
+			continue
+		}
+
+		if cur, ok := os.LookupEnv(k); ok != prev.ok || cur != prev.value {
+			changed = append(changed, k)
+		}
+		if err := setEnv(k, prev); err != nil {
+			return nil, err
+		}
+		delete(fileEnv, k)
+	}
+
+	for k, v := range vars {
+		old, ok := os.LookupEnv(k)
+		if _, set := fileEnv[k]; !set {
+			fileEnv[k] = envValue{old, ok}
+		}
+		if ok && old == v {
+			continue
+		}
+
+		if err := os.Setenv(k, v); err != nil {
+			return nil, err
+		}
+		changed = append(changed, k)
+	}
+
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// setEnv sets the env var to the value, or unsets it if the value is not ok
+func setEnv(k string, v envValue) error {
+	if !v.ok {
+		return os.Unsetenv(k)
+	}
+
+	return os.Setenv(k, v.value)
+}
+
+// reloadConfig reloads the config, e.g. on SIGHUP, and applies its reloadable settings.
+// Changes to settings that require a restart, e.g. the port, are logged as ignored.
+// Nothing is reloaded without a config file, as the env vars of the process can't change while it runs.
+func reloadConfig(logger *zap.Logger, level zap.AtomicLevel, svc *service) {
+	if svc.cfg.ConfigFile == "" {
+		logger.Warn("ignored the config reload, it requires CONFIGFILE to be set")
+		return
+	}
+
+	cfg, changed, err := loadConfig()
+	if err != nil {
+		logger.Error("failed to reload config, keeping the current one", zap.Error(err))
+		return
+	}
+
+	var ignored []string
+	for _, k := range changed {
+		if !reloadable[k] {
+			ignored = append(ignored, k)
+		}
+	}
+	if len(ignored) > 0 {
+		logger.Warn("ignored changed settings that require a restart", zap.Strings("ignored", ignored))
+	}
+
+	level.SetLevel(cfg.LogLevel)
+	svc.reload(cfg)
+	logger.Info("reloaded config", zap.Strings("changed", changed))
+}
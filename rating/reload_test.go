@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_service_reload(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.MaxKeyLength = 10
+	cfg.MaxStarsPerPut = 1
+	svc := newService(nil, zap.NewNop(), cfg)
+	assert.Equal(t, cfg, svc.config())
+
+	next := cfg
+	next.Port = 8080
+	next.DSN = "db/other.db"
+	next.LogLevel = zapcore.DebugLevel
+	next.AccessLogLevel = zapcore.WarnLevel
+	next.MaxKeyLength = 20
+	next.ReservedKeys = keyPatterns{"admin"}
+	next.MaxStarsPerPut = 2
+	next.MaxVotesPerResource = 1000
+	svc.reload(next)
+
+	want := cfg
+	want.LogLevel = zapcore.DebugLevel
+	want.AccessLogLevel = zapcore.WarnLevel
+	want.MaxKeyLength = 20
+	want.ReservedKeys = keyPatterns{"admin"}
+	want.MaxStarsPerPut = 2
+	want.MaxVotesPerResource = 1000
+	assert.Equal(t, want, svc.config(), "only the reloadable settings should change")
+	assert.Equal(t, cfg, svc.cfg, "the config the service was started with should be kept")
+}
+
+// not parallel as it changes the environment of the process
+func Test_applyEnvFile(t *testing.T) {
+	for _, k := range []string{"RATING_TEST_RELOAD_SAME", "RATING_TEST_RELOAD_OLD", "RATING_TEST_RELOAD_NEW"} {
+		defer os.Unsetenv(k)
+	}
+	defer func() { fileEnv = map[string]envValue{} }()
+
+	os.Setenv("RATING_TEST_RELOAD_SAME", "same")
+	os.Setenv("RATING_TEST_RELOAD_OLD", "old")
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("# limits\nRATING_TEST_RELOAD_SAME=same\n\nRATING_TEST_RELOAD_OLD = new\nRATING_TEST_RELOAD_NEW=a=b\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	changed, err := applyEnvFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RATING_TEST_RELOAD_NEW", "RATING_TEST_RELOAD_OLD"}, changed)
+	assert.Equal(t, "new", os.Getenv("RATING_TEST_RELOAD_OLD"))
+	assert.Equal(t, "a=b", os.Getenv("RATING_TEST_RELOAD_NEW"))
+
+	assert.NoError(t, ioutil.WriteFile(f.Name(), []byte("RATING_TEST_RELOAD_SAME=same\n"), 0600))
+
+	changed, err = applyEnvFile(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RATING_TEST_RELOAD_NEW", "RATING_TEST_RELOAD_OLD"}, changed)
+	assert.Equal(t, "old", os.Getenv("RATING_TEST_RELOAD_OLD"), "removed lines should revert to the previous value")
+	_, ok := os.LookupEnv("RATING_TEST_RELOAD_NEW")
+	assert.False(t, ok, "removed lines should unset the env vars that were not set before")
+	assert.Equal(t, "same", os.Getenv("RATING_TEST_RELOAD_SAME"))
+}
+
+func Test_reloadConfig_noConfigFile(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig()
+	cfg.ConfigFile = ""
+	svc := newService(nil, zap.NewNop(), cfg)
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	reloadConfig(zap.New(core), zap.NewAtomicLevelAt(zapcore.InfoLevel), svc)
+
+	assert.Equal(t, 1, logs.FilterMessage("ignored the config reload, it requires CONFIGFILE to be set").Len())
+	assert.Nil(t, svc.live.Load(), "the config should not be reloaded")
+}
+
+func Test_applyEnvFile_invalid(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "env")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("RATING_TEST_RELOAD_INVALID\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	_, err = applyEnvFile(f.Name())
+	assert.EqualError(t, err, f.Name()+":1: expected KEY=value, got RATING_TEST_RELOAD_INVALID")
+
+	_, err = applyEnvFile(f.Name() + ".missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ratingSchema is the json schema of the votes put by clients. Negative votes take votes back.
+// Other fields are allowed since clients send back the ratings they got, which carry e.g. their median.
+const ratingSchema = `{
+	"type": "object",
+	"properties": {
+		"five_stars": {"type": "integer"},
+		"four_stars": {"type": "integer"},
+		"three_stars": {"type": "integer"},
+		"two_stars": {"type": "integer"},
+		"one_stars": {"type": "integer"}
+	}
+}`
+
+// compiled once at startup, panicking if a schema is invalid
+var ratingPayload = mustCompileSchema(ratingSchema)
+
+func mustCompileSchema(schema string) *gojsonschema.Schema {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("invalid json schema: %v", err))
+	}
+
+	return s
+}
+
+// fieldError is why a field of a payload was rejected, sent alike for schema and rule failures
+type fieldError struct {
+	Field   string `json:"field"` // e.g. five_stars, (root) for the payload itself
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// schemaError is returned for payloads that are valid json but don't match their schema
+type schemaError []fieldError
+
+func (e schemaError) Error() string {
+	reasons := make([]string, len(e))
+	for i, f := range e {
+		reasons[i] = f.Field + ": " + f.Message
+	}
+
+	return "payload does not match its schema, " + strings.Join(reasons, "; ")
+}
+
+// checkSchema validates the json payload against the schema,
+// returning a schemaError listing every field that failed and why
+func checkSchema(s *gojsonschema.Schema, data []byte) error {
+	res, err := s.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil { // the payload is not json
+		return err
+	}
+
+	if res.Valid() {
+		return nil
+	}
+
+	fields := make(schemaError, len(res.Errors()))
+	for i, e := range res.Errors() {
+		fields[i] = fieldError{Field: e.Field(), Code: strings.ToUpper(e.Type()), Message: e.Description()}
+	}
+
+	return fields
+}
+
+// respondWithFields responds with a 400 with the message and the fields of the payload
+// that failed the validation against its schema
+func (svc *service) respondWithFields(w http.ResponseWriter, msg string, fields schemaError) {
+	payload := struct {
+		Message string      `json:"message"`
+		Fields  schemaError `json:"fields"`
+	}{msg, fields}
+
+	svc.respondWithPayload(w, payload, http.StatusBadRequest)
+}
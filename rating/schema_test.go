@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_checkSchema(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantFields schemaError
+		wantErr    bool
+	}{
+		{
+			name:    "it accepts votes matching the schema, including negative ones",
+			payload: `{"five_stars": 2, "one_stars": -1}`,
+		},
+		{
+			name:    "it accepts a rating sent back with the fields of the response",
+			payload: `{"five_stars": 2, "submissions": 1, "median": 5, "percentages": {"five_stars": 100}}`,
+		},
+		{
+			name:    "it lists every field that does not match the schema",
+			payload: `{"five_stars": "2", "four_stars": 1.5}`,
+			wantFields: schemaError{
+				{Field: "five_stars", Code: "INVALID_TYPE", Message: "Invalid type. Expected: integer, given: string"},
+				{Field: "four_stars", Code: "INVALID_TYPE", Message: "Invalid type. Expected: integer, given: number"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "it rejects a payload that is not an object",
+			payload: `[5]`,
+			wantFields: schemaError{
+				{Field: "(root)", Code: "INVALID_TYPE", Message: "Invalid type. Expected: object, given: array"},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "it returns the parse error of a payload that is not json",
+			payload: `{"five_stars": "4}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSchema(ratingPayload, []byte(tt.payload))
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			fields, _ := err.(schemaError)
+			assert.ElementsMatch(t, tt.wantFields, fields)
+		})
+	}
+}
+
+func Test_service_respondWithFields(t *testing.T) {
+	t.Parallel()
+
+	svc := newService(nil, zap.NewNop(), testConfig())
+	w := httptest.NewRecorder()
+	svc.respondWithFields(w, ratingFieldsInvalid,
+		schemaError{{Field: "five_stars", Code: "INVALID_TYPE", Message: "Invalid type"}})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"message":"rating has invalid fields","fields":[{"field":"five_stars","code":"INVALID_TYPE","message":"Invalid type"}]}`,
+		strings.TrimSpace(w.Body.String()))
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-chi/chi"
@@ -18,71 +21,196 @@ type key string
 type service struct {
 	logger *zap.Logger
 	db     *bolt.DB
+	cfg    config
+	client *http.Client // for calls to the comment service
+	cache  *ratingCache // nil unless enabled
+
+	draining int32        // set once the shutdown started, see drain
+	live     atomic.Value // config, as last reloaded
 }
 
 const (
-	ratingIsInvalid   = "rating could not be parsed"
-	ratingNotFoundErr = "rating not found"
-	ratingFetchErr    = "could not load ratings"
-	ratingSaveErr     = "rating could not be saved"
+	ratingIsInvalid    = "rating could not be parsed"
+	ratingNotFoundErr  = "rating not found"
+	ratingFetchErr     = "could not load ratings"
+	ratingSaveErr      = "rating could not be saved"
+	ratingAggregateErr = "could not aggregate ratings"
+	serviceReadOnlyErr = "service is read-only"
+	dbUnavailableErr   = "service is temporarily unavailable, please retry"
+	ratingTooLargeFmt  = "a rating can change each star level by at most %d"
 
 	rateableTypeParam = "rateableType"
 	rateableKeyParam  = "rateableKey"
 )
 
-func newService(db *bolt.DB, logger *zap.Logger) *service {
-	return &service{db: db, logger: logger}
+const serviceShuttingDownErr = "service is shutting down, please retry"
+
+const ratingFieldsInvalid = "rating has invalid fields"
+
+func newService(db *bolt.DB, logger *zap.Logger, cfg config) *service {
+	return &service{
+		db:     db,
+		logger: logger,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.PeerTimeout},
+		cache:  newRatingCache(cfg.CacheSize),
+	}
 }
 
 func (svc *service) registerRoutes(r chi.Router) {
-	// GET /authors/1234/ratings
-	// POST /authors/1234/ratings
+	r.Use(svc.accessLog, svc.drain, svc.secureHeaders, svc.redirectSlashes, svc.readOnly, svc.pretty)
 
+	// the api routes are versioned under the configured prefix
+	// while the operational routes stay at the root
+	if svc.cfg.APIPrefix == "" {
+		svc.registerAPIRoutes(r)
+	} else {
+		r.Route(svc.cfg.APIPrefix, svc.registerAPIRoutes)
+	}
+
+	r.Get("/status", svc.handleStatus)
+	r.Get(livezPath, svc.handleLivez)
+	r.Get(readyzPath, svc.handleReadyz)
+	r.Get("/metrics", svc.handleMetrics)
+
+	if svc.cfg.Pprof {
+		r.Route(pprofPrefix, svc.registerPprofRoutes)
+	}
+}
+
+func (svc *service) registerAPIRoutes(r chi.Router) {
+	// POST /v1/admin/ratings/import
+	// POST /v1/admin/ratings/normalize
+	// GET /v1/admin/export
+	// POST /v1/admin/import/full
+	// GET /v1/admin/overview
+	r.With(svc.adminOnly).Route("/admin", func(r chi.Router) {
+		r.Post("/ratings/import", svc.handleImport)
+		r.Post("/ratings/normalize", svc.handleNormalize)
+		r.Get("/overview", svc.handleOverview)
+		r.Get("/export", svc.handleExportSnapshot)
+		r.Post("/import/full", svc.handleImportSnapshot)
+	})
+
+	// GET /v1/authors/1234/ratings
+	// PUT /v1/authors/1234/ratings
+	// GET /v1/authors/1234/ratings/summary
 	pathWithParam := fmt.Sprintf("/{%s}/{%s}/ratings", rateableTypeParam, rateableKeyParam)
 	r.With(svc.verifier).Route(pathWithParam, func(r chi.Router) {
+		if !svc.cfg.AutoCreateResources {
+			r.Use(svc.validator)
+		}
+
 		r.Get("/", svc.handleGet)
 		r.Put("/", svc.handlePut)
-	})
 
-	r.Get("/status", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		io.WriteString(w, "OK")
+		// the summary is nested like the comments of the comment service, so that a gateway
+		// can route both services alike, and is validated like the rating it holds
+		r.Get("/summary", svc.handleSummary)
 	})
+
+	// GET /v1/authors/ratings/aggregate
+	r.With(svc.verifier).Get(fmt.Sprintf("/{%s}/ratings/aggregate", rateableTypeParam), svc.handleAggregate)
+
+	// GET /v1/authors/ratings.csv
+	r.With(svc.verifier).Get(fmt.Sprintf("/{%s}/ratings.csv", rateableTypeParam), svc.handleExportCSV)
+
+	// GET /v1/authors/1234/summary
+	summaryPath := fmt.Sprintf("/{%s}/{%s}/summary", rateableTypeParam, rateableKeyParam)
+	r.With(svc.verifier).Get(summaryPath, svc.handleSummary)
 }
 
 func (svc *service) setup(cm []string) error {
-	return setup(svc.db, cm)
+	if err := setup(svc.db, cm); err != nil {
+		return err
+	}
+
+	return svc.reconcile(cm)
 }
 
 func (svc *service) handlePut(w http.ResponseWriter, r *http.Request) {
-	rt := &rating{}
-	err := json.NewDecoder(r.Body).Decode(rt)
+	rt, err := decodeRating(r)
+	if fields, ok := err.(schemaError); ok {
+		svc.respondWithFields(w, ratingFieldsInvalid, fields)
+		svc.logger.Warn(ratingFieldsInvalid, zap.Error(err))
+		return
+	}
+
 	if err != nil {
 		svc.respondWithMsg(w, ratingIsInvalid, http.StatusBadRequest)
 		svc.logger.Error(ratingIsInvalid, zap.Error(err))
 		return
 	}
 
+	if max := svc.config().MaxStarsPerPut; max > 0 && rt.exceeds(max) {
+		msg := fmt.Sprintf(ratingTooLargeFmt, max)
+		svc.respondWithMsg(w, msg, http.StatusUnprocessableEntity)
+		svc.logger.Error(msg, zap.Any("rating", *rt))
+		return
+	}
+
 	k := chi.URLParam(r, rateableKeyParam)
 	rte := r.Context().Value(key(k)).(*rateable)
 
-	rt, err = rte.save(*rt)
+	rte.maxVotes = svc.config().MaxVotesPerResource
+	newRt, err := rte.save(*rt)
+	svc.cache.invalidate(rte.kind, rte.key)
+	if capErr, capped := err.(voteCapError); capped {
+		svc.respondWithMsg(w, capErr.Error(), http.StatusConflict)
+		svc.logger.Warn("rejected rating beyond the vote cap", zap.String(rateableKeyParam, rte.key),
+			zap.String(rateableTypeParam, rte.kind), zap.Any("rating", *rt))
+		return
+	}
+
+	if _, notFound := err.(rateableNotFoundError); notFound {
+		svc.respondWithMsg(w, err.Error(), http.StatusNotFound)
+		svc.logger.Warn("rejected rating of unknown rateable", zap.String(rateableKeyParam, rte.key),
+			zap.String(rateableTypeParam, rte.kind))
+		return
+	}
+
 	if err != nil {
-		svc.respondWithMsg(w, ratingSaveErr, http.StatusInternalServerError)
+		svc.respondWithStoreErr(w, err, ratingSaveErr, http.StatusInternalServerError)
 		svc.logger.Error(ratingSaveErr, zap.Error(err), zap.Any("rating", *rt))
 		return
 	}
 
-	svc.respondWithPayload(w, rt, http.StatusOK)
+	svc.respondWithPayload(w, svc.ratingDTO(newRt), http.StatusOK)
+}
+
+// decodeRating decodes the rating in the request body, returning a schemaError if it does not match ratingSchema
+func decodeRating(r *http.Request) (*rating, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkSchema(ratingPayload, data); err != nil {
+		return nil, err
+	}
+
+	rt := &rating{}
+	if err = json.Unmarshal(data, rt); err != nil {
+		return nil, err
+	}
+
+	// submissions are counted by the service, those of a rating sent back are not added to them
+	rt.Submissions = 0
+	return rt, nil
 }
 
 func (svc *service) handleGet(w http.ResponseWriter, r *http.Request) {
 	k := chi.URLParam(r, rateableKeyParam)
 	rte := r.Context().Value(key(k)).(*rateable)
 
-	rt, err := rte.get()
+	rt, err := svc.getRating(rte)
+	if _, notFound := err.(rateableNotFoundError); notFound {
+		svc.respondWithMsg(w, ratingNotFoundErr, http.StatusNotFound)
+		return
+	}
+
 	if err != nil {
-		svc.respondWithMsg(w, ratingFetchErr, http.StatusBadRequest)
+		svc.respondWithStoreErr(w, err, ratingFetchErr, http.StatusInternalServerError)
 		svc.logger.Error(
 			ratingFetchErr,
 			zap.Error(err),
@@ -93,7 +221,25 @@ func (svc *service) handleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	svc.respondWithPayload(w, rt, http.StatusOK)
+	svc.respondWithPayload(w, svc.detail(rt), http.StatusOK)
+}
+
+// handleAggregate responds with the combined rating of all resources of a type
+func (svc *service) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, rateableTypeParam)
+
+	rt, resources, err := aggregate(svc.db, kind)
+	if err != nil {
+		svc.respondWithStoreErr(w, err, ratingAggregateErr, http.StatusInternalServerError)
+		svc.logger.Error(ratingAggregateErr, zap.Error(err), zap.String(rateableTypeParam, kind))
+		return
+	}
+
+	svc.respondWithPayload(w, struct {
+		ratingSummary
+		Votes     int64 `json:"votes"`
+		Resources int   `json:"resources"`
+	}{svc.summarize(rt), rt.total(), resources}, http.StatusOK)
 }
 
 func (svc *service) verifier(next http.Handler) http.Handler {
@@ -101,13 +247,29 @@ func (svc *service) verifier(next http.Handler) http.Handler {
 		kind := chi.URLParam(r, rateableTypeParam)
 		rKey := chi.URLParam(r, rateableKeyParam)
 
-		if !verify(svc.db, kind) {
+		found, err := verify(svc.db, kind)
+		if err != nil {
+			svc.respondWithMsg(w, dbUnavailableErr, http.StatusServiceUnavailable)
+			svc.logger.Error("could not verify rateable type", zap.Error(err), zap.String(rateableTypeParam, kind))
+			return
+		}
+
+		if !found {
 			svc.respondWithMsg(w, fmt.Sprintf(rateableTypeNotFoundFmt, kind), http.StatusNotAcceptable)
 			svc.logger.Warn("could not verify rateable type", zap.String(rateableTypeParam, kind))
 			return
 		}
 
-		rt := &rateable{db: svc.db, kind: kind, key: rKey}
+		// the aggregate and export routes are of the whole type, without a key
+		if hasURLParam(r, rateableKeyParam) {
+			if err := checkKey(rKey, svc.config().MaxKeyLength, svc.config().ReservedKeys); err != nil {
+				svc.respondWithMsg(w, fmt.Sprintf(rateableKeyInvalidFmt, err), http.StatusBadRequest)
+				svc.logger.Warn("invalid rateable key", zap.Error(err), zap.String(rateableKeyParam, rKey))
+				return
+			}
+		}
+
+		rt := &rateable{db: svc.db, kind: kind, key: rKey, mustExist: !svc.cfg.AutoCreateResources}
 		ctx := context.WithValue(r.Context(), key(rKey), rt)
 		r = r.WithContext(ctx)
 
@@ -117,6 +279,119 @@ func (svc *service) verifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// hasURLParam reports whether the matched route has the url param, even if it is empty
+func hasURLParam(r *http.Request, name string) bool {
+	for _, k := range chi.RouteContext(r.Context()).URLParams.Keys {
+		if k == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validator validates that a resource of the given key exists for the given resource kind
+func (svc *service) validator(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		kind := chi.URLParam(r, rateableTypeParam)
+		rKey := chi.URLParam(r, rateableKeyParam)
+
+		rte := &rateable{db: svc.db, kind: kind, key: rKey}
+		found, err := rte.exists()
+		if err != nil {
+			svc.respondWithMsg(w, dbUnavailableErr, http.StatusServiceUnavailable)
+			svc.logger.Error("could not validate rateable", zap.Error(err),
+				zap.String(rateableKeyParam, rte.key),
+				zap.String(rateableTypeParam, rte.kind))
+			return
+		}
+
+		if !found {
+			svc.respondWithMsg(w, fmt.Sprintf(rateableNotFoundFmt, rte.kind, rte.key), http.StatusNotFound)
+			svc.logger.Warn("could not validate rateable",
+				zap.String(rateableKeyParam, rte.key),
+				zap.String(rateableTypeParam, rte.kind))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// secureHeaders sets headers hardening the responses against being sniffed or framed by browsers
+func (svc *service) secureHeaders(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Del("Server")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		if svc.cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", svc.cfg.ContentSecurityPolicy)
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// redirectSlashes permanently redirects paths with a trailing slash to the same path without it,
+// so that clients adding one still reach the routes. 308 keeps the method and body of the request.
+// The pprof index is left alone since its links are relative to its trailing slash.
+func (svc *service) redirectSlashes(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") && r.URL.Path != pprofPrefix+"/" {
+			// leading slashes are collapsed too, as browsers follow //evil.com, or /\evil.com, to another host
+			p := "/" + strings.TrimLeft(strings.TrimRight(r.URL.Path, "/"), `/\`)
+			u := url.URL{Path: p, RawQuery: r.URL.RawQuery}
+
+			http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// readOnly rejects mutating requests with a 503 while the service is in read-only mode
+func (svc *service) readOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if svc.cfg.ReadOnly {
+				svc.respondWithMsg(w, serviceReadOnlyErr, http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// respondWithStoreErr responds to a failed db operation. Failures of the db itself, see isDBUnavailable,
+// are reported as 503 so clients know to retry, while every other failure is reported with the given
+// message and status code
+func (svc *service) respondWithStoreErr(w http.ResponseWriter, err error, msg string, code int) {
+	if isDBUnavailable(err) {
+		msg, code = dbUnavailableErr, http.StatusServiceUnavailable
+	}
+
+	svc.respondWithMsg(w, msg, code)
+}
+
+// isDBUnavailable tells whether the db could not be used at all, i.e. it is closed or its file is locked by
+// another process. Neither passes by retrying the operation within the service, bolt runs writes one at
+// a time without ever timing out, but another instance may still serve the request.
+func isDBUnavailable(err error) bool {
+	return err == bolt.ErrTimeout || err == bolt.ErrDatabaseNotOpen
+}
+
 func (svc *service) respondWithMsg(w http.ResponseWriter, msg string, code int) {
 	payload := struct {
 		Message string `json:"message"`
@@ -126,7 +401,13 @@ func (svc *service) respondWithMsg(w http.ResponseWriter, msg string, code int)
 }
 
 func (svc *service) respondWithPayload(w http.ResponseWriter, payload interface{}, code int) {
-	data, err := json.Marshal(payload)
+	var data []byte
+	var err error
+	if _, pretty := w.(prettyWriter); pretty {
+		data, err = json.MarshalIndent(payload, "", "  ")
+	} else {
+		data, err = json.Marshal(payload)
+	}
 	if err != nil {
 		code = http.StatusInternalServerError
 		data = []byte(`{"message":"failed to prepare response. Please try again"}`)
@@ -5,13 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/boltdb/bolt"
 	"github.com/go-chi/chi"
+	"github.com/kelseyhightower/envconfig"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -20,39 +24,92 @@ var buildResp = func(msg string) string {
 	return fmt.Sprintf(`{"message":"%s"}`, msg)
 }
 
+// testConfig returns the config with its defaults applied
+func testConfig() config {
+	var cfg config
+	if err := envconfig.Process("library_test", &cfg); err != nil {
+		panic(err)
+	}
+
+	return cfg
+}
+
 func Test_service_handlerPut(t *testing.T) {
 	t.Parallel()
 
 	kind := "posts"
 	key := "my-key"
 	tests := []struct {
-		name     string
-		path     string
-		payload  []byte
-		wantCode int
+		name              string
+		path              string
+		payload           []byte
+		disableAutoCreate bool
+		maxStars          int64
+		wantCode          int
 	}{
 		{
 			name:     "it does not add the rating if the payload is invalid",
 			payload:  []byte(`{"five_stars": "4}`),
-			path:     fmt.Sprintf("/%s/%s/ratings", kind, key),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "it does not add the rating if its fields do not match the schema",
+			payload:  []byte(`{"five_stars": 1.5, "sixStars": 1}`),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
 			wantCode: http.StatusBadRequest,
 		},
 		{
 			name:     "it does not add the rating if resourceType does not exists",
 			payload:  []byte(`{"five_stars": 4}`),
-			path:     fmt.Sprintf("/unknownResourceType/%s/ratings", key),
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/ratings", key),
 			wantCode: http.StatusNotAcceptable,
 		},
 		{
 			name:     "it creates resource and adds the rating if resource does not exist",
 			payload:  []byte(`{"five_stars": 4}`),
-			path:     fmt.Sprintf("/%s/another-key/ratings", kind),
+			path:     fmt.Sprintf("/v1/%s/another-key/ratings", kind),
 			wantCode: http.StatusOK,
 		},
 		{
 			name:     "it adds the rating to the resource if not empty",
 			payload:  []byte(`{"five_stars": 4}`),
-			path:     fmt.Sprintf("/%s/%s/ratings", kind, key),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:              "it does not create the resource if auto create is disabled",
+			payload:           []byte(`{"five_stars": 4}`),
+			path:              fmt.Sprintf("/v1/%s/another-key/ratings", kind),
+			disableAutoCreate: true,
+			wantCode:          http.StatusNotFound,
+		},
+		{
+			name:              "it adds the rating to an existing resource if auto create is disabled",
+			payload:           []byte(`{"five_stars": 4}`),
+			path:              fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			disableAutoCreate: true,
+			wantCode:          http.StatusOK,
+		},
+		{
+			name:     "it does not add the rating if a star level is over the max",
+			payload:  []byte(`{"five_stars": 9999999999}`),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			maxStars: 100,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "it does not add the rating if a star level is under the negative max",
+			payload:  []byte(`{"five_stars": 1, "one_stars": -2}`),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			maxStars: 1,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "it adds the rating at the max",
+			payload:  []byte(`{"five_stars": 1, "one_stars": 1}`),
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			maxStars: 1,
 			wantCode: http.StatusOK,
 		},
 	}
@@ -73,8 +130,14 @@ func Test_service_handlerPut(t *testing.T) {
 			})
 			assert.NoError(t, err)
 
+			cfg := testConfig()
+			cfg.AutoCreateResources = !tt.disableAutoCreate
+			if tt.maxStars != 0 {
+				cfg.MaxStarsPerPut = tt.maxStars
+			}
+
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), cfg)
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
@@ -87,6 +150,86 @@ func Test_service_handlerPut(t *testing.T) {
 	}
 }
 
+func Test_service_registerRoutes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	key := "my-key"
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
+
+		_, err = b.CreateBucket([]byte(key))
+		return err
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		prefix   string
+		path     string
+		wantCode int
+	}{
+		{
+			name:     "it serves the api routes under the prefix",
+			prefix:   "/v1",
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it does not serve the api routes outside the prefix",
+			prefix:   "/v1",
+			path:     fmt.Sprintf("/%s/%s/ratings", kind, key),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "it serves the api routes under a custom prefix",
+			prefix:   "/api/v2",
+			path:     fmt.Sprintf("/api/v2/%s/%s/ratings", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the api routes from the root if the prefix is empty",
+			path:     fmt.Sprintf("/%s/%s/ratings", kind, key),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it serves the status route from the root",
+			prefix:   "/v1",
+			path:     "/status",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "it does not serve the status route under the prefix",
+			prefix:   "/v1",
+			path:     "/v1/status",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.APIPrefix = tt.prefix
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			mux.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
 func Test_service_handleGet(t *testing.T) {
 	t.Parallel()
 
@@ -123,6 +266,8 @@ func Test_service_handleGet(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
+	percentages := `{"five_stars":6.666666666666667,"four_stars":13.333333333333334,"three_stars":20,` +
+		`"two_stars":26.666666666666668,"one_stars":33.333333333333336}`
 	tests := []struct {
 		name     string
 		path     string
@@ -131,20 +276,20 @@ func Test_service_handleGet(t *testing.T) {
 	}{
 		{
 			name:     "it responds with error if rateableType does not exists",
-			path:     fmt.Sprintf("/unknownResourceType/%s/ratings", key),
+			path:     fmt.Sprintf("/v1/unknownResourceType/%s/ratings", key),
 			want:     buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknownResourceType")),
 			wantCode: http.StatusNotAcceptable,
 		},
 		{
-			name:     "it responds with error if rating for resource with key does not exist",
-			path:     fmt.Sprintf("/%s/another-key/ratings", kind),
-			want:     buildResp(ratingFetchErr),
-			wantCode: http.StatusBadRequest,
+			name:     "it responds with not found if resource with key does not exist",
+			path:     fmt.Sprintf("/v1/%s/another-key/ratings", kind),
+			want:     buildResp(ratingNotFoundErr),
+			wantCode: http.StatusNotFound,
 		},
 		{
-			name:     "it responds with the rating",
-			path:     fmt.Sprintf("/%s/%s/ratings", kind, key),
-			want:     string(data),
+			name:     "it responds with the rating, its median and star percentages",
+			path:     fmt.Sprintf("/v1/%s/%s/ratings", kind, key),
+			want:     strings.TrimSuffix(string(data), "}") + `,"median":2,"percentages":` + percentages + "}",
 			wantCode: http.StatusOK,
 		},
 	}
@@ -152,7 +297,7 @@ func Test_service_handleGet(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mux := chi.NewRouter()
-			svc := newService(db, zap.NewNop())
+			svc := newService(db, zap.NewNop(), testConfig())
 			svc.registerRoutes(mux)
 
 			w := httptest.NewRecorder()
@@ -170,10 +315,17 @@ func Test_servicer_verifier(t *testing.T) {
 	t.Parallel()
 
 	kind := "posts"
+	createKind := func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(kind))
+		return err
+	}
+
 	tests := []struct {
 		name      string
 		setupFunc func(*bolt.Tx) error
 		kind      string
+		withKey   bool // whether the route has a key param
+		key       string
 		wantBody  string
 		pass      bool
 	}{
@@ -183,12 +335,130 @@ func Test_servicer_verifier(t *testing.T) {
 			wantBody: buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, kind)),
 		},
 		{
-			name: "it passes on the request if the rateable type exists",
-			kind: kind,
+			name:      "it passes on the request if the rateable type exists",
+			kind:      kind,
+			setupFunc: createKind,
+			pass:      true,
+		},
+		{
+			name:      "it passes on the request if the key is valid",
+			kind:      kind,
+			withKey:   true,
+			key:       strings.Repeat("k", 128),
+			setupFunc: createKind,
+			pass:      true,
+		},
+		{
+			name:      "it returns error if the key is empty",
+			kind:      kind,
+			withKey:   true,
+			setupFunc: createKind,
+			wantBody:  buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key is empty")),
+		},
+		{
+			name:      "it returns error if the key is too long",
+			kind:      kind,
+			withKey:   true,
+			key:       strings.Repeat("k", 129),
+			setupFunc: createKind,
+			wantBody:  buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key is longer than 128 bytes")),
+		},
+		{
+			name:      "it returns error if the key contains control characters",
+			kind:      kind,
+			withKey:   true,
+			key:       "my\x00key",
+			setupFunc: createKind,
+			wantBody:  buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key contains control characters")),
+		},
+		{
+			name:      "it returns error if the key is reserved",
+			kind:      kind,
+			withKey:   true,
+			key:       "internal-1234",
+			setupFunc: createKind,
+			wantBody:  buildResp(fmt.Sprintf(rateableKeyInvalidFmt, "key matches the reserved pattern internal-*")),
+		},
+		{
+			name:      "it passes on the request if the key is not reserved",
+			kind:      kind,
+			withKey:   true,
+			key:       "my-internal-1234",
+			setupFunc: createKind,
+			pass:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupDB()
+			defer cleanup(db)
+
+			if tt.setupFunc != nil {
+				assert.NoError(t, db.Update(tt.setupFunc))
+			}
+
+			cfg := testConfig()
+			cfg.ReservedKeys = keyPatterns{"internal-*"}
+			svc := &service{logger: zap.NewNop(), db: db, cfg: cfg}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add(rateableTypeParam, tt.kind)
+			if tt.withKey {
+				rctx.URLParams.Add(rateableKeyParam, tt.key)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handler := svc.verifier(http.HandlerFunc(fn))
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.pass, passed)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_service_validator(t *testing.T) {
+	t.Parallel()
+
+	key := "my-key"
+	kind := "posts"
+	errMsg := buildResp(fmt.Sprintf(rateableNotFoundFmt, kind, key))
+	tests := []struct {
+		name      string
+		setupFunc func(*bolt.Tx) error
+		wantBody  string
+		pass      bool
+	}{
+		{
+			name:     "it returns error if resource type does not exist",
+			wantBody: errMsg,
+		},
+		{
+			name: "it returns error if resource does not exist",
 			setupFunc: func(tx *bolt.Tx) error {
 				_, err := tx.CreateBucket([]byte(kind))
 				return err
 			},
+			wantBody: errMsg,
+		},
+		{
+			name: "it passes on the request if the resource exists",
+			setupFunc: func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucket([]byte(kind))
+				if err != nil {
+					return err
+				}
+
+				_, err = b.CreateBucket([]byte(key))
+				return err
+			},
 			pass: true,
 		},
 	}
@@ -209,20 +479,326 @@ func Test_servicer_verifier(t *testing.T) {
 			}
 
 			rctx := chi.NewRouteContext()
-			rctx.URLParams.Add(rateableTypeParam, tt.kind)
+			rctx.URLParams.Add(rateableTypeParam, kind)
+			rctx.URLParams.Add(rateableKeyParam, key)
 			r := httptest.NewRequest(http.MethodGet, "/", nil)
 			w := httptest.NewRecorder()
 			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
 
-			handler := svc.verifier(http.HandlerFunc(fn))
+			handler := svc.validator(http.HandlerFunc(fn))
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.pass, passed)
+			assert.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
+
+func Test_service_readOnly(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		readOnly bool
+		method   string
+		wantBody string
+		pass     bool
+	}{
+		{
+			name:     "it passes on reads when read-only",
+			method:   http.MethodGet,
+			readOnly: true,
+			pass:     true,
+		},
+		{
+			name:     "it rejects POST when read-only",
+			method:   http.MethodPost,
+			readOnly: true,
+			wantBody: buildResp(serviceReadOnlyErr),
+		},
+		{
+			name:     "it rejects PUT when read-only",
+			method:   http.MethodPut,
+			readOnly: true,
+			wantBody: buildResp(serviceReadOnlyErr),
+		},
+		{
+			name:     "it rejects PATCH when read-only",
+			method:   http.MethodPatch,
+			readOnly: true,
+			wantBody: buildResp(serviceReadOnlyErr),
+		},
+		{
+			name:     "it rejects DELETE when read-only",
+			method:   http.MethodDelete,
+			readOnly: true,
+			wantBody: buildResp(serviceReadOnlyErr),
+		},
+		{
+			name:   "it passes on writes when not read-only",
+			method: http.MethodPost,
+			pass:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{ReadOnly: tt.readOnly}}
+
+			var passed bool
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				passed = true
+			}
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			w := httptest.NewRecorder()
+
+			handler := svc.readOnly(http.HandlerFunc(fn))
 			handler.ServeHTTP(w, r)
 
 			assert.Equal(t, tt.pass, passed)
 			assert.Equal(t, tt.wantBody, w.Body.String())
+			if !tt.pass {
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			}
+		})
+	}
+}
+
+func Test_service_secureHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		csp     string
+		wantCSP string
+	}{
+		{
+			name:    "it sets the configured content security policy",
+			csp:     "default-src 'none'",
+			wantCSP: "default-src 'none'",
+		},
+		{
+			name: "it leaves out the content security policy if not configured",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop(), cfg: config{ContentSecurityPolicy: tt.csp}}
+
+			fn := func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "OK")
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+			w.Header().Set("Server", "library")
+
+			handler := svc.secureHeaders(http.HandlerFunc(fn))
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+			assert.Equal(t, tt.wantCSP, w.Header().Get("Content-Security-Policy"))
+			assert.Empty(t, w.Header().Get("Server"))
+		})
+	}
+}
+
+func Test_service_respondWithStoreErr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "it responds with 503 if the db is locked",
+			err:      bolt.ErrTimeout,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: buildResp(dbUnavailableErr),
+		},
+		{
+			name:     "it responds with 503 if the db is not open",
+			err:      bolt.ErrDatabaseNotOpen,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: buildResp(dbUnavailableErr),
+		},
+		{
+			name:     "it responds with the given message and code for other errors",
+			err:      fmt.Errorf("some error"),
+			wantCode: http.StatusInternalServerError,
+			wantBody: buildResp("something went wrong"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			svc := &service{}
+			svc.respondWithStoreErr(w, tt.err, "something went wrong", http.StatusInternalServerError)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantBody, w.Body.String())
 		})
 	}
 }
 
+func Test_service_handleGet_dbUnavailable(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	cleanup(db)
+
+	c := &rateable{db: db, kind: "posts", key: "my-key"}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(rateableTypeParam, c.kind)
+	rctx.URLParams.Add(rateableKeyParam, c.key)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	r = r.WithContext(context.WithValue(ctx, key(c.key), c))
+	w := httptest.NewRecorder()
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.handleGet(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildResp(dbUnavailableErr), w.Body.String())
+}
+
+func Test_service_routes_dbUnavailable(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	assert.NoError(t, setup(db, []string{"posts"}))
+	cleanup(db)
+
+	cfg := testConfig()
+	cfg.AutoCreateResources = false
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), cfg)
+	svc.registerRoutes(mux)
+
+	// the verifier fails with the db rather than telling the type is not found
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/posts/my-key/ratings", nil)
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildResp(dbUnavailableErr), w.Body.String())
+
+	// and so does the validator rather than telling the rateable is not found
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(rateableTypeParam, "posts")
+	rctx.URLParams.Add(rateableKeyParam, "my-key")
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+
+	svc.validator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the next handler should not be called")
+	})).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, buildResp(dbUnavailableErr), w.Body.String())
+}
+
+func Test_service_handlePut_mustExist(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	// as if the rateable was removed after the validator let the request through
+	c := &rateable{db: db, kind: "posts", key: "my-key", mustExist: true}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(rateableTypeParam, c.kind)
+	rctx.URLParams.Add(rateableKeyParam, c.key)
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{"five_stars": 1}`))
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	r = r.WithContext(context.WithValue(ctx, key(c.key), c))
+	w := httptest.NewRecorder()
+
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.handlePut(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, buildResp(fmt.Sprintf(rateableNotFoundFmt, c.kind, c.key)), w.Body.String())
+	found, err := c.exists()
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func Test_service_handlePut_echo(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+
+	// a rating sent back as it was got, along with the fields only found in responses
+	body := `{"five_stars": 1, "submissions": 7, "median": 5, "percentages": {"five_stars": 100}}`
+	r := httptest.NewRequest(http.MethodPut, "/v1/posts/my-key/ratings", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	got, err := (&rateable{db: db, kind: "posts", key: "my-key"}).get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FiveStars: 1, Submissions: 1}, got)
+}
+
+func Test_service_handlePut_concurrent(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+	assert.NoError(t, setup(db, []string{"posts"}))
+
+	mux := chi.NewRouter()
+	svc := newService(db, zap.NewNop(), testConfig())
+	svc.registerRoutes(mux)
+
+	// every vote is read, added to and written back, so any lost update shows in the totals
+	const puts = 50
+	var wg sync.WaitGroup
+	codes := make(chan int, puts)
+	for i := 0; i < puts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body := fmt.Sprintf(`{"five_stars": 1, "two_stars": %d}`, i%3)
+			r := httptest.NewRequest(http.MethodPut, "/v1/posts/my-key/ratings", strings.NewReader(body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			codes <- w.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	var wantTwoStars int64
+	for i := 0; i < puts; i++ {
+		wantTwoStars += int64(i % 3)
+	}
+
+	got, err := (&rateable{db: db, kind: "posts", key: "my-key"}).get()
+	assert.NoError(t, err)
+	assert.Equal(t, &rating{FiveStars: puts, TwoStars: wantTwoStars, Submissions: puts}, got)
+}
+
 func Test_respondWithMsg(t *testing.T) {
 	t.Parallel()
 
@@ -299,3 +875,131 @@ func Test_respondWithPayload(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_handleAggregate(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	assert.NoError(t, setup(db, []string{kind}))
+	for _, key := range []string{"one", "two"} {
+		rt := &rateable{db: db, kind: kind, key: key}
+		_, err := rt.save(rating{FiveStars: 1, FourStars: 1})
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "it responds with error if rateableType does not exists",
+			path:     "/v1/unknownResourceType/ratings/aggregate",
+			wantCode: http.StatusNotAcceptable,
+			want:     buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknownResourceType")),
+		},
+		{
+			name:     "it responds with the combined rating of the type",
+			path:     fmt.Sprintf("/v1/%s/ratings/aggregate", kind),
+			wantCode: http.StatusOK,
+			want: `{"five_stars":2,"four_stars":2,"three_stars":0,"two_stars":0,"one_stars":0,"submissions":2,` +
+				`"average":4.5,"votes":4,"resources":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func Test_service_redirectSlashes(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	assert.NoError(t, setup(db, []string{"posts"}))
+	_, err := (&rateable{db: db, kind: "posts", key: "1"}).save(rating{FiveStars: 1})
+	assert.NoError(t, err)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/v1/posts/1/ratings"},
+		{http.MethodPut, "/v1/posts/1/ratings"},
+		{http.MethodGet, "/v1/posts/ratings/aggregate"},
+		{http.MethodGet, "/v1/posts/ratings.csv"},
+		{http.MethodGet, "/v1/posts/1/summary"},
+		{http.MethodGet, "/status"},
+		{http.MethodGet, "/metrics"},
+	}
+
+	for _, rt := range routes {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), testConfig())
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(rt.method, rt.path+"/?pretty=true", bytes.NewBufferString(`{"five_stars":1}`))
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code, "the trailing slash should be redirected")
+			assert.Equal(t, rt.path+"?pretty=true", w.Header().Get("Location"))
+
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(rt.method, rt.path, bytes.NewBufferString(`{"five_stars":1}`))
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code, "the path without the trailing slash should be served")
+		})
+	}
+}
+
+func Test_service_redirectSlashes_sameHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "//evil.com/", want: "/evil.com"},
+		{path: "/%2Fevil.com/", want: "/evil.com"},
+		{path: "///evil.com//", want: "/evil.com"},
+		{path: "/%5Cevil.com/", want: "/evil.com"},
+		{path: "/%2F%5Cevil.com/", want: "/evil.com"},
+		{path: "//", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			svc := &service{logger: zap.NewNop()}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the request should be redirected")
+			})
+
+			w := httptest.NewRecorder()
+			svc.redirectSlashes(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"), "the redirect should stay on the host")
+		})
+	}
+}
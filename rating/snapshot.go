@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"go.uber.org/zap"
+)
+
+// snapshotVersion is the version of the snapshot format, snapshots of other versions are rejected
+const snapshotVersion = 1
+
+// snapshot is a portable copy of the whole db, e.g. to migrate between environments where copying
+// the bolt file is not an option. Keys and values are kept as bytes, i.e. base64 in json, as bolt
+// keys and values need not be text, e.g. the sequence keys of the audit trail.
+type snapshot struct {
+	Version int             `json:"version"`
+	Buckets []snapshotEntry `json:"buckets"`
+}
+
+// snapshotEntry is a key of a bucket along with either its value or its nested bucket
+type snapshotEntry struct {
+	Key    []byte          `json:"key"`
+	Value  []byte          `json:"value,omitempty"`
+	Bucket *snapshotBucket `json:"bucket,omitempty"`
+}
+
+type snapshotBucket struct {
+	Sequence uint64          `json:"sequence,omitempty"`
+	Entries  []snapshotEntry `json:"entries"`
+}
+
+const (
+	snapshotExportErr  = "could not export the db"
+	snapshotImportErr  = "could not import the snapshot"
+	snapshotInvalidErr = "snapshot could not be parsed"
+)
+
+// handleExportSnapshot streams a snapshot of the whole db as json
+func (svc *service) handleExportSnapshot(w http.ResponseWriter, r *http.Request) {
+	var written bool
+	err := svc.db.View(func(tx *bolt.Tx) error {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="ratings-snapshot.json"`)
+		written = true
+
+		return writeSnapshot(tx, w)
+	})
+
+	if err != nil && !written {
+		svc.respondWithStoreErr(w, err, snapshotExportErr, http.StatusInternalServerError)
+	}
+
+	if err != nil {
+		// the export is cut short if it fails midway as the status has already been sent
+		svc.logger.Error(snapshotExportErr, zap.Error(err))
+	}
+}
+
+// handleImportSnapshot restores the buckets of a snapshot made by handleExportSnapshot
+func (svc *service) handleImportSnapshot(w http.ResponseWriter, r *http.Request) {
+	var s snapshot
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		svc.respondWithMsg(w, snapshotInvalidErr, http.StatusBadRequest)
+		svc.logger.Error(snapshotInvalidErr, zap.Error(err))
+		return
+	}
+
+	if err := s.validate(); err != nil {
+		svc.respondWithMsg(w, err.Error(), http.StatusUnprocessableEntity)
+		svc.logger.Error(snapshotInvalidErr, zap.Error(err))
+		return
+	}
+
+	n, err := restoreSnapshot(svc.db, &s)
+	if err != nil {
+		svc.respondWithStoreErr(w, err, snapshotImportErr, http.StatusInternalServerError)
+		svc.logger.Error(snapshotImportErr, zap.Error(err))
+		return
+	}
+
+	// the cached ratings may have been replaced
+	svc.cache.clear()
+
+	svc.logger.Info("imported snapshot", zap.Int("written", n))
+	svc.respondWithPayload(w, struct {
+		Written int `json:"written"`
+	}{n}, http.StatusOK)
+}
+
+// writeSnapshot streams the snapshot of the db as seen by tx to w, one key at a time,
+// so that the db is never held in memory as a whole
+func writeSnapshot(tx *bolt.Tx, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"version":%d,"buckets":[`, snapshotVersion)
+
+	first := true
+	err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+
+		return writeSnapshotEntry(bw, name, nil, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	bw.WriteString("]}")
+	return bw.Flush()
+}
+
+// writeSnapshotEntry writes the key with its value, or with its nested bucket if b is set
+func writeSnapshotEntry(w *bufio.Writer, k, v []byte, b *bolt.Bucket) error {
+	key, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	w.WriteString(`{"key":`)
+	w.Write(key)
+
+	if b == nil {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		w.WriteString(`,"value":`)
+		w.Write(value)
+		return w.WriteByte('}')
+	}
+
+	fmt.Fprintf(w, `,"bucket":{"sequence":%d,"entries":[`, b.Sequence())
+	first := true
+	err = b.ForEach(func(k, v []byte) error {
+		if !first {
+			w.WriteByte(',')
+		}
+		first = false
+
+		if v == nil {
+			return writeSnapshotEntry(w, k, nil, b.Bucket(k))
+		}
+		return writeSnapshotEntry(w, k, v, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteString("]}}")
+	return err
+}
+
+// validate checks that the snapshot can be restored as a whole before anything is written
+func (s *snapshot) validate() error {
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, snapshotVersion)
+	}
+
+	for _, e := range s.Buckets {
+		if e.Bucket == nil {
+			return fmt.Errorf("top level key %q is not a bucket", e.Key)
+		}
+	}
+
+	return validateEntries(s.Buckets)
+}
+
+func validateEntries(entries []snapshotEntry) error {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		switch {
+		case len(e.Key) == 0:
+			return errors.New("snapshot has an empty key")
+		case seen[string(e.Key)]:
+			return fmt.Errorf("key %q is in the snapshot more than once", e.Key)
+		case (e.Value == nil) == (e.Bucket == nil):
+			return fmt.Errorf("key %q should have either a value or a bucket", e.Key)
+		}
+		seen[string(e.Key)] = true
+
+		if e.Bucket != nil {
+			if err := validateEntries(e.Bucket.Entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreSnapshot writes the buckets of the snapshot in one transaction, each replacing the bucket
+// of the same name. Buckets that are not in the snapshot are left as they are.
+// It returns how many keys were written, including those of the buckets.
+func restoreSnapshot(db *bolt.DB, s *snapshot) (int, error) {
+	var written int
+	err := db.Update(func(tx *bolt.Tx) error {
+		written = 0
+		for _, e := range s.Buckets {
+			if tx.Bucket(e.Key) != nil {
+				if err := tx.DeleteBucket(e.Key); err != nil {
+					return err
+				}
+			}
+
+			b, err := tx.CreateBucket(e.Key)
+			if err != nil {
+				return err
+			}
+
+			n, err := restoreBucket(b, e.Bucket)
+			written += n + 1
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return written, err
+}
+
+func restoreBucket(b *bolt.Bucket, sb *snapshotBucket) (int, error) {
+	if err := b.SetSequence(sb.Sequence); err != nil {
+		return 0, err
+	}
+
+	var written int
+	for _, e := range sb.Entries {
+		if e.Bucket == nil {
+			if err := b.Put(e.Key, e.Value); err != nil {
+				return written, err
+			}
+			written++
+			continue
+		}
+
+		nested, err := b.CreateBucket(e.Key)
+		if err != nil {
+			return written, err
+		}
+
+		n, err := restoreBucket(nested, e.Bucket)
+		written += n + 1
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// dbStatus describes the bolt file, e.g. for operators to watch for runaway growth before compacting it
+type dbStatus struct {
+	Path  string `json:"path"`
+	Size  *int64 `json:"size,omitempty"`  // in bytes, left out if the file could not be stat'ed
+	Error string `json:"error,omitempty"` // why the file could not be stat'ed
+}
+
+// handleStatus responds with OK along with the status of the db. Failing to stat the db file
+// is reported in the payload rather than failing the check, as the service can still serve.
+func (svc *service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	db := dbStatus{Path: svc.db.Path()}
+	fi, err := os.Stat(db.Path)
+	if err != nil {
+		svc.logger.Warn("failed to stat the db file", zap.Error(err), zap.String("path", db.Path))
+		db.Error = err.Error()
+	} else {
+		size := fi.Size()
+		db.Size = &size
+	}
+
+	svc.respondWithPayload(w, struct {
+		Status string   `json:"status"`
+		DB     dbStatus `json:"db"`
+	}{"OK", db}, http.StatusOK)
+}
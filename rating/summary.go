@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+const ratingSummaryErr = "could not summarize the resource"
+
+// commentTotalCountHeader holds the number of comments on a resource in the lists of the comment service
+const commentTotalCountHeader = "X-Total-Count"
+
+// summary combines the comments and the rating of a resource
+type summary struct {
+	// nil when the comment service is not configured or could not be reached
+	CommentCount *int          `json:"comment_count"`
+	Rating       ratingSummary `json:"rating"`
+}
+
+// ratingSummary is a rating along with its average, only one of rating or camelRating is set
+type ratingSummary struct {
+	*rating
+	*camelRating
+	Submissions int64   `json:"submissions"` // named alike in either naming, so the embedded ones would cancel out
+	Average     float64 `json:"average"`
+}
+
+// handleSummary responds with the rating of the resource along with its number of comments,
+// which is fetched from the comment service when one is configured
+func (svc *service) handleSummary(w http.ResponseWriter, r *http.Request) {
+	k := chi.URLParam(r, rateableKeyParam)
+	rte := r.Context().Value(key(k)).(*rateable)
+	l := svc.logger.With(
+		zap.String(rateableKeyParam, rte.key),
+		zap.String(rateableTypeParam, rte.kind),
+	)
+
+	rt, err := svc.getRating(rte)
+	if _, notRated := err.(rateableNotFoundError); notRated {
+		rt, err = &rating{}, nil
+	}
+
+	if err != nil {
+		svc.respondWithStoreErr(w, err, ratingSummaryErr, http.StatusInternalServerError)
+		l.Error(ratingSummaryErr, zap.Error(err))
+		return
+	}
+
+	s := summary{Rating: svc.summarize(rt)}
+	if svc.cfg.CommentServiceURL != "" {
+		count, err := svc.countComments(r.Context(), rte.kind, rte.key)
+		if err != nil {
+			// the rating is still useful without the comments so the summary is sent without them
+			l.Warn("could not count comments", zap.Error(err))
+		} else {
+			s.CommentCount = &count
+		}
+	}
+
+	if svc.cfg.FieldNaming == fieldNamingCamel {
+		svc.respondWithPayload(w, camelSummary(s), http.StatusOK)
+		return
+	}
+
+	svc.respondWithPayload(w, s, http.StatusOK)
+}
+
+// countComments fetches the number of comments on the resource from the comment service. It is read from
+// the X-Total-Count header of the list, as the list itself is a page of the comments and may not even be
+// wrapped in an object, see LISTENVELOPE, so only the smallest page is asked for.
+func (svc *service) countComments(ctx context.Context, kind, rKey string) (int, error) {
+	u := fmt.Sprintf("%s/%s/%s/comments?limit=1", svc.cfg.CommentServiceURL, url.PathEscape(kind), url.PathEscape(rKey))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := svc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// the comment service has not seen the resource yet
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("comment service responded with %d", resp.StatusCode)
+	}
+
+	count, err := strconv.Atoi(resp.Header.Get(commentTotalCountHeader))
+	if err != nil {
+		return 0, fmt.Errorf("comment service responded without a valid %s: %v", commentTotalCountHeader, err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_service_handleSummary(t *testing.T) {
+	t.Parallel()
+
+	db := setupDB()
+	defer cleanup(db)
+
+	kind := "posts"
+	key := "my-key"
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(kind))
+		if err != nil {
+			return err
+		}
+
+		cb, err := b.CreateBucket([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(rating{FiveStars: 1, OneStars: 1})
+		if err != nil {
+			return err
+		}
+		return cb.Put(ratingsKey, data)
+	})
+	assert.NoError(t, err)
+
+	// comments stands in for the comment service, which only lists a page of the comments
+	comments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/v1/%s/%s/comments", kind, key):
+			w.Header().Set(commentTotalCountHeader, "2")
+			io.WriteString(w, `{"comments":[{"id":"1","value":"a"}]}`)
+		case fmt.Sprintf("/v1/%s/popular-key/comments", kind):
+			// more comments than fit a page, listed without an envelope
+			w.Header().Set(commentTotalCountHeader, "75")
+			io.WriteString(w, `[`+strings.TrimSuffix(strings.Repeat(`{"id":"1","value":"a"},`, 50), ",")+`]`)
+		case fmt.Sprintf("/v1/%s/no-count-key/comments", kind):
+			io.WriteString(w, `{"comments":[]}`)
+		case fmt.Sprintf("/v1/%s/unknown-key/comments", kind):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer comments.Close()
+
+	rated := `"rating":{"five_stars":1,"four_stars":0,"three_stars":0,"two_stars":0,"one_stars":1,"submissions":0,"average":3}`
+	unrated := `"rating":{"five_stars":0,"four_stars":0,"three_stars":0,"two_stars":0,"one_stars":0,"submissions":0,"average":0}`
+	tests := []struct {
+		name       string
+		path       string
+		commentURL string
+		noCreate   bool
+		wantCode   int
+		want       string
+	}{
+		{
+			name:       "it responds with error if rateableType does not exists",
+			path:       fmt.Sprintf("/v1/unknownResourceType/%s/summary", key),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusNotAcceptable,
+			want:       buildResp(fmt.Sprintf(rateableTypeNotFoundFmt, "unknownResourceType")),
+		},
+		{
+			name:       "it responds with the rating and the number of comments",
+			path:       fmt.Sprintf("/v1/%s/%s/summary", kind, key),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":2,%s}`, rated),
+		},
+		{
+			name:       "it responds with the number of comments beyond a page",
+			path:       fmt.Sprintf("/v1/%s/popular-key/summary", kind),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":75,%s}`, unrated),
+		},
+		{
+			name:       "it responds without the number of comments if the comment service does not tell it",
+			path:       fmt.Sprintf("/v1/%s/no-count-key/summary", kind),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":null,%s}`, unrated),
+		},
+		{
+			name:       "it responds with an empty summary if the resource is unknown to both services",
+			path:       fmt.Sprintf("/v1/%s/unknown-key/summary", kind),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":0,%s}`, unrated),
+		},
+		{
+			name:       "it responds without the number of comments if the comment service fails",
+			path:       fmt.Sprintf("/v1/%s/%s/summary", kind, key),
+			commentURL: comments.URL + "/broken",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":null,%s}`, rated),
+		},
+		{
+			name:       "it responds with the summary nested under the ratings too",
+			path:       fmt.Sprintf("/v1/%s/%s/ratings/summary", kind, key),
+			commentURL: comments.URL + "/v1",
+			wantCode:   http.StatusOK,
+			want:       fmt.Sprintf(`{"comment_count":2,%s}`, rated),
+		},
+		{
+			name:     "it validates the resource of the nested summary like its rating",
+			path:     fmt.Sprintf("/v1/%s/unknown-key/ratings/summary", kind),
+			noCreate: true,
+			wantCode: http.StatusNotFound,
+			want:     buildResp(fmt.Sprintf(rateableNotFoundFmt, kind, "unknown-key")),
+		},
+		{
+			name:     "it responds without the number of comments if the comment service is not configured",
+			path:     fmt.Sprintf("/v1/%s/%s/summary", kind, key),
+			wantCode: http.StatusOK,
+			want:     fmt.Sprintf(`{"comment_count":null,%s}`, rated),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.CommentServiceURL = tt.commentURL
+			cfg.AutoCreateResources = !tt.noCreate
+
+			mux := chi.NewRouter()
+			svc := newService(db, zap.NewNop(), cfg)
+			svc.registerRoutes(mux)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+		})
+	}
+}
+
+func Test_service_countComments_unreachable(t *testing.T) {
+	t.Parallel()
+
+	comments := httptest.NewServer(http.NotFoundHandler())
+	url := comments.URL
+	comments.Close()
+
+	cfg := testConfig()
+	cfg.CommentServiceURL = url
+	svc := newService(nil, zap.NewNop(), cfg)
+
+	_, err := svc.countComments(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "posts", "my-key")
+	assert.Error(t, err)
+}